@@ -0,0 +1,80 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// Quote a string for graphviz
+func graphvizQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+// Draw the AS paths of routes to the target from each server in DOT
+// format, for use without a frontend. Paths of best routes are in red.
+func routesToGraphviz(target string, results []queryResult) string {
+	nodes := make(map[string]string)
+	edges := make(map[[2]string]bool)
+	addEdge := func(from string, to string, primary bool) {
+		key := [2]string{from, to}
+		edges[key] = edges[key] || primary
+	}
+
+	targetNode := "Target: " + target
+	nodes[targetNode] = "color=red,shape=diamond"
+	for _, result := range results {
+		nodes[result.Server] = "color=blue,shape=box"
+		for _, route := range parseRoutes(result.Data) {
+			previous := result.Server
+			for _, asn := range strings.Fields(route.ASPath) {
+				node := "AS" + strings.Trim(asn, "{}")
+				if node == previous {
+					// Prepended
+					continue
+				}
+				if _, ok := nodes[node]; !ok {
+					nodes[node] = ""
+				}
+				addEdge(previous, node, route.Primary)
+				previous = node
+			}
+			addEdge(previous, targetNode, route.Primary)
+		}
+	}
+
+	// Sort nodes and edges, so the same routes always give the same output
+	var nodeNames []string
+	for name := range nodes {
+		nodeNames = append(nodeNames, name)
+	}
+	sort.Strings(nodeNames)
+	var edgeKeys [][2]string
+	for key := range edges {
+		edgeKeys = append(edgeKeys, key)
+	}
+	sort.Slice(edgeKeys, func(i, j int) bool {
+		if edgeKeys[i][0] != edgeKeys[j][0] {
+			return edgeKeys[i][0] < edgeKeys[j][0]
+		}
+		return edgeKeys[i][1] < edgeKeys[j][1]
+	})
+
+	result := "digraph {\n"
+	for _, name := range nodeNames {
+		result += "\t" + graphvizQuote(name)
+		if len(nodes[name]) > 0 {
+			result += " [" + nodes[name] + "]"
+		}
+		result += ";\n"
+	}
+	for _, key := range edgeKeys {
+		result += "\t" + graphvizQuote(key[0]) + " -> " + graphvizQuote(key[1])
+		if edges[key] {
+			result += " [color=red]"
+		} else {
+			result += " [fontsize=12,style=dashed]"
+		}
+		result += ";\n"
+	}
+	return result + "}\n"
+}
@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestRoutesToGraphviz(t *testing.T) {
+	results := []queryResult{
+		{"b", outputTestRoutes},
+		{"a", "Network not found\n"},
+	}
+	want := `digraph {
+	"AS4242420001";
+	"AS4242420002";
+	"AS4242420003";
+	"Target: 10.0.0.0/24" [color=red,shape=diamond];
+	"a" [color=blue,shape=box];
+	"b" [color=blue,shape=box];
+	"AS4242420001" -> "AS4242420002" [color=red];
+	"AS4242420002" -> "Target: 10.0.0.0/24" [color=red];
+	"AS4242420003" -> "AS4242420002" [fontsize=12,style=dashed];
+	"b" -> "AS4242420001" [color=red];
+	"b" -> "AS4242420003" [fontsize=12,style=dashed];
+}
+`
+	if got := routesToGraphviz("10.0.0.0/24", results); got != want {
+		t.Errorf("graph:\n%s\nwant:\n%s", got, want)
+	}
+}
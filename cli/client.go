@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type queryResult struct {
+	Server string `json:"server"`
+	Data   string `json:"data"`
+}
+
+type channelData struct {
+	id   int
+	data string
+}
+
+// Request and response of the frontend's JSON API
+type apiRequest struct {
+	Servers []string `json:"servers"`
+	Type    string   `json:"type"`
+	Args    string   `json:"args"`
+}
+
+type apiResponse struct {
+	Error  string        `json:"error"`
+	Result []queryResult `json:"result"`
+}
+
+func httpClient() *http.Client {
+	return &http.Client{Timeout: time.Duration(setting.timeout) * time.Second}
+}
+
+func apiCall(request apiRequest) ([]queryResult, error) {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	response, err := httpClient().Post(strings.TrimSuffix(setting.frontend, "/")+"/api/", "application/json", bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	var result apiResponse
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("HTTP status %s: %s", response.Status, err.Error())
+	}
+	if len(result.Error) > 0 {
+		return nil, fmt.Errorf("%s", result.Error)
+	}
+	return result.Result, nil
+}
+
+// Servers of the frontend, if none are given
+func apiServerList() ([]string, error) {
+	results, err := apiCall(apiRequest{Type: "server_list"})
+	if err != nil {
+		return nil, err
+	}
+	var servers []string
+	for _, result := range results {
+		servers = append(servers, result.Server)
+	}
+	return servers, nil
+}
+
+// Send a command to proxies in parallel, the same way as the frontend's
+// batchRequest does, and return their responses in order
+func proxyRequest(servers []string, endpoint string, command string) []queryResult {
+	ch := make(chan channelData)
+	results := make([]queryResult, len(servers))
+	client := httpClient()
+
+	for i, server := range servers {
+		url := "http://" + server + "." + setting.domain + ":" + strconv.Itoa(setting.proxyPort) + "/" + url.PathEscape(endpoint) + "?q=" + url.QueryEscape(command)
+		go func(url string, i int) {
+			response, err := client.Get(url)
+			if err != nil {
+				ch <- channelData{i, "request failed: " + err.Error() + "\n"}
+				return
+			}
+			text, _ := ioutil.ReadAll(response.Body)
+			response.Body.Close()
+			ch <- channelData{i, string(text)}
+		}(url, i)
+	}
+
+	for range servers {
+		output := <-ch
+		results[output.id] = queryResult{Server: servers[output.id], Data: output.data}
+		if len(output.data) == 0 {
+			results[output.id].Data = "node returned empty response\n"
+		}
+	}
+	return results
+}
+
+// Run a command on the servers, through the frontend if set, or else
+// directly on the proxies. apiType is the request type of the JSON API,
+// and endpoint and command what is sent to the proxies.
+func query(apiType string, args string, endpoint string, command string) ([]queryResult, error) {
+	if len(setting.frontend) > 0 {
+		return apiCall(apiRequest{Servers: setting.servers, Type: apiType, Args: args})
+	}
+	return proxyRequest(setting.servers, endpoint, command), nil
+}
+
+// Query whois through the frontend, which follows referrals and filters
+// results as configured, or directly from the whois server
+func queryWhois(target string) (string, error) {
+	if len(setting.frontend) > 0 {
+		results, err := apiCall(apiRequest{Type: "whois", Args: target})
+		if err != nil || len(results) == 0 {
+			return "", err
+		}
+		return results[0].Data, nil
+	}
+
+	server := setting.whoisServer
+	if !strings.Contains(server, ":") {
+		server += ":43"
+	}
+	conn, err := net.DialTimeout("tcp", server, time.Duration(setting.timeout)*time.Second)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Duration(setting.timeout) * time.Second))
+	if _, err := conn.Write([]byte(strings.NewReplacer("\r", "", "\n", "").Replace(target) + "\r\n")); err != nil {
+		return "", err
+	}
+	result, err := ioutil.ReadAll(conn)
+	return string(result), err
+}
+
+// Get the bgpmap of the target in DOT format from the frontend
+func frontendBGPMap(target string) (string, error) {
+	path := "/route_bgpmap/" + url.PathEscape(strings.Join(setting.servers, "+")) + "/" + url.PathEscape(target) + "?format=dot"
+	response, err := httpClient().Get(strings.TrimSuffix(setting.frontend, "/") + path)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return "", err
+	}
+	if response.StatusCode >= 300 {
+		return "", fmt.Errorf("HTTP status %s", response.Status)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Send requests to all proxies to a stand-in server, with the given
+// settings for the test
+func testProxy(t *testing.T, servers []string, handler http.HandlerFunc) {
+	t.Helper()
+	proxy := httptest.NewServer(handler)
+	transport := http.DefaultTransport
+	http.DefaultTransport = &http.Transport{
+		DialContext: func(ctx context.Context, network string, address string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, proxy.Listener.Addr().String())
+		},
+	}
+	saved := setting
+	setting = settingType{domain: "test", proxyPort: 8000, servers: servers, timeout: 5}
+	t.Cleanup(func() {
+		proxy.Close()
+		http.DefaultTransport = transport
+		setting = saved
+	})
+}
+
+// Use a stand-in frontend for the test, answering API requests with the
+// given function
+func testFrontend(t *testing.T, servers []string, handler func(request apiRequest) apiResponse) {
+	t.Helper()
+	frontend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/api/" {
+			http.NotFound(w, r)
+			return
+		}
+		var request apiRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Error(err)
+		}
+		json.NewEncoder(w).Encode(handler(request))
+	}))
+	saved := setting
+	setting = settingType{frontend: frontend.URL + "/", servers: servers, timeout: 5}
+	t.Cleanup(func() {
+		frontend.Close()
+		setting = saved
+	})
+}
+
+func TestProxyRequest(t *testing.T) {
+	var mutex sync.Mutex
+	var requests []string
+	testProxy(t, []string{"a", "b"}, func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		requests = append(requests, r.Host+" "+r.URL.Path+" "+r.URL.Query().Get("q"))
+		mutex.Unlock()
+		if strings.HasPrefix(r.Host, "b.") {
+			// Empty responses are reported
+			return
+		}
+		w.Write([]byte("output of " + r.URL.Path + "\n"))
+	})
+
+	tests := []struct {
+		endpoint string
+		command  string
+	}{
+		{"bird", "show route for 10.0.0.0/24 all"},
+		{"traceroute", "fd00::1 & rm -rf /"},
+	}
+	for _, test := range tests {
+		requests = nil
+		got := proxyRequest(setting.servers, test.endpoint, test.command)
+		want := []queryResult{
+			{"a", "output of /" + test.endpoint + "\n"},
+			{"b", "node returned empty response\n"},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("results %v, want %v", got, want)
+		}
+		for _, server := range []string{"a", "b"} {
+			request := server + ".test:8000 /" + test.endpoint + " " + test.command
+			found := false
+			for _, r := range requests {
+				found = found || r == request
+			}
+			if !found {
+				t.Errorf("request %q not in %q", request, requests)
+			}
+		}
+	}
+}
+
+func TestProxyRequestFailed(t *testing.T) {
+	testProxy(t, []string{"a"}, func(w http.ResponseWriter, r *http.Request) {})
+	// Restored by testProxy
+	http.DefaultTransport = &http.Transport{
+		DialContext: func(ctx context.Context, network string, address string) (net.Conn, error) {
+			return nil, &net.OpError{Op: "dial", Net: network, Err: net.UnknownNetworkError("unreachable")}
+		},
+	}
+	got := proxyRequest(setting.servers, "bird", "show protocols")
+	if len(got) != 1 || !strings.HasPrefix(got[0].Data, "request failed: ") {
+		t.Errorf("results %v", got)
+	}
+}
+
+func TestQueryFrontend(t *testing.T) {
+	var requests []apiRequest
+	testFrontend(t, []string{"a", "b"}, func(request apiRequest) apiResponse {
+		requests = append(requests, request)
+		switch request.Type {
+		case "server_list":
+			return apiResponse{Result: []queryResult{{Server: "a"}, {Server: "b"}, {Server: "c"}}}
+		case "whois":
+			return apiResponse{Result: []queryResult{{Data: "aut-num: AS4242420001\n"}}}
+		case "traceroute":
+			return apiResponse{Error: "traceroute is disabled"}
+		}
+		return apiResponse{Result: []queryResult{{"a", "output a"}, {"b", "output b"}}}
+	})
+
+	results, err := query("route_all", "10.0.0.0/24", "bird", "show route for 10.0.0.0/24 all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []queryResult{{"a", "output a"}, {"b", "output b"}}; !reflect.DeepEqual(results, want) {
+		t.Errorf("results %v, want %v", results, want)
+	}
+	if want := (apiRequest{Servers: []string{"a", "b"}, Type: "route_all", Args: "10.0.0.0/24"}); !reflect.DeepEqual(requests[0], want) {
+		t.Errorf("request %+v, want %+v", requests[0], want)
+	}
+
+	// API errors are returned as errors
+	if _, err := query("traceroute", "fd00::1", "traceroute", "fd00::1"); err == nil || err.Error() != "traceroute is disabled" {
+		t.Errorf("error %v", err)
+	}
+
+	servers, err := apiServerList()
+	if err != nil || !reflect.DeepEqual(servers, []string{"a", "b", "c"}) {
+		t.Errorf("servers %v, %v", servers, err)
+	}
+
+	result, err := queryWhois("AS4242420001")
+	if err != nil || result != "aut-num: AS4242420001\n" {
+		t.Errorf("whois %q, %v", result, err)
+	}
+	if last := requests[len(requests)-1]; last.Type != "whois" || last.Args != "AS4242420001" {
+		t.Errorf("whois request %+v", last)
+	}
+}
+
+func TestAPICallInvalidResponse(t *testing.T) {
+	frontend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "not found", http.StatusNotFound)
+	}))
+	defer frontend.Close()
+	saved := setting
+	defer func() { setting = saved }()
+	setting = settingType{frontend: frontend.URL, timeout: 5}
+
+	if _, err := apiCall(apiRequest{Type: "summary"}); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("error %v", err)
+	}
+}
+
+func TestFrontendBGPMap(t *testing.T) {
+	var path string
+	frontend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.RequestURI()
+		if strings.Contains(path, "missing") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("digraph {}\n"))
+	}))
+	defer frontend.Close()
+	saved := setting
+	defer func() { setting = saved }()
+	setting = settingType{frontend: frontend.URL, servers: []string{"a", "b"}, timeout: 5}
+
+	graph, err := frontendBGPMap("10.0.0.0/24")
+	if err != nil || graph != "digraph {}\n" {
+		t.Errorf("graph %q, %v", graph, err)
+	}
+	if want := "/route_bgpmap/a+b/10.0.0.0%2F24?format=dot"; path != want {
+		t.Errorf("path %q, want %q", path, want)
+	}
+	if _, err := frontendBGPMap("missing"); err == nil {
+		t.Error("no error for HTTP 404")
+	}
+}
@@ -0,0 +1,3 @@
+module github.com/xddxdd/bird-lg-go/cli
+
+go 1.16
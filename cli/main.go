@@ -0,0 +1,277 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Config file, with server groups that can be queried by name
+type configType struct {
+	Frontend    string              `json:"frontend"`
+	Domain      string              `json:"domain"`
+	ProxyPort   int                 `json:"proxy_port"`
+	Servers     []string            `json:"servers"`
+	Groups      map[string][]string `json:"groups"`
+	WhoisServer string              `json:"whois"`
+	Timeout     int                 `json:"timeout"`
+}
+
+// Settings from the config file, overridden by flags
+type settingType struct {
+	frontend    string
+	domain      string
+	proxyPort   int
+	servers     []string
+	whoisServer string
+	timeout     int
+	output      string
+}
+
+var (
+	config  configType
+	setting settingType
+)
+
+const usage = `Usage: birdlg [flags] <command> [flags] [target]
+
+Commands:
+  summary             protocols of the servers
+  detail <protocol>   details of a protocol
+  route <target>      routes to an IP or prefix
+  trace <target>      traceroute from the servers
+  whois <target>      whois of an ASN, IP or object
+  bgpmap --dot <target>
+                      map of routes to the target in DOT format
+  servers             servers and groups to query
+
+Flags:
+`
+
+// Default config file, $BIRDLG_CONFIG or birdlg/config.json in the user's
+// config directory
+func defaultConfigPath() string {
+	if env := os.Getenv("BIRDLG_CONFIG"); env != "" {
+		return env
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "birdlg", "config.json")
+}
+
+// Load the config file. A missing file is only an error if it was given
+// explicitly.
+func loadConfig(path string, explicit bool) error {
+	config = configType{
+		ProxyPort:   8000,
+		WhoisServer: "whois.verisign-grs.com",
+		Timeout:     30,
+	}
+	if len(path) == 0 {
+		return nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) && !explicit {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("%s: %s", path, err.Error())
+	}
+	return nil
+}
+
+// Expand groups in the config file into their servers
+func expandServers(list []string) []string {
+	var servers []string
+	for _, item := range list {
+		if group, ok := config.Groups[item]; ok {
+			servers = append(servers, group...)
+		} else if item = strings.TrimSpace(item); len(item) > 0 {
+			servers = append(servers, item)
+		}
+	}
+	return servers
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "birdlg: "+err.Error())
+	os.Exit(1)
+}
+
+func main() {
+	configPath, output := defaultConfigPath(), "table"
+	var frontend, domain, servers, whoisServer string
+	var proxyPort, timeout int
+	var dot bool
+	// The same flags are accepted before and after the command, keeping
+	// values given before it
+	addFlags := func(flags *flag.FlagSet) {
+		flags.StringVar(&configPath, "config", configPath, "config file with servers and groups, in JSON")
+		flags.StringVar(&frontend, "frontend", frontend, "URL of the frontend to query through its JSON API, instead of the proxies")
+		flags.StringVar(&domain, "domain", domain, "server name domain suffix of the proxies")
+		flags.IntVar(&proxyPort, "proxy-port", proxyPort, "port bird-lgproxy is running on (default 8000)")
+		flags.StringVar(&servers, "servers", servers, "servers or groups to query, separated by comma (default all servers)")
+		flags.StringVar(&whoisServer, "whois", whoisServer, "whois server to query without a frontend (default whois.verisign-grs.com)")
+		flags.IntVar(&timeout, "timeout", timeout, "maximum time for requests, in seconds (default 30)")
+		flags.StringVar(&output, "output", output, "output format, [table|json|raw]")
+		flags.StringVar(&output, "o", output, "short for --output")
+		flags.BoolVar(&dot, "dot", dot, "output bgpmap in DOT format")
+	}
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	addFlags(flag.CommandLine)
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	command := flag.Arg(0)
+	commandFlags := flag.NewFlagSet(command, flag.ExitOnError)
+	commandFlags.Usage = flag.Usage
+	addFlags(commandFlags)
+	commandFlags.Parse(flag.Args()[1:])
+	target := strings.Join(commandFlags.Args(), " ")
+
+	explicitConfig := false
+	flag.Visit(func(f *flag.Flag) { explicitConfig = explicitConfig || f.Name == "config" })
+	commandFlags.Visit(func(f *flag.Flag) { explicitConfig = explicitConfig || f.Name == "config" })
+	if err := loadConfig(configPath, explicitConfig); err != nil {
+		fail(err)
+	}
+
+	setting = settingType{
+		frontend:    config.Frontend,
+		domain:      config.Domain,
+		proxyPort:   config.ProxyPort,
+		servers:     expandServers(config.Servers),
+		whoisServer: config.WhoisServer,
+		timeout:     config.Timeout,
+		output:      strings.ToLower(output),
+	}
+	for _, override := range []struct {
+		value  string
+		result *string
+	}{
+		{frontend, &setting.frontend},
+		{domain, &setting.domain},
+		{whoisServer, &setting.whoisServer},
+	} {
+		if len(override.value) > 0 {
+			*override.result = override.value
+		}
+	}
+	if proxyPort > 0 {
+		setting.proxyPort = proxyPort
+	}
+	if timeout > 0 {
+		setting.timeout = timeout
+	}
+	if len(servers) > 0 {
+		setting.servers = expandServers(strings.Split(servers, ","))
+	}
+	if setting.output != "table" && setting.output != "json" && setting.output != "raw" {
+		fail(fmt.Errorf("invalid output format: %s", output))
+	}
+
+	if err := run(command, target, dot); err != nil {
+		fail(err)
+	}
+}
+
+func run(command string, target string, dot bool) error {
+	switch command {
+	case "summary", "servers":
+	case "detail", "route", "trace", "whois", "bgpmap":
+		if len(target) == 0 {
+			return fmt.Errorf("%s needs a target", command)
+		}
+	default:
+		return fmt.Errorf("unknown command: %s", command)
+	}
+
+	if command == "whois" {
+		result, err := queryWhois(target)
+		if err != nil {
+			return err
+		}
+		return writeResults(command, []queryResult{{Data: result}})
+	}
+
+	if len(setting.frontend) == 0 && len(setting.domain) == 0 {
+		return fmt.Errorf("set the frontend, or the domain of the proxies, in the config file or with flags")
+	}
+	if len(setting.servers) == 0 && len(setting.frontend) > 0 {
+		servers, err := apiServerList()
+		if err != nil {
+			return err
+		}
+		setting.servers = servers
+	}
+	if command == "servers" {
+		var results []queryResult
+		for _, server := range setting.servers {
+			results = append(results, queryResult{Server: server})
+		}
+		return writeResults(command, results)
+	}
+	if len(setting.servers) == 0 {
+		return fmt.Errorf("no server set")
+	}
+
+	var results []queryResult
+	var err error
+	switch command {
+	case "summary":
+		results, err = query("summary", "", "bird", "show protocols")
+	case "detail":
+		results, err = query("detail", target, "bird", "show protocols all "+target)
+	case "route":
+		results, err = query("route_all", target, "bird", "show route for "+target+" all")
+	case "trace":
+		results, err = query("traceroute", target, "traceroute", target)
+	case "bgpmap":
+		if !dot {
+			return fmt.Errorf("bgpmap is only available in DOT format, add --dot")
+		}
+		var graph string
+		if len(setting.frontend) > 0 {
+			graph, err = frontendBGPMap(target)
+		} else {
+			graph = routesToGraphviz(target, proxyRequest(setting.servers, "bird", "show route for "+target+" all"))
+		}
+		if err == nil {
+			fmt.Print(graph)
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	return writeResults(command, results)
+}
+
+func writeResults(command string, results []queryResult) error {
+	switch setting.output {
+	case "json":
+		return writeJSON(os.Stdout, command, results)
+	case "raw":
+		if command == "servers" {
+			writeServers(os.Stdout, results)
+			return nil
+		}
+		writeRaw(os.Stdout, results)
+	default:
+		writeTable(os.Stdout, command, results)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfig(t *testing.T) {
+	saved := config
+	defer func() { config = saved }()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	data := `{"frontend": "https://lg.example.com", "domain": "example.com", "servers": ["a", "eu"], "groups": {"eu": ["b", "c"]}, "timeout": 10}`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := loadConfig(path, true); err != nil {
+		t.Fatal(err)
+	}
+	want := configType{
+		Frontend:    "https://lg.example.com",
+		Domain:      "example.com",
+		ProxyPort:   8000,
+		Servers:     []string{"a", "eu"},
+		Groups:      map[string][]string{"eu": {"b", "c"}},
+		WhoisServer: "whois.verisign-grs.com",
+		Timeout:     10,
+	}
+	if !reflect.DeepEqual(config, want) {
+		t.Errorf("config %+v, want %+v", config, want)
+	}
+	if servers := expandServers([]string{"eu", " d ", "", "a"}); !reflect.DeepEqual(servers, []string{"b", "c", "d", "a"}) {
+		t.Errorf("servers %v", servers)
+	}
+
+	// The default config file is optional, a given one is not
+	missing := filepath.Join(dir, "missing.json")
+	if err := loadConfig(missing, false); err != nil || config.ProxyPort != 8000 || len(config.Frontend) != 0 {
+		t.Errorf("missing default config: %v, %+v", err, config)
+	}
+	if err := loadConfig(missing, true); err == nil {
+		t.Error("no error for a missing config file")
+	}
+
+	if err := os.WriteFile(path, []byte(`{"servers": "a"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadConfig(path, false); err == nil || !strings.HasPrefix(err.Error(), path+": ") {
+		t.Errorf("error %v for an invalid config file", err)
+	}
+}
+
+func TestRunInvalid(t *testing.T) {
+	saved := setting
+	defer func() { setting = saved }()
+
+	tests := []struct {
+		setting settingType
+		command string
+		target  string
+		err     string
+	}{
+		{settingType{domain: "test"}, "ping", "", "unknown command: ping"},
+		{settingType{domain: "test"}, "route", "", "route needs a target"},
+		{settingType{}, "summary", "", "set the frontend, or the domain of the proxies, in the config file or with flags"},
+		{settingType{domain: "test"}, "summary", "", "no server set"},
+		{settingType{domain: "test", servers: []string{"a"}}, "bgpmap", "10.0.0.0/24", "bgpmap is only available in DOT format, add --dot"},
+	}
+	for _, test := range tests {
+		setting = test.setting
+		if err := run(test.command, test.target, false); err == nil || err.Error() != test.err {
+			t.Errorf("run(%q, %q) = %v, want %q", test.command, test.target, err, test.err)
+		}
+	}
+}
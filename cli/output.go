@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// A row of "show protocols"
+type protocolRow struct {
+	Name  string `json:"name"`
+	Proto string `json:"proto"`
+	Table string `json:"table"`
+	State string `json:"state"`
+	Since string `json:"since"`
+	Info  string `json:"info"`
+}
+
+// A route of "show route ... all"
+type routeRow struct {
+	Network    string `json:"network"`
+	Protocol   string `json:"protocol"`
+	Primary    bool   `json:"primary"`
+	Preference string `json:"preference"`
+	Gateway    string `json:"gateway"`
+	ASPath     string `json:"as_path"`
+}
+
+// A result in JSON output, with parsed rows of commands that have them
+type jsonResult struct {
+	Server    string        `json:"server"`
+	Data      string        `json:"data"`
+	Protocols []protocolRow `json:"protocols,omitempty"`
+	Routes    []routeRow    `json:"routes,omitempty"`
+}
+
+var (
+	protocolRowRegex = regexp.MustCompile(`^(\w+)\s+(\w+)\s+([\w-]+)\s+(\w+)\s+([0-9\-\. :]+)(.*)`)
+	routeRowRegex    = regexp.MustCompile(`^(\S*)\s+\S+\s+\[(\S+)[^\]]*\](\s+\*)?\s+\((\d+)`)
+)
+
+// Parse the output of "show protocols", as the frontend's summary page does
+func parseProtocols(data string) []protocolRow {
+	var rows []protocolRow
+	lines := strings.Split(strings.TrimSpace(data), "\n")
+	if len(lines) <= 1 || !strings.HasPrefix(strings.ToLower(lines[0]), "name") {
+		return nil
+	}
+	for _, line := range lines[1:] {
+		match := protocolRowRegex.FindStringSubmatch(strings.TrimSpace(line))
+		if match == nil {
+			continue
+		}
+		rows = append(rows, protocolRow{
+			Name:  match[1],
+			Proto: match[2],
+			Table: match[3],
+			State: match[4],
+			Since: strings.TrimSpace(match[5]),
+			Info:  strings.TrimSpace(match[6]),
+		})
+	}
+	return rows
+}
+
+// Parse routes of "show route ... all", with their gateway and AS path
+func parseRoutes(data string) []routeRow {
+	var rows []routeRow
+	network := ""
+	for _, line := range strings.Split(data, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if match := routeRowRegex.FindStringSubmatch(line); match != nil {
+			if len(match[1]) > 0 {
+				network = match[1]
+			}
+			rows = append(rows, routeRow{
+				Network:    network,
+				Protocol:   match[2],
+				Primary:    len(match[3]) > 0,
+				Preference: match[4],
+			})
+		} else if len(rows) == 0 {
+			continue
+		} else if route := &rows[len(rows)-1]; strings.HasPrefix(trimmed, "via ") && len(route.Gateway) == 0 {
+			route.Gateway = strings.TrimPrefix(trimmed, "via ")
+		} else if strings.HasPrefix(trimmed, "dev ") && len(route.Gateway) == 0 {
+			route.Gateway = trimmed
+		} else if strings.HasPrefix(trimmed, "BGP.as_path:") {
+			route.ASPath = strings.TrimSpace(strings.TrimPrefix(trimmed, "BGP.as_path:"))
+		}
+	}
+	return rows
+}
+
+// Write the servers to query, and the groups of the config file
+func writeServers(w io.Writer, results []queryResult) {
+	for _, result := range results {
+		fmt.Fprintln(w, result.Server)
+	}
+	var names []string
+	for name := range config.Groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintln(w, name+": "+strings.Join(config.Groups[name], ","))
+	}
+}
+
+// Write results as returned by the servers, each after the server name if
+// there are several
+func writeRaw(w io.Writer, results []queryResult) {
+	for _, result := range results {
+		if len(results) > 1 {
+			fmt.Fprintln(w, result.Server)
+		}
+		fmt.Fprintln(w, strings.TrimSpace(result.Data))
+		if len(results) > 1 {
+			fmt.Fprintln(w)
+		}
+	}
+}
+
+func writeJSON(w io.Writer, command string, results []queryResult) error {
+	var output []jsonResult
+	for _, result := range results {
+		item := jsonResult{Server: result.Server, Data: result.Data}
+		switch command {
+		case "summary":
+			item.Protocols = parseProtocols(result.Data)
+		case "route":
+			item.Routes = parseRoutes(result.Data)
+		}
+		output = append(output, item)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(output)
+}
+
+// Write protocols or routes of all servers as one table. Results that
+// couldn't be parsed, like errors, are written as they are after it.
+func writeTable(w io.Writer, command string, results []queryResult) {
+	if command == "servers" {
+		writeServers(w, results)
+		return
+	}
+	if command != "summary" && command != "route" {
+		writeRaw(w, results)
+		return
+	}
+
+	header := "SERVER\tNAME\tPROTO\tTABLE\tSTATE\tSINCE\tINFO"
+	if command == "route" {
+		header = "SERVER\tNETWORK\tPROTOCOL\tBEST\tPREF\tGATEWAY\tAS PATH"
+	}
+	var lines []string
+	var unparsed []queryResult
+	for _, result := range results {
+		count := len(lines)
+		if command == "summary" {
+			for _, row := range parseProtocols(result.Data) {
+				lines = append(lines, strings.Join([]string{result.Server, row.Name, row.Proto, row.Table, row.State, row.Since, row.Info}, "\t"))
+			}
+		} else {
+			for _, row := range parseRoutes(result.Data) {
+				best := ""
+				if row.Primary {
+					best = "*"
+				}
+				lines = append(lines, strings.Join([]string{result.Server, row.Network, row.Protocol, best, row.Preference, row.Gateway, row.ASPath}, "\t"))
+			}
+		}
+		if len(lines) == count {
+			unparsed = append(unparsed, result)
+		}
+	}
+
+	if len(lines) > 0 {
+		table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(table, header)
+		for _, line := range lines {
+			fmt.Fprintln(table, line)
+		}
+		table.Flush()
+	}
+	for i, result := range unparsed {
+		if len(lines) > 0 || i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%s: %s\n", result.Server, strings.TrimSpace(result.Data))
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+const outputTestProtocols = `Name       Proto      Table      State  Since         Info
+device1    Device     ---        up     2024-01-01 10:00:00
+peer1      BGP        ---        up     2024-01-01    Established
+peer2      BGP        ---        start  2024-01-02    Active        Socket: Connection refused
+`
+
+const outputTestRoutes = `Table master4:
+10.0.0.0/24          unicast [peer1 2024-01-01 from fe80::1] * (100) [AS4242420002i]
+	via fe80::1 on eth0
+	Type: BGP univ
+	BGP.as_path: 4242420001 4242420002
+                     unicast [peer2 2024-01-01] (100) [AS4242420002i]
+	via fe80::2 on eth1
+	Type: BGP univ
+	BGP.as_path: 4242420003 4242420003 4242420002
+`
+
+func TestParseProtocols(t *testing.T) {
+	want := []protocolRow{
+		{"device1", "Device", "---", "up", "2024-01-01 10:00:00", ""},
+		{"peer1", "BGP", "---", "up", "2024-01-01", "Established"},
+		{"peer2", "BGP", "---", "start", "2024-01-02", "Active        Socket: Connection refused"},
+	}
+	if got := parseProtocols(outputTestProtocols); !reflect.DeepEqual(got, want) {
+		t.Errorf("protocols %+v, want %+v", got, want)
+	}
+	if got := parseProtocols("request failed: timeout\n"); got != nil {
+		t.Errorf("protocols %+v in an error", got)
+	}
+}
+
+func TestParseRoutes(t *testing.T) {
+	want := []routeRow{
+		{"10.0.0.0/24", "peer1", true, "100", "fe80::1 on eth0", "4242420001 4242420002"},
+		// Alternative routes of the same network
+		{"10.0.0.0/24", "peer2", false, "100", "fe80::2 on eth1", "4242420003 4242420003 4242420002"},
+	}
+	if got := parseRoutes(outputTestRoutes); !reflect.DeepEqual(got, want) {
+		t.Errorf("routes %+v, want %+v", got, want)
+	}
+}
+
+func TestWriteTable(t *testing.T) {
+	results := []queryResult{
+		{"a", outputTestProtocols},
+		{"b", "request failed: timeout\n"},
+	}
+	var buffer bytes.Buffer
+	writeTable(&buffer, "summary", results)
+	want := "SERVER  NAME     PROTO   TABLE  STATE  SINCE                INFO\n" +
+		// Padding of the empty info column
+		"a       device1  Device  ---    up     2024-01-01 10:00:00  \n" +
+		`a       peer1    BGP     ---    up     2024-01-01           Established
+a       peer2    BGP     ---    start  2024-01-02           Active        Socket: Connection refused
+
+b: request failed: timeout
+`
+	if buffer.String() != want {
+		t.Errorf("summary table:\n%s\nwant:\n%s", buffer.String(), want)
+	}
+
+	buffer.Reset()
+	writeTable(&buffer, "route", []queryResult{{"a", outputTestRoutes}})
+	want = `SERVER  NETWORK      PROTOCOL  BEST  PREF  GATEWAY          AS PATH
+a       10.0.0.0/24  peer1     *     100   fe80::1 on eth0  4242420001 4242420002
+a       10.0.0.0/24  peer2           100   fe80::2 on eth1  4242420003 4242420003 4242420002
+`
+	if buffer.String() != want {
+		t.Errorf("route table:\n%s\nwant:\n%s", buffer.String(), want)
+	}
+
+	// Other commands are written as they are
+	buffer.Reset()
+	writeTable(&buffer, "trace", []queryResult{{"a", "1 hop\n"}, {"b", "2 hop\n"}})
+	if want := "a\n1 hop\n\nb\n2 hop\n\n"; buffer.String() != want {
+		t.Errorf("trace output %q, want %q", buffer.String(), want)
+	}
+}
+
+func TestWriteRaw(t *testing.T) {
+	var buffer bytes.Buffer
+	writeRaw(&buffer, []queryResult{{"a", "\noutput\n\n"}})
+	// Server names are only written for several servers
+	if want := "output\n"; buffer.String() != want {
+		t.Errorf("raw output %q, want %q", buffer.String(), want)
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	results := []queryResult{{"a", outputTestRoutes}, {"b", "Network not found\n"}}
+	var buffer bytes.Buffer
+	if err := writeJSON(&buffer, "route", results); err != nil {
+		t.Fatal(err)
+	}
+	var got []jsonResult
+	if err := json.Unmarshal(buffer.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := []jsonResult{
+		{Server: "a", Data: outputTestRoutes, Routes: parseRoutes(outputTestRoutes)},
+		{Server: "b", Data: "Network not found\n"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("JSON %+v, want %+v", got, want)
+	}
+	if bytes.Contains(buffer.Bytes(), []byte(`"protocols"`)) {
+		t.Errorf("protocols of a route command:\n%s", buffer.String())
+	}
+
+	buffer.Reset()
+	if err := writeJSON(&buffer, "summary", []queryResult{{"a", outputTestProtocols}}); err != nil {
+		t.Fatal(err)
+	}
+	got = nil
+	if err := json.Unmarshal(buffer.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || len(got[0].Protocols) != 3 || got[0].Routes != nil {
+		t.Errorf("summary JSON %+v", got)
+	}
+}
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A protocol state change or best path change to notify about
+type alertMessage struct {
+	// "protocol" or "prefix"
+	Kind          string    `json:"kind"`
+	Time          time.Time `json:"time"`
+	Server        string    `json:"server"`
+	Protocol      string    `json:"protocol"`
+	State         string    `json:"state,omitempty"`
+	PreviousState string    `json:"previous_state,omitempty"`
+	Info          string    `json:"info,omitempty"`
+	Since         string    `json:"since,omitempty"`
+	// Best path changes of watched prefixes
+	Prefix         string   `json:"prefix,omitempty"`
+	Route          string   `json:"route,omitempty"`
+	Path           []string `json:"path,omitempty"`
+	PreviousPath   []string `json:"previous_path,omitempty"`
+	Origin         string   `json:"origin,omitempty"`
+	ExpectedOrigin string   `json:"expected_origin,omitempty"`
+	Changes        []string `json:"changes,omitempty"`
+	Text           string   `json:"text"`
+}
+
+func (message alertMessage) subject() string {
+	if message.Kind == "prefix" {
+		return message.Server + " " + message.Prefix + " " + strings.Join(message.Changes, ", ")
+	}
+	return message.Server + "/" + message.Protocol + " " + message.State
+}
+
+// A period without notifications, for all protocols matching the filter
+type alertMaintenanceWindow struct {
+	filter string
+	// Absolute period
+	start time.Time
+	end   time.Time
+	// Or daily period, in minutes after midnight UTC
+	daily      bool
+	dailyStart int
+	dailyEnd   int
+}
+
+type alertState struct {
+	// Last state notified about, or the initial state
+	notified string
+	// Change waiting for the debounce period, or a maintenance window to end
+	pending *protocolEvent
+	since   time.Time
+}
+
+// Like alertState, for the best path of a watched prefix on a server
+type alertPrefixState struct {
+	notified *prefixEvent
+	pending  *prefixEvent
+	since    time.Time
+}
+
+var (
+	alertMutex              sync.Mutex
+	alertStates             = make(map[[2]string]*alertState)
+	alertPrefixStates       = make(map[[2]string]*alertPrefixState)
+	alertMaintenanceWindows []alertMaintenanceWindow
+)
+
+func alertEnabled() bool {
+	return len(setting.alertWebhooks) > 0 ||
+		(len(setting.telegramToken) > 0 && len(setting.alertTelegramChats) > 0) ||
+		(len(setting.alertSMTPServer) > 0 && len(setting.alertSMTPTo) > 0)
+}
+
+// Match a protocol against a glob pattern. Patterns with a slash match
+// "server/protocol", others match the protocol name only.
+func alertPatternMatch(pattern string, server string, protocol string) bool {
+	name := protocol
+	if strings.Contains(pattern, "/") {
+		name = server + "/" + protocol
+	}
+	matched, _ := path.Match(pattern, name)
+	return matched
+}
+
+// Whether a protocol matches the filters. Patterns starting with "!"
+// exclude protocols matched by earlier patterns.
+func alertFilterMatch(server string, protocol string) bool {
+	var result bool
+	for _, pattern := range setting.alertFilter {
+		if strings.HasPrefix(pattern, "!") {
+			if alertPatternMatch(pattern[1:], server, protocol) {
+				result = false
+			}
+		} else if alertPatternMatch(pattern, server, protocol) {
+			result = true
+		}
+	}
+	return result
+}
+
+func alertParseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Parse a maintenance window, in the form of "[filter@]start/end" with
+// RFC 3339 times, or "[filter@]HH:MM-HH:MM" every day in UTC
+func parseAlertMaintenanceWindow(s string) (alertMaintenanceWindow, error) {
+	window := alertMaintenanceWindow{filter: "*"}
+	if index := strings.LastIndex(s, "@"); index >= 0 {
+		window.filter = s[:index]
+		s = s[index+1:]
+	}
+	if _, err := path.Match(window.filter, ""); err != nil {
+		return window, fmt.Errorf("invalid maintenance window filter: %s", window.filter)
+	}
+
+	if split := strings.SplitN(s, "/", 2); len(split) == 2 {
+		var err error
+		if window.start, err = time.Parse(time.RFC3339, split[0]); err != nil {
+			return window, err
+		}
+		if window.end, err = time.Parse(time.RFC3339, split[1]); err != nil {
+			return window, err
+		}
+		return window, nil
+	}
+
+	if split := strings.SplitN(s, "-", 2); len(split) == 2 {
+		var err error
+		window.daily = true
+		if window.dailyStart, err = alertParseClock(split[0]); err != nil {
+			return window, err
+		}
+		if window.dailyEnd, err = alertParseClock(split[1]); err != nil {
+			return window, err
+		}
+		return window, nil
+	}
+
+	return window, fmt.Errorf("invalid maintenance window: %s", s)
+}
+
+func (window alertMaintenanceWindow) contains(server string, protocol string, t time.Time) bool {
+	if !alertPatternMatch(window.filter, server, protocol) {
+		return false
+	}
+	if !window.daily {
+		return !t.Before(window.start) && t.Before(window.end)
+	}
+	t = t.UTC()
+	minute := t.Hour()*60 + t.Minute()
+	if window.dailyStart <= window.dailyEnd {
+		return minute >= window.dailyStart && minute < window.dailyEnd
+	}
+	// Window across midnight
+	return minute >= window.dailyStart || minute < window.dailyEnd
+}
+
+func alertInMaintenance(server string, protocol string, t time.Time) bool {
+	for _, window := range alertMaintenanceWindows {
+		if window.contains(server, protocol, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Track state changes from the protocol poller, and send notifications
+func alertProtocolEvents(events []protocolEvent, previous map[[2]string]string, now time.Time) {
+	for _, message := range alertProtocolChanges(events, previous, now) {
+		go alertSend(message)
+	}
+}
+
+// Track state changes, and return the ones to notify about. A change is
+// notified once it lasts for the debounce period and no maintenance window
+// applies, so short flaps and planned work don't cause notifications.
+func alertProtocolChanges(events []protocolEvent, previous map[[2]string]string, now time.Time) []alertMessage {
+	var messages []alertMessage
+
+	alertMutex.Lock()
+	for _, event := range events {
+		if !alertFilterMatch(event.Server, event.Protocol) {
+			continue
+		}
+		key := [2]string{event.Server, event.Protocol}
+		state, ok := alertStates[key]
+		if !ok {
+			prev, known := previous[key]
+			if !known {
+				// First time the protocol is seen
+				alertStates[key] = &alertState{notified: event.State}
+				continue
+			}
+			state = &alertState{notified: prev}
+			alertStates[key] = state
+		}
+		if event.State == state.notified {
+			// Back to the notified state before the change was sent
+			state.pending = nil
+			continue
+		}
+		if state.pending == nil {
+			state.since = event.Time
+		}
+		event := event
+		state.pending = &event
+	}
+
+	debounce := time.Duration(setting.alertDebounce) * time.Second
+	for key, state := range alertStates {
+		if state.pending == nil || now.Sub(state.since) < debounce {
+			continue
+		}
+		if alertInMaintenance(key[0], key[1], now) {
+			continue
+		}
+		text := fmt.Sprintf("%s/%s: %s -> %s", key[0], key[1], state.notified, state.pending.State)
+		if len(state.pending.Info) > 0 {
+			text += " (" + state.pending.Info + ")"
+		}
+		messages = append(messages, alertMessage{
+			Kind:          "protocol",
+			Time:          state.pending.Time,
+			Server:        key[0],
+			Protocol:      key[1],
+			State:         state.pending.State,
+			PreviousState: state.notified,
+			Info:          state.pending.Info,
+			Since:         state.pending.Since,
+			Text:          text,
+		})
+		state.notified = state.pending.State
+		state.pending = nil
+	}
+	alertMutex.Unlock()
+	return messages
+}
+
+// Track best path changes from the prefix watcher, and send notifications
+func alertPrefixEvents(events []prefixEvent, previous map[[2]string]prefixEvent, now time.Time) {
+	for _, message := range alertPrefixChanges(events, previous, now) {
+		go alertSend(message)
+	}
+}
+
+// Track best path changes, and return the ones to notify about. Like
+// protocol changes, they are notified once they last for the debounce
+// period, and held back by maintenance windows matching the protocol of
+// the best route.
+func alertPrefixChanges(events []prefixEvent, previous map[[2]string]prefixEvent, now time.Time) []alertMessage {
+	var messages []alertMessage
+
+	alertMutex.Lock()
+	for _, event := range events {
+		entry, ok := prefixWatchFind(event.Prefix)
+		if !ok {
+			continue
+		}
+		key := [2]string{event.Server, event.Prefix}
+		state, ok := alertPrefixStates[key]
+		if !ok {
+			state = &alertPrefixState{}
+			if prev, known := previous[key]; known {
+				state.notified = &prev
+			}
+			alertPrefixStates[key] = state
+		}
+		event := event
+		event.Changes = prefixWatchChanges(entry, state.notified, event)
+		if !event.Notable() {
+			// Same origin and upstream as notified, or the first time the
+			// prefix is seen
+			state.notified = &event
+			state.pending = nil
+			continue
+		}
+		if state.pending == nil {
+			state.since = event.Time
+		}
+		state.pending = &event
+	}
+
+	debounce := time.Duration(setting.alertDebounce) * time.Second
+	for key, state := range alertPrefixStates {
+		if state.pending == nil || now.Sub(state.since) < debounce {
+			continue
+		}
+		protocol := state.pending.Protocol
+		if len(protocol) == 0 && state.notified != nil {
+			protocol = state.notified.Protocol
+		}
+		if alertInMaintenance(key[0], protocol, now) {
+			continue
+		}
+		entry, _ := prefixWatchFind(key[1])
+		messages = append(messages, prefixWatchAlertMessage(entry, state.notified, *state.pending))
+		state.notified = state.pending
+		state.pending = nil
+	}
+	alertMutex.Unlock()
+	return messages
+}
+
+func alertSend(message alertMessage) {
+	for _, url := range setting.alertWebhooks {
+		if err := alertSendWebhook(url, message); err != nil {
+			println("alert webhook " + url + ": " + err.Error())
+		}
+	}
+	if len(setting.telegramToken) > 0 {
+		for _, chat := range setting.alertTelegramChats {
+			if err := alertSendTelegram(chat, message); err != nil {
+				println("alert telegram " + chat + ": " + err.Error())
+			}
+		}
+	}
+	if len(setting.alertSMTPServer) > 0 && len(setting.alertSMTPTo) > 0 {
+		if err := alertSendEmail(message); err != nil {
+			println("alert email: " + err.Error())
+		}
+	}
+}
+
+func alertPostJSON(url string, data interface{}) error {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	response, err := http.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("HTTP status %s", response.Status)
+	}
+	return nil
+}
+
+func alertSendWebhook(url string, message alertMessage) error {
+	return alertPostJSON(url, message)
+}
+
+func alertSendTelegram(chat string, message alertMessage) error {
+	chatID, err := strconv.ParseInt(chat, 10, 64)
+	if err != nil {
+		return err
+	}
+	return telegramAPI("sendMessage", map[string]interface{}{
+		"chat_id": chatID,
+		"text":    setting.titleBrand + ": " + message.Text,
+	})
+}
+
+func alertSendEmail(message alertMessage) error {
+	var auth smtp.Auth
+	if len(setting.alertSMTPUsername) > 0 {
+		host := strings.Split(setting.alertSMTPServer, ":")[0]
+		auth = smtp.PlainAuth("", setting.alertSMTPUsername, setting.alertSMTPPassword, host)
+	}
+
+	body := "From: " + setting.alertSMTPFrom + "\r\n" +
+		"To: " + strings.Join(setting.alertSMTPTo, ", ") + "\r\n" +
+		"Subject: " + setting.titleBrand + ": " + message.subject() + "\r\n" +
+		"Date: " + message.Time.Format(time.RFC1123Z) + "\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" +
+		message.Text + "\r\n"
+	if len(message.Since) > 0 {
+		body += "Since: " + message.Since + "\r\n"
+	}
+	return smtp.SendMail(setting.alertSMTPServer, auth, setting.alertSMTPFrom, setting.alertSMTPTo, []byte(body))
+}
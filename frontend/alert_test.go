@@ -0,0 +1,190 @@
+package main
+
+import (
+	"sort"
+	"testing"
+	"time"
+)
+
+func alertTestSetup(t *testing.T, debounce int, filter []string, windows ...string) {
+	saved := setting
+	savedWindows := alertMaintenanceWindows
+	setting.alertDebounce = debounce
+	setting.alertFilter = filter
+	alertMaintenanceWindows = nil
+	for _, window := range windows {
+		parsed, err := parseAlertMaintenanceWindow(window)
+		if err != nil {
+			t.Fatal(err)
+		}
+		alertMaintenanceWindows = append(alertMaintenanceWindows, parsed)
+	}
+	alertMutex.Lock()
+	alertStates = make(map[[2]string]*alertState)
+	alertMutex.Unlock()
+	t.Cleanup(func() {
+		setting = saved
+		alertMaintenanceWindows = savedWindows
+	})
+}
+
+func alertTestEvent(server string, protocol string, state string, t time.Time) protocolEvent {
+	return protocolEvent{Time: t, Server: server, Protocol: protocol, State: state}
+}
+
+func alertTestTexts(messages []alertMessage) []string {
+	var result []string
+	for _, message := range messages {
+		result = append(result, message.Text)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func TestAlertFilterMatch(t *testing.T) {
+	alertTestSetup(t, 0, []string{"*", "!kernel*", "!device*", "hostdare/kernel1"})
+	tests := []struct {
+		server   string
+		protocol string
+		want     bool
+	}{
+		{"a", "bgp1", true},
+		{"a", "kernel1", false},
+		{"a", "device1", false},
+		{"hostdare", "kernel1", true},
+		{"hostdare", "kernel2", false},
+	}
+	for _, test := range tests {
+		if got := alertFilterMatch(test.server, test.protocol); got != test.want {
+			t.Errorf("alertFilterMatch(%s, %s) = %v, want %v", test.server, test.protocol, got, test.want)
+		}
+	}
+
+	setting.alertFilter = nil
+	if alertFilterMatch("a", "bgp1") {
+		t.Error("empty filter matched")
+	}
+}
+
+func TestParseAlertMaintenanceWindow(t *testing.T) {
+	at := func(s string) time.Time {
+		parsed, _ := time.Parse(time.RFC3339, s)
+		return parsed
+	}
+	tests := []struct {
+		window   string
+		server   string
+		protocol string
+		time     string
+		want     bool
+	}{
+		{"hostdare/*@2024-05-01T02:00:00Z/2024-05-01T04:00:00Z", "hostdare", "bgp1", "2024-05-01T02:00:00Z", true},
+		{"hostdare/*@2024-05-01T02:00:00Z/2024-05-01T04:00:00Z", "hostdare", "bgp1", "2024-05-01T04:00:00Z", false},
+		{"hostdare/*@2024-05-01T02:00:00Z/2024-05-01T04:00:00Z", "other", "bgp1", "2024-05-01T03:00:00Z", false},
+		{"2024-05-01T04:00:00+02:00/2024-05-01T05:00:00+02:00", "a", "bgp1", "2024-05-01T02:30:00Z", true},
+		{"03:00-03:30", "a", "bgp1", "2024-05-01T03:29:59Z", true},
+		{"03:00-03:30", "a", "bgp1", "2024-05-01T03:30:00Z", false},
+		// Daily windows are in UTC
+		{"03:00-03:30", "a", "bgp1", "2024-05-01T05:15:00+02:00", true},
+		// Across midnight
+		{"bgp*@23:00-01:00", "a", "bgp1", "2024-05-01T00:30:00Z", true},
+		{"bgp*@23:00-01:00", "a", "bgp1", "2024-05-01T23:30:00Z", true},
+		{"bgp*@23:00-01:00", "a", "bgp1", "2024-05-01T12:00:00Z", false},
+		{"bgp*@23:00-01:00", "a", "ospf1", "2024-05-01T00:30:00Z", false},
+	}
+	for _, test := range tests {
+		window, err := parseAlertMaintenanceWindow(test.window)
+		if err != nil {
+			t.Errorf("parseAlertMaintenanceWindow(%q): %v", test.window, err)
+			continue
+		}
+		if got := window.contains(test.server, test.protocol, at(test.time)); got != test.want {
+			t.Errorf("%q contains %s/%s at %s = %v, want %v", test.window, test.server, test.protocol, test.time, got, test.want)
+		}
+	}
+
+	for _, invalid := range []string{"", "tomorrow", "03:00", "25:00-26:00", "2024-05-01/2024-05-02", "[@03:00-04:00"} {
+		if _, err := parseAlertMaintenanceWindow(invalid); err == nil {
+			t.Errorf("parseAlertMaintenanceWindow(%q) accepted", invalid)
+		}
+	}
+}
+
+func TestAlertProtocolChangesDebounce(t *testing.T) {
+	alertTestSetup(t, 60, []string{"*"})
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	at := func(seconds int) time.Time {
+		return start.Add(time.Duration(seconds) * time.Second)
+	}
+	steps := []struct {
+		events   []protocolEvent
+		previous map[[2]string]string
+		now      int
+		want     []string
+	}{
+		// First seen, not a change
+		{[]protocolEvent{alertTestEvent("a", "bgp1", "up", at(0)), alertTestEvent("a", "bgp2", "up", at(0))}, nil, 0, nil},
+		// Down, waiting for the debounce period
+		{[]protocolEvent{alertTestEvent("a", "bgp1", "start", at(10)), alertTestEvent("a", "bgp2", "start", at(10))}, map[[2]string]string{{"a", "bgp1"}: "up", {"a", "bgp2"}: "up"}, 10, nil},
+		// bgp2 is back before the debounce period ends
+		{[]protocolEvent{alertTestEvent("a", "bgp2", "up", at(40))}, map[[2]string]string{{"a", "bgp2"}: "start"}, 40, nil},
+		{nil, nil, 69, nil},
+		{nil, nil, 70, []string{"a/bgp1: up -> start"}},
+		// Sent only once
+		{nil, nil, 200, nil},
+		{[]protocolEvent{alertTestEvent("a", "bgp1", "up", at(300))}, map[[2]string]string{{"a", "bgp1"}: "start"}, 300, nil},
+		{nil, nil, 360, []string{"a/bgp1: start -> up"}},
+	}
+	for i, step := range steps {
+		got := alertTestTexts(alertProtocolChanges(step.events, step.previous, at(step.now)))
+		if len(got) != len(step.want) || (len(got) > 0 && got[0] != step.want[0]) {
+			t.Errorf("step %d: %q, want %q", i, got, step.want)
+		}
+	}
+}
+
+func TestAlertProtocolChangesFirstChange(t *testing.T) {
+	alertTestSetup(t, 0, []string{"*", "!kernel*"})
+	now := time.Now()
+	// The poller knew the previous state before alerts saw the protocol
+	events := []protocolEvent{
+		alertTestEvent("a", "bgp1", "start", now),
+		alertTestEvent("a", "kernel1", "down", now),
+	}
+	previous := map[[2]string]string{{"a", "bgp1"}: "up", {"a", "kernel1"}: "up"}
+	got := alertTestTexts(alertProtocolChanges(events, previous, now))
+	if len(got) != 1 || got[0] != "a/bgp1: up -> start" {
+		t.Errorf("messages = %q", got)
+	}
+}
+
+func TestAlertProtocolChangesMaintenance(t *testing.T) {
+	start := time.Date(2024, 5, 1, 2, 0, 0, 0, time.UTC)
+	alertTestSetup(t, 0, []string{"*"}, "hostdare/*@2024-05-01T02:00:00Z/2024-05-01T04:00:00Z")
+	at := func(minutes int) time.Time {
+		return start.Add(time.Duration(minutes) * time.Minute)
+	}
+
+	alertProtocolChanges([]protocolEvent{
+		alertTestEvent("hostdare", "bgp1", "up", at(-10)),
+		alertTestEvent("hostdare", "bgp2", "up", at(-10)),
+		alertTestEvent("other", "bgp1", "up", at(-10)),
+	}, nil, at(-10))
+
+	// Held back during the window, except for other servers
+	got := alertTestTexts(alertProtocolChanges([]protocolEvent{
+		alertTestEvent("hostdare", "bgp1", "start", at(10)),
+		alertTestEvent("hostdare", "bgp2", "start", at(10)),
+		alertTestEvent("other", "bgp1", "start", at(10)),
+	}, nil, at(10)))
+	if len(got) != 1 || got[0] != "other/bgp1: up -> start" {
+		t.Errorf("during maintenance: %q", got)
+	}
+
+	// bgp2 recovered during the window, so only bgp1 is sent after it
+	alertProtocolChanges([]protocolEvent{alertTestEvent("hostdare", "bgp2", "up", at(60))}, nil, at(60))
+	got = alertTestTexts(alertProtocolChanges(nil, nil, at(120)))
+	if len(got) != 1 || got[0] != "hostdare/bgp1: up -> start" {
+		t.Errorf("after maintenance: %q", got)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type apiRequest struct {
+	Servers []string `json:"servers"`
+	Type    string   `json:"type"`
+	Args    string   `json:"args"`
+}
+
+type apiResult struct {
+	Server      string                `json:"server"`
+	Data        string                `json:"data"`
+	Communities []communityAnnotation `json:"communities,omitempty"`
+	// Unique prefixes of route searches
+	Prefixes []routeSearchPrefix `json:"prefixes,omitempty"`
+	// Routing table statistics, oldest first
+	Stats []statsSnapshot `json:"stats,omitempty"`
+}
+
+type apiResponse struct {
+	Error  string      `json:"error"`
+	Result []apiResult `json:"result"`
+}
+
+func apiServerList(request apiRequest) apiResponse {
+	var response apiResponse
+	for _, server := range setting.servers {
+		response.Result = append(response.Result, apiResult{Server: server})
+	}
+	return response
+}
+
+func apiWhois(request apiRequest) apiResponse {
+	result, err := whois(request.Args)
+	if err != nil {
+		return apiResponse{Error: err.Error()}
+	}
+	return apiResponse{
+		Result: []apiResult{{Data: result}},
+	}
+}
+
+// Latest routing table statistics of servers, or all of them in a period
+// given as args, like "24h"
+func apiStats(request apiRequest) apiResponse {
+	if !statsEnabled() {
+		return apiResponse{Error: "routing table statistics are not enabled"}
+	}
+	var since time.Time
+	if len(request.Args) > 0 {
+		period, ok := statsParsePeriod(request.Args)
+		if !ok {
+			return apiResponse{Error: "invalid period: " + request.Args}
+		}
+		since = time.Now().Add(-period)
+	}
+
+	var response apiResponse
+	for _, server := range request.Servers {
+		result := apiResult{Server: server}
+		if isValidServer(server) {
+			result.Stats = statsGet(server, since)
+			if len(request.Args) == 0 && len(result.Stats) > 0 {
+				result.Stats = result.Stats[len(result.Stats)-1:]
+			}
+		}
+		response.Result = append(response.Result, result)
+	}
+	return response
+}
+
+func apiBackendCommand(request apiRequest) apiResponse {
+	backendCommandPrimitive, commandPresent := backendCommandPrimitives[request.Type]
+	_, isRouteSearch := routeSearchFilters[request.Type]
+	if !commandPresent && !isRouteSearch {
+		return apiResponse{Error: "invalid request type: " + request.Type}
+	}
+
+	backendCommand := backendCommandPrimitive
+	if isRouteSearch {
+		search, err := parseRouteSearch(request.Args)
+		if err != nil {
+			return apiResponse{Error: err.Error()}
+		}
+		backendCommand = routeSearchCommand(request.Type, search)
+	} else if strings.Contains(backendCommandPrimitive, "%") {
+		backendCommand = fmt.Sprintf(backendCommandPrimitive, request.Args)
+	}
+	backendCommand = strings.TrimSpace(backendCommand)
+
+	endpoint := "bird"
+	if request.Type == "traceroute" {
+		endpoint = "traceroute"
+	}
+
+	var response apiResponse
+	for i, data := range batchRequest(request.Servers, endpoint, backendCommand, "en") {
+		result := apiResult{
+			Server: request.Servers[i],
+			Data:   data,
+		}
+		if endpoint == "bird" {
+			result.Communities = communityExtract(data)
+		}
+		if isRouteSearch {
+			result.Prefixes = routeSearchPrefixes(data)
+		}
+		response.Result = append(response.Result, result)
+	}
+	return response
+}
+
+func webHandlerAPI(w http.ResponseWriter, r *http.Request) {
+	var request apiRequest
+	var response apiResponse
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		response = apiResponse{Error: err.Error()}
+	} else {
+		switch request.Type {
+		case "server_list":
+			response = apiServerList(request)
+		case "whois":
+			response = apiWhois(request)
+		case "stats":
+			response = apiStats(request)
+		default:
+			response = apiBackendCommand(request)
+		}
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"container/list"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	asnCacheSize       = 4096
+	asnCacheTTL        = time.Hour
+	asnPrefetchWorkers = 16
+)
+
+type asnCacheEntry struct {
+	asn     string
+	info    []string
+	expires time.Time
+	// Closed when the lookup has finished
+	ready chan struct{}
+}
+
+var (
+	asnCacheMutex   sync.Mutex
+	asnCacheEntries = make(map[string]*list.Element)
+	asnCacheOrder   = list.New()
+
+	// Lookups started by asnPrefetchBackground, shared by all requests
+	asnBackgroundWorkers = make(chan struct{}, asnPrefetchWorkers)
+)
+
+// Sources of ASN information, each returns lines describing the AS, or nil
+var asnSources = map[string]func(asn string) []string{
+	"dns":      asnSourceDNS,
+	"whois":    asnSourceWhois,
+	"registry": asnSourceRegistry,
+}
+
+func asnSourceDNS(asn string) []string {
+	records, err := net.LookupTXT(fmt.Sprintf("AS%s.%s", asn, setting.dnsInterface))
+	if err != nil {
+		return nil
+	}
+
+	result := strings.Join(records, " ")
+	if resultSplit := strings.Split(result, " | "); len(resultSplit) > 1 {
+		return resultSplit[1:]
+	}
+	return []string{result}
+}
+
+func asnSourceWhois(asn string) []string {
+	result, err := whois("AS" + asn)
+	if err != nil {
+		return nil
+	}
+	for _, object := range rpslParse(result) {
+		for _, key := range []string{"as-name", "asname"} {
+			if name := object.GetFirst(key); len(name) > 0 {
+				return []string{name}
+			}
+		}
+	}
+	return nil
+}
+
+func asnSourceRegistry(asn string) []string {
+	if !registryEnabled() {
+		return nil
+	}
+	return registryASNRepresentation(asn)
+}
+
+// Ask each configured source in order, until one of them knows the AS
+func asnResolve(asn string) []string {
+	for _, name := range setting.asnSources {
+		source, ok := asnSources[name]
+		if !ok {
+			continue
+		}
+		if result := source(asn); len(result) > 0 {
+			return result
+		}
+	}
+	return nil
+}
+
+// Get information of an AS, from cache if possible. Concurrent lookups
+// of the same AS wait for the same request.
+func asnLookup(asn string) []string {
+	asnCacheMutex.Lock()
+	if element, ok := asnCacheEntries[asn]; ok {
+		entry := element.Value.(*asnCacheEntry)
+		select {
+		case <-entry.ready:
+			if time.Now().Before(entry.expires) {
+				asnCacheOrder.MoveToFront(element)
+				asnCacheMutex.Unlock()
+				return entry.info
+			}
+			asnCacheOrder.Remove(element)
+			delete(asnCacheEntries, asn)
+		default:
+			// Lookup in progress
+			asnCacheMutex.Unlock()
+			<-entry.ready
+			return entry.info
+		}
+	}
+
+	entry := &asnCacheEntry{asn: asn, ready: make(chan struct{})}
+	asnCacheEntries[asn] = asnCacheOrder.PushFront(entry)
+	for asnCacheOrder.Len() > asnCacheSize {
+		oldest := asnCacheOrder.Back()
+		asnCacheOrder.Remove(oldest)
+		delete(asnCacheEntries, oldest.Value.(*asnCacheEntry).asn)
+	}
+	asnCacheMutex.Unlock()
+
+	info := asnResolve(asn)
+
+	asnCacheMutex.Lock()
+	entry.info = info
+	entry.expires = time.Now().Add(asnCacheTTL)
+	asnCacheMutex.Unlock()
+	close(entry.ready)
+	return info
+}
+
+// Get information of an AS only if it's already in cache
+func asnLookupCached(asn string) []string {
+	asnCacheMutex.Lock()
+	defer asnCacheMutex.Unlock()
+	element, ok := asnCacheEntries[asn]
+	if !ok {
+		return nil
+	}
+	entry := element.Value.(*asnCacheEntry)
+	select {
+	case <-entry.ready:
+		if time.Now().Before(entry.expires) {
+			return entry.info
+		}
+	default:
+	}
+	return nil
+}
+
+// Look up all given ASNs in parallel, so later lookups hit the cache
+func asnPrefetch(asns []string) {
+	var wg sync.WaitGroup
+	workers := make(chan struct{}, asnPrefetchWorkers)
+	for _, asn := range asns {
+		wg.Add(1)
+		go func(asn string) {
+			workers <- struct{}{}
+			asnLookup(asn)
+			<-workers
+			wg.Done()
+		}(asn)
+	}
+	wg.Wait()
+}
+
+// Look up ASNs not in cache without waiting for them, for pages that only
+// show cached names. Lookups that don't fit in the shared workers are
+// skipped, and done on a later view.
+func asnPrefetchBackground(asns []string) {
+	for _, asn := range asns {
+		asnCacheMutex.Lock()
+		_, cached := asnCacheEntries[asn]
+		asnCacheMutex.Unlock()
+		if cached {
+			continue
+		}
+		select {
+		case asnBackgroundWorkers <- struct{}{}:
+			go func(asn string) {
+				asnLookup(asn)
+				<-asnBackgroundWorkers
+			}(asn)
+		default:
+			return
+		}
+	}
+}
+
+var (
+	asnLineRegex   = regexp.MustCompile(`(?m)^\s*(BGP\.as_path|Neighbor AS|Local AS):(.*)$`)
+	asnNumberRegex = regexp.MustCompile(`\d+`)
+	asnOriginRegex = regexp.MustCompile(`\[AS(\d+)`)
+)
+
+// Find all unique ASNs in BIRD responses
+func asnExtract(responses []string) []string {
+	var result []string
+	seen := make(map[string]bool)
+	add := func(asn string) {
+		if !seen[asn] {
+			seen[asn] = true
+			result = append(result, asn)
+		}
+	}
+	for _, response := range responses {
+		for _, match := range asnLineRegex.FindAllStringSubmatch(response, -1) {
+			for _, asn := range asnNumberRegex.FindAllString(match[2], -1) {
+				add(asn)
+			}
+		}
+		for _, match := range asnOriginRegex.FindAllStringSubmatch(response, -1) {
+			add(match[1])
+		}
+	}
+	return result
+}
+
+// Name of an AS in a single line, or empty string if unknown
+func asnName(info []string) string {
+	return strings.TrimSpace(strings.Join(info, " | "))
+}
+
+// Find the origin AS of an IP address, from the registry if possible, or
+// from the origin zones under the DNS interface (as provided by Team Cymru)
+func ipToASN(ip string) string {
+	if registryEnabled() {
+		for _, object := range registryQuery(ip) {
+			if origin := object.GetFirst("origin"); len(origin) > 0 {
+				return strings.TrimPrefix(strings.ToUpper(origin), "AS")
+			}
+		}
+	}
+
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+	var name string
+	if ipv4 := parsed.To4(); ipv4 != nil {
+		name = fmt.Sprintf("%d.%d.%d.%d.origin.%s", ipv4[3], ipv4[2], ipv4[1], ipv4[0], setting.dnsInterface)
+	} else {
+		const hexDigits = "0123456789abcdef"
+		for i := len(parsed) - 1; i >= 0; i-- {
+			name += string(hexDigits[parsed[i]&0xf]) + "." + string(hexDigits[parsed[i]>>4]) + "."
+		}
+		name += "origin6." + setting.dnsInterface
+	}
+
+	records, err := net.LookupTXT(name)
+	if err != nil || len(records) == 0 {
+		return ""
+	}
+	// Format: "13335 | 1.1.1.0/24 | US | arin | 2010-07-14"
+	fields := strings.Fields(strings.Split(records[0], "|")[0])
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"container/list"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestASNExtract(t *testing.T) {
+	responses := []string{
+		"172.20.0.0/24 unicast [bgp1 2024-01-01] * (100) [AS4242420003i]\n" +
+			"\tBGP.as_path: 4242420002 4242420002 4242420003\n",
+		"  Neighbor AS:      4242420005\n  Local AS:         4242420001\n" +
+			"fd00::/48 unicast [bgp2 2024-01-01] (100) [AS4242420003i]\n",
+	}
+	want := []string{"4242420002", "4242420003", "4242420005", "4242420001"}
+	if got := asnExtract(responses); !reflect.DeepEqual(got, want) {
+		t.Errorf("asnExtract() = %v, want %v", got, want)
+	}
+}
+
+// Replace the ASN sources by a slow one, returning the number of lookups
+// started, and a function to let them finish
+func asnTestSlowSource(t *testing.T) (*int32, func()) {
+	asnCacheMutex.Lock()
+	asnCacheEntries = make(map[string]*list.Element)
+	asnCacheOrder = list.New()
+	asnCacheMutex.Unlock()
+
+	var started int32
+	release := make(chan struct{})
+	asnSources["test"] = func(asn string) []string {
+		atomic.AddInt32(&started, 1)
+		<-release
+		return []string{"AS" + asn}
+	}
+	sources := setting.asnSources
+	setting.asnSources = []string{"test"}
+	t.Cleanup(func() {
+		delete(asnSources, "test")
+		setting.asnSources = sources
+	})
+	return &started, func() { close(release) }
+}
+
+func TestASNLookupCachesAndShares(t *testing.T) {
+	started, release := asnTestSlowSource(t)
+	results := make(chan []string, 3)
+	for i := 0; i < 3; i++ {
+		go func() { results <- asnLookup("64500") }()
+	}
+	time.Sleep(50 * time.Millisecond)
+	if asnLookupCached("64500") != nil {
+		t.Error("lookup in progress returned from cache")
+	}
+	release()
+	for i := 0; i < 3; i++ {
+		if got := <-results; !reflect.DeepEqual(got, []string{"AS64500"}) {
+			t.Errorf("asnLookup() = %v", got)
+		}
+	}
+	if atomic.LoadInt32(started) != 1 {
+		t.Errorf("source called %d times, want 1", atomic.LoadInt32(started))
+	}
+	if got := asnLookupCached("64500"); !reflect.DeepEqual(got, []string{"AS64500"}) {
+		t.Errorf("asnLookupCached() = %v", got)
+	}
+}
+
+func TestASNPrefetchBackground(t *testing.T) {
+	started, release := asnTestSlowSource(t)
+	var asns []string
+	for i := 0; i < 100; i++ {
+		asns = append(asns, fmt.Sprint(64600+i))
+	}
+
+	done := make(chan struct{})
+	go func() {
+		asnPrefetchBackground(asns)
+		asnPrefetchBackground(asns)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("asnPrefetchBackground blocked on lookups")
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt32(started); n != asnPrefetchWorkers {
+		t.Errorf("%d lookups started, want %d", n, asnPrefetchWorkers)
+	}
+	release()
+}
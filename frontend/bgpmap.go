@@ -1,98 +1,269 @@
 package main
 
 import (
-	"fmt"
-	"net"
+	"sort"
 	"strings"
 )
 
-func getASNRepresentation(asn string) string {
-	records, err := net.LookupTXT(fmt.Sprintf("AS%s.%s", asn, setting.dnsInterface))
-	if err != nil {
-		// DNS query failed, only use ASN as output
-		return fmt.Sprintf("AS%s", asn)
+type bgpmapNode struct {
+	ID string `json:"id"`
+	// One of "server", "nexthop", "as", "hop" and "target"
+	Type  string `json:"type"`
+	Label string `json:"label"`
+	ASN   string `json:"asn,omitempty"`
+	Name  string `json:"name,omitempty"`
+	// Page to open when the node is clicked
+	URL string `json:"url,omitempty"`
+	// Traceroute hops only
+	IP       string   `json:"ip,omitempty"`
+	Hostname string   `json:"hostname,omitempty"`
+	RTTs     []string `json:"rtts,omitempty"`
+	Servers  []string `json:"servers,omitempty"`
+}
+
+type bgpmapEdge struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	// Whether any route using this edge is preferred
+	Preferred bool     `json:"preferred"`
+	Servers   []string `json:"servers"`
+	// Prefixes with routes using this edge, and those with preferred routes
+	Prefixes          []string `json:"prefixes"`
+	PreferredPrefixes []string `json:"preferred_prefixes,omitempty"`
+	Nexthops          []string `json:"nexthops,omitempty"`
+	// Set if no route to the target is found on the server
+	Unknown     bool     `json:"unknown,omitempty"`
+	LocalPrefs  []string `json:"local_prefs,omitempty"`
+	MEDs        []string `json:"meds,omitempty"`
+	Communities []string `json:"communities,omitempty"`
+	// Maximum times the destination AS appears in a row on AS paths
+	Prepends int `json:"prepends,omitempty"`
+	// Traceroute hops not responding between the nodes
+	HiddenHops int    `json:"hidden_hops,omitempty"`
+	ROAStatus  string `json:"roa_status,omitempty"`
+	ROA        string `json:"roa,omitempty"`
+}
+
+type bgpmapGraph struct {
+	Targets []string      `json:"targets"`
+	Nodes   []*bgpmapNode `json:"nodes"`
+	Edges   []*bgpmapEdge `json:"edges"`
+
+	nodeIndex map[string]*bgpmapNode
+	edgeIndex map[[2]string]*bgpmapEdge
+}
+
+func newBGPMapGraph() *bgpmapGraph {
+	return &bgpmapGraph{
+		nodeIndex: make(map[string]*bgpmapNode),
+		edgeIndex: make(map[[2]string]*bgpmapEdge),
+	}
+}
+
+// Get a node, creating it if not present
+func (g *bgpmapGraph) addNode(id string, nodeType string, label string) *bgpmapNode {
+	if node, ok := g.nodeIndex[id]; ok {
+		return node
 	}
+	node := &bgpmapNode{ID: id, Type: nodeType, Label: label}
+	g.nodeIndex[id] = node
+	g.Nodes = append(g.Nodes, node)
+	return node
+}
 
-	result := strings.Join(records, " ")
-	if resultSplit := strings.Split(result, " | "); len(resultSplit) > 1 {
-		result = strings.Join(resultSplit[1:], "\\n")
+// Get a node for an AS, with its name as label
+func (g *bgpmapGraph) addASNode(asn string) *bgpmapNode {
+	id := "AS" + asn
+	if node, ok := g.nodeIndex[id]; ok {
+		return node
 	}
-	return fmt.Sprintf("AS%s\\n%s", asn, result)
+	info := asnLookup(asn)
+	node := g.addNode(id, "as", strings.Join(append([]string{id}, info...), "\n"))
+	node.ASN = asn
+	node.Name = asnName(info)
+	node.URL = "/whois/" + id
+	return node
 }
 
-func birdRouteToGraphviz(servers []string, responses []string, target string) string {
-	graph := make(map[string]string)
-	// Helper to add an edge
-	addEdge := func(src string, dest string, attr string) {
-		key := "\"" + src + "\" -> \"" + dest + "\""
-		_, present := graph[key]
-		// Do not remove edge's attributes if it's already present
-		if present && len(attr) == 0 {
-			return
+// Get an edge, creating it if not present, and record the server and
+// prefix using it
+func (g *bgpmapGraph) addEdge(source string, dest string, server string, prefix string, preferred bool) *bgpmapEdge {
+	key := [2]string{source, dest}
+	edge, ok := g.edgeIndex[key]
+	if !ok {
+		edge = &bgpmapEdge{Source: source, Target: dest}
+		g.edgeIndex[key] = edge
+		g.Edges = append(g.Edges, edge)
+	}
+	edge.Servers = appendUnique(edge.Servers, server)
+	edge.Prefixes = appendUnique(edge.Prefixes, prefix)
+	if preferred {
+		edge.Preferred = true
+		edge.PreferredPrefixes = appendUnique(edge.PreferredPrefixes, prefix)
+	}
+	return edge
+}
+
+// Sort nodes and edges, so output is the same for the same routes
+func (g *bgpmapGraph) sort() {
+	sort.SliceStable(g.Nodes, func(i, j int) bool {
+		return g.Nodes[i].ID < g.Nodes[j].ID
+	})
+	sort.SliceStable(g.Edges, func(i, j int) bool {
+		if g.Edges[i].Source != g.Edges[j].Source {
+			return g.Edges[i].Source < g.Edges[j].Source
 		}
-		graph[key] = attr
+		return g.Edges[i].Target < g.Edges[j].Target
+	})
+	for _, node := range g.Nodes {
+		sort.Strings(node.RTTs)
+		sort.Strings(node.Servers)
 	}
-	// Helper to set attribute for a point in graph
-	addPoint := func(name string, attr string) {
-		key := "\"" + name + "\""
-		_, present := graph[key]
-		// Do not remove point's attributes if it's already present
-		if present && len(attr) == 0 {
-			return
+	for _, edge := range g.Edges {
+		sort.Strings(edge.Servers)
+		sort.Strings(edge.Prefixes)
+		sort.Strings(edge.PreferredPrefixes)
+		sort.Strings(edge.Nexthops)
+		sort.Strings(edge.LocalPrefs)
+		sort.Strings(edge.MEDs)
+		sort.Strings(edge.Communities)
+	}
+}
+
+func appendUnique(list []string, item string) []string {
+	for _, existing := range list {
+		if existing == item {
+			return list
+		}
+	}
+	return append(list, item)
+}
+
+// Remove parentheses around confederation segments, and collapse
+// prepended ASNs, returning the times each AS appears in a row
+func bgpmapParseASPath(asPath string) ([]string, []int) {
+	var asns []string
+	var counts []int
+	for _, asn := range strings.Fields(asPath) {
+		asn = strings.TrimPrefix(asn, "(")
+		asn = strings.TrimSuffix(asn, ")")
+		if len(asns) > 0 && asns[len(asns)-1] == asn {
+			counts[len(counts)-1]++
+			continue
 		}
-		graph[key] = attr
+		asns = append(asns, asn)
+		counts = append(counts, 1)
 	}
+	return asns, counts
+}
+
+// Draw routes to each target, responses are indexed by target then by
+// server. Target nodes link to the given option of the web interface.
+func birdRouteToGraph(servers []string, responses [][]string, targets []string, targetOption string) *bgpmapGraph {
+	graph := newBGPMapGraph()
+	graph.Targets = targets
+
+	// Resolve all ASNs in parallel before drawing
+	var allResponses []string
+	for _, targetResponses := range responses {
+		allResponses = append(allResponses, targetResponses...)
+	}
+	asnPrefetch(asnExtract(allResponses))
+
+	for targetIndex, target := range targets {
+		graph.addBirdRoutes(servers, responses[targetIndex], target, targetOption)
+	}
+	graph.sort()
+	return graph
+}
 
-	addPoint("Target: "+target, "[color=red,shape=diamond]")
+// Add routes to a target from each server to the graph
+func (g *bgpmapGraph) addBirdRoutes(servers []string, responses []string, target string, targetOption string) {
+	targetID := "Target: " + target
+	g.addNode(targetID, "target", targetID).URL = "/" + targetOption + "/" + strings.Join(servers, "+") + "/" + target
 	for serverID, server := range servers {
 		response := responses[serverID]
 		if len(response) == 0 {
 			continue
 		}
-		addPoint(server, "[color=blue,shape=box]")
+		g.addNode(server, "server", server).URL = "/summary/" + server + "/"
 		// This is the best split point I can find for bird2
 		routes := strings.Split(response, "\tvia ")
 		routeFound := false
+		routePrefix := ""
 		for routeIndex, route := range routes {
 			var routeNexthop string
 			var routeASPath string
+			var routeLocalPref string
+			var routeMED string
+			var routeCommunities []string
 			var routePreferred bool = routeIndex > 0 && strings.Contains(routes[routeIndex-1], "*")
 			// Have to look at previous slice to determine if route is preferred, due to bad split point selection
+			// and for the same reason, prefix of this route is the last one seen in previous slices
+			var routeEntryPrefix string = routePrefix
 
 			for _, routeParameter := range strings.Split(route, "\n") {
+				routePrefix = roaPrefixFromLine(routeParameter, routePrefix)
 				if strings.HasPrefix(routeParameter, "\tBGP.next_hop: ") {
 					routeNexthop = strings.TrimPrefix(routeParameter, "\tBGP.next_hop: ")
 				} else if strings.HasPrefix(routeParameter, "\tBGP.as_path: ") {
 					routeASPath = strings.TrimPrefix(routeParameter, "\tBGP.as_path: ")
+				} else if strings.HasPrefix(routeParameter, "\tBGP.local_pref: ") {
+					routeLocalPref = strings.TrimSpace(strings.TrimPrefix(routeParameter, "\tBGP.local_pref: "))
+				} else if strings.HasPrefix(routeParameter, "\tBGP.med: ") {
+					routeMED = strings.TrimSpace(strings.TrimPrefix(routeParameter, "\tBGP.med: "))
+				} else if kind, isCommunityLine := communityLineKind(routeParameter); isCommunityLine {
+					for _, tuple := range communityTupleRegex.FindAllString(routeParameter, -1) {
+						if description := communityLookup(kind, communityTupleFields(tuple)); len(description) > 0 {
+							routeCommunities = append(routeCommunities, tuple+" "+description)
+						} else {
+							routeCommunities = append(routeCommunities, tuple)
+						}
+					}
 				}
 			}
-			if len(routeASPath) == 0 {
+
+			// Connect each node on AS path
+			paths, prepends := bgpmapParseASPath(routeASPath)
+			if len(paths) == 0 {
 				// Either this is not a BGP route, or the information is incomplete
 				continue
 			}
 
-			// Connect each node on AS path
-			paths := strings.Split(strings.TrimSpace(routeASPath), " ")
-
-			for pathIndex := range paths {
-				paths[pathIndex] = strings.TrimPrefix(paths[pathIndex], "(")
-				paths[pathIndex] = strings.TrimSuffix(paths[pathIndex], ")")
+			// Record prepending on edges leading to each AS
+			addPathEdge := func(source string, pathIndex int) *bgpmapEdge {
+				edge := g.addEdge(source, g.addASNode(paths[pathIndex]).ID, server, target, routePreferred)
+				if prepends[pathIndex] > 1 && prepends[pathIndex] > edge.Prepends {
+					edge.Prepends = prepends[pathIndex]
+				}
+				return edge
 			}
 
 			// First step starting from originating server
-			if len(paths) > 0 {
-				if len(routeNexthop) > 0 {
-					// Edge from originating server to nexthop
-					addEdge(server, "Nexthop:\\n"+routeNexthop, (map[bool]string{true: "[color=red]"})[routePreferred])
-					// and from nexthop to AS
-					addEdge("Nexthop:\\n"+routeNexthop, getASNRepresentation(paths[0]), (map[bool]string{true: "[color=red]"})[routePreferred])
-					addPoint("Nexthop:\\n"+routeNexthop, "[shape=diamond]")
-					routeFound = true
-				} else {
-					// Edge from originating server to AS
-					addEdge(server, getASNRepresentation(paths[0]), (map[bool]string{true: "[color=red]"})[routePreferred])
-					routeFound = true
-				}
+			var firstEdge *bgpmapEdge
+			if len(routeNexthop) > 0 {
+				// Edge from originating server to nexthop
+				nexthopID := "Nexthop: " + routeNexthop
+				g.addNode(nexthopID, "nexthop", "Nexthop:\n"+routeNexthop).URL = "/whois/" + routeNexthop
+				firstEdge = g.addEdge(server, nexthopID, server, target, routePreferred)
+				// and from nexthop to AS
+				addPathEdge(nexthopID, 0)
+				firstEdge.Nexthops = appendUnique(firstEdge.Nexthops, routeNexthop)
+			} else {
+				// Edge from originating server to AS
+				firstEdge = addPathEdge(server, 0)
+			}
+			routeFound = true
+
+			// Show attributes of the route on the first edge
+			if len(routeLocalPref) > 0 {
+				firstEdge.LocalPrefs = appendUnique(firstEdge.LocalPrefs, routeLocalPref)
+			}
+			if len(routeMED) > 0 {
+				firstEdge.MEDs = appendUnique(firstEdge.MEDs, routeMED)
+			}
+			for _, community := range routeCommunities {
+				firstEdge.Communities = appendUnique(firstEdge.Communities, community)
 			}
 
 			// Following steps, edges between AS
@@ -100,22 +271,26 @@ func birdRouteToGraphviz(servers []string, responses []string, target string) st
 				if pathIndex == 0 {
 					continue
 				}
-				addEdge(getASNRepresentation(paths[pathIndex-1]), getASNRepresentation(paths[pathIndex]), (map[bool]string{true: "[color=red]"})[routePreferred])
+				addPathEdge("AS"+paths[pathIndex-1], pathIndex)
+			}
+
+			// Last AS to destination, with ROA status of the origin
+			lastEdge := g.addEdge("AS"+paths[len(paths)-1], targetID, server, target, routePreferred)
+			if roaEnabled() {
+				if asn, err := parseROAASN(paths[len(paths)-1]); err == nil {
+					status, roa := roaValidate(routeEntryPrefix, asn)
+					lastEdge.ROAStatus = string(status)
+					lastEdge.ROA = "no ROA covering " + routeEntryPrefix
+					if roa != nil {
+						lastEdge.ROA = "ROA: " + roa.String()
+					}
+				}
 			}
-			// Last AS to destination
-			addEdge(getASNRepresentation(paths[len(paths)-1]), "Target: "+target, (map[bool]string{true: "[color=red]"})[routePreferred])
 		}
 
 		if !routeFound {
 			// Cannot find a path starting from this server
-			addEdge(server, "Target: "+target, "[color=gray,label=\"?\"]")
+			g.addEdge(server, targetID, server, target, false).Unknown = true
 		}
 	}
-
-	// Combine all graphviz commands
-	var result string
-	for edge, attr := range graph {
-		result += edge + " " + attr + ";\n"
-	}
-	return "digraph {\n" + result + "}\n"
 }
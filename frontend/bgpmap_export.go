@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Quote a string for graphviz
+func graphvizQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+// Combine graphviz attributes, skipping empty ones
+func graphvizAttrs(attrs ...string) string {
+	var nonEmpty []string
+	for _, attr := range attrs {
+		if len(attr) > 0 {
+			nonEmpty = append(nonEmpty, attr)
+		}
+	}
+	if len(nonEmpty) == 0 {
+		return ""
+	}
+	return " [" + strings.Join(nonEmpty, ",") + "]"
+}
+
+// Colors for preferred paths of each target, if there are several of them
+var graphvizTargetColors = []string{"red", "darkgreen", "orange", "purple", "brown", "magenta", "cyan4"}
+
+func (g *bgpmapGraph) targetColor(target string) string {
+	if len(g.Targets) <= 1 {
+		return "red"
+	}
+	for i, t := range g.Targets {
+		if t == target {
+			return graphvizTargetColors[i%len(graphvizTargetColors)]
+		}
+	}
+	return "red"
+}
+
+func (g *bgpmapGraph) Graphviz() string {
+	var result string
+	for _, node := range g.Nodes {
+		var color string
+		if node.Type == "target" {
+			color = "color=" + g.targetColor(strings.TrimPrefix(node.ID, "Target: "))
+		}
+		result += graphvizQuote(node.ID) + graphvizAttrs(
+			(map[bool]string{true: "label=" + graphvizQuote(node.Label)})[node.Label != node.ID],
+			color,
+			// Traceroute hops reached from several servers, where paths converge
+			(map[bool]string{true: "style=filled,fillcolor=lightyellow"})[node.Type == "hop" && len(node.Servers) > 1],
+			(map[bool]string{true: "tooltip=" + graphvizQuote(strings.Join(node.RTTs, "\n"))})[len(node.RTTs) > 0],
+			map[string]string{
+				"server":  "color=blue,shape=box",
+				"nexthop": "shape=diamond",
+				"target":  "shape=diamond",
+			}[node.Type],
+			(map[bool]string{true: "URL=" + graphvizQuote(node.URL) + ",target=_blank"})[len(node.URL) > 0],
+		) + ";\n"
+	}
+	for _, edge := range g.Edges {
+		var labels []string
+		var tooltip []string
+		var colors []string
+
+		if edge.Unknown {
+			labels = append(labels, "?")
+		}
+		if edge.HiddenHops > 0 {
+			labels = append(labels, fmt.Sprintf("%d hidden", edge.HiddenHops))
+		}
+		if edge.Prepends > 1 {
+			labels = append(labels, fmt.Sprintf("x%d", edge.Prepends))
+			tooltip = append(tooltip, fmt.Sprintf("prepended: %d times", edge.Prepends))
+		}
+		tooltip = append(tooltip, "servers: "+strings.Join(edge.Servers, ", "))
+		if len(g.Targets) > 1 {
+			tooltip = append(tooltip, "prefixes: "+strings.Join(edge.Prefixes, ", "))
+		}
+		if len(edge.LocalPrefs) > 0 {
+			tooltip = append(tooltip, "local pref: "+strings.Join(edge.LocalPrefs, ", "))
+		}
+		if len(edge.MEDs) > 0 {
+			tooltip = append(tooltip, "MED: "+strings.Join(edge.MEDs, ", "))
+		}
+		tooltip = append(tooltip, edge.Communities...)
+		if len(edge.ROAStatus) > 0 {
+			labels = append(labels, "ROA "+edge.ROAStatus)
+			tooltip = append(tooltip, edge.ROA)
+		}
+		for _, target := range edge.PreferredPrefixes {
+			colors = append(colors, g.targetColor(target))
+		}
+		if edge.Unknown {
+			colors = append(colors, "gray")
+		}
+
+		result += graphvizQuote(edge.Source) + " -> " + graphvizQuote(edge.Target) + graphvizAttrs(
+			(map[bool]string{true: "color=" + graphvizQuote(strings.Join(colors, ":"))})[len(colors) > 0],
+			(map[bool]string{true: "style=dashed"})[edge.ROAStatus == string(roaInvalid)],
+			(map[bool]string{true: "style=dotted"})[edge.HiddenHops > 0],
+			(map[bool]string{true: "label=" + graphvizQuote(strings.Join(labels, "\n"))})[len(labels) > 0],
+			"tooltip="+graphvizQuote(strings.Join(tooltip, "\n")),
+		) + ";\n"
+	}
+	return "digraph {\n" + result + "}\n"
+}
+
+func (g *bgpmapGraph) JSON() string {
+	result, err := json.MarshalIndent(g, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	return string(result)
+}
+
+type graphMLKey struct {
+	ID       string `xml:"id,attr"`
+	For      string `xml:"for,attr"`
+	AttrName string `xml:"attr.name,attr"`
+	AttrType string `xml:"attr.type,attr"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLDocument struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   struct {
+		EdgeDefault string        `xml:"edgedefault,attr"`
+		Nodes       []graphMLNode `xml:"node"`
+		Edges       []graphMLEdge `xml:"edge"`
+	} `xml:"graph"`
+}
+
+// Add a data element, skipping empty values
+func graphMLAppendData(data []graphMLData, key string, value string) []graphMLData {
+	if len(value) == 0 {
+		return data
+	}
+	return append(data, graphMLData{key, value})
+}
+
+func (g *bgpmapGraph) GraphML() string {
+	var doc graphMLDocument
+	doc.XMLNS = "http://graphml.graphdrawing.org/xmlns"
+	doc.Keys = []graphMLKey{
+		{"type", "node", "type", "string"},
+		{"label", "node", "label", "string"},
+		{"asn", "node", "asn", "string"},
+		{"name", "node", "name", "string"},
+		{"url", "node", "url", "string"},
+		{"ip", "node", "ip", "string"},
+		{"hostname", "node", "hostname", "string"},
+		{"rtts", "node", "rtts", "string"},
+		{"node_servers", "node", "servers", "string"},
+		{"preferred", "edge", "preferred", "boolean"},
+		{"servers", "edge", "servers", "string"},
+		{"prefixes", "edge", "prefixes", "string"},
+		{"preferred_prefixes", "edge", "preferred_prefixes", "string"},
+		{"nexthops", "edge", "nexthops", "string"},
+		{"unknown", "edge", "unknown", "boolean"},
+		{"local_prefs", "edge", "local_prefs", "string"},
+		{"meds", "edge", "meds", "string"},
+		{"prepends", "edge", "prepends", "int"},
+		{"hidden_hops", "edge", "hidden_hops", "int"},
+		{"communities", "edge", "communities", "string"},
+		{"roa_status", "edge", "roa_status", "string"},
+		{"roa", "edge", "roa", "string"},
+	}
+	doc.Graph.EdgeDefault = "directed"
+
+	for _, node := range g.Nodes {
+		var data []graphMLData
+		data = graphMLAppendData(data, "type", node.Type)
+		data = graphMLAppendData(data, "label", node.Label)
+		data = graphMLAppendData(data, "asn", node.ASN)
+		data = graphMLAppendData(data, "name", node.Name)
+		data = graphMLAppendData(data, "url", node.URL)
+		data = graphMLAppendData(data, "ip", node.IP)
+		data = graphMLAppendData(data, "hostname", node.Hostname)
+		data = graphMLAppendData(data, "rtts", strings.Join(node.RTTs, "\n"))
+		data = graphMLAppendData(data, "node_servers", strings.Join(node.Servers, ","))
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphMLNode{node.ID, data})
+	}
+	for _, edge := range g.Edges {
+		var data []graphMLData
+		data = graphMLAppendData(data, "preferred", strconv.FormatBool(edge.Preferred))
+		data = graphMLAppendData(data, "servers", strings.Join(edge.Servers, ","))
+		data = graphMLAppendData(data, "prefixes", strings.Join(edge.Prefixes, ","))
+		data = graphMLAppendData(data, "preferred_prefixes", strings.Join(edge.PreferredPrefixes, ","))
+		data = graphMLAppendData(data, "nexthops", strings.Join(edge.Nexthops, ","))
+		data = graphMLAppendData(data, "unknown", strconv.FormatBool(edge.Unknown))
+		data = graphMLAppendData(data, "local_prefs", strings.Join(edge.LocalPrefs, ","))
+		data = graphMLAppendData(data, "meds", strings.Join(edge.MEDs, ","))
+		if edge.Prepends > 0 {
+			data = graphMLAppendData(data, "prepends", strconv.Itoa(edge.Prepends))
+		}
+		if edge.HiddenHops > 0 {
+			data = graphMLAppendData(data, "hidden_hops", strconv.Itoa(edge.HiddenHops))
+		}
+		data = graphMLAppendData(data, "communities", strings.Join(edge.Communities, "\n"))
+		data = graphMLAppendData(data, "roa_status", edge.ROAStatus)
+		data = graphMLAppendData(data, "roa", edge.ROA)
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{edge.Source, edge.Target, data})
+	}
+
+	result, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	return xml.Header + string(result) + "\n"
+}
+
+// Export formats of bgpmap, with content type and file extension
+var bgpmapFormats = map[string]struct {
+	contentType string
+	extension   string
+	export      func(g *bgpmapGraph) string
+}{
+	"dot":     {"text/vnd.graphviz; charset=utf-8", "dot", (*bgpmapGraph).Graphviz},
+	"json":    {"application/json", "json", (*bgpmapGraph).JSON},
+	"graphml": {"application/xml", "graphml", (*bgpmapGraph).GraphML},
+}
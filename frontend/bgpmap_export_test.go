@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+)
+
+// Routes to 10.0.0.0/24, each with its own network line so they can be
+// reordered
+var bgpmapExportTestRoutes = []string{
+	`10.0.0.0/24          unicast [peer1 2024-01-01 from fe80::1] * (100) [AS4242420003i]
+	via fe80::1 on eth0
+	Type: BGP univ
+	BGP.origin: IGP
+	BGP.as_path: 4242420002 4242420003
+	BGP.next_hop: fe80::1
+	BGP.local_pref: 100
+	BGP.community: (64511,3) (64511,24)
+`,
+	`10.0.0.0/24          unicast [peer2 2024-01-01 from fe80::2] (100) [AS4242420003i]
+	via fe80::2 on eth1
+	Type: BGP univ
+	BGP.origin: IGP
+	BGP.as_path: 4242420004 4242420004 4242420004 4242420003
+	BGP.next_hop: fe80::2
+	BGP.local_pref: 200
+	BGP.med: 10
+`,
+	`10.0.0.0/24          unicast [peer3 2024-01-01 from fe80::3] (100) [AS4242420003i]
+	via fe80::3 on eth2
+	Type: BGP univ
+	BGP.origin: IGP
+	BGP.as_path: 4242420005 4242420002 4242420003
+	BGP.next_hop: fe80::3
+	BGP.local_pref: 100
+	BGP.community: (64511,5) (65535,666)
+`,
+}
+
+// Orders of the three routes in a response
+var bgpmapExportTestOrders = [][]int{{0, 1, 2}, {0, 2, 1}, {1, 0, 2}, {1, 2, 0}, {2, 0, 1}, {2, 1, 0}}
+
+func bgpmapExportTestGraph(t *testing.T, orderA []int, orderB []int) *bgpmapGraph {
+	t.Helper()
+	response := func(order []int) string {
+		var result string
+		for _, i := range order {
+			result += bgpmapExportTestRoutes[i]
+		}
+		return result
+	}
+	return birdRouteToGraph(
+		[]string{"a", "b"},
+		[][]string{{response(orderA), response(orderB)}},
+		[]string{"10.0.0.0/24"},
+		"route_all",
+	)
+}
+
+func TestBGPMapExportDeterministic(t *testing.T) {
+	communityTestDictionary(t, "dn42", "")
+	setting.asnSources = nil
+
+	want := bgpmapExportTestGraph(t, bgpmapExportTestOrders[0], bgpmapExportTestOrders[0])
+	if len(want.Nodes) == 0 || len(want.Edges) == 0 {
+		t.Fatal("no routes drawn")
+	}
+	for i, orderA := range bgpmapExportTestOrders {
+		// Server b gets the routes in a different order than server a
+		orderB := bgpmapExportTestOrders[len(bgpmapExportTestOrders)-1-i]
+		got := bgpmapExportTestGraph(t, orderA, orderB)
+		for name, format := range bgpmapFormats {
+			if format.export(got) != format.export(want) {
+				t.Errorf("%s output differs for routes in order %v and %v:\n%s\nwant:\n%s", name, orderA, orderB, format.export(got), format.export(want))
+			}
+		}
+	}
+}
+
+func TestBGPMapExportGraphMLWellFormed(t *testing.T) {
+	communityTestDictionary(t, "dn42", "")
+	setting.asnSources = nil
+
+	graph := bgpmapExportTestGraph(t, bgpmapExportTestOrders[0], bgpmapExportTestOrders[0])
+	output := graph.GraphML()
+	if !strings.Contains(output, "latency &lt;= 20ms") {
+		t.Errorf("community descriptions not escaped:\n%s", output)
+	}
+
+	// Every token must parse, with matching end elements
+	decoder := xml.NewDecoder(strings.NewReader(output))
+	for {
+		_, err := decoder.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("malformed GraphML: %v\n%s", err, output)
+		}
+	}
+
+	var doc graphMLDocument
+	if err := xml.Unmarshal([]byte(output), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Graph.Nodes) != len(graph.Nodes) || len(doc.Graph.Edges) != len(graph.Edges) {
+		t.Errorf("%d nodes and %d edges, want %d and %d", len(doc.Graph.Nodes), len(doc.Graph.Edges), len(graph.Nodes), len(graph.Edges))
+	}
+	keys := make(map[string]bool)
+	for _, key := range doc.Keys {
+		keys[key.ID] = true
+	}
+	nodes := make(map[string]bool)
+	for _, node := range doc.Graph.Nodes {
+		nodes[node.ID] = true
+		for _, data := range node.Data {
+			if !keys[data.Key] {
+				t.Errorf("node %s uses undeclared key %s", node.ID, data.Key)
+			}
+		}
+	}
+	for _, edge := range doc.Graph.Edges {
+		if !nodes[edge.Source] || !nodes[edge.Target] {
+			t.Errorf("edge %s -> %s between unknown nodes", edge.Source, edge.Target)
+		}
+		for _, data := range edge.Data {
+			if !keys[data.Key] {
+				t.Errorf("edge %s -> %s uses undeclared key %s", edge.Source, edge.Target, data.Key)
+			}
+		}
+	}
+}
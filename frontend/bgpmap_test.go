@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestBGPMapParseASPath(t *testing.T) {
+	tests := []struct {
+		path   string
+		asns   []string
+		counts []int
+	}{
+		{"", nil, nil},
+		{"4242420001", []string{"4242420001"}, []int{1}},
+		{"4242420001 4242420002 4242420003", []string{"4242420001", "4242420002", "4242420003"}, []int{1, 1, 1}},
+		{" 4242420001 4242420001 4242420001 4242420002 ", []string{"4242420001", "4242420002"}, []int{3, 1}},
+		{"64500 64501 64500", []string{"64500", "64501", "64500"}, []int{1, 1, 1}},
+		// Confederation segments are shown in parentheses
+		{"(65001 65002) 64500", []string{"65001", "65002", "64500"}, []int{1, 1, 1}},
+	}
+	for _, test := range tests {
+		asns, counts := bgpmapParseASPath(test.path)
+		if !reflect.DeepEqual(asns, test.asns) || !reflect.DeepEqual(counts, test.counts) {
+			t.Errorf("bgpmapParseASPath(%q) = %v, %v, want %v, %v", test.path, asns, counts, test.asns, test.counts)
+		}
+	}
+}
+
+func TestWebHandlerBGPMapTargetLimit(t *testing.T) {
+	var requests int32
+	testProxy(t, []string{"a", "b"}, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write([]byte("Network not found\n"))
+	})
+	handler := webHandlerBGPMap("bird", "route_bgpmap")
+
+	var targets []string
+	for i := 0; i < bgpmapMaxTargets; i++ {
+		targets = append(targets, fmt.Sprintf("10.0.%d.0/24", i))
+	}
+	tests := []struct {
+		targets  string
+		code     int
+		requests int32
+	}{
+		{strings.Join(targets, ","), http.StatusOK, 2 * bgpmapMaxTargets},
+		{strings.Join(targets, ",") + ",10.1.0.0/24", http.StatusBadRequest, 0},
+		// Empty items don't count
+		{strings.Join(targets, ",") + ",,", http.StatusOK, 2 * bgpmapMaxTargets},
+	}
+	for _, test := range tests {
+		atomic.StoreInt32(&requests, 0)
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", "/route_bgpmap/a+b/"+test.targets, nil))
+		if w.Code != test.code {
+			t.Errorf("%s: status %d, want %d", test.targets, w.Code, test.code)
+		}
+		if n := atomic.LoadInt32(&requests); n != test.requests {
+			t.Errorf("%s: %d proxy requests, want %d", test.targets, n, test.requests)
+		}
+	}
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Commands of the chat bots, shared by all platforms. Adapters parse
+// messages with botParseCommand, run them with botHandle, which checks
+// access first, and send the result in the format of the platform.
+
+type botCommand struct {
+	Name   string
+	Target string
+}
+
+// Where a command comes from
+type botContext struct {
+	// Key of the chat for its default servers and access checks, e.g.
+	// "irc:#dn42" or "telegram:-1001234"
+	Chat string
+	// Key of the user for rate limits, e.g. "matrix:@alice:example.org",
+	// and the name to show in the audit log
+	User     string
+	Username string
+	// Set if the platform waits for a reply to every command
+	NeedsReply bool
+	// Servers used if the chat has no default
+	DefaultServers []string
+	Lang           string
+	// Command prefix of the platform, for help messages
+	Prefix string
+}
+
+// A file to send instead of a text message
+type botFile struct {
+	Name    string
+	Data    []byte
+	Image   bool
+	Caption string
+}
+
+type botResult struct {
+	Text string
+	File *botFile
+	// Servers the command ran on, empty if it doesn't run on servers
+	Servers []string
+}
+
+// Commands that need a target after the command
+var botTargetCommands = []string{"detail", "route", "path", "bgpmap", "ping", "trace", "mtr", "whois"}
+
+// Default servers of each chat, changed with the servers command
+var (
+	botChatServersMutex sync.RWMutex
+	botChatServers      = make(map[string][]string)
+)
+
+// Parse a message like "/route 1.1.1.1", or "/route@bot 1.1.1.1" as sent
+// in Telegram groups, with the command prefix of the platform
+func botParseCommand(text string, prefix string) (botCommand, bool) {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, prefix) {
+		return botCommand{}, false
+	}
+	split := strings.SplitN(text[len(prefix):], " ", 2)
+	command := botCommand{Name: strings.ToLower(strings.SplitN(split[0], "@", 2)[0])}
+	if len(split) == 2 {
+		command.Target = strings.TrimSpace(split[1])
+	}
+	return command, len(command.Name) > 0
+}
+
+func botMissingTarget(command botCommand) bool {
+	for _, name := range botTargetCommands {
+		if command.Name == name && len(command.Target) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func botHelp(ctx botContext) string {
+	lines := strings.Split(i18nTranslate(ctx.Lang, "/summary\n/detail <protocol>\n/status\n/route <IP>\n/path <IP>\n/bgpmap <IP>\n/ping <IP>\n/trace <IP>\n/mtr <IP>\n/whois <Target>\n/servers [server ...]"), "\n")
+	for i, line := range lines {
+		lines[i] = ctx.Prefix + strings.TrimPrefix(line, "/")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Load default servers of chats from the state file
+func botLoadChatServers() error {
+	data, err := ioutil.ReadFile(setting.botStateFile)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var loaded map[string][]string
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return err
+	}
+	botChatServersMutex.Lock()
+	defer botChatServersMutex.Unlock()
+	for chat, servers := range loaded {
+		// State files of the Telegram-only bot are keyed by plain chat IDs
+		if _, err := strconv.ParseInt(chat, 10, 64); err == nil {
+			chat = "telegram:" + chat
+		}
+		botChatServers[chat] = servers
+	}
+	return nil
+}
+
+// Change default servers of a chat, removing them if empty
+func botSetChatServers(chat string, servers []string) {
+	botChatServersMutex.Lock()
+	defer botChatServersMutex.Unlock()
+	if len(servers) == 0 {
+		delete(botChatServers, chat)
+	} else {
+		botChatServers[chat] = servers
+	}
+
+	if len(setting.botStateFile) == 0 {
+		return
+	}
+	data, err := json.Marshal(botChatServers)
+	if err == nil {
+		err = ioutil.WriteFile(setting.botStateFile, data, 0644)
+	}
+	if err != nil {
+		println(err.Error())
+	}
+}
+
+// Servers to run commands on in a chat: the chat's own default, or the
+// given default servers
+func botGetChatServers(chat string, defaultServers []string) []string {
+	botChatServersMutex.RLock()
+	defer botChatServersMutex.RUnlock()
+	if servers, ok := botChatServers[chat]; ok {
+		return servers
+	}
+	return defaultServers
+}
+
+func botDefaultsText(ctx botContext) string {
+	return i18nTranslate(ctx.Lang, "Default servers of this chat: %s",
+		strings.Join(botGetChatServers(ctx.Chat, ctx.DefaultServers), ", "))
+}
+
+func botDefaultPostProcess(s string) string {
+	return strings.TrimSpace(s)
+}
+
+func botBatchRequestFormat(servers []string, endpoint string, command string, lang string, postProcess func(string) string) string {
+	results := batchRequest(servers, endpoint, command, lang)
+	result := ""
+	for i, r := range results {
+		if len(servers) > 1 {
+			result += servers[i] + "\n"
+		}
+		result += postProcess(r) + "\n\n"
+	}
+	return result
+}
+
+// Protocol counts and BIRD status of each server
+func botStatus(servers []string, lang string) string {
+	statuses := batchRequest(servers, "bird", "show status", lang)
+	protocols := batchRequest(servers, "bird", "show protocols", lang)
+	result := ""
+	for i, server := range servers {
+		result += server + "\n" + strings.TrimSpace(statuses[i]) + "\n"
+		if len(protocols[i]) > 4 && strings.ToLower(protocols[i][0:4]) == "name" {
+			var up, total int
+			for _, row := range summaryTable(protocols[i], server).Rows {
+				total++
+				if row.State == "up" {
+					up++
+				}
+			}
+			result += i18nTranslate(lang, "%d of %d protocols up", up, total) + "\n"
+		}
+		result += "\n"
+	}
+	return result
+}
+
+// Draw a map of routes to the target, as an image if Graphviz is installed
+func botBGPMap(servers []string, target string, lang string) *botFile {
+	responses := batchRequest(servers, "bird", "show route for "+target+" all", lang)
+	graph := birdRouteToGraph(servers, [][]string{responses}, []string{target}, "route_bgpmap")
+	dot := graph.Graphviz()
+	fileName := "bgpmap-" + strings.NewReplacer("/", "_", ":", "_").Replace(target)
+
+	command := exec.Command("dot", "-Tpng")
+	command.Stdin = strings.NewReader(dot)
+	if image, err := command.Output(); err == nil {
+		return &botFile{Name: fileName + ".png", Data: image, Image: true, Caption: "bgpmap " + target}
+	}
+	return &botFile{Name: fileName + ".dot", Data: []byte(dot), Caption: "bgpmap " + target}
+}
+
+// Expand short DN42 ASNs, so "/whois 0253" queries AS4242420253
+func botWhoisTarget(target string) string {
+	if setting.netSpecificMode != "dn42" {
+		return target
+	}
+	targetNumber, err := strconv.ParseUint(target, 10, 64)
+	if err != nil {
+		return target
+	}
+	if targetNumber < 10000 {
+		targetNumber += 4242420000
+		return "AS" + strconv.FormatUint(targetNumber, 10)
+	}
+	return "AS" + target
+}
+
+// Change default servers of the chat with "servers a b", or show them
+func botServersCommand(ctx botContext, target string) string {
+	var servers []string
+	for _, server := range strings.Fields(target) {
+		if !isValidServer(server) {
+			return i18nTranslate(ctx.Lang, "request failed: %s", i18nTranslate(ctx.Lang, "invalid server"))
+		}
+		servers = append(servers, server)
+	}
+	if len(servers) > 0 {
+		botSetChatServers(ctx.Chat, servers)
+	}
+	return botDefaultsText(ctx)
+}
+
+// Run a bot command, on the given servers, or the servers of the chat if
+// nil. Returns false if it's not a known command.
+func botRun(ctx botContext, command botCommand, servers []string) (botResult, bool) {
+	if botMissingTarget(command) {
+		return botResult{Text: botHelp(ctx)}, true
+	}
+	if servers == nil {
+		servers = botGetChatServers(ctx.Chat, ctx.DefaultServers)
+	}
+	lang := ctx.Lang
+	target := command.Target
+	result := botResult{Servers: servers}
+
+	switch command.Name {
+	case "trace":
+		result.Text = botBatchRequestFormat(servers, "traceroute", target, lang, botDefaultPostProcess)
+
+	case "ping":
+		result.Text = botBatchRequestFormat(servers, "ping", target, lang, botDefaultPostProcess)
+
+	case "mtr":
+		result.Text = botBatchRequestFormat(servers, "mtr", target, lang, botDefaultPostProcess)
+
+	case "summary":
+		result.Text = botBatchRequestFormat(servers, "bird", "show protocols", lang, botDefaultPostProcess)
+
+	case "detail":
+		result.Text = botBatchRequestFormat(servers, "bird", "show protocols all "+target, lang, botDefaultPostProcess)
+
+	case "status":
+		result.Text = botStatus(servers, lang)
+
+	case "bgpmap":
+		result.File = botBGPMap(servers, target, lang)
+		return result, true
+
+	case "route":
+		result.Text = botBatchRequestFormat(servers, "bird", "show route for "+target+" primary", lang, botDefaultPostProcess)
+
+	case "path":
+		result.Text = botBatchRequestFormat(servers, "bird", "show route for "+target+" all primary", lang, func(result string) string {
+			for _, s := range strings.Split(result, "\n") {
+				if strings.Contains(s, "BGP.as_path: ") {
+					path := strings.TrimSpace(strings.Split(s, ":")[1])
+					asns := asnExtract([]string{s})
+					asnPrefetch(asns)
+					for _, asn := range asns {
+						path += "\nAS" + asn + " " + asnName(asnLookup(asn))
+					}
+					return path
+				}
+			}
+			return ""
+		})
+
+	case "whois":
+		result.Servers = nil
+		tempResult, err := whois(botWhoisTarget(target))
+		if err != nil {
+			result.Text = err.Error()
+		} else if setting.netSpecificMode == "dn42" {
+			result.Text = dn42WhoisFilter(tempResult, lang)
+		} else {
+			result.Text = tempResult
+		}
+
+	case "servers":
+		return botResult{Text: botServersCommand(ctx, target)}, true
+
+	case "help", "start":
+		return botResult{Text: botHelp(ctx)}, true
+
+	default:
+		return botResult{}, false
+	}
+
+	result.Text = strings.TrimSpace(result.Text)
+	if len(result.Text) <= 0 {
+		result.Text = i18nTranslate(lang, "empty result")
+	}
+	return result, true
+}
+
+// Split a result into parts no longer than the limit, at line breaks
+// where possible
+func botSplitMessage(text string, limit int) []string {
+	var result []string
+	for len(text) > limit {
+		cut := strings.LastIndex(text[:limit], "\n")
+		if cut <= 0 {
+			// Don't cut a multi-byte character in half
+			cut = limit
+			for cut > 0 && !utf8.RuneStart(text[cut]) {
+				cut--
+			}
+			if cut == 0 {
+				_, cut = utf8.DecodeRuneInString(text)
+			}
+		}
+		result = append(result, text[:cut])
+		text = strings.TrimPrefix(text[cut:], "\n")
+	}
+	if len(text) == 0 && len(result) > 0 {
+		return result
+	}
+	return append(result, text)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// Access checks and the audit log of the chat bots, shared by all
+// platforms. Adapters run commands with botHandle, or check them with
+// botAllow first if they also handle other actions like buttons.
+
+// Counts requests of each chat or user in the last minute
+type botRateLimiter struct {
+	mutex    sync.Mutex
+	requests map[string][]time.Time
+}
+
+var (
+	botChatLimiter = botRateLimiter{requests: make(map[string][]time.Time)}
+	botUserLimiter = botRateLimiter{requests: make(map[string][]time.Time)}
+	botAuditMutex  sync.Mutex
+)
+
+// Reasons of rejected commands, as recorded in the audit log
+const (
+	botRejectedBlocked     = "chat blocked"
+	botRejectedNotAllowed  = "chat not allowed"
+	botRejectedChatLimited = "chat rate limited"
+	botRejectedUserLimited = "user rate limited"
+)
+
+// Record a request, and check if there were no more than the limit in
+// the last minute. A limit of 0 means no limit.
+func (limiter *botRateLimiter) allow(id string, limit int, now time.Time) bool {
+	if limit <= 0 {
+		return true
+	}
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	prune := func(id string) []time.Time {
+		requests := limiter.requests[id]
+		first := 0
+		for first < len(requests) && now.Sub(requests[first]) >= time.Minute {
+			first++
+		}
+		requests = requests[first:]
+		if len(requests) == 0 {
+			delete(limiter.requests, id)
+		}
+		return requests
+	}
+	// Forget chats and users that stopped sending requests
+	if len(limiter.requests) > 1000 {
+		for other := range limiter.requests {
+			prune(other)
+		}
+	}
+
+	requests := prune(id)
+	if len(requests) >= limit {
+		limiter.requests[id] = requests
+		return false
+	}
+	limiter.requests[id] = append(requests, now)
+	return true
+}
+
+func botChatInList(chat string, list []string) bool {
+	for _, item := range list {
+		if item == chat {
+			return true
+		}
+	}
+	return false
+}
+
+// Check if a chat and user may run a command now. Returns the reason if
+// not allowed, or an empty string.
+func botCheckAccess(ctx botContext, now time.Time) string {
+	if botChatInList(ctx.Chat, setting.botBlockChats) {
+		return botRejectedBlocked
+	}
+	if len(setting.botAllowChats) > 0 && !botChatInList(ctx.Chat, setting.botAllowChats) {
+		return botRejectedNotAllowed
+	}
+	if !botChatLimiter.allow(ctx.Chat, setting.botChatRateLimit, now) {
+		return botRejectedChatLimited
+	}
+	if !botUserLimiter.allow(ctx.User, setting.botUserRateLimit, now) {
+		return botRejectedUserLimited
+	}
+	return ""
+}
+
+// A command sent to a bot, stored as one JSON line in the audit log
+type botAuditEntry struct {
+	Time     time.Time `json:"time"`
+	Chat     string    `json:"chat"`
+	User     string    `json:"user"`
+	Username string    `json:"username,omitempty"`
+	Command  string    `json:"command"`
+	// Empty if the command was run
+	Rejected string `json:"rejected,omitempty"`
+}
+
+func botAudit(entry botAuditEntry) {
+	if len(setting.botAuditLog) == 0 {
+		return
+	}
+	botAuditMutex.Lock()
+	defer botAuditMutex.Unlock()
+	file, err := os.OpenFile(setting.botAuditLog, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		println(err.Error())
+		return
+	}
+	if err := json.NewEncoder(file).Encode(entry); err != nil {
+		println(err.Error())
+	}
+	file.Close()
+}
+
+// Check access of a command, and record it in the audit log. If rejected,
+// also returns the notice to send, which is empty for chats that may not
+// use the bot at all, unless the platform waits for a reply.
+func botAllow(ctx botContext, text string) (bool, string) {
+	now := time.Now()
+	rejected := botCheckAccess(ctx, now)
+	botAudit(botAuditEntry{
+		Time:     now,
+		Chat:     ctx.Chat,
+		User:     ctx.User,
+		Username: ctx.Username,
+		Command:  text,
+		Rejected: rejected,
+	})
+	switch rejected {
+	case "":
+		return true, ""
+	case botRejectedChatLimited, botRejectedUserLimited:
+		return false, i18nTranslate(ctx.Lang, "Too many requests, please try again later.")
+	}
+	if ctx.NeedsReply {
+		return false, i18nTranslate(ctx.Lang, "Commands are not allowed in this chat.")
+	}
+	return false, ""
+}
+
+// Run a command from a chat after checking access. Returns false if the
+// command is unknown, or rejected without a notice.
+func botHandle(ctx botContext, command botCommand, text string) (botResult, bool) {
+	if allowed, notice := botAllow(ctx, text); !allowed {
+		return botResult{Text: notice}, len(notice) > 0
+	}
+	return botRun(ctx, command, nil)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTelegramCheckSecret(t *testing.T) {
+	saved := setting.telegramSecret
+	defer func() { setting.telegramSecret = saved }()
+
+	tests := []struct {
+		secret string
+		header string
+		want   bool
+	}{
+		{"", "", false},
+		{"", "anything", false},
+		{"s3cret", "s3cret", true},
+		{"s3cret", "", false},
+		{"s3cret", "s3cre", false},
+	}
+	for _, test := range tests {
+		setting.telegramSecret = test.secret
+		r := httptest.NewRequest("POST", "/telegram/", nil)
+		if len(test.header) > 0 {
+			r.Header.Set("X-Telegram-Bot-Api-Secret-Token", test.header)
+		}
+		if got := telegramCheckSecret(r); got != test.want {
+			t.Errorf("secret %q, header %q: %v, want %v", test.secret, test.header, got, test.want)
+		}
+	}
+}
+
+func TestWebHandlerTelegramBotWithoutSecret(t *testing.T) {
+	saved := setting.telegramSecret
+	setting.telegramSecret = ""
+	defer func() { setting.telegramSecret = saved }()
+
+	w := httptest.NewRecorder()
+	webHandlerTelegramBot(w, httptest.NewRequest("POST", "/telegram/", nil))
+	if w.Code != 403 {
+		t.Errorf("status %d, want 403", w.Code)
+	}
+}
+
+func TestBotRateLimiter(t *testing.T) {
+	limiter := botRateLimiter{requests: make(map[string][]time.Time)}
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		if !limiter.allow("telegram:1", 3, now) {
+			t.Fatalf("request %d refused", i)
+		}
+	}
+	if limiter.allow("telegram:1", 3, now.Add(59*time.Second)) {
+		t.Error("fourth request in a minute allowed")
+	}
+	if !limiter.allow("telegram:2", 3, now) {
+		t.Error("other chat limited")
+	}
+	if !limiter.allow("telegram:1", 3, now.Add(time.Minute)) {
+		t.Error("request after a minute refused")
+	}
+	if !limiter.allow("telegram:1", 0, now) {
+		t.Error("limit 0 refused a request")
+	}
+}
+
+func TestBotCheckAccess(t *testing.T) {
+	saved := setting
+	defer func() { setting = saved }()
+	setting.botChatRateLimit = 0
+	setting.botUserRateLimit = 0
+
+	tests := []struct {
+		allow []string
+		block []string
+		chat  string
+		want  string
+	}{
+		{nil, nil, "irc:#dn42", ""},
+		{nil, []string{"irc:#dn42"}, "irc:#dn42", botRejectedBlocked},
+		{nil, []string{"irc:#dn42"}, "matrix:!room:example.com", ""},
+		{[]string{"telegram:-100"}, nil, "telegram:-100", ""},
+		{[]string{"telegram:-100"}, nil, "telegram:100", botRejectedNotAllowed},
+		// Chat keys of other platforms don't match
+		{[]string{"telegram:-100"}, nil, "discord:-100", botRejectedNotAllowed},
+		{[]string{"telegram:-100"}, []string{"telegram:-100"}, "telegram:-100", botRejectedBlocked},
+	}
+	for _, test := range tests {
+		setting.botAllowChats = test.allow
+		setting.botBlockChats = test.block
+		ctx := botContext{Chat: test.chat, User: "irc:host"}
+		if got := botCheckAccess(ctx, time.Now()); got != test.want {
+			t.Errorf("allow %v, block %v, chat %s: %q, want %q", test.allow, test.block, test.chat, got, test.want)
+		}
+	}
+}
+
+func TestBotHandleRejected(t *testing.T) {
+	saved := setting
+	defer func() { setting = saved }()
+	setting.botAllowChats = []string{"discord:1"}
+	setting.botChatRateLimit = 0
+	setting.botUserRateLimit = 0
+	command := botCommand{Name: "help"}
+
+	// Chats that may not use the bot get no answer, unless the
+	// platform waits for a reply
+	if result, ok := botHandle(botContext{Chat: "irc:#other", Lang: "en"}, command, "!help"); ok {
+		t.Errorf("rejected command answered with %q", result.Text)
+	}
+	result, ok := botHandle(botContext{Chat: "discord:2", Lang: "en", NeedsReply: true}, command, "/help")
+	if !ok || result.Text != "Commands are not allowed in this chat." {
+		t.Errorf("rejected command with reply: %q, %v", result.Text, ok)
+	}
+
+	// Rate limited commands always get a notice
+	setting.botUserRateLimit = 1
+	botUserLimiter = botRateLimiter{requests: make(map[string][]time.Time)}
+	ctx := botContext{Chat: "discord:1", User: "discord:42", Lang: "en", Prefix: "/"}
+	if _, ok := botHandle(ctx, command, "/help"); !ok {
+		t.Error("first command not answered")
+	}
+	result, ok = botHandle(ctx, command, "/help")
+	if !ok || result.Text != "Too many requests, please try again later." {
+		t.Errorf("rate limited command: %q, %v", result.Text, ok)
+	}
+}
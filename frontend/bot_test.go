@@ -0,0 +1,79 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestBotSplitMessage(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		limit int
+		want  []string
+	}{
+		{"short", "abc", 10, []string{"abc"}},
+		{"exact", "abcde", 5, []string{"abcde"}},
+		{"at line breaks", "abc\ndef\nghi", 8, []string{"abc\ndef", "ghi"}},
+		{"long line", "abcdefgh\nij", 5, []string{"abcde", "fgh", "ij"}},
+		{"leading line break", "\nabcdef", 4, []string{"\nabc", "def"}},
+		// Each character is 3 bytes
+		{"multi-byte", "路由表统计", 7, []string{"路由", "表统", "计"}},
+		{"multi-byte with ASCII", "a路由表", 5, []string{"a路", "由", "表"}},
+		{"trailing line break", "abc\n", 3, []string{"abc"}},
+		{"limit below character size", "路由", 2, []string{"路", "由"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := botSplitMessage(test.text, test.limit)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("botSplitMessage() = %q, want %q", got, test.want)
+			}
+			for _, part := range got {
+				if !utf8.ValidString(part) {
+					t.Errorf("invalid UTF-8 in %q", part)
+				}
+			}
+		})
+	}
+
+	// Long output without line breaks, as from a single whois attribute
+	text := strings.Repeat("ü", 5000)
+	for _, part := range botSplitMessage(text, 4096) {
+		if len(part) > 4096 || !utf8.ValidString(part) {
+			t.Errorf("part of %d bytes, valid %v", len(part), utf8.ValidString(part))
+		}
+	}
+}
+
+func TestBotLoadChatServers(t *testing.T) {
+	savedFile, savedServers := setting.botStateFile, botChatServers
+	defer func() { setting.botStateFile, botChatServers = savedFile, savedServers }()
+	setting.botStateFile = filepath.Join(t.TempDir(), "state.json")
+	botChatServers = make(map[string][]string)
+
+	// Chat IDs of the Telegram-only state format, and keys of other platforms
+	data := `{"123":["a"],"-100456":["b"],"matrix:!room:example.com":["c"],"telegram:789":["d"]}`
+	if err := ioutil.WriteFile(setting.botStateFile, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := botLoadChatServers(); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{
+		"telegram:123":             {"a"},
+		"telegram:-100456":         {"b"},
+		"matrix:!room:example.com": {"c"},
+		"telegram:789":             {"d"},
+	}
+	if !reflect.DeepEqual(botChatServers, want) {
+		t.Errorf("chat servers %v, want %v", botChatServers, want)
+	}
+	if servers := botGetChatServers(telegramChatKey(-100456), nil); !reflect.DeepEqual(servers, []string{"b"}) {
+		t.Errorf("servers of the migrated chat %v", servers)
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type communityKind int
+
+const (
+	communityStandard communityKind = iota
+	communityExtended
+	communityLarge
+)
+
+// Prefixes of BIRD route attribute lines carrying each kind of community
+var communityLinePrefixes = map[string]communityKind{
+	"BGP.community:":       communityStandard,
+	"BGP.ext_community:":   communityExtended,
+	"BGP.large_community:": communityLarge,
+}
+
+// A dictionary entry. Each field is either a literal value, "*" to match
+// anything, or a numeric range like "1000-1999".
+type communityPattern struct {
+	kind        communityKind
+	fields      []string
+	description string
+	describe    func(fields []string) string
+}
+
+type communityAnnotation struct {
+	Community   string `json:"community"`
+	Description string `json:"description"`
+}
+
+// Dictionary entries, in order of precedence
+var communityDictionary []communityPattern
+
+var wellKnownCommunities = []string{
+	"65535:0      graceful shutdown",
+	"65535:1      accept own",
+	"65535:666    blackhole",
+	"65535:65281  no export",
+	"65535:65282  no advertise",
+	"65535:65283  no export subconfed",
+	"65535:65284  no peer",
+	"rt:*:*       route target $2:$3",
+	"ro:*:*       route origin $2:$3",
+}
+
+var dn42Communities = []string{
+	"64511:1      latency <= 2.7ms",
+	"64511:2      latency <= 7.3ms",
+	"64511:3      latency <= 20ms",
+	"64511:4      latency <= 55ms",
+	"64511:5      latency <= 148ms",
+	"64511:6      latency <= 403ms",
+	"64511:7      latency <= 1097ms",
+	"64511:8      latency <= 2981ms",
+	"64511:9      latency > 2981ms",
+	"64511:21     bandwidth >= 100kbps",
+	"64511:22     bandwidth >= 1Mbps",
+	"64511:23     bandwidth >= 10Mbps",
+	"64511:24     bandwidth >= 100Mbps",
+	"64511:25     bandwidth >= 1Gbps",
+	"64511:26     bandwidth >= 10Gbps",
+	"64511:27     bandwidth >= 100Gbps",
+	"64511:28     bandwidth >= 1Tbps",
+	"64511:29     bandwidth >= 10Tbps",
+	"64511:31     not encrypted",
+	"64511:32     encrypted with unsafe VPN solution",
+	"64511:33     safe encryption, but no forward secrecy",
+	"64511:34     safe encryption with perfect forward secrecy",
+	"64511:41     region: Europe",
+	"64511:42     region: North America - East",
+	"64511:43     region: North America - Central",
+	"64511:44     region: North America - West",
+	"64511:45     region: Central America",
+	"64511:46     region: South America - East",
+	"64511:47     region: South America - West",
+	"64511:48     region: Africa - North",
+	"64511:49     region: Africa - South",
+	"64511:50     region: Asia - South",
+	"64511:51     region: Asia - Southeast",
+	"64511:52     region: Asia - East",
+	"64511:53     region: Pacific & Oceania",
+	"64511:54     region: Antarctica",
+	"64511:55     region: Asia - North",
+	"64511:56     region: Asia - West",
+	"64511:57     region: Central Asia",
+}
+
+// Parse a dictionary line in the form of "a:b description",
+// "type:a:b description" or "a:b:c description"
+func parseCommunityPattern(line string) (communityPattern, error) {
+	var pattern communityPattern
+	split := strings.Fields(line)
+	if len(split) < 2 {
+		return pattern, fmt.Errorf("missing description: %s", line)
+	}
+	pattern.fields = strings.Split(split[0], ":")
+	pattern.description = strings.Join(split[1:], " ")
+
+	switch len(pattern.fields) {
+	case 2:
+		pattern.kind = communityStandard
+	case 3:
+		if _, err := strconv.ParseUint(pattern.fields[0], 10, 32); err == nil || pattern.fields[0] == "*" {
+			pattern.kind = communityLarge
+		} else {
+			pattern.kind = communityExtended
+		}
+	default:
+		return pattern, fmt.Errorf("invalid community: %s", split[0])
+	}
+	return pattern, nil
+}
+
+func loadCommunityFile(path string) ([]communityPattern, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var patterns []communityPattern
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		pattern, err := parseCommunityPattern(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, lineNumber, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, scanner.Err()
+}
+
+// Load operator defined dictionaries first, so they take precedence over
+// the built-in ones
+func loadCommunityDictionaries() error {
+	var dictionary []communityPattern
+	for _, path := range setting.communityFiles {
+		patterns, err := loadCommunityFile(strings.TrimSpace(path))
+		if err != nil {
+			return err
+		}
+		dictionary = append(dictionary, patterns...)
+	}
+
+	builtins := wellKnownCommunities
+	if setting.netSpecificMode == "dn42" {
+		builtins = append(dn42Communities, builtins...)
+	}
+	for _, line := range builtins {
+		pattern, err := parseCommunityPattern(line)
+		if err != nil {
+			return err
+		}
+		dictionary = append(dictionary, pattern)
+	}
+	if setting.netSpecificMode == "dn42" {
+		dictionary = append(dictionary, communityPattern{
+			kind:   communityStandard,
+			fields: []string{"64511", "1000-1999"},
+			describe: func(fields []string) string {
+				code, _ := strconv.Atoi(fields[1])
+				return fmt.Sprintf("country: ISO 3166-1 numeric %03d", code-1000)
+			},
+		})
+	}
+
+	communityDictionary = dictionary
+	return nil
+}
+
+func communityFieldMatch(pattern string, value string) bool {
+	if pattern == "*" || strings.EqualFold(pattern, value) {
+		return true
+	}
+	if index := strings.IndexByte(pattern, '-'); index > 0 {
+		min, errMin := strconv.ParseUint(pattern[:index], 10, 64)
+		max, errMax := strconv.ParseUint(pattern[index+1:], 10, 64)
+		number, err := strconv.ParseUint(value, 10, 64)
+		return errMin == nil && errMax == nil && err == nil && min <= number && number <= max
+	}
+	return false
+}
+
+// Find the description of a community, given its fields as printed by BIRD
+func communityLookup(kind communityKind, fields []string) string {
+	for _, pattern := range communityDictionary {
+		if pattern.kind != kind || len(pattern.fields) != len(fields) {
+			continue
+		}
+		matched := true
+		for i := range fields {
+			if !communityFieldMatch(pattern.fields[i], fields[i]) {
+				matched = false
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+		if pattern.describe != nil {
+			return pattern.describe(fields)
+		}
+		result := pattern.description
+		for i := len(fields); i > 0; i-- {
+			result = strings.ReplaceAll(result, "$"+strconv.Itoa(i), fields[i-1])
+		}
+		return result
+	}
+	return ""
+}
+
+var communityTupleRegex = regexp.MustCompile(`\(([^()]*)\)`)
+
+func communityTupleFields(tuple string) []string {
+	fields := strings.Split(strings.Trim(tuple, "()"), ",")
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+	return fields
+}
+
+// Check if a line of BIRD output lists communities, and which kind
+func communityLineKind(line string) (communityKind, bool) {
+	line = strings.TrimSpace(line)
+	for prefix, kind := range communityLinePrefixes {
+		if strings.HasPrefix(line, prefix) {
+			return kind, true
+		}
+	}
+	return communityStandard, false
+}
+
+// Add tooltips with descriptions to every known community in a line
+func communityFormatLine(kind communityKind, line string) string {
+	return communityTupleRegex.ReplaceAllStringFunc(line, func(tuple string) string {
+		description := communityLookup(kind, communityTupleFields(tuple))
+		if len(description) == 0 {
+			return tuple
+		}
+		return `<abbr class="community" title="` + html.EscapeString(description) + `">` + tuple + `</abbr>`
+	})
+}
+
+// Collect descriptions for all known communities in a BIRD response
+func communityExtract(response string) []communityAnnotation {
+	var result []communityAnnotation
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(response, "\n") {
+		kind, isCommunityLine := communityLineKind(line)
+		if !isCommunityLine {
+			continue
+		}
+		for _, tuple := range communityTupleRegex.FindAllString(line, -1) {
+			if seen[tuple] {
+				continue
+			}
+			seen[tuple] = true
+			if description := communityLookup(kind, communityTupleFields(tuple)); len(description) > 0 {
+				result = append(result, communityAnnotation{tuple, description})
+			}
+		}
+	}
+	return result
+}
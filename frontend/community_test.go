@@ -0,0 +1,118 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func communityTestDictionary(t *testing.T, mode string, lines string) {
+	saved := setting
+	setting.netSpecificMode = mode
+	setting.communityFiles = nil
+	if len(lines) > 0 {
+		path := filepath.Join(t.TempDir(), "communities.txt")
+		if err := os.WriteFile(path, []byte(lines), 0644); err != nil {
+			t.Fatal(err)
+		}
+		setting.communityFiles = []string{path}
+	}
+	if err := loadCommunityDictionaries(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		setting = saved
+		loadCommunityDictionaries()
+	})
+}
+
+func TestParseCommunityPattern(t *testing.T) {
+	tests := []struct {
+		line   string
+		kind   communityKind
+		fields []string
+		err    bool
+	}{
+		{"65535:666 blackhole", communityStandard, []string{"65535", "666"}, false},
+		{"4242420001:1:* large   community", communityLarge, []string{"4242420001", "1", "*"}, false},
+		{"*:1:2 any large", communityLarge, []string{"*", "1", "2"}, false},
+		{"rt:*:* route target", communityExtended, []string{"rt", "*", "*"}, false},
+		{"65535:666", communityStandard, nil, true},
+		{"1:2:3:4 too long", communityStandard, nil, true},
+	}
+	for _, test := range tests {
+		pattern, err := parseCommunityPattern(test.line)
+		if (err != nil) != test.err {
+			t.Errorf("parseCommunityPattern(%q) error = %v", test.line, err)
+			continue
+		}
+		if err == nil && (pattern.kind != test.kind || !reflect.DeepEqual(pattern.fields, test.fields)) {
+			t.Errorf("parseCommunityPattern(%q) = %d %q", test.line, pattern.kind, pattern.fields)
+		}
+	}
+}
+
+func TestCommunityLookup(t *testing.T) {
+	communityTestDictionary(t, "dn42", "# Operator dictionary\n64511:1 operator latency\n4242420001:100-199:* customer $2 of $1 ($3)\n")
+
+	tests := []struct {
+		kind   communityKind
+		fields []string
+		want   string
+	}{
+		{communityStandard, []string{"65535", "666"}, "blackhole"},
+		{communityStandard, []string{"65535", "667"}, ""},
+		// Operator dictionaries take precedence over the built-in ones
+		{communityStandard, []string{"64511", "1"}, "operator latency"},
+		{communityStandard, []string{"64511", "2"}, "latency <= 7.3ms"},
+		{communityStandard, []string{"64511", "1276"}, "country: ISO 3166-1 numeric 276"},
+		{communityStandard, []string{"64511", "2000"}, ""},
+		{communityStandard, []string{"64511", "20"}, ""},
+		{communityStandard, []string{"64511", "21"}, "bandwidth >= 100kbps"},
+		{communityLarge, []string{"4242420001", "150", "7"}, "customer 150 of 4242420001 (7)"},
+		{communityLarge, []string{"4242420001", "200", "7"}, ""},
+		// Same fields, but a different kind
+		{communityStandard, []string{"4242420001", "150"}, ""},
+		{communityExtended, []string{"RT", "64500", "1"}, "route target 64500:1"},
+		{communityExtended, []string{"ro", "64500", "1"}, "route origin 64500:1"},
+	}
+	for _, test := range tests {
+		if got := communityLookup(test.kind, test.fields); got != test.want {
+			t.Errorf("communityLookup(%d, %q) = %q, want %q", test.kind, test.fields, got, test.want)
+		}
+	}
+}
+
+func TestCommunityLookupWithoutDN42(t *testing.T) {
+	communityTestDictionary(t, "", "")
+	if got := communityLookup(communityStandard, []string{"64511", "1"}); got != "" {
+		t.Errorf("dn42 community described outside dn42 mode: %q", got)
+	}
+}
+
+func TestCommunityExtract(t *testing.T) {
+	communityTestDictionary(t, "dn42", "")
+	response := "172.20.0.0/24 unicast [bgp1 2024-01-01] * (100) [AS4242420001i]\n" +
+		"\tBGP.community: (64511,3) (64511,24) (64511,3) (65000,1)\n" +
+		"\tBGP.ext_community: (rt, 64500, 1)\n" +
+		"\tBGP.large_community: (4242420001, 1, 1)\n" +
+		"\tBGP.med: (65535,666)\n"
+	want := []communityAnnotation{
+		{"(64511,3)", "latency <= 20ms"},
+		{"(64511,24)", "bandwidth >= 100Mbps"},
+		{"(rt, 64500, 1)", "route target 64500:1"},
+	}
+	if got := communityExtract(response); !reflect.DeepEqual(got, want) {
+		t.Errorf("communityExtract() = %v, want %v", got, want)
+	}
+}
+
+func TestCommunityFormatLine(t *testing.T) {
+	communityTestDictionary(t, "", "")
+	got := communityFormatLine(communityStandard, "\tBGP.community: (65535,666) (1,2)")
+	want := "\tBGP.community: <abbr class=\"community\" title=\"blackhole\">(65535,666)</abbr> (1,2)"
+	if got != want {
+		t.Errorf("communityFormatLine() = %q, want %q", got, want)
+	}
+}
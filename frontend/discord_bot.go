@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"strings"
+)
+
+const (
+	discordAPIBase      = "https://discord.com/api/v10"
+	discordMessageLimit = 2000
+	discordMaxMessages  = 4
+)
+
+// Interaction types and response types of the interactions webhook
+const (
+	discordInteractionPing    = 1
+	discordInteractionCommand = 2
+
+	discordResponsePong     = 1
+	discordResponseDeferred = 5
+)
+
+type discordUser struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+}
+
+type discordInteraction struct {
+	Type          int    `json:"type"`
+	ApplicationID string `json:"application_id"`
+	Token         string `json:"token"`
+	ChannelID     string `json:"channel_id"`
+	Locale        string `json:"locale"`
+	// The user in servers, or in direct messages
+	Member struct {
+		User discordUser `json:"user"`
+	} `json:"member"`
+	User discordUser `json:"user"`
+	Data struct {
+		Name    string `json:"name"`
+		Options []struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"options"`
+	} `json:"data"`
+}
+
+// Slash commands registered with the bot token, with a description and
+// the name of the target option if it takes one
+var discordCommands = []struct {
+	Name        string
+	Description string
+	Option      string
+}{
+	{"summary", "Show protocols of the servers", ""},
+	{"detail", "Show details of a protocol", "protocol"},
+	{"status", "Show BIRD status of the servers", ""},
+	{"route", "Show the best route to an IP or prefix", "target"},
+	{"path", "Show the AS path to an IP or prefix", "target"},
+	{"bgpmap", "Draw a map of routes to an IP or prefix", "target"},
+	{"ping", "Ping an IP or domain from the servers", "target"},
+	{"trace", "Traceroute an IP or domain from the servers", "target"},
+	{"mtr", "Run mtr to an IP or domain from the servers", "target"},
+	{"whois", "Query whois for an ASN, IP or object", "target"},
+	{"servers", "Show or change default servers of this channel", "servers"},
+	{"help", "Show available commands", ""},
+}
+
+func discordEnabled() bool {
+	return len(setting.discordPublicKey) > 0
+}
+
+// Check the signature of an interaction request with the application's
+// public key, as Discord requires
+func discordCheckSignature(r *http.Request, body []byte) bool {
+	key, err := hex.DecodeString(setting.discordPublicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return false
+	}
+	signature, err := hex.DecodeString(r.Header.Get("X-Signature-Ed25519"))
+	if err != nil {
+		return false
+	}
+	message := append([]byte(r.Header.Get("X-Signature-Timestamp")), body...)
+	return ed25519.Verify(ed25519.PublicKey(key), message, signature)
+}
+
+// Call the Discord API, with the bot token if authorize is set. Interaction
+// webhooks are authorized by the token in the URL instead.
+func discordRequest(method string, url string, contentType string, body []byte, authorize bool) error {
+	request, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", contentType)
+	if authorize {
+		request.Header.Set("Authorization", "Bot "+setting.discordBotToken)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("HTTP status %s", response.Status)
+	}
+	return nil
+}
+
+// Send a message through the interaction webhook, editing the deferred
+// response if first, with the file attached if not nil
+func discordSend(interaction discordInteraction, first bool, content string, file *botFile) error {
+	url := discordAPIBase + "/webhooks/" + interaction.ApplicationID + "/" + interaction.Token
+	method := "POST"
+	if first {
+		url += "/messages/@original"
+		method = "PATCH"
+	}
+	payload, err := json.Marshal(map[string]string{"content": content})
+	if err != nil {
+		return err
+	}
+	if file == nil {
+		return discordRequest(method, url, "application/json", payload, false)
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("payload_json", string(payload))
+	part, err := writer.CreateFormFile("files[0]", file.Name)
+	if err != nil {
+		return err
+	}
+	part.Write(file.Data)
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return discordRequest(method, url, writer.FormDataContentType(), body.Bytes(), false)
+}
+
+// Run a slash command, and send the result in place of the deferred response
+func discordHandleCommand(interaction discordInteraction) {
+	command := botCommand{Name: interaction.Data.Name}
+	for _, option := range interaction.Data.Options {
+		command.Target = strings.TrimSpace(option.Value)
+	}
+	lang := i18nMatch(interaction.Locale)
+	if len(lang) == 0 {
+		lang = setting.language
+	}
+	user := interaction.Member.User
+	if len(user.ID) == 0 {
+		user = interaction.User
+	}
+	ctx := botContext{
+		Chat:           "discord:" + interaction.ChannelID,
+		User:           "discord:" + user.ID,
+		Username:       user.Username,
+		NeedsReply:     true,
+		DefaultServers: setting.servers,
+		Lang:           lang,
+		Prefix:         "/",
+	}
+
+	text := "/" + command.Name
+	if len(command.Target) > 0 {
+		text += " " + command.Target
+	}
+	result, ok := botHandle(ctx, command, text)
+	var err error
+	if !ok {
+		err = discordSend(interaction, true, botHelp(ctx), nil)
+	} else if result.File != nil {
+		err = discordSend(interaction, true, result.File.Caption, result.File)
+	} else if parts := botSplitMessage(result.Text, discordMessageLimit-len("```\n\n```")); len(parts) > discordMaxMessages {
+		err = discordSend(interaction, true, i18nTranslate(lang, "The result is too long, and is sent as a file."),
+			&botFile{Name: "result.txt", Data: []byte(result.Text)})
+	} else {
+		for i, part := range parts {
+			if err = discordSend(interaction, i == 0, "```\n"+part+"\n```", nil); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		println("discord send: " + err.Error())
+	}
+}
+
+// Register the slash commands of the bot, replacing existing ones
+func discordRegisterCommands() error {
+	var commands []map[string]interface{}
+	for _, c := range discordCommands {
+		command := map[string]interface{}{
+			"name":        c.Name,
+			"description": c.Description,
+		}
+		if len(c.Option) > 0 {
+			command["options"] = []map[string]interface{}{{
+				"type":        3, // string
+				"name":        c.Option,
+				"description": c.Option,
+				"required":    c.Name != "servers",
+			}}
+		}
+		commands = append(commands, command)
+	}
+	data, err := json.Marshal(commands)
+	if err != nil {
+		return err
+	}
+	return discordRequest("PUT", discordAPIBase+"/applications/"+setting.discordApplicationID+"/commands", "application/json", data, true)
+}
+
+func webHandlerDiscordBot(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		println(err.Error())
+		return
+	}
+	if !discordCheckSignature(r, body) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var interaction discordInteraction
+	if err := json.Unmarshal(body, &interaction); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	response := map[string]int{"type": discordResponsePong}
+	if interaction.Type == discordInteractionCommand {
+		// Commands may take longer than the 3 seconds Discord waits for,
+		// so the result is sent afterwards
+		response["type"] = discordResponseDeferred
+		go discordHandleCommand(interaction)
+	} else if interaction.Type != discordInteractionPing {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -1,50 +1,62 @@
 package main
 
 import (
-	"fmt"
+	"net"
+	"strconv"
 	"strings"
 )
 
-func dn42WhoisFilter(whois string) string {
-	commandResult := ""
-	isNextSection := false
-	skippedLines := 0
+// Address ranges and ASNs handled by the dn42 whois server
+var dn42Networks = []string{
+	"172.20.0.0/14",
+	"10.0.0.0/8",
+	"fd00::/8",
+}
+
+func dn42IsASN(asn uint64) bool {
+	return (asn >= 4242420000 && asn <= 4242429999) ||
+		(asn >= 4201270000 && asn <= 4201279999) ||
+		(asn >= 64512 && asn <= 65534) ||
+		(asn >= 76100 && asn <= 76199)
+}
 
-	// Filter out some long (and useless) keys
-	filteredPrefix := []string{
-		"descr:", "remarks:", "ds-rdata:", "auth:", "country:",
-		"nserver:", "status:", "pgp-fingerprint:", "mp-import:", "mp-export:",
-		"members:", "key:", "inetnum:", "inet6num:", " ", "+",
+// Check if a whois target belongs to dn42
+func dn42IsTarget(target string) bool {
+	lower := strings.ToLower(target)
+	if strings.HasSuffix(lower, ".dn42") {
+		return true
+	}
+	if asn, err := strconv.ParseUint(strings.TrimPrefix(lower, "as"), 10, 32); err == nil {
+		return dn42IsASN(asn)
 	}
-	for _, s := range strings.Split(whois, "\n") {
-		if len(s) == 0 {
-			// This line is a separation between parts of results
-			// Only keep last part of result
-			isNextSection = true
-			continue
-		}
-		shouldSkip := false
-		for _, filtered := range filteredPrefix {
-			if strings.HasPrefix(s, filtered) {
-				shouldSkip = true
-			}
-		}
-		if shouldSkip {
-			skippedLines++
-			continue
-		}
 
-		if isNextSection {
-			isNextSection = false
-			skippedLines = 0
-			commandResult = ""
+	ip := net.ParseIP(target)
+	if _, network, err := net.ParseCIDR(target); err == nil {
+		ip = network.IP
+	}
+	if ip == nil {
+		return false
+	}
+	for _, cidr := range dn42Networks {
+		if _, network, _ := net.ParseCIDR(cidr); network.Contains(ip) {
+			return true
 		}
+	}
+	return false
+}
 
-		commandResult += s + "\n"
+// Show only the last object of whois result, without filtered attributes
+func dn42WhoisFilter(whois string, lang string) string {
+	objects := rpslParse(whois)
+	if len(objects) == 0 {
+		return whois
 	}
 
+	object, skippedLines := whoisFilterObject(objects[len(objects)-1])
+	commandResult := object.String()
+
 	if skippedLines > 0 {
-		return commandResult + fmt.Sprintf("\n%d line(s) skipped.\n", skippedLines)
+		return commandResult + "\n" + i18nTranslate(lang, "%d line(s) skipped.", skippedLines) + "\n"
 	} else {
 		return commandResult
 	}
@@ -0,0 +1,22 @@
+#!/bin/sh
+# Download third party libraries into static/, so they are bundled into the
+# binary by the next build. Every file is checked against its pinned sha256
+# hash, and the script fails if any download doesn't match.
+set -e
+cd "$(dirname "$0")/static"
+
+fetch() {
+	curl -fsSL -o "$1.tmp" "$2"
+	if ! echo "$3  $1.tmp" | sha256sum -c --quiet -; then
+		rm -f "$1.tmp"
+		echo "checksum mismatch for $2" >&2
+		exit 1
+	fi
+	mv "$1.tmp" "$1"
+}
+
+fetch bootstrap.min.css https://cdn.jsdelivr.net/npm/bootstrap@4.5.1/dist/css/bootstrap.min.css 5681594a59b24d7b1e81179008d99b5eb4b884105497f71ec59bcf98f5a826c6
+fetch bootstrap.min.js https://cdn.jsdelivr.net/npm/bootstrap@4.5.1/dist/js/bootstrap.min.js d0889aa19088fbef68000be609be58d2bf775e4ba1bc9a516a564b7df4172e89
+fetch jquery.min.js https://cdn.jsdelivr.net/npm/jquery@3.5.1/dist/jquery.min.js f7f6a5894f1d19ddad6fa392b2ece2c5e578cbf7da4ea805b6885eb6985b6e3d
+fetch viz.min.js https://cdn.jsdelivr.net/npm/viz.js@2.1.2/viz.min.js f111f22be005ceaf625f06c5a36ba7aa27703dbc0753914559edd1c24715b6e5
+fetch lite.render.js https://cdn.jsdelivr.net/npm/viz.js@2.1.2/lite.render.js 427e64dd5aa4e6174aa1643a974257a19f5968c2bce0198b9bdca8d98c5bd417
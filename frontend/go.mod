@@ -1,5 +1,5 @@
 module github.com/xddxdd/bird-lg-go/frontend
 
-go 1.15
+go 1.16
 
 require github.com/gorilla/handlers v1.5.1
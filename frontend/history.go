@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Events older than this are removed from the history, except the last
+// one of each protocol, which is still its current state
+const historyRetention = 30 * 24 * time.Hour
+
+// A state change of a protocol, stored as one JSON line in the history file
+type protocolEvent struct {
+	Time     time.Time `json:"time"`
+	Server   string    `json:"server"`
+	Protocol string    `json:"protocol"`
+	State    string    `json:"state"`
+	Info     string    `json:"info"`
+	Since    string    `json:"since"`
+	// Set if the protocol was up before, and went down or restarted
+	Flap bool `json:"flap"`
+}
+
+var (
+	historyMutex  sync.RWMutex
+	historyEvents = make(map[[2]string][]protocolEvent)
+	historyStore  *jsonLinesStore
+)
+
+func historyEnabled() bool {
+	return len(setting.historyFile) > 0
+}
+
+// Load events from the history file, and rewrite it without old events
+func historyLoad() error {
+	historyStore = newJSONLinesStore(setting.historyFile, historyDump)
+	events := make(map[[2]string][]protocolEvent)
+	err := historyStore.load(func(line []byte) error {
+		var event protocolEvent
+		if err := json.Unmarshal(line, &event); err != nil {
+			return err
+		}
+		key := [2]string{event.Server, event.Protocol}
+		events[key] = append(events[key], event)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	historyMutex.Lock()
+	for key, protocolEvents := range events {
+		sort.SliceStable(protocolEvents, func(i, j int) bool {
+			return protocolEvents[i].Time.Before(protocolEvents[j].Time)
+		})
+		historyEvents[key] = protocolEvents
+	}
+	historyMutex.Unlock()
+	return historyStore.compact()
+}
+
+// Remove events before the cutoff, except the last one of them
+func historyTrim(events []protocolEvent, cutoff time.Time) []protocolEvent {
+	first := sort.Search(len(events), func(i int) bool {
+		return !events[i].Time.Before(cutoff)
+	})
+	if first > 0 {
+		first--
+	}
+	return events[first:]
+}
+
+// Remove old events of all protocols, and write the remaining ones to the
+// history file
+func historyDump(encoder *json.Encoder) error {
+	cutoff := time.Now().Add(-historyRetention)
+	historyMutex.Lock()
+	defer historyMutex.Unlock()
+	for key, events := range historyEvents {
+		events = historyTrim(events, cutoff)
+		historyEvents[key] = events
+		for _, event := range events {
+			if err := encoder.Encode(event); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func historyAppend(events []protocolEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	return historyStore.append(func(encoder *json.Encoder) error {
+		for _, event := range events {
+			if err := encoder.Encode(event); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Whether the since column shows a recent time, instead of only a date.
+// BIRD shows older timestamps with less precision, so a change of since
+// without a time is not a restart.
+func historySinceIsRecent(since string) bool {
+	return strings.Contains(since, ":")
+}
+
+// Query protocols of all servers, record changes since last time, and
+// pass them on for alerting
+func historyPoll() {
+	responses := batchRequest(setting.servers, "bird", "show protocols", "en")
+	now := time.Now()
+	cutoff := now.Add(-historyRetention)
+
+	var newEvents []protocolEvent
+	previousStates := make(map[[2]string]string)
+	historyMutex.Lock()
+	for i, response := range responses {
+		if len(response) <= 4 || strings.ToLower(response[0:4]) != "name" {
+			// Server unreachable or error message, state unknown
+			continue
+		}
+		server := setting.servers[i]
+		for _, row := range summaryTable(response, server).Rows {
+			key := [2]string{server, row.Name}
+			events := historyEvents[key]
+			event := protocolEvent{
+				Time:     now,
+				Server:   server,
+				Protocol: row.Name,
+				State:    row.State,
+				Info:     row.Info,
+				Since:    row.Since,
+			}
+			if len(events) > 0 {
+				last := events[len(events)-1]
+				restarted := row.State == "up" && row.Since != last.Since && historySinceIsRecent(row.Since)
+				if last.State == row.State && !restarted {
+					continue
+				}
+				event.Flap = last.State == "up"
+				previousStates[key] = last.State
+			}
+			historyEvents[key] = historyTrim(append(events, event), cutoff)
+			newEvents = append(newEvents, event)
+		}
+	}
+	historyMutex.Unlock()
+
+	if historyEnabled() {
+		if err := historyAppend(newEvents); err != nil {
+			println(err.Error())
+		}
+	}
+	if alertEnabled() {
+		alertProtocolEvents(newEvents, previousStates, now)
+	}
+}
+
+func historyPollLoop() {
+	historyPoll()
+	for range time.Tick(time.Duration(setting.historyInterval) * time.Second) {
+		historyPoll()
+	}
+}
+
+// Get state changes of a protocol, oldest first
+func historyGet(server string, protocol string) []protocolEvent {
+	historyMutex.RLock()
+	defer historyMutex.RUnlock()
+	events := historyEvents[[2]string{server, protocol}]
+	return append([]protocolEvent(nil), events...)
+}
+
+// Count flaps in the period before now
+func historyFlaps(events []protocolEvent, period time.Duration, now time.Time) int {
+	var result int
+	start := now.Add(-period)
+	for _, event := range events {
+		if event.Flap && event.Time.After(start) {
+			result++
+		}
+	}
+	return result
+}
+
+// A period of time in the same state, as part of the given duration
+type historySegment struct {
+	State    string
+	From     time.Time
+	To       time.Time
+	Fraction float64
+}
+
+// Split the period before now into segments of the same state. Time
+// before the first event has an empty state.
+func historyTimeline(events []protocolEvent, period time.Duration, now time.Time) []historySegment {
+	var result []historySegment
+	start := now.Add(-period)
+	add := func(state string, from time.Time, to time.Time) {
+		if from.Before(start) {
+			from = start
+		}
+		if !to.After(from) {
+			return
+		}
+		result = append(result, historySegment{
+			State:    state,
+			From:     from,
+			To:       to,
+			Fraction: float64(to.Sub(from)) / float64(period),
+		})
+	}
+
+	if len(events) == 0 {
+		add("", start, now)
+		return result
+	}
+	add("", start, events[0].Time)
+	for i, event := range events {
+		to := now
+		if i+1 < len(events) {
+			to = events[i+1].Time
+		}
+		add(event.State, event.Time, to)
+	}
+	return result
+}
+
+// Fraction of time the protocol was up in the period before now, only
+// counting time with known state. Returns false if nothing is known.
+func historyUptime(events []protocolEvent, period time.Duration, now time.Time) (float64, bool) {
+	var up, known time.Duration
+	for _, segment := range historyTimeline(events, period, now) {
+		if segment.State == "" {
+			continue
+		}
+		known += segment.To.Sub(segment.From)
+		if segment.State == "up" {
+			up += segment.To.Sub(segment.From)
+		}
+	}
+	if known == 0 {
+		return 0, false
+	}
+	return float64(up) / float64(known), true
+}
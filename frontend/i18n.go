@@ -0,0 +1,484 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Message catalogs, by language code and then by the English message.
+// Messages missing from a catalog are shown in English.
+var i18nCatalogs = map[string]map[string]string{
+	"en": {
+		"language_name": "English",
+	},
+	"zh": {
+		"language_name": "中文",
+
+		"show route for ... (bgpmap)":             "show route for ... (BGP 路径图)",
+		"show route where net ~ [ ... ] (bgpmap)": "show route where net ~ [ ... ] (BGP 路径图)",
+		"traceroute ... (map)":                    "traceroute ... (拓扑图)",
+		"All Servers":                             "所有服务器",
+		"Target":                                  "目标",
+
+		"full":                "完整",
+		"compact":             "精简",
+		"%d line(s) skipped.": "已省略 %d 行。",
+		"previous":            "上一页",
+		"next":                "下一页",
+		"page %d of %d":       "第 %d 页，共 %d 页",
+		"%d networks":         "%d 个网络",
+		"truncated":           "已截断",
+		"+ add new peer":      "+ 添加新 Peer",
+
+		"node returned empty response, please refresh to try again.": "节点返回了空响应，请刷新重试。",
+		"request failed: %s":                   "请求失败：%s",
+		"invalid server":                       "无效的服务器",
+		"At most %d prefixes can be compared.": "最多只能比较 %d 个前缀。",
+		"empty result":                         "结果为空",
+		"/summary\n/detail <protocol>\n/status\n/route <IP>\n/path <IP>\n/bgpmap <IP>\n/ping <IP>\n/trace <IP>\n/mtr <IP>\n/whois <Target>\n/servers [server ...]": "/summary\n/detail <协议>\n/status\n/route <IP>\n/path <IP>\n/bgpmap <IP>\n/ping <IP>\n/trace <IP>\n/mtr <IP>\n/whois <目标>\n/servers [服务器 ...]",
+		"%d of %d protocols up":                                   "%d / %d 个协议在线",
+		"Default servers of this chat: %s":                        "本聊天的默认服务器：%s",
+		"The result is too long, and is sent as a file.":          "结果过长，已作为文件发送。",
+		"The result is truncated.":                                "结果已截断。",
+		"Files can only be sent with the bot token set.":          "只有设置了机器人令牌才能发送文件。",
+		"Files can't be sent here, please use the web interface.": "此处无法发送文件，请使用网页界面。",
+		"Too many requests, please try again later.":              "请求过多，请稍后再试。",
+		"Commands are not allowed in this chat.":                  "此聊天不允许使用命令。",
+
+		"log out %s":              "退出登录 %s",
+		"actions":                 "操作",
+		"enable":                  "启用",
+		"disable":                 "禁用",
+		"restart":                 "重启",
+		"reload in":               "重新加载导入",
+		"reload out":              "重新加载导出",
+		"Done.":                   "已完成。",
+		"back to %s":              "返回 %s",
+		"Run %s on %s as %s?":     "以 %[3]s 的身份在 %[2]s 上运行 %[1]s？",
+		"confirm":                 "确认",
+		"cancel":                  "取消",
+		"invalid operator action": "无效的操作",
+		"The confirmation has expired, please try again.": "确认已过期，请重试。",
+
+		"peer portal":           "对等门户",
+		"peer portal (ASN) ...": "对等门户 (ASN) ...",
+		"show sessions":         "显示会话",
+		"Logged in as AS%s.":    "已登录为 AS%s。",
+		"log out":               "退出登录",
+		"Log in to see route counts, errors and exported routes.": "登录后可查看路由数量、错误和导出的路由。",
+		"log in":                                "登录",
+		"server":                                "服务器",
+		"uptime (30d)":                          "在线率 (30 天)",
+		"routes":                                "路由",
+		"last error":                            "最近错误",
+		"%d imported, %d filtered, %d exported": "导入 %d，过滤 %d，导出 %d",
+		"exported routes":                       "导出的路由",
+		"No sessions with AS%s found.":          "未找到与 AS%s 的会话。",
+		"log in as AS%s":                        "登录为 AS%s",
+		"invalid ASN":                           "无效的 ASN",
+		"The login has expired, please try again.": "登录已过期，请重试。",
+		"Sign the text below with an SSH key in the auth attribute of a maintainer of AS%s (%s) in the registry, and paste the signature:": "请使用注册表中 AS%s 维护者 (%s) 的 auth 属性里的 SSH 密钥签名以下文本，并粘贴签名：",
+		"No ssh-ed25519 key found in maintainers of AS%s in the registry.":                                                                 "注册表中 AS%s 的维护者没有 ssh-ed25519 密钥。",
+
+		"protocol history ...":             "协议历史 ...",
+		"history of %s":                    "%s 的历史",
+		"Protocol history is not enabled.": "未启用协议历史记录。",
+		"No state changes recorded.":       "没有记录到状态变化。",
+		"uptime (%s)":                      "在线率 (%s)",
+		"flaps (24h)":                      "抖动 (24h)",
+		"flap":                             "抖动",
+		"last 24 hours":                    "最近 24 小时",
+		"time":                             "时间",
+		"state":                            "状态",
+		"since":                            "起始",
+		"info":                             "信息",
+
+		"prefix history ...":       "前缀历史 ...",
+		"watched prefixes":         "监视的前缀",
+		"%s is not watched.":       "未监视 %s。",
+		"No prefixes are watched.": "没有监视任何前缀。",
+		"expected origin":          "预期源 AS",
+		"best path of %s":          "%s 的最优路径",
+		"No best path recorded.":   "没有记录到最优路径。",
+		"changes":                  "变化",
+		"route":                    "路由",
+		"protocol":                 "协议",
+		"AS path":                  "AS 路径",
+		"first seen":               "首次记录",
+		"announced":                "已宣告",
+		"withdrawn":                "已撤回",
+		"origin":                   "源 AS",
+		"upstream":                 "上游",
+		"path":                     "路径",
+		"unexpected origin":        "意外的源 AS",
+		"(local)":                  "(本地)",
+		"(withdrawn)":              "(已撤回)",
+		"prefix":                   "前缀",
+		"%d prefix(es)":            "%d 个前缀",
+		"Enter an ASN, optionally followed by community=a:b or community=a:b:c, and length=n or length=n-m, e.g. %s": "请输入 ASN，可在其后加上 community=a:b 或 community=a:b:c，以及 length=n 或 length=n-m，例如 %s",
+
+		"routing table statistics":                  "路由表统计",
+		"Routing table statistics are not enabled.": "未启用路由表统计。",
+		"No statistics recorded.":                   "没有记录到统计数据。",
+		"last %s":                                   "最近 %s",
+		"collected at %s":                           "采集于 %s",
+		"IPv4 prefixes":                             "IPv4 前缀",
+		"IPv6 prefixes":                             "IPv6 前缀",
+		"origin ASes":                               "源 AS 数",
+		"Routes couldn't be queried, derived numbers are missing:":                     "无法查询路由，缺少派生数据：",
+		"Routes were truncated by the proxy, derived numbers are incomplete.":          "路由被代理截断，派生数据不完整。",
+		"The output was truncated by the proxy, so networks and pages may be missing.": "输出被代理截断，可能缺少部分网络和页面。",
+		"routes per table":           "各路由表的路由数",
+		"prefixes by address family": "各地址族的前缀数",
+		"IPv4 prefix lengths":        "IPv4 前缀长度",
+		"IPv6 prefix lengths":        "IPv6 前缀长度",
+		"tables":                     "路由表",
+		"table":                      "路由表",
+		"networks":                   "网络",
+		"top origin ASes":            "前缀最多的源 AS",
+		"top transit ASes":           "前缀最多的中转 AS",
+		"routes per protocol":        "各协议的路由数",
+		"imported":                   "导入",
+		"filtered":                   "过滤",
+		"exported":                   "导出",
+
+		"peering request": "Peering 申请",
+		"Congratulations, WireGuard tunnel and BGP sessions have been setup on my server instantly. Just in case you're new to DN42, below are some example configuration files that you could use to setup your own node. Happy hacking!": "恭喜，我的服务器上已经立即建立了 WireGuard 隧道和 BGP 会话。如果你刚接触 DN42，下面是一些配置文件示例，可以用来配置你自己的节点。玩得开心！",
+		"My AS Number":            "我的 AS 号",
+		"PoP Location":            "节点位置",
+		"Tunneled IPv4 Address":   "隧道 IPv4 地址",
+		"Tunneled IPv6 Address":   "隧道 IPv6 地址",
+		"Link Local IPv6 Address": "链路本地 IPv6 地址",
+		"WireGuard Public Key":    "WireGuard 公钥",
+		"WireGuard Endpoint":      "WireGuard 端点",
+		"Additional Notes":        "备注",
+		"your point of presence":  "你的节点",
+		"Your AS Number":          "你的 AS 号",
+		"bgp preferences":         "BGP 偏好设置",
+		"Multi-protocol Session":  "多协议会话",
+		"Link Latency":            "链路延迟",
+		"Link Bandwidth":          "链路带宽",
+		"Encryption Level":        "加密等级",
+		"Submit":                  "提交",
+		"Loading...":              "加载中……",
+		"UDP Port":                "UDP 端口",
+		"I have checked all the configurations above. Set up the new peering for me immediately.": "我已检查以上所有配置，请立即为我建立新的 Peering。",
+		"alphanumeric only, IATA identifier or grid locator preferred":                            "仅限字母和数字，建议使用 IATA 代码或网格定位",
+		"Clearnet IP or domain of your server":                                                    "你的服务器的公网 IP 或域名",
+		"Please feel free to write anything here - probably about yourself, your network topology or your special peering needs.&#10;Will never be shown to anyone else.": "可以随意填写，比如关于你自己、你的网络拓扑或特殊的 Peering 需求。&#10;不会展示给其他任何人。",
+		"Multi-protocol BGP over IPv6 link-local (Preferred)":   "基于 IPv6 链路本地地址的多协议 BGP（推荐）",
+		"Establish two BGP sessions: IPv6 link-local and IPv4":  "建立两个 BGP 会话：IPv6 链路本地和 IPv4",
+		"Only route IPv6 prefixes (over IPv6 link-local)":       "仅路由 IPv6 前缀（通过 IPv6 链路本地地址）",
+		"Only route IPv6 prefixes (over IPv6 tunneled address)": "仅路由 IPv6 前缀（通过 IPv6 隧道地址）",
+		"Only route IPv4 prefixes (over IPv4 tunneled address)": "仅路由 IPv4 前缀（通过 IPv4 隧道地址）",
+		"Not encrypted":                                "未加密",
+		"Encrypted with unsafe VPN solution":           "使用不安全的 VPN 方案加密",
+		"Safe encryption, but no forward secrecy":      "安全加密，但无前向保密",
+		"Safe encryption with perfect forward secrecy": "安全加密，且有完美前向保密",
+	},
+	"de": {
+		"language_name": "Deutsch",
+
+		"show route for ... (bgpmap)":             "show route for ... (BGP-Karte)",
+		"show route where net ~ [ ... ] (bgpmap)": "show route where net ~ [ ... ] (BGP-Karte)",
+		"traceroute ... (map)":                    "traceroute ... (Karte)",
+		"All Servers":                             "Alle Server",
+		"Target":                                  "Ziel",
+
+		"full":                "vollständig",
+		"compact":             "kompakt",
+		"%d line(s) skipped.": "%d Zeile(n) ausgelassen.",
+		"previous":            "zurück",
+		"next":                "weiter",
+		"page %d of %d":       "Seite %d von %d",
+		"%d networks":         "%d Netze",
+		"truncated":           "gekürzt",
+		"+ add new peer":      "+ neuen Peer hinzufügen",
+
+		"node returned empty response, please refresh to try again.": "Der Knoten hat eine leere Antwort geliefert, bitte neu laden und erneut versuchen.",
+		"request failed: %s":                   "Anfrage fehlgeschlagen: %s",
+		"invalid server":                       "ungültiger Server",
+		"At most %d prefixes can be compared.": "Es können höchstens %d Präfixe verglichen werden.",
+		"empty result":                         "leeres Ergebnis",
+		"/summary\n/detail <protocol>\n/status\n/route <IP>\n/path <IP>\n/bgpmap <IP>\n/ping <IP>\n/trace <IP>\n/mtr <IP>\n/whois <Target>\n/servers [server ...]": "/summary\n/detail <Protokoll>\n/status\n/route <IP>\n/path <IP>\n/bgpmap <IP>\n/ping <IP>\n/trace <IP>\n/mtr <IP>\n/whois <Ziel>\n/servers [Server ...]",
+		"%d of %d protocols up":                                   "%d von %d Protokollen aktiv",
+		"Default servers of this chat: %s":                        "Standardserver dieses Chats: %s",
+		"The result is too long, and is sent as a file.":          "Das Ergebnis ist zu lang und wird als Datei gesendet.",
+		"The result is truncated.":                                "Das Ergebnis wurde gekürzt.",
+		"Files can only be sent with the bot token set.":          "Dateien können nur mit gesetztem Bot-Token gesendet werden.",
+		"Files can't be sent here, please use the web interface.": "Dateien können hier nicht gesendet werden, bitte die Weboberfläche verwenden.",
+		"Too many requests, please try again later.":              "Zu viele Anfragen, bitte später erneut versuchen.",
+		"Commands are not allowed in this chat.":                  "Befehle sind in diesem Chat nicht erlaubt.",
+
+		"log out %s":              "%s abmelden",
+		"actions":                 "Aktionen",
+		"enable":                  "aktivieren",
+		"disable":                 "deaktivieren",
+		"restart":                 "neu starten",
+		"reload in":               "Import neu laden",
+		"reload out":              "Export neu laden",
+		"Done.":                   "Erledigt.",
+		"back to %s":              "zurück zu %s",
+		"Run %s on %s as %s?":     "%s auf %s als %s ausführen?",
+		"confirm":                 "bestätigen",
+		"cancel":                  "abbrechen",
+		"invalid operator action": "ungültige Aktion",
+		"The confirmation has expired, please try again.": "Die Bestätigung ist abgelaufen, bitte erneut versuchen.",
+
+		"peer portal":           "Peer-Portal",
+		"peer portal (ASN) ...": "Peer-Portal (ASN) ...",
+		"show sessions":         "Sitzungen anzeigen",
+		"Logged in as AS%s.":    "Angemeldet als AS%s.",
+		"log out":               "abmelden",
+		"Log in to see route counts, errors and exported routes.": "Anmelden, um Routenanzahl, Fehler und exportierte Routen zu sehen.",
+		"log in":                                "anmelden",
+		"server":                                "Server",
+		"uptime (30d)":                          "Verfügbarkeit (30 T.)",
+		"routes":                                "Routen",
+		"last error":                            "letzter Fehler",
+		"%d imported, %d filtered, %d exported": "%d importiert, %d gefiltert, %d exportiert",
+		"exported routes":                       "exportierte Routen",
+		"No sessions with AS%s found.":          "Keine Sitzungen mit AS%s gefunden.",
+		"log in as AS%s":                        "als AS%s anmelden",
+		"invalid ASN":                           "ungültige ASN",
+		"The login has expired, please try again.": "Die Anmeldung ist abgelaufen, bitte erneut versuchen.",
+		"Sign the text below with an SSH key in the auth attribute of a maintainer of AS%s (%s) in the registry, and paste the signature:": "Den folgenden Text mit einem SSH-Schlüssel aus dem auth-Attribut eines Maintainers von AS%s (%s) in der Registry signieren und die Signatur einfügen:",
+		"No ssh-ed25519 key found in maintainers of AS%s in the registry.":                                                                 "Kein ssh-ed25519-Schlüssel bei den Maintainern von AS%s in der Registry gefunden.",
+
+		"protocol history ...":             "Protokollverlauf ...",
+		"history of %s":                    "Verlauf von %s",
+		"Protocol history is not enabled.": "Der Protokollverlauf ist nicht aktiviert.",
+		"No state changes recorded.":       "Keine Statusänderungen aufgezeichnet.",
+		"uptime (%s)":                      "Verfügbarkeit (%s)",
+		"flaps (24h)":                      "Flaps (24h)",
+		"flap":                             "Flap",
+		"last 24 hours":                    "letzte 24 Stunden",
+		"time":                             "Zeit",
+		"state":                            "Status",
+		"since":                            "seit",
+		"info":                             "Info",
+
+		"prefix history ...":       "Präfixverlauf ...",
+		"watched prefixes":         "Beobachtete Präfixe",
+		"%s is not watched.":       "%s wird nicht beobachtet.",
+		"No prefixes are watched.": "Es werden keine Präfixe beobachtet.",
+		"expected origin":          "erwarteter Ursprung",
+		"best path of %s":          "Bester Pfad von %s",
+		"No best path recorded.":   "Kein bester Pfad aufgezeichnet.",
+		"changes":                  "Änderungen",
+		"route":                    "Route",
+		"protocol":                 "Protokoll",
+		"AS path":                  "AS-Pfad",
+		"first seen":               "erstmals gesehen",
+		"announced":                "angekündigt",
+		"withdrawn":                "zurückgezogen",
+		"origin":                   "Ursprung",
+		"upstream":                 "Upstream",
+		"path":                     "Pfad",
+		"unexpected origin":        "unerwarteter Ursprung",
+		"(local)":                  "(lokal)",
+		"(withdrawn)":              "(zurückgezogen)",
+		"prefix":                   "Präfix",
+		"%d prefix(es)":            "%d Präfix(e)",
+		"Enter an ASN, optionally followed by community=a:b or community=a:b:c, and length=n or length=n-m, e.g. %s": "Eine ASN eingeben, optional gefolgt von community=a:b oder community=a:b:c und length=n oder length=n-m, z. B. %s",
+
+		"routing table statistics":                  "Routingtabellen-Statistik",
+		"Routing table statistics are not enabled.": "Die Routingtabellen-Statistik ist nicht aktiviert.",
+		"No statistics recorded.":                   "Keine Statistik aufgezeichnet.",
+		"last %s":                                   "letzte %s",
+		"collected at %s":                           "erfasst am %s",
+		"IPv4 prefixes":                             "IPv4-Präfixe",
+		"IPv6 prefixes":                             "IPv6-Präfixe",
+		"origin ASes":                               "Ursprungs-AS",
+		"Routes couldn't be queried, derived numbers are missing:":                     "Routen konnten nicht abgefragt werden, abgeleitete Werte fehlen:",
+		"Routes were truncated by the proxy, derived numbers are incomplete.":          "Routen wurden vom Proxy gekürzt, abgeleitete Werte sind unvollständig.",
+		"The output was truncated by the proxy, so networks and pages may be missing.": "Die Ausgabe wurde vom Proxy gekürzt, daher können Netze und Seiten fehlen.",
+		"routes per table":           "Routen pro Tabelle",
+		"prefixes by address family": "Präfixe nach Adressfamilie",
+		"IPv4 prefix lengths":        "IPv4-Präfixlängen",
+		"IPv6 prefix lengths":        "IPv6-Präfixlängen",
+		"tables":                     "Tabellen",
+		"table":                      "Tabelle",
+		"networks":                   "Netze",
+		"top origin ASes":            "Ursprungs-AS mit den meisten Präfixen",
+		"top transit ASes":           "Transit-AS mit den meisten Präfixen",
+		"routes per protocol":        "Routen pro Protokoll",
+		"imported":                   "importiert",
+		"filtered":                   "gefiltert",
+		"exported":                   "exportiert",
+
+		"peering request": "Peering-Anfrage",
+		"Congratulations, WireGuard tunnel and BGP sessions have been setup on my server instantly. Just in case you're new to DN42, below are some example configuration files that you could use to setup your own node. Happy hacking!": "Glückwunsch, der WireGuard-Tunnel und die BGP-Sitzungen wurden auf meinem Server sofort eingerichtet. Falls du neu bei DN42 bist, findest du unten einige Beispielkonfigurationen, mit denen du deinen eigenen Knoten einrichten kannst. Viel Spaß beim Hacken!",
+		"My AS Number":            "Meine AS-Nummer",
+		"PoP Location":            "PoP-Standort",
+		"Tunneled IPv4 Address":   "Getunnelte IPv4-Adresse",
+		"Tunneled IPv6 Address":   "Getunnelte IPv6-Adresse",
+		"Link Local IPv6 Address": "Link-Local-IPv6-Adresse",
+		"WireGuard Public Key":    "Öffentlicher WireGuard-Schlüssel",
+		"WireGuard Endpoint":      "WireGuard-Endpunkt",
+		"Additional Notes":        "Anmerkungen",
+		"your point of presence":  "dein Point of Presence",
+		"Your AS Number":          "Deine AS-Nummer",
+		"bgp preferences":         "BGP-Einstellungen",
+		"Multi-protocol Session":  "Multiprotokoll-Sitzung",
+		"Link Latency":            "Latenz der Verbindung",
+		"Link Bandwidth":          "Bandbreite der Verbindung",
+		"Encryption Level":        "Verschlüsselungsstufe",
+		"Submit":                  "Absenden",
+		"Loading...":              "Wird geladen...",
+		"UDP Port":                "UDP-Port",
+		"I have checked all the configurations above. Set up the new peering for me immediately.": "Ich habe alle obigen Einstellungen geprüft. Richte das neue Peering sofort für mich ein.",
+		"alphanumeric only, IATA identifier or grid locator preferred":                            "nur alphanumerisch, am besten IATA-Code oder Locator",
+		"Clearnet IP or domain of your server":                                                    "Clearnet-IP oder Domain deines Servers",
+		"Please feel free to write anything here - probably about yourself, your network topology or your special peering needs.&#10;Will never be shown to anyone else.": "Hier kannst du alles Mögliche schreiben - zum Beispiel über dich, deine Netzwerktopologie oder besondere Peering-Wünsche.&#10;Wird niemandem sonst angezeigt.",
+		"Multi-protocol BGP over IPv6 link-local (Preferred)":   "Multiprotokoll-BGP über IPv6 Link-Local (bevorzugt)",
+		"Establish two BGP sessions: IPv6 link-local and IPv4":  "Zwei BGP-Sitzungen aufbauen: IPv6 Link-Local und IPv4",
+		"Only route IPv6 prefixes (over IPv6 link-local)":       "Nur IPv6-Präfixe routen (über IPv6 Link-Local)",
+		"Only route IPv6 prefixes (over IPv6 tunneled address)": "Nur IPv6-Präfixe routen (über getunnelte IPv6-Adresse)",
+		"Only route IPv4 prefixes (over IPv4 tunneled address)": "Nur IPv4-Präfixe routen (über getunnelte IPv4-Adresse)",
+		"Not encrypted":                                "Nicht verschlüsselt",
+		"Encrypted with unsafe VPN solution":           "Mit unsicherer VPN-Lösung verschlüsselt",
+		"Safe encryption, but no forward secrecy":      "Sichere Verschlüsselung, aber ohne Forward Secrecy",
+		"Safe encryption with perfect forward secrecy": "Sichere Verschlüsselung mit Perfect Forward Secrecy",
+	},
+}
+
+// Load catalogs named "<language>.json" from the locale directory, each
+// a JSON object from English messages to translations. They add to the
+// built-in catalogs, or add new languages.
+func loadLocales() error {
+	if len(setting.localeDir) == 0 {
+		return nil
+	}
+	files, err := filepath.Glob(filepath.Join(setting.localeDir, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		var catalog map[string]string
+		if err := json.Unmarshal(data, &catalog); err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+
+		lang := strings.ToLower(strings.TrimSuffix(filepath.Base(file), ".json"))
+		if _, ok := i18nCatalogs[lang]; !ok {
+			i18nCatalogs[lang] = make(map[string]string)
+		}
+		for message, translation := range catalog {
+			i18nCatalogs[lang][message] = translation
+		}
+	}
+	return nil
+}
+
+// Translate a message, and format it with the arguments if any
+func i18nTranslate(lang string, message string, args ...interface{}) string {
+	if translation, ok := i18nCatalogs[lang][message]; ok {
+		message = translation
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(message, args...)
+	}
+	return message
+}
+
+// Available languages, by code, with their own names
+func i18nLanguages() map[string]string {
+	result := make(map[string]string)
+	for lang := range i18nCatalogs {
+		result[lang] = i18nTranslate(lang, "language_name")
+		if result[lang] == "language_name" {
+			result[lang] = lang
+		}
+	}
+	return result
+}
+
+// Find the catalog for a language tag, e.g. "zh-CN" uses "zh" unless
+// there's a "zh-cn" catalog. Returns empty string if not available.
+func i18nMatch(tag string) string {
+	tag = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"))
+	if _, ok := i18nCatalogs[tag]; ok && len(tag) > 0 {
+		return tag
+	}
+	base := strings.SplitN(tag, "-", 2)[0]
+	if _, ok := i18nCatalogs[base]; ok && len(base) > 0 {
+		return base
+	}
+	return ""
+}
+
+// Choose the language of a request, from the language switcher cookie,
+// then the Accept-Language header, then the default language
+func i18nNegotiate(r *http.Request) string {
+	if cookie, err := r.Cookie("lang"); err == nil {
+		if lang := i18nMatch(cookie.Value); len(lang) > 0 {
+			return lang
+		}
+	}
+
+	type weightedTag struct {
+		tag string
+		q   float64
+	}
+	var tags []weightedTag
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		fields := strings.Split(part, ";")
+		tag := weightedTag{strings.TrimSpace(fields[0]), 1}
+		for _, param := range fields[1:] {
+			if param = strings.TrimSpace(param); strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					tag.q = q
+				}
+			}
+		}
+		if len(tag.tag) > 0 && tag.q > 0 {
+			tags = append(tags, tag)
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].q > tags[j].q
+	})
+	for _, tag := range tags {
+		if lang := i18nMatch(tag.tag); len(lang) > 0 {
+			return lang
+		}
+	}
+
+	return setting.language
+}
+
+// Handle the language switcher: "?lang=xx" on any page stores the choice
+// in a cookie, and goes back to the page
+func i18nHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if r.Method != "GET" || len(query.Get("lang")) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if lang := i18nMatch(query.Get("lang")); len(lang) > 0 {
+			http.SetCookie(w, &http.Cookie{
+				Name:   "lang",
+				Value:  lang,
+				Path:   "/",
+				MaxAge: 365 * 24 * 3600,
+			})
+		}
+		query.Del("lang")
+		redirect := *r.URL
+		redirect.RawQuery = query.Encode()
+		http.Redirect(w, r, redirect.String(), 302)
+	})
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestI18nMatch(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want string
+	}{
+		{"en", "en"},
+		{"zh-CN", "zh"},
+		{"zh_TW", "zh"},
+		{" DE-at ", "de"},
+		{"fr", ""},
+		{"", ""},
+		{"-", ""},
+	}
+	for _, test := range tests {
+		if got := i18nMatch(test.tag); got != test.want {
+			t.Errorf("i18nMatch(%q) = %q, want %q", test.tag, got, test.want)
+		}
+	}
+}
+
+func TestI18nNegotiate(t *testing.T) {
+	saved := setting.language
+	setting.language = "en"
+	defer func() { setting.language = saved }()
+
+	tests := []struct {
+		name           string
+		cookie         string
+		acceptLanguage string
+		want           string
+	}{
+		{"default", "", "", "en"},
+		{"first supported", "", "fr-FR, de-DE, zh", "de"},
+		{"by weight", "", "de;q=0.5, zh-CN;q=0.9, en;q=0.1", "zh"},
+		{"equal weights keep order", "", "de;q=0.8, zh;q=0.8", "de"},
+		{"zero weight excluded", "", "zh;q=0, de;q=0.1", "de"},
+		{"invalid weight counts as 1", "", "de;q=0.5, zh;q=x", "zh"},
+		{"none supported", "", "fr, ja;q=0.8", "en"},
+		{"cookie first", "zh", "de", "zh"},
+		{"invalid cookie ignored", "xx", "de", "de"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			if len(test.cookie) > 0 {
+				r.AddCookie(&http.Cookie{Name: "lang", Value: test.cookie})
+			}
+			if len(test.acceptLanguage) > 0 {
+				r.Header.Set("Accept-Language", test.acceptLanguage)
+			}
+			if got := i18nNegotiate(r); got != test.want {
+				t.Errorf("i18nNegotiate() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestI18nTranslate(t *testing.T) {
+	if got := i18nTranslate("de", "At most %d prefixes can be compared.", 10); got != "Es können höchstens 10 Präfixe verglichen werden." {
+		t.Errorf("German translation = %q", got)
+	}
+	if got := i18nTranslate("xx", "At most %d prefixes can be compared.", 10); got != "At most 10 prefixes can be compared." {
+		t.Errorf("unknown language = %q", got)
+	}
+	if got := i18nTranslate("zh", "no translation for this"); got != "no translation for this" {
+		t.Errorf("missing message = %q", got)
+	}
+}
+
+func TestI18nHandler(t *testing.T) {
+	handler := i18nHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("page"))
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/summary/a?lang=zh-CN&x=1", nil))
+	if w.Code != 302 || w.Header().Get("Location") != "/summary/a?x=1" {
+		t.Errorf("switcher: status %d, location %q", w.Code, w.Header().Get("Location"))
+	}
+	if cookies := w.Result().Cookies(); len(cookies) != 1 || cookies[0].Value != "zh" {
+		t.Errorf("switcher cookies = %v", cookies)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/?lang=xx", nil))
+	if w.Code != 302 || len(w.Result().Cookies()) != 0 {
+		t.Errorf("unknown language: status %d, cookies %v", w.Code, w.Result().Cookies())
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Body.String() != "page" {
+		t.Errorf("page without switcher = %q", w.Body.String())
+	}
+}
+
+func TestLoadLocales(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "FR.json"), []byte(`{"language_name": "Français"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	saved := setting.localeDir
+	setting.localeDir = dir
+	defer func() {
+		setting.localeDir = saved
+		delete(i18nCatalogs, "fr")
+	}()
+
+	if err := loadLocales(); err != nil {
+		t.Fatal(err)
+	}
+	if got := i18nLanguages()["fr"]; got != "Français" {
+		t.Errorf("loaded language name = %q", got)
+	}
+	if got := i18nMatch("fr-CA"); got != "fr" {
+		t.Errorf("i18nMatch(fr-CA) = %q", got)
+	}
+
+	os.WriteFile(filepath.Join(dir, "it.json"), []byte(`not json`), 0644)
+	if err := loadLocales(); err == nil {
+		t.Error("invalid catalog accepted")
+	}
+	delete(i18nCatalogs, "it")
+}
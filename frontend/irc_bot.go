@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"net"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// Maximum bytes of text in each line, leaving room for the PRIVMSG prefix
+// in the 512 byte limit, maximum lines of a result, and time between lines
+// to stay below flood limits of servers
+const (
+	ircLineLimit    = 400
+	ircMaxLines     = 20
+	ircLineInterval = 500 * time.Millisecond
+)
+
+type ircConn struct {
+	conn  net.Conn
+	mutex sync.Mutex
+	nick  string
+}
+
+func ircEnabled() bool {
+	return len(setting.ircServer) > 0
+}
+
+// Connect to the server, with TLS if given as ircs://host:port
+func ircDial() (net.Conn, error) {
+	address := setting.ircServer
+	if strings.HasPrefix(address, "ircs://") {
+		return tls.DialWithDialer(&net.Dialer{Timeout: 30 * time.Second}, "tcp", strings.TrimPrefix(address, "ircs://"), nil)
+	}
+	return net.DialTimeout("tcp", strings.TrimPrefix(address, "irc://"), 30*time.Second)
+}
+
+func (irc *ircConn) write(line string) error {
+	irc.conn.SetWriteDeadline(time.Now().Add(30 * time.Second))
+	_, err := irc.conn.Write([]byte(line + "\r\n"))
+	return err
+}
+
+// Remove carriage returns and other control characters from a line, so
+// output like whois results can't end the PRIVMSG and send raw commands
+func ircSanitize(line string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\t' {
+			return ' '
+		}
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, line)
+}
+
+// Send a result to a channel or nick line by line, truncated if too long
+func (irc *ircConn) reply(target string, text string, lang string) {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		line = ircSanitize(line)
+		// IRC clients collapse empty lines, keep them visible
+		if len(strings.TrimSpace(line)) == 0 {
+			line = " "
+		}
+		lines = append(lines, botSplitMessage(line, ircLineLimit)...)
+	}
+	if len(lines) > ircMaxLines {
+		lines = append(lines[:ircMaxLines], i18nTranslate(lang, "The result is truncated."))
+	}
+
+	irc.mutex.Lock()
+	defer irc.mutex.Unlock()
+	for _, line := range lines {
+		if err := irc.write("PRIVMSG " + target + " :" + line); err != nil {
+			println("irc send: " + err.Error())
+			return
+		}
+		time.Sleep(ircLineInterval)
+	}
+}
+
+func ircIsChannel(target string) bool {
+	return strings.HasPrefix(target, "#") || strings.HasPrefix(target, "&")
+}
+
+// Whether the bot answers commands sent to a channel or to itself. Only
+// the configured channels are answered, and private messages if enabled.
+func ircAnswers(target string) bool {
+	if !ircIsChannel(target) {
+		return setting.ircPrivate
+	}
+	for _, channel := range setting.ircChannels {
+		if strings.EqualFold(channel, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Run a command from a channel or private message. The sender is the
+// prefix of the message, "nick!user@host".
+func (irc *ircConn) handleMessage(sender string, target string, text string) {
+	command, ok := botParseCommand(text, "!")
+	if !ok || !ircAnswers(target) {
+		return
+	}
+	nick := strings.SplitN(sender, "!", 2)[0]
+	// Nicks can be changed at will, so rate limits go by host
+	user := sender
+	if index := strings.LastIndex(sender, "@"); index >= 0 {
+		user = sender[index+1:]
+	}
+	// Reply to private messages in private
+	if !ircIsChannel(target) {
+		target = nick
+	}
+	ctx := botContext{
+		Chat:           "irc:" + strings.ToLower(target),
+		User:           "irc:" + strings.ToLower(user),
+		Username:       nick,
+		DefaultServers: setting.servers,
+		Lang:           setting.language,
+		Prefix:         "!",
+	}
+	result, ok := botHandle(ctx, command, text)
+	if !ok {
+		return
+	}
+	if result.File != nil {
+		result.Text = i18nTranslate(ctx.Lang, "Files can't be sent here, please use the web interface.")
+	}
+	irc.reply(target, result.Text, ctx.Lang)
+}
+
+// Handle one line from the server
+func (irc *ircConn) handleLine(line string) {
+	prefix := ""
+	if strings.HasPrefix(line, ":") {
+		split := strings.SplitN(line[1:], " ", 2)
+		if len(split) < 2 {
+			return
+		}
+		prefix, line = split[0], split[1]
+	}
+	trailing := ""
+	if index := strings.Index(line, " :"); index >= 0 {
+		line, trailing = line[:index], line[index+2:]
+	}
+	params := strings.Fields(line)
+	if len(params) == 0 {
+		return
+	}
+
+	switch params[0] {
+	case "PING":
+		irc.mutex.Lock()
+		irc.write("PONG :" + trailing)
+		irc.mutex.Unlock()
+
+	case "001":
+		// Registered, join the channels
+		irc.mutex.Lock()
+		for _, channel := range setting.ircChannels {
+			irc.write("JOIN " + channel)
+		}
+		irc.mutex.Unlock()
+
+	case "433":
+		// Nick in use, try another one
+		irc.nick += "_"
+		irc.mutex.Lock()
+		irc.write("NICK " + irc.nick)
+		irc.mutex.Unlock()
+
+	case "PRIVMSG":
+		if len(params) < 2 {
+			return
+		}
+		go irc.handleMessage(prefix, params[1], trailing)
+	}
+}
+
+// Stay connected to the server, reconnecting if disconnected
+func ircLoop() {
+	for {
+		conn, err := ircDial()
+		if err != nil {
+			println("irc connect: " + err.Error())
+			time.Sleep(30 * time.Second)
+			continue
+		}
+		irc := &ircConn{conn: conn, nick: setting.ircNick}
+
+		irc.mutex.Lock()
+		if len(setting.ircPassword) > 0 {
+			irc.write("PASS " + setting.ircPassword)
+		}
+		irc.write("NICK " + irc.nick)
+		irc.write("USER " + irc.nick + " 0 * :bird-lg-go")
+		irc.mutex.Unlock()
+
+		reader := bufio.NewReader(conn)
+		for {
+			// Servers send PING every few minutes, so a long silence
+			// means the connection is lost
+			conn.SetReadDeadline(time.Now().Add(10 * time.Minute))
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				println("irc read: " + err.Error())
+				break
+			}
+			irc.handleLine(strings.TrimRight(line, "\r\n"))
+		}
+		conn.Close()
+		time.Sleep(30 * time.Second)
+	}
+}
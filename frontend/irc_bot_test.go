@@ -0,0 +1,49 @@
+package main
+
+import "testing"
+
+func TestIRCSanitize(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"BGP.as_path: 4242420001", "BGP.as_path: 4242420001"},
+		{"descr:          Example\r", "descr:          Example"},
+		{"a\tb", "a b"},
+		// A carriage return would end the line, and start another command
+		{"x\rQUIT :bye", "xQUIT :bye"},
+		{"\x01ACTION\x01 \x1b[31mred", "ACTION [31mred"},
+		{"路由表", "路由表"},
+	}
+	for _, test := range tests {
+		if got := ircSanitize(test.line); got != test.want {
+			t.Errorf("ircSanitize(%q) = %q, want %q", test.line, got, test.want)
+		}
+	}
+}
+
+func TestIRCAnswers(t *testing.T) {
+	saved := setting
+	defer func() { setting = saved }()
+	setting.ircChannels = []string{"#dn42"}
+
+	tests := []struct {
+		private bool
+		target  string
+		want    bool
+	}{
+		{false, "#dn42", true},
+		{false, "#DN42", true},
+		{false, "#other", false},
+		{false, "&local", false},
+		{false, "someone", false},
+		{true, "someone", true},
+		{true, "#other", false},
+	}
+	for _, test := range tests {
+		setting.ircPrivate = test.private
+		if got := ircAnswers(test.target); got != test.want {
+			t.Errorf("private %v, ircAnswers(%q) = %v, want %v", test.private, test.target, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// How often files of JSON lines are rewritten, removing old values
+const jsonLinesCompactInterval = 24 * time.Hour
+
+// A file with one JSON value per line. New values are appended, and once
+// per compaction interval the file is rewritten from the values in memory,
+// so it doesn't grow beyond the retention period.
+type jsonLinesStore struct {
+	path string
+	// Remove old values from memory, and write the remaining ones
+	dump func(encoder *json.Encoder) error
+
+	mutex     sync.Mutex
+	compacted time.Time
+}
+
+func newJSONLinesStore(path string, dump func(encoder *json.Encoder) error) *jsonLinesStore {
+	return &jsonLinesStore{path: path, dump: dump}
+}
+
+// Call decode for each line of the file. A missing file is empty.
+func (store *jsonLinesStore) load(decode func(line []byte) error) error {
+	file, err := os.Open(store.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		// Lines that fail to decode are likely partially written
+		decode(scanner.Bytes())
+	}
+	return scanner.Err()
+}
+
+// Rewrite the file with all values in memory
+func (store *jsonLinesStore) compact() error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	return store.compactLocked()
+}
+
+func (store *jsonLinesStore) compactLocked() error {
+	temp := store.path + ".tmp"
+	file, err := os.Create(temp)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	if err := store.dump(json.NewEncoder(writer)); err != nil {
+		file.Close()
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(temp, store.path); err != nil {
+		return err
+	}
+	store.compacted = time.Now()
+	return nil
+}
+
+// Append new values to the file with write. The values must already be in
+// memory, since the file is rewritten from memory instead when it's due.
+func (store *jsonLinesStore) append(write func(encoder *json.Encoder) error) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if time.Since(store.compacted) >= jsonLinesCompactInterval {
+		return store.compactLocked()
+	}
+
+	file, err := os.OpenFile(store.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if err := write(json.NewEncoder(file)); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// A store of integers, all of which are kept in memory
+func jsonLinesTestStore(t *testing.T, values *[]int) *jsonLinesStore {
+	return newJSONLinesStore(filepath.Join(t.TempDir(), "values.json"), func(encoder *json.Encoder) error {
+		for _, value := range *values {
+			if err := encoder.Encode(value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func jsonLinesTestLoad(t *testing.T, store *jsonLinesStore) []int {
+	var result []int
+	err := store.load(func(line []byte) error {
+		var value int
+		if err := json.Unmarshal(line, &value); err != nil {
+			return err
+		}
+		result = append(result, value)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestJSONLinesStore(t *testing.T) {
+	var values []int
+	store := jsonLinesTestStore(t, &values)
+
+	// Missing files are empty
+	if got := jsonLinesTestLoad(t, store); got != nil {
+		t.Errorf("missing file loaded %v", got)
+	}
+
+	// Partially written lines are skipped
+	if err := os.WriteFile(store.path, []byte("1\n2\n{\"trunc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	values = jsonLinesTestLoad(t, store)
+	if !reflect.DeepEqual(values, []int{1, 2}) {
+		t.Errorf("loaded %v, want [1 2]", values)
+	}
+
+	values = values[1:]
+	if err := store.compact(); err != nil {
+		t.Fatal(err)
+	}
+	if got := jsonLinesTestLoad(t, store); !reflect.DeepEqual(got, []int{2}) {
+		t.Errorf("after compaction %v, want [2]", got)
+	}
+
+	appendValue := func(value int) {
+		values = append(values, value)
+		err := store.append(func(encoder *json.Encoder) error {
+			return encoder.Encode(value)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	appendValue(3)
+	values = values[1:]
+	appendValue(4)
+	// Not compacted yet, removed values are still in the file
+	if got := jsonLinesTestLoad(t, store); !reflect.DeepEqual(got, []int{2, 3, 4}) {
+		t.Errorf("after appending %v, want [2 3 4]", got)
+	}
+
+	// Rewritten from memory once the compaction interval passed
+	store.compacted = time.Now().Add(-jsonLinesCompactInterval)
+	appendValue(5)
+	if got := jsonLinesTestLoad(t, store); !reflect.DeepEqual(got, []int{3, 4, 5}) {
+		t.Errorf("after compaction interval %v, want [3 4 5]", got)
+	}
+	if time.Since(store.compacted) > time.Minute {
+		t.Error("compaction time not updated")
+	}
+}
+
+func TestHistoryDump(t *testing.T) {
+	now := time.Now()
+	saved := historyEvents
+	historyEvents = map[[2]string][]protocolEvent{
+		{"a", "bgp1"}: {
+			{Time: now.Add(-40 * 24 * time.Hour), Server: "a", Protocol: "bgp1", State: "up"},
+			{Time: now.Add(-35 * 24 * time.Hour), Server: "a", Protocol: "bgp1", State: "down"},
+			{Time: now.Add(-time.Hour), Server: "a", Protocol: "bgp1", State: "up"},
+		},
+		// Old events are kept if they're the current state
+		{"a", "bgp2"}: {
+			{Time: now.Add(-40 * 24 * time.Hour), Server: "a", Protocol: "bgp2", State: "up"},
+		},
+	}
+	defer func() { historyEvents = saved }()
+
+	var dumped []protocolEvent
+	store := newJSONLinesStore(filepath.Join(t.TempDir(), "history.json"), historyDump)
+	if err := store.compact(); err != nil {
+		t.Fatal(err)
+	}
+	store.load(func(line []byte) error {
+		var event protocolEvent
+		json.Unmarshal(line, &event)
+		dumped = append(dumped, event)
+		return nil
+	})
+	if len(dumped) != 3 {
+		t.Errorf("%d events written, want 3", len(dumped))
+	}
+	if events := historyEvents[[2]string{"a", "bgp1"}]; len(events) != 2 || events[0].State != "down" {
+		t.Errorf("events in memory after compaction: %v", events)
+	}
+	if events := historyEvents[[2]string{"a", "bgp2"}]; len(events) != 1 {
+		t.Errorf("current state removed: %v", events)
+	}
+}
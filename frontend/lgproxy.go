@@ -1,6 +1,8 @@
 package main
 
 import (
+	"bufio"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
@@ -22,8 +24,39 @@ func isValidServer(server string) bool {
 	return false
 }
 
-// Send commands to lgproxy instances in parallel, and retrieve their responses
-func batchRequest(servers []string, endpoint string, command string) []string {
+// URL of a request to the lgproxy of a server
+func proxyURL(server string, endpoint string, query url.Values) string {
+	return "http://" + server + "." + setting.domain + ":" + strconv.Itoa(setting.proxyPort) + "/" + url.PathEscape(endpoint) + "?" + query.Encode()
+}
+
+// Send a command to the lgproxy of a server, and pass each line of the
+// response to handle as it arrives, without keeping the whole response
+func streamRequest(server string, endpoint string, command string, handle func(line string)) error {
+	if !isValidServer(server) {
+		return fmt.Errorf("invalid server")
+	}
+	response, err := http.Get(proxyURL(server, endpoint, url.Values{"q": {command}}))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	scanner := bufio.NewScanner(response.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		handle(scanner.Text())
+	}
+	return scanner.Err()
+}
+
+// Send commands to lgproxy instances in parallel, and retrieve their responses.
+// Error messages are in the given language.
+func batchRequest(servers []string, endpoint string, command string, lang string) []string {
+	return batchRequestQuery(servers, endpoint, url.Values{"q": {command}}, lang)
+}
+
+// Send a request with the given query parameters to lgproxy instances in
+// parallel, like batchRequest
+func batchRequestQuery(servers []string, endpoint string, query url.Values, lang string) []string {
 	// Channel and array for storing responses
 	var ch chan channelData = make(chan channelData)
 	var responseArray []string = make([]string, len(servers))
@@ -32,15 +65,15 @@ func batchRequest(servers []string, endpoint string, command string) []string {
 		if !isValidServer(server) {
 			// If the server is not valid, create a dummy goroutine to return a failure
 			go func(i int) {
-				ch <- channelData{i, "request failed: invalid server\n"}
+				ch <- channelData{i, i18nTranslate(lang, "request failed: %s", i18nTranslate(lang, "invalid server")) + "\n"}
 			}(i)
 		} else {
 			// Compose URL and send the request
-			url := "http://" + server + "." + setting.domain + ":" + strconv.Itoa(setting.proxyPort) + "/" + url.PathEscape(endpoint) + "?q=" + url.QueryEscape(command)
+			url := proxyURL(server, endpoint, query)
 			go func(url string, i int) {
 				response, err := http.Get(url)
 				if err != nil {
-					ch <- channelData{i, "request failed: " + err.Error() + "\n"}
+					ch <- channelData{i, i18nTranslate(lang, "request failed: %s", err.Error()) + "\n"}
 					return
 				}
 				text, _ := ioutil.ReadAll(response.Body)
@@ -54,7 +87,7 @@ func batchRequest(servers []string, endpoint string, command string) []string {
 		var output channelData = <-ch
 		responseArray[output.id] = output.data
 		if len(responseArray[output.id]) == 0 {
-			responseArray[output.id] = "node returned empty response, please refresh to try again."
+			responseArray[output.id] = i18nTranslate(lang, "node returned empty response, please refresh to try again.")
 		}
 	}
 
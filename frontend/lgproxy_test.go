@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Start a stand-in proxy for all servers, with templates loaded. Requests
+// to any server go to the handler, with the server in the Host header.
+func testProxy(t *testing.T, servers []string, handler http.HandlerFunc) {
+	proxy := httptest.NewServer(handler)
+	transport := http.DefaultTransport
+	http.DefaultTransport = &http.Transport{
+		DialContext: func(ctx context.Context, network string, address string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, proxy.Listener.Addr().String())
+		},
+	}
+	saved := setting
+	setting.servers = servers
+	setting.domain = "test"
+	setting.proxyPort = 8000
+	setting.language = "en"
+	if err := loadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		proxy.Close()
+		http.DefaultTransport = transport
+		setting = saved
+	})
+}
+
+// Server name of a request to the stand-in proxy
+func testProxyServer(r *http.Request) string {
+	return strings.TrimSuffix(strings.SplitN(r.Host, ":", 2)[0], ".test")
+}
+
+func TestBatchRequest(t *testing.T) {
+	testProxy(t, []string{"a", "b", "c"}, func(w http.ResponseWriter, r *http.Request) {
+		switch testProxyServer(r) {
+		case "a":
+			w.Write([]byte(r.URL.Path + " " + r.URL.Query().Get("q")))
+		case "b":
+			// Empty response
+		}
+	})
+
+	got := batchRequest([]string{"a", "b", "x"}, "bird", "show route for 10.0.0.0/8", "en")
+	want := []string{
+		"/bird show route for 10.0.0.0/8",
+		"node returned empty response, please refresh to try again.",
+		"request failed: invalid server\n",
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("response %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
@@ -8,30 +8,109 @@ import (
 )
 
 type settingType struct {
-	servers         []string
-	domain          string
-	proxyPort       int
-	timeout         int
-	whoisServer     string
-	listen          string
-	dnsInterface    string
-	netSpecificMode string
-	titleBrand      string
-	navBarBrand     string
+	servers              []string
+	domain               string
+	proxyPort            int
+	timeout              int
+	whoisServer          string
+	listen               string
+	dnsInterface         string
+	netSpecificMode      string
+	titleBrand           string
+	navBarBrand          string
+	communityFiles       []string
+	roaFiles             []string
+	roaRefresh           int
+	registryPath         string
+	whoisFilter          []string
+	dn42WhoisServer      string
+	whoisCacheTTL        int
+	asnSources           []string
+	staticDir            string
+	themeDir             string
+	language             string
+	localeDir            string
+	historyFile          string
+	historyInterval      int
+	telegramToken        string
+	telegramMode         string
+	telegramAPIBase      string
+	telegramSecret       string
+	botStateFile         string
+	botAllowChats        []string
+	botBlockChats        []string
+	botChatRateLimit     int
+	botUserRateLimit     int
+	botAuditLog          string
+	matrixHomeserver     string
+	matrixToken          string
+	matrixRooms          []string
+	discordPublicKey     string
+	discordApplicationID string
+	discordBotToken      string
+	ircServer            string
+	ircNick              string
+	ircChannels          []string
+	ircPassword          string
+	ircPrivate           bool
+	operatorUsers        []string
+	operatorTokens       []string
+	operatorSessionKey   string
+	operatorProxyKeys    []string
+	operatorAuditLog     string
+	peerPortal           string
+	routePageSize        int
+	alertFilter          []string
+	alertWebhooks        []string
+	alertDebounce        int
+	alertMaintenance     []string
+	alertTelegramChats   []string
+	alertSMTPServer      string
+	alertSMTPFrom        string
+	alertSMTPTo          []string
+	alertSMTPUsername    string
+	alertSMTPPassword    string
+	prefixWatch          []string
+	prefixWatchFile      string
+	prefixWatchInterval  int
+	statsInterval        int
+	statsFile            string
 }
 
 var setting settingType
 
 func main() {
 	var settingDefault = settingType{
-		servers:      []string{""},
-		proxyPort:    8000,
-		timeout:      1000,
-		whoisServer:  "whois.verisign-grs.com",
-		listen:       ":5000",
-		dnsInterface: "asn.cymru.com",
-		titleBrand:   "Bird-lg Go",
-		navBarBrand:  "Bird-lg Go",
+		servers:             []string{""},
+		proxyPort:           8000,
+		timeout:             1000,
+		whoisServer:         "whois.verisign-grs.com",
+		dn42WhoisServer:     "whois.dn42",
+		whoisCacheTTL:       3600,
+		asnSources:          []string{"registry", "dns"},
+		language:            "en",
+		listen:              ":5000",
+		dnsInterface:        "asn.cymru.com",
+		titleBrand:          "Bird-lg Go",
+		navBarBrand:         "Bird-lg Go",
+		roaRefresh:          600,
+		historyInterval:     60,
+		alertFilter:         []string{"*"},
+		alertDebounce:       120,
+		telegramMode:        "webhook",
+		telegramAPIBase:     "https://api.telegram.org",
+		botChatRateLimit:    20,
+		botUserRateLimit:    10,
+		ircNick:             "bird-lg",
+		peerPortal:          "public",
+		routePageSize:       100,
+		alertSMTPFrom:       "bird-lg@localhost",
+		prefixWatchInterval: 300,
+		whoisFilter: []string{
+			"descr", "remarks", "ds-rdata", "auth", "country",
+			"nserver", "status", "pgp-fingerprint", "mp-import", "mp-export",
+			"members", "key", "inetnum", "inet6num",
+		},
 	}
 
 	if env := os.Getenv("BIRDLG_SERVERS"); env != "" {
@@ -55,12 +134,195 @@ func main() {
 	if env := os.Getenv("BIRDLG_WHOIS"); env != "" {
 		settingDefault.whoisServer = env
 	}
+	if env := os.Getenv("BIRDLG_WHOIS_DN42"); env != "" {
+		settingDefault.dn42WhoisServer = env
+	}
+	if env := os.Getenv("BIRDLG_WHOIS_CACHE_TTL"); env != "" {
+		var err error
+		if settingDefault.whoisCacheTTL, err = strconv.Atoi(env); err != nil {
+			panic(err)
+		}
+	}
 	if env := os.Getenv("BIRDLG_LISTEN"); env != "" {
 		settingDefault.listen = env
 	}
 	if env := os.Getenv("BIRDLG_DNS_INTERFACE"); env != "" {
 		settingDefault.dnsInterface = env
 	}
+	if env := os.Getenv("BIRDLG_ASN_SOURCES"); env != "" {
+		settingDefault.asnSources = strings.Split(env, ",")
+	}
+	if env := os.Getenv("BIRDLG_STATIC_DIR"); env != "" {
+		settingDefault.staticDir = env
+	}
+	if env := os.Getenv("BIRDLG_THEME_DIR"); env != "" {
+		settingDefault.themeDir = env
+	}
+	if env := os.Getenv("BIRDLG_LANGUAGE"); env != "" {
+		settingDefault.language = env
+	}
+	if env := os.Getenv("BIRDLG_LOCALE_DIR"); env != "" {
+		settingDefault.localeDir = env
+	}
+	if env := os.Getenv("BIRDLG_HISTORY_FILE"); env != "" {
+		settingDefault.historyFile = env
+	}
+	if env := os.Getenv("BIRDLG_HISTORY_INTERVAL"); env != "" {
+		var err error
+		if settingDefault.historyInterval, err = strconv.Atoi(env); err != nil {
+			panic(err)
+		}
+	}
+	if env := os.Getenv("BIRDLG_TELEGRAM_TOKEN"); env != "" {
+		settingDefault.telegramToken = env
+	}
+	if env := os.Getenv("BIRDLG_TELEGRAM_MODE"); env != "" {
+		settingDefault.telegramMode = env
+	}
+	if env := os.Getenv("BIRDLG_TELEGRAM_API_URL"); env != "" {
+		settingDefault.telegramAPIBase = env
+	}
+	if env := os.Getenv("BIRDLG_TELEGRAM_SECRET"); env != "" {
+		settingDefault.telegramSecret = env
+	}
+	if env := os.Getenv("BIRDLG_BOT_STATE_FILE"); env != "" {
+		settingDefault.botStateFile = env
+	}
+	if env := os.Getenv("BIRDLG_BOT_ALLOW_CHATS"); env != "" {
+		settingDefault.botAllowChats = strings.Split(env, ",")
+	}
+	if env := os.Getenv("BIRDLG_BOT_BLOCK_CHATS"); env != "" {
+		settingDefault.botBlockChats = strings.Split(env, ",")
+	}
+	if env := os.Getenv("BIRDLG_BOT_CHAT_RATE_LIMIT"); env != "" {
+		var err error
+		if settingDefault.botChatRateLimit, err = strconv.Atoi(env); err != nil {
+			panic(err)
+		}
+	}
+	if env := os.Getenv("BIRDLG_BOT_USER_RATE_LIMIT"); env != "" {
+		var err error
+		if settingDefault.botUserRateLimit, err = strconv.Atoi(env); err != nil {
+			panic(err)
+		}
+	}
+	if env := os.Getenv("BIRDLG_BOT_AUDIT_LOG"); env != "" {
+		settingDefault.botAuditLog = env
+	}
+	if env := os.Getenv("BIRDLG_MATRIX_HOMESERVER"); env != "" {
+		settingDefault.matrixHomeserver = env
+	}
+	if env := os.Getenv("BIRDLG_MATRIX_TOKEN"); env != "" {
+		settingDefault.matrixToken = env
+	}
+	if env := os.Getenv("BIRDLG_MATRIX_ROOMS"); env != "" {
+		settingDefault.matrixRooms = strings.Split(env, ",")
+	}
+	if env := os.Getenv("BIRDLG_DISCORD_PUBLIC_KEY"); env != "" {
+		settingDefault.discordPublicKey = env
+	}
+	if env := os.Getenv("BIRDLG_DISCORD_APPLICATION_ID"); env != "" {
+		settingDefault.discordApplicationID = env
+	}
+	if env := os.Getenv("BIRDLG_DISCORD_BOT_TOKEN"); env != "" {
+		settingDefault.discordBotToken = env
+	}
+	if env := os.Getenv("BIRDLG_IRC_SERVER"); env != "" {
+		settingDefault.ircServer = env
+	}
+	if env := os.Getenv("BIRDLG_IRC_NICK"); env != "" {
+		settingDefault.ircNick = env
+	}
+	if env := os.Getenv("BIRDLG_IRC_CHANNELS"); env != "" {
+		settingDefault.ircChannels = strings.Split(env, ",")
+	}
+	if env := os.Getenv("BIRDLG_IRC_PASSWORD"); env != "" {
+		settingDefault.ircPassword = env
+	}
+	if env := os.Getenv("BIRDLG_IRC_PRIVATE"); env != "" {
+		var err error
+		if settingDefault.ircPrivate, err = strconv.ParseBool(env); err != nil {
+			panic(err)
+		}
+	}
+	if env := os.Getenv("BIRDLG_OPERATOR_USERS"); env != "" {
+		settingDefault.operatorUsers = strings.Split(env, ",")
+	}
+	if env := os.Getenv("BIRDLG_OPERATOR_TOKENS"); env != "" {
+		settingDefault.operatorTokens = strings.Split(env, ",")
+	}
+	if env := os.Getenv("BIRDLG_OPERATOR_SESSION_KEY"); env != "" {
+		settingDefault.operatorSessionKey = env
+	}
+	if env := os.Getenv("BIRDLG_OPERATOR_PROXY_KEYS"); env != "" {
+		settingDefault.operatorProxyKeys = strings.Split(env, ",")
+	}
+	if env := os.Getenv("BIRDLG_OPERATOR_AUDIT_LOG"); env != "" {
+		settingDefault.operatorAuditLog = env
+	}
+	if env := os.Getenv("BIRDLG_PEER_PORTAL"); env != "" {
+		settingDefault.peerPortal = env
+	}
+	if env := os.Getenv("BIRDLG_ROUTE_PAGE_SIZE"); env != "" {
+		var err error
+		if settingDefault.routePageSize, err = strconv.Atoi(env); err != nil {
+			panic(err)
+		}
+	}
+	if env := os.Getenv("BIRDLG_ALERT_FILTER"); env != "" {
+		settingDefault.alertFilter = strings.Split(env, ",")
+	}
+	if env := os.Getenv("BIRDLG_ALERT_WEBHOOKS"); env != "" {
+		settingDefault.alertWebhooks = strings.Split(env, ",")
+	}
+	if env := os.Getenv("BIRDLG_ALERT_DEBOUNCE"); env != "" {
+		var err error
+		if settingDefault.alertDebounce, err = strconv.Atoi(env); err != nil {
+			panic(err)
+		}
+	}
+	if env := os.Getenv("BIRDLG_ALERT_MAINTENANCE"); env != "" {
+		settingDefault.alertMaintenance = strings.Split(env, ",")
+	}
+	if env := os.Getenv("BIRDLG_ALERT_TELEGRAM_CHATS"); env != "" {
+		settingDefault.alertTelegramChats = strings.Split(env, ",")
+	}
+	if env := os.Getenv("BIRDLG_ALERT_SMTP_SERVER"); env != "" {
+		settingDefault.alertSMTPServer = env
+	}
+	if env := os.Getenv("BIRDLG_ALERT_SMTP_FROM"); env != "" {
+		settingDefault.alertSMTPFrom = env
+	}
+	if env := os.Getenv("BIRDLG_ALERT_SMTP_TO"); env != "" {
+		settingDefault.alertSMTPTo = strings.Split(env, ",")
+	}
+	if env := os.Getenv("BIRDLG_ALERT_SMTP_USERNAME"); env != "" {
+		settingDefault.alertSMTPUsername = env
+	}
+	if env := os.Getenv("BIRDLG_ALERT_SMTP_PASSWORD"); env != "" {
+		settingDefault.alertSMTPPassword = env
+	}
+	if env := os.Getenv("BIRDLG_PREFIX_WATCH"); env != "" {
+		settingDefault.prefixWatch = strings.Split(env, ",")
+	}
+	if env := os.Getenv("BIRDLG_PREFIX_WATCH_FILE"); env != "" {
+		settingDefault.prefixWatchFile = env
+	}
+	if env := os.Getenv("BIRDLG_PREFIX_WATCH_INTERVAL"); env != "" {
+		var err error
+		if settingDefault.prefixWatchInterval, err = strconv.Atoi(env); err != nil {
+			panic(err)
+		}
+	}
+	if env := os.Getenv("BIRDLG_STATS_INTERVAL"); env != "" {
+		var err error
+		if settingDefault.statsInterval, err = strconv.Atoi(env); err != nil {
+			panic(err)
+		}
+	}
+	if env := os.Getenv("BIRDLG_STATS_FILE"); env != "" {
+		settingDefault.statsFile = env
+	}
 	if env := os.Getenv("BIRDLG_NET_SPECIFIC_MODE"); env != "" {
 		settingDefault.netSpecificMode = env
 	}
@@ -71,17 +333,92 @@ func main() {
 	if env := os.Getenv("BIRDLG_NAVBAR_BRAND"); env != "" {
 		settingDefault.navBarBrand = env
 	}
+	if env := os.Getenv("BIRDLG_COMMUNITY_FILES"); env != "" {
+		settingDefault.communityFiles = strings.Split(env, ",")
+	}
+	if env := os.Getenv("BIRDLG_ROA_FILES"); env != "" {
+		settingDefault.roaFiles = strings.Split(env, ",")
+	}
+	if env := os.Getenv("BIRDLG_WHOIS_FILTER"); env != "" {
+		settingDefault.whoisFilter = strings.Split(env, ",")
+	}
+	if env := os.Getenv("BIRDLG_REGISTRY"); env != "" {
+		settingDefault.registryPath = env
+	}
+	if env := os.Getenv("BIRDLG_ROA_REFRESH"); env != "" {
+		var err error
+		if settingDefault.roaRefresh, err = strconv.Atoi(env); err != nil {
+			panic(err)
+		}
+	}
 
 	serversPtr := flag.String("servers", strings.Join(settingDefault.servers, ","), "server name prefixes, separated by comma")
 	domainPtr := flag.String("domain", settingDefault.domain, "server name domain suffixes")
 	proxyPortPtr := flag.Int("proxy-port", settingDefault.proxyPort, "port bird-lgproxy is running on")
 	timeoutPtr := flag.Int("timeout", settingDefault.timeout, "maximum time allowed for HTTP requests, in milliseconds")
 	whoisPtr := flag.String("whois", settingDefault.whoisServer, "whois server for queries")
+	dn42WhoisPtr := flag.String("whois-dn42", settingDefault.dn42WhoisServer, "whois server for dn42 resources in dn42 mode")
+	whoisCacheTTLPtr := flag.Int("whois-cache-ttl", settingDefault.whoisCacheTTL, "time to cache whois results, in seconds")
 	listenPtr := flag.String("listen", settingDefault.listen, "address bird-lg is listening on")
 	dnsInterfacePtr := flag.String("dns-interface", settingDefault.dnsInterface, "dns zone to query ASN information")
+	asnSourcesPtr := flag.String("asn-sources", strings.Join(settingDefault.asnSources, ","), "sources of ASN information in order, separated by comma, [registry|dns|whois]")
 	netSpecificModePtr := flag.String("net-specific-mode", settingDefault.netSpecificMode, "network specific operation mode, [(none)|dn42]")
 	titleBrandPtr := flag.String("title-brand", settingDefault.titleBrand, "prefix of page titles in browser tabs")
 	navBarBrandPtr := flag.String("navbar-brand", settingDefault.navBarBrand, "brand to show in the navigation bar")
+	communityFilesPtr := flag.String("community-files", strings.Join(settingDefault.communityFiles, ","), "files with BGP community descriptions, separated by comma")
+	roaFilesPtr := flag.String("roa-files", strings.Join(settingDefault.roaFiles, ","), "ROA tables in BIRD config or JSON format, separated by comma")
+	whoisFilterPtr := flag.String("whois-filter", strings.Join(settingDefault.whoisFilter, ","), "whois attributes hidden in compact view, separated by comma")
+	registryPathPtr := flag.String("registry", settingDefault.registryPath, "path to a local checkout of the dn42 registry")
+	staticDirPtr := flag.String("static-dir", settingDefault.staticDir, "directory with static files overriding the bundled ones")
+	themeDirPtr := flag.String("theme-dir", settingDefault.themeDir, "directory with templates overriding the built-in ones")
+	languagePtr := flag.String("language", settingDefault.language, "language used if none of the visitor's languages is available")
+	localeDirPtr := flag.String("locale-dir", settingDefault.localeDir, "directory with message catalogs, named <language>.json")
+	historyFilePtr := flag.String("history-file", settingDefault.historyFile, "file to record protocol state changes in, enables protocol history")
+	historyIntervalPtr := flag.Int("history-interval", settingDefault.historyInterval, "interval to query protocol states for history, in seconds")
+	telegramTokenPtr := flag.String("telegram-token", settingDefault.telegramToken, "telegram bot token, for sending messages by itself")
+	telegramModePtr := flag.String("telegram-mode", settingDefault.telegramMode, "how the telegram bot receives messages, [webhook|polling], polling needs the bot token")
+	telegramAPIBasePtr := flag.String("telegram-api-url", settingDefault.telegramAPIBase, "base URL of the telegram Bot API")
+	telegramSecretPtr := flag.String("telegram-secret", settingDefault.telegramSecret, "secret token to check in telegram webhook requests, as set with setWebhook, the webhook refuses all requests without it")
+	botStateFilePtr := flag.String("bot-state-file", settingDefault.botStateFile, "file to keep default servers of bot chats in")
+	botAllowChatsPtr := flag.String("bot-allow-chats", strings.Join(settingDefault.botAllowChats, ","), "bot chats allowed to run commands, e.g. telegram:<chat ID> or irc:#channel, separated by comma, all chats if empty")
+	botBlockChatsPtr := flag.String("bot-block-chats", strings.Join(settingDefault.botBlockChats, ","), "bot chats not allowed to run commands, separated by comma")
+	botChatRateLimitPtr := flag.Int("bot-chat-rate-limit", settingDefault.botChatRateLimit, "maximum bot commands per minute in each chat, 0 for no limit")
+	botUserRateLimitPtr := flag.Int("bot-user-rate-limit", settingDefault.botUserRateLimit, "maximum bot commands per minute from each user, 0 for no limit")
+	botAuditLogPtr := flag.String("bot-audit-log", settingDefault.botAuditLog, "file to log bot commands of all platforms in")
+	matrixHomeserverPtr := flag.String("matrix-homeserver", settingDefault.matrixHomeserver, "URL of the matrix homeserver the bot logs in to, e.g. https://matrix.org")
+	matrixTokenPtr := flag.String("matrix-token", settingDefault.matrixToken, "access token of the matrix bot account, enables the matrix bot")
+	matrixRoomsPtr := flag.String("matrix-rooms", strings.Join(settingDefault.matrixRooms, ","), "IDs of matrix rooms the bot joins and answers in, separated by comma")
+	discordPublicKeyPtr := flag.String("discord-public-key", settingDefault.discordPublicKey, "public key of the discord application, enables the discord interactions endpoint")
+	discordApplicationIDPtr := flag.String("discord-application-id", settingDefault.discordApplicationID, "ID of the discord application, for registering slash commands")
+	discordBotTokenPtr := flag.String("discord-bot-token", settingDefault.discordBotToken, "discord bot token, registers slash commands on start if set")
+	ircServerPtr := flag.String("irc-server", settingDefault.ircServer, "IRC server for the bot as host:port, or ircs://host:port for TLS, enables the IRC bot")
+	ircNickPtr := flag.String("irc-nick", settingDefault.ircNick, "nick of the IRC bot")
+	ircChannelsPtr := flag.String("irc-channels", strings.Join(settingDefault.ircChannels, ","), "IRC channels to join, separated by comma")
+	ircPasswordPtr := flag.String("irc-password", settingDefault.ircPassword, "password of the IRC server")
+	ircPrivatePtr := flag.Bool("irc-private", settingDefault.ircPrivate, "answer IRC private messages, not only commands in the channels")
+	operatorUsersPtr := flag.String("operator-users", strings.Join(settingDefault.operatorUsers, ","), "operators who log in with a password, name:pbkdf2_sha256$iterations$salt$hash, separated by comma")
+	operatorTokensPtr := flag.String("operator-tokens", strings.Join(settingDefault.operatorTokens, ","), "API tokens of operators, name:token, separated by comma")
+	operatorSessionKeyPtr := flag.String("operator-session-key", settingDefault.operatorSessionKey, "key to sign operator sessions and confirmations, only known to the frontend, enables operator mode with users or tokens")
+	operatorProxyKeysPtr := flag.String("operator-proxy-keys", strings.Join(settingDefault.operatorProxyKeys, ","), "keys to sign operator commands to each proxy, as set in its --operator-secret, server:key, separated by comma")
+	operatorAuditLogPtr := flag.String("operator-audit-log", settingDefault.operatorAuditLog, "file to log operator actions in")
+	peerPortalPtr := flag.String("peer-portal", settingDefault.peerPortal, "peer portal showing sessions by ASN, [public|login|off], login needs the registry")
+	routePageSizePtr := flag.Int("route-page-size", settingDefault.routePageSize, "networks per page of route_export and route_import results")
+	alertFilterPtr := flag.String("alert-filter", strings.Join(settingDefault.alertFilter, ","), "protocols to send alerts for, glob patterns of protocol or server/protocol, \"!\" to exclude, separated by comma")
+	alertWebhooksPtr := flag.String("alert-webhooks", strings.Join(settingDefault.alertWebhooks, ","), "URLs to post alerts to as JSON, separated by comma")
+	alertDebouncePtr := flag.Int("alert-debounce", settingDefault.alertDebounce, "time a state change must last before alerting, in seconds")
+	alertMaintenancePtr := flag.String("alert-maintenance", strings.Join(settingDefault.alertMaintenance, ","), "maintenance windows without alerts, [filter@]start/end in RFC 3339 or [filter@]HH:MM-HH:MM daily in UTC, separated by comma")
+	alertTelegramChatsPtr := flag.String("alert-telegram-chats", strings.Join(settingDefault.alertTelegramChats, ","), "telegram chat IDs to send alerts to, separated by comma")
+	alertSMTPServerPtr := flag.String("alert-smtp-server", settingDefault.alertSMTPServer, "SMTP relay to send alert emails with, host:port")
+	alertSMTPFromPtr := flag.String("alert-smtp-from", settingDefault.alertSMTPFrom, "sender address of alert emails")
+	alertSMTPToPtr := flag.String("alert-smtp-to", strings.Join(settingDefault.alertSMTPTo, ","), "recipients of alert emails, separated by comma")
+	alertSMTPUsernamePtr := flag.String("alert-smtp-username", settingDefault.alertSMTPUsername, "username for the SMTP relay")
+	alertSMTPPasswordPtr := flag.String("alert-smtp-password", settingDefault.alertSMTPPassword, "password for the SMTP relay")
+	prefixWatchPtr := flag.String("prefix-watch", strings.Join(settingDefault.prefixWatch, ","), "prefixes to watch for best path changes, each optionally with the expected origin as prefix@ASN, separated by comma")
+	prefixWatchFilePtr := flag.String("prefix-watch-file", settingDefault.prefixWatchFile, "file to record best path changes of watched prefixes in")
+	prefixWatchIntervalPtr := flag.Int("prefix-watch-interval", settingDefault.prefixWatchInterval, "interval to query best paths of watched prefixes, in seconds")
+	statsIntervalPtr := flag.Int("stats-interval", settingDefault.statsInterval, "interval to collect routing table statistics, in seconds, 0 to disable")
+	statsFilePtr := flag.String("stats-file", settingDefault.statsFile, "file to record routing table statistics in, kept in memory only if not set")
+	roaRefreshPtr := flag.Int("roa-refresh", settingDefault.roaRefresh, "interval to reload ROA tables, in seconds")
 	flag.Parse()
 
 	if *serversPtr == "" {
@@ -91,16 +428,220 @@ func main() {
 	}
 
 	setting = settingType{
-		strings.Split(*serversPtr, ","),
-		*domainPtr,
-		*proxyPortPtr,
-		*timeoutPtr,
-		*whoisPtr,
-		*listenPtr,
-		*dnsInterfacePtr,
-		strings.ToLower(*netSpecificModePtr),
-		*titleBrandPtr,
-		*navBarBrandPtr,
+		servers:              strings.Split(*serversPtr, ","),
+		domain:               *domainPtr,
+		proxyPort:            *proxyPortPtr,
+		timeout:              *timeoutPtr,
+		whoisServer:          *whoisPtr,
+		dn42WhoisServer:      *dn42WhoisPtr,
+		whoisCacheTTL:        *whoisCacheTTLPtr,
+		listen:               *listenPtr,
+		dnsInterface:         *dnsInterfacePtr,
+		netSpecificMode:      strings.ToLower(*netSpecificModePtr),
+		titleBrand:           *titleBrandPtr,
+		navBarBrand:          *navBarBrandPtr,
+		roaRefresh:           *roaRefreshPtr,
+		registryPath:         *registryPathPtr,
+		staticDir:            *staticDirPtr,
+		themeDir:             *themeDirPtr,
+		localeDir:            *localeDirPtr,
+		historyFile:          *historyFilePtr,
+		historyInterval:      *historyIntervalPtr,
+		telegramToken:        *telegramTokenPtr,
+		telegramMode:         strings.ToLower(*telegramModePtr),
+		telegramAPIBase:      *telegramAPIBasePtr,
+		telegramSecret:       *telegramSecretPtr,
+		botStateFile:         *botStateFilePtr,
+		botChatRateLimit:     *botChatRateLimitPtr,
+		botUserRateLimit:     *botUserRateLimitPtr,
+		botAuditLog:          *botAuditLogPtr,
+		matrixHomeserver:     *matrixHomeserverPtr,
+		matrixToken:          *matrixTokenPtr,
+		discordPublicKey:     *discordPublicKeyPtr,
+		discordApplicationID: *discordApplicationIDPtr,
+		discordBotToken:      *discordBotTokenPtr,
+		ircServer:            *ircServerPtr,
+		ircNick:              *ircNickPtr,
+		ircPassword:          *ircPasswordPtr,
+		ircPrivate:           *ircPrivatePtr,
+		operatorSessionKey:   *operatorSessionKeyPtr,
+		operatorAuditLog:     *operatorAuditLogPtr,
+		peerPortal:           strings.ToLower(*peerPortalPtr),
+		routePageSize:        *routePageSizePtr,
+		alertDebounce:        *alertDebouncePtr,
+		alertSMTPServer:      *alertSMTPServerPtr,
+		alertSMTPFrom:        *alertSMTPFromPtr,
+		alertSMTPUsername:    *alertSMTPUsernamePtr,
+		alertSMTPPassword:    *alertSMTPPasswordPtr,
+		prefixWatchFile:      *prefixWatchFilePtr,
+		prefixWatchInterval:  *prefixWatchIntervalPtr,
+		statsInterval:        *statsIntervalPtr,
+		statsFile:            *statsFilePtr,
+	}
+	for _, source := range strings.Split(*asnSourcesPtr, ",") {
+		if source = strings.ToLower(strings.TrimSpace(source)); len(source) > 0 {
+			if _, ok := asnSources[source]; !ok {
+				panic("invalid ASN source: " + source)
+			}
+			setting.asnSources = append(setting.asnSources, source)
+		}
+	}
+	for _, list := range []struct {
+		value  string
+		result *[]string
+	}{
+		{*botAllowChatsPtr, &setting.botAllowChats},
+		{*botBlockChatsPtr, &setting.botBlockChats},
+		{*matrixRoomsPtr, &setting.matrixRooms},
+		{*ircChannelsPtr, &setting.ircChannels},
+		{*operatorUsersPtr, &setting.operatorUsers},
+		{*operatorTokensPtr, &setting.operatorTokens},
+		{*operatorProxyKeysPtr, &setting.operatorProxyKeys},
+		{*alertFilterPtr, &setting.alertFilter},
+		{*alertWebhooksPtr, &setting.alertWebhooks},
+		{*alertMaintenancePtr, &setting.alertMaintenance},
+		{*alertTelegramChatsPtr, &setting.alertTelegramChats},
+		{*alertSMTPToPtr, &setting.alertSMTPTo},
+		{*prefixWatchPtr, &setting.prefixWatch},
+	} {
+		for _, item := range strings.Split(list.value, ",") {
+			if item = strings.TrimSpace(item); len(item) > 0 {
+				*list.result = append(*list.result, item)
+			}
+		}
+	}
+	for _, key := range strings.Split(*whoisFilterPtr, ",") {
+		if key = strings.ToLower(strings.TrimSpace(key)); len(key) > 0 {
+			setting.whoisFilter = append(setting.whoisFilter, key)
+		}
+	}
+	if *communityFilesPtr != "" {
+		setting.communityFiles = strings.Split(*communityFilesPtr, ",")
+	}
+	if *roaFilesPtr != "" {
+		setting.roaFiles = strings.Split(*roaFilesPtr, ",")
+	}
+
+	if err := loadCommunityDictionaries(); err != nil {
+		panic(err)
+	}
+	if err := loadLocales(); err != nil {
+		panic(err)
+	}
+	if setting.language = i18nMatch(*languagePtr); len(setting.language) == 0 {
+		panic("invalid language: " + *languagePtr)
+	}
+	if err := loadTemplates(); err != nil {
+		panic(err)
+	}
+	if err := staticCheck(); err != nil {
+		panic(err)
+	}
+	if err := loadROATables(); err != nil {
+		panic(err)
+	}
+	go roaRefreshLoop()
+	if registryEnabled() {
+		if err := registryReload(); err != nil {
+			panic(err)
+		}
+		go registryWatchLoop()
+	}
+	if setting.telegramMode != "webhook" && setting.telegramMode != "polling" {
+		panic("invalid telegram mode: " + setting.telegramMode)
+	}
+	if setting.telegramMode == "polling" && len(setting.telegramToken) == 0 {
+		panic("telegram polling mode needs the bot token")
+	}
+	if len(setting.botStateFile) > 0 {
+		if err := botLoadChatServers(); err != nil {
+			panic(err)
+		}
+	}
+	if setting.telegramMode == "polling" {
+		go telegramPollLoop()
+	}
+	if matrixEnabled() {
+		if len(setting.matrixRooms) == 0 {
+			panic("matrix bot needs the rooms to join")
+		}
+		go matrixSyncLoop()
+	}
+	if ircEnabled() {
+		go ircLoop()
+	}
+	if discordEnabled() && len(setting.discordBotToken) > 0 {
+		if len(setting.discordApplicationID) == 0 {
+			panic("registering discord commands needs the application ID")
+		}
+		go func() {
+			if err := discordRegisterCommands(); err != nil {
+				println("discord register commands: " + err.Error())
+			}
+		}()
+	}
+	if (len(setting.operatorUsers) > 0 || len(setting.operatorTokens) > 0) && len(setting.operatorSessionKey) == 0 {
+		panic("operator users and tokens need the operator session key")
+	}
+	for _, entry := range append(append(append([]string{}, setting.operatorUsers...), setting.operatorTokens...), setting.operatorProxyKeys...) {
+		if split := strings.SplitN(entry, ":", 2); len(split) != 2 || len(split[0]) == 0 || len(split[1]) == 0 {
+			panic("invalid operator entry, expected name:value: " + split[0])
+		}
+	}
+	for _, entry := range setting.operatorProxyKeys {
+		if server := strings.SplitN(entry, ":", 2)[0]; !isValidServer(server) {
+			panic("operator proxy key of unknown server: " + server)
+		}
+		if strings.SplitN(entry, ":", 2)[1] == setting.operatorSessionKey {
+			panic("operator proxy keys must differ from the session key")
+		}
+	}
+	if setting.peerPortal != "public" && setting.peerPortal != "login" && setting.peerPortal != "off" {
+		panic("invalid peer portal mode: " + setting.peerPortal)
+	}
+	if setting.routePageSize < 1 {
+		panic("route page size must be positive")
+	}
+	if setting.peerPortal == "login" && !registryEnabled() {
+		panic("peer portal login needs the registry")
+	}
+	if historyEnabled() {
+		if err := historyLoad(); err != nil {
+			panic(err)
+		}
+	}
+	for _, window := range setting.alertMaintenance {
+		parsed, err := parseAlertMaintenanceWindow(window)
+		if err != nil {
+			panic(err)
+		}
+		alertMaintenanceWindows = append(alertMaintenanceWindows, parsed)
+	}
+	if historyEnabled() || alertEnabled() {
+		go historyPollLoop()
+	}
+	for _, item := range setting.prefixWatch {
+		entry, err := parsePrefixWatchEntry(item)
+		if err != nil {
+			panic(err)
+		}
+		prefixWatchList = append(prefixWatchList, entry)
+	}
+	if prefixWatchEnabled() {
+		if len(setting.prefixWatchFile) > 0 {
+			if err := prefixWatchLoad(); err != nil {
+				panic(err)
+			}
+		}
+		go prefixWatchPollLoop()
+	}
+	if statsEnabled() {
+		if len(setting.statsFile) > 0 {
+			if err := statsLoad(); err != nil {
+				panic(err)
+			}
+		}
+		go statsPollLoop()
 	}
 
 	webServerStart()
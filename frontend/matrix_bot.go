@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Seconds to wait for events in each sync request, and maximum length of
+// a message
+const (
+	matrixSyncTimeout  = 30
+	matrixMessageLimit = 16000
+	matrixMaxMessages  = 4
+)
+
+type matrixEvent struct {
+	Type    string `json:"type"`
+	Sender  string `json:"sender"`
+	EventID string `json:"event_id"`
+	Content struct {
+		MsgType string `json:"msgtype"`
+		Body    string `json:"body"`
+	} `json:"content"`
+}
+
+type matrixSyncResponse struct {
+	NextBatch string `json:"next_batch"`
+	Rooms     struct {
+		Join map[string]struct {
+			Timeline struct {
+				Events []matrixEvent `json:"events"`
+			} `json:"timeline"`
+		} `json:"join"`
+		Invite map[string]json.RawMessage `json:"invite"`
+	} `json:"rooms"`
+}
+
+// Counter for transaction IDs of sent messages
+var matrixTransaction int64
+
+func matrixEnabled() bool {
+	return len(setting.matrixHomeserver) > 0 && len(setting.matrixToken) > 0
+}
+
+// Whether the bot may join and answer in a room
+func matrixRoomAllowed(roomID string) bool {
+	for _, room := range setting.matrixRooms {
+		if room == roomID {
+			return true
+		}
+	}
+	return false
+}
+
+// Join a room, or decline an invite with leave
+func matrixMembership(roomID string, membership string) {
+	if err := matrixRequest(http.DefaultClient, "POST",
+		"/_matrix/client/v3/rooms/"+url.PathEscape(roomID)+"/"+membership, map[string]string{}, nil); err != nil {
+		println("matrix " + membership + " " + roomID + ": " + err.Error())
+	}
+}
+
+// Call a client-server API endpoint, with a JSON body unless it's a
+// []byte, and decode the JSON response into result if not nil
+func matrixRequest(client *http.Client, method string, path string, body interface{}, result interface{}) error {
+	var reader *bytes.Reader
+	contentType := "application/json"
+	if data, ok := body.([]byte); ok {
+		reader = bytes.NewReader(data)
+		contentType = "application/octet-stream"
+	} else if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	request, err := http.NewRequest(method, strings.TrimSuffix(setting.matrixHomeserver, "/")+path, reader)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", "Bearer "+setting.matrixToken)
+	request.Header.Set("Content-Type", contentType)
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("HTTP status %s", response.Status)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(response.Body).Decode(result)
+}
+
+// Send a message to a room, as a reply to the event if set
+func matrixSend(roomID string, replyTo string, content map[string]interface{}) error {
+	if len(replyTo) > 0 {
+		content["m.relates_to"] = map[string]interface{}{
+			"m.in_reply_to": map[string]string{"event_id": replyTo},
+		}
+	}
+	transaction := strconv.FormatInt(time.Now().UnixNano(), 36) + "." + strconv.FormatInt(atomic.AddInt64(&matrixTransaction, 1), 10)
+	return matrixRequest(http.DefaultClient, "PUT",
+		"/_matrix/client/v3/rooms/"+url.PathEscape(roomID)+"/send/m.room.message/"+transaction, content, nil)
+}
+
+// Send a result as preformatted notices, so other bots don't respond to it
+func matrixSendText(roomID string, replyTo string, text string) error {
+	return matrixSend(roomID, replyTo, map[string]interface{}{
+		"msgtype":        "m.notice",
+		"body":           text,
+		"format":         "org.matrix.custom.html",
+		"formatted_body": "<pre><code>" + html.EscapeString(text) + "</code></pre>",
+	})
+}
+
+// Upload a file to the media repository, and send it to a room
+func matrixSendFile(roomID string, replyTo string, file *botFile) error {
+	var upload struct {
+		ContentURI string `json:"content_uri"`
+	}
+	if err := matrixRequest(http.DefaultClient, "POST",
+		"/_matrix/media/v3/upload?filename="+url.QueryEscape(file.Name), file.Data, &upload); err != nil {
+		return err
+	}
+	msgType := "m.file"
+	if file.Image {
+		msgType = "m.image"
+	}
+	return matrixSend(roomID, replyTo, map[string]interface{}{
+		"msgtype":  msgType,
+		"body":     file.Name,
+		"filename": file.Name,
+		"url":      upload.ContentURI,
+	})
+}
+
+// Run a command from a room message, and send the result
+func matrixHandleMessage(roomID string, event matrixEvent) {
+	if event.Type != "m.room.message" || event.Content.MsgType != "m.text" || !matrixRoomAllowed(roomID) {
+		return
+	}
+	command, ok := botParseCommand(event.Content.Body, "!")
+	if !ok {
+		return
+	}
+	ctx := botContext{
+		Chat:           "matrix:" + roomID,
+		User:           "matrix:" + event.Sender,
+		Username:       event.Sender,
+		DefaultServers: setting.servers,
+		Lang:           setting.language,
+		Prefix:         "!",
+	}
+	result, ok := botHandle(ctx, command, event.Content.Body)
+	if !ok {
+		return
+	}
+
+	var err error
+	if result.File != nil {
+		err = matrixSendFile(roomID, event.EventID, result.File)
+	} else if parts := botSplitMessage(result.Text, matrixMessageLimit); len(parts) > matrixMaxMessages {
+		if err = matrixSendText(roomID, event.EventID, i18nTranslate(ctx.Lang, "The result is too long, and is sent as a file.")); err == nil {
+			err = matrixSendFile(roomID, event.EventID, &botFile{Name: "result.txt", Data: []byte(result.Text)})
+		}
+	} else {
+		for _, part := range parts {
+			if err = matrixSendText(roomID, event.EventID, part); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		println("matrix send: " + err.Error())
+	}
+}
+
+// Receive messages with the sync API, after joining the configured rooms.
+// Invites to other rooms are declined.
+func matrixSyncLoop() {
+	client := &http.Client{Timeout: (matrixSyncTimeout + 10) * time.Second}
+	var whoami struct {
+		UserID string `json:"user_id"`
+	}
+	for {
+		err := matrixRequest(client, "GET", "/_matrix/client/v3/account/whoami", nil, &whoami)
+		if err == nil {
+			break
+		}
+		println("matrix whoami: " + err.Error())
+		time.Sleep(30 * time.Second)
+	}
+	for _, roomID := range setting.matrixRooms {
+		matrixMembership(roomID, "join")
+	}
+
+	since := ""
+	for {
+		path := "/_matrix/client/v3/sync?timeout=" + strconv.Itoa(matrixSyncTimeout*1000)
+		if len(since) > 0 {
+			path += "&since=" + url.QueryEscape(since)
+		}
+		var sync matrixSyncResponse
+		if err := matrixRequest(client, "GET", path, nil, &sync); err != nil {
+			println("matrix sync: " + err.Error())
+			time.Sleep(5 * time.Second)
+			continue
+		}
+
+		for roomID := range sync.Rooms.Invite {
+			if matrixRoomAllowed(roomID) {
+				matrixMembership(roomID, "join")
+			} else {
+				matrixMembership(roomID, "leave")
+			}
+		}
+		// Skip messages sent before starting
+		if len(since) > 0 {
+			for roomID, room := range sync.Rooms.Join {
+				for _, event := range room.Timeline.Events {
+					if event.Sender != whoami.UserID {
+						go matrixHandleMessage(roomID, event)
+					}
+				}
+			}
+		}
+		since = sync.NextBatch
+	}
+}
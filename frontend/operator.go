@@ -0,0 +1,366 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Actions operators can run on a protocol, and the BIRD commands sent for
+// them. The proxies only accept these commands.
+var operatorActions = map[string]string{
+	"disable":    "disable %s",
+	"enable":     "enable %s",
+	"restart":    "restart %s",
+	"reload":     "reload %s",
+	"reload_in":  "reload in %s",
+	"reload_out": "reload out %s",
+}
+
+var operatorProtocolRegex = regexp.MustCompile(`^[A-Za-z_]\w*$`)
+
+// Whether operators may run actions on a protocol. BIRD takes "all" as
+// every protocol, so it is refused, like the keywords of reload.
+func operatorValidProtocol(name string) bool {
+	return operatorProtocolRegex.MatchString(name) && name != "all" && name != "in" && name != "out"
+}
+
+const (
+	operatorSessionCookie   = "birdlg_operator"
+	operatorSessionLifetime = 12 * time.Hour
+	// Time to confirm an action after opening the confirmation page
+	operatorConfirmLifetime = 10 * time.Minute
+)
+
+var operatorAuditMutex sync.Mutex
+
+func operatorEnabled() bool {
+	return len(setting.operatorSessionKey) > 0 && (len(setting.operatorUsers) > 0 || len(setting.operatorTokens) > 0)
+}
+
+// PBKDF2 with HMAC-SHA256, as in RFC 8018
+func pbkdf2SHA256(password []byte, salt []byte, iterations int, length int) []byte {
+	mac := hmac.New(sha256.New, password)
+	var result []byte
+	for block := uint32(1); len(result) < length; block++ {
+		mac.Reset()
+		mac.Write(salt)
+		mac.Write([]byte{byte(block >> 24), byte(block >> 16), byte(block >> 8), byte(block)})
+		u := mac.Sum(nil)
+		t := append([]byte(nil), u...)
+		for i := 1; i < iterations; i++ {
+			mac.Reset()
+			mac.Write(u)
+			u = mac.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		result = append(result, t...)
+	}
+	return result[:length]
+}
+
+// Check a password against a hash in Django's format,
+// "pbkdf2_sha256$<iterations>$<salt>$<base64 hash>"
+func operatorCheckPassword(hash string, password string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != "pbkdf2_sha256" {
+		return false
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations < 1 {
+		return false
+	}
+	expected, err := base64.StdEncoding.DecodeString(parts[3])
+	if err != nil || len(expected) == 0 {
+		return false
+	}
+	actual := pbkdf2SHA256([]byte(password), []byte(parts[2]), iterations, len(expected))
+	return subtle.ConstantTimeCompare(actual, expected) == 1
+}
+
+// Sign a message with a key derived from the session key, for session
+// cookies and confirmations. The proxies don't know this key.
+func operatorSign(purpose string, message string) string {
+	key := hmac.New(sha256.New, []byte(setting.operatorSessionKey))
+	key.Write([]byte(purpose))
+	mac := hmac.New(sha256.New, key.Sum(nil))
+	mac.Write([]byte(message))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Key of the proxy of a server, empty if it has none
+func operatorProxyKey(server string) string {
+	for _, entry := range setting.operatorProxyKeys {
+		if split := strings.SplitN(entry, ":", 2); len(split) == 2 && split[0] == server {
+			return split[1]
+		}
+	}
+	return ""
+}
+
+// Sign a command for the proxy of a server with its own key, in the
+// same way as the proxy checks it. The server name is signed too, so a
+// request can't be replayed to another server sharing the key.
+func operatorProxySignature(key string, server string, timestamp string, user string, command string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(server + "\n" + timestamp + "\n" + user + "\n" + command))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Cookie value of a session, "user:expiry:signature"
+func operatorSessionValue(user string, expires time.Time) string {
+	message := user + ":" + strconv.FormatInt(expires.Unix(), 10)
+	return message + ":" + operatorSign("session", message)
+}
+
+func operatorCheckSession(value string, now time.Time) string {
+	split := strings.Split(value, ":")
+	if len(split) != 3 {
+		return ""
+	}
+	expires, err := strconv.ParseInt(split[1], 10, 64)
+	if err != nil || now.Unix() > expires {
+		return ""
+	}
+	expected := operatorSign("session", split[0]+":"+split[1])
+	if !hmac.Equal([]byte(split[2]), []byte(expected)) {
+		return ""
+	}
+	return split[0]
+}
+
+// Operator of a request, from an API token, HTTP basic auth or a session
+// cookie, and how they were authenticated. Empty if not authenticated.
+func operatorAuthenticate(r *http.Request) (string, string) {
+	if !operatorEnabled() {
+		return "", ""
+	}
+	if authorization := r.Header.Get("Authorization"); strings.HasPrefix(authorization, "Bearer ") {
+		token := strings.TrimPrefix(authorization, "Bearer ")
+		for _, entry := range setting.operatorTokens {
+			split := strings.SplitN(entry, ":", 2)
+			if len(split) == 2 && subtle.ConstantTimeCompare([]byte(split[1]), []byte(token)) == 1 {
+				return split[0], "token"
+			}
+		}
+		return "", ""
+	}
+	if username, password, ok := r.BasicAuth(); ok {
+		for _, entry := range setting.operatorUsers {
+			split := strings.SplitN(entry, ":", 2)
+			if len(split) == 2 && split[0] == username && operatorCheckPassword(split[1], password) {
+				return username, "password"
+			}
+		}
+		return "", ""
+	}
+	if cookie, err := r.Cookie(operatorSessionCookie); err == nil {
+		if user := operatorCheckSession(cookie.Value, time.Now()); len(user) > 0 {
+			return user, "session"
+		}
+	}
+	return "", ""
+}
+
+// Token of the confirmation form, valid for a while for the same operator
+// and command
+func operatorConfirmToken(user string, server string, command string, expires time.Time) string {
+	expiry := strconv.FormatInt(expires.Unix(), 10)
+	return expiry + ":" + operatorSign("confirm", user+"\n"+server+"\n"+command+"\n"+expiry)
+}
+
+func operatorCheckConfirmToken(token string, user string, server string, command string, now time.Time) bool {
+	split := strings.SplitN(token, ":", 2)
+	if len(split) != 2 {
+		return false
+	}
+	expires, err := strconv.ParseInt(split[0], 10, 64)
+	if err != nil || now.Unix() > expires {
+		return false
+	}
+	return hmac.Equal([]byte(token), []byte(operatorConfirmToken(user, server, command, time.Unix(expires, 0))))
+}
+
+// Send a signed write command to the proxy of a server
+func operatorRequest(server string, user string, command string) (string, error) {
+	key := operatorProxyKey(server)
+	if len(key) == 0 {
+		return "", fmt.Errorf("no operator key for server %s", server)
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	request, err := http.NewRequest("POST",
+		"http://"+server+"."+setting.domain+":"+strconv.Itoa(setting.proxyPort)+"/operator",
+		strings.NewReader(url.Values{"q": {command}}.Encode()))
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("X-Operator-User", user)
+	request.Header.Set("X-Operator-Timestamp", timestamp)
+	request.Header.Set("X-Operator-Signature", operatorProxySignature(key, server, timestamp, user, command))
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	text, _ := ioutil.ReadAll(response.Body)
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("HTTP status %s: %s", response.Status, strings.TrimSpace(string(text)))
+	}
+	return string(text), nil
+}
+
+// An action of an operator, stored as one JSON line in the audit log
+type operatorAuditEntry struct {
+	Time   time.Time `json:"time"`
+	User   string    `json:"user"`
+	Auth   string    `json:"auth,omitempty"`
+	Remote string    `json:"remote"`
+	Server string    `json:"server,omitempty"`
+	// BIRD command, or "login"
+	Command string `json:"command"`
+	// Empty if the action succeeded
+	Error string `json:"error,omitempty"`
+}
+
+func operatorAudit(entry operatorAuditEntry) {
+	if len(setting.operatorAuditLog) == 0 {
+		return
+	}
+	operatorAuditMutex.Lock()
+	defer operatorAuditMutex.Unlock()
+	file, err := os.OpenFile(setting.operatorAuditLog, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		println(err.Error())
+		return
+	}
+	if err := json.NewEncoder(file).Encode(entry); err != nil {
+		println(err.Error())
+	}
+	file.Close()
+}
+
+// Ask the browser for a username and password
+func operatorChallenge(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Basic realm="bird-lg operator", charset="UTF-8"`)
+	w.WriteHeader(http.StatusUnauthorized)
+	w.Write([]byte("Unauthorized\n"))
+}
+
+// Log in with HTTP basic auth, and keep the operator logged in with a
+// session cookie, so the summary and detail pages show the buttons
+func webHandlerOperatorLogin(w http.ResponseWriter, r *http.Request) {
+	user, method := operatorAuthenticate(r)
+	if method != "password" {
+		if username, _, ok := r.BasicAuth(); ok {
+			operatorAudit(operatorAuditEntry{Time: time.Now(), User: username, Remote: r.RemoteAddr, Command: "login", Error: "invalid password"})
+		}
+		operatorChallenge(w)
+		return
+	}
+	operatorAudit(operatorAuditEntry{Time: time.Now(), User: user, Auth: method, Remote: r.RemoteAddr, Command: "login"})
+
+	expires := time.Now().Add(operatorSessionLifetime)
+	http.SetCookie(w, &http.Cookie{
+		Name:     operatorSessionCookie,
+		Value:    operatorSessionValue(user, expires),
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func webHandlerOperatorLogout(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     operatorSessionCookie,
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// Confirmation page of an action at /operator/<server>/<action>/<protocol>,
+// which runs the action when confirmed. Requests with an API token run it
+// directly, and get the result as JSON.
+func webHandlerOperator(w http.ResponseWriter, r *http.Request) {
+	lang := i18nNegotiate(r)
+	split := strings.Split(r.URL.Path[len("/operator/"):], "/")
+	if len(split) != 3 || !isValidServer(split[0]) || len(operatorActions[split[1]]) == 0 || !operatorValidProtocol(split[2]) {
+		w.WriteHeader(http.StatusNotFound)
+		renderTemplate(w, r, " - operator", "<pre>"+html.EscapeString(i18nTranslate(lang, "invalid operator action"))+"</pre>")
+		return
+	}
+	user, method := operatorAuthenticate(r)
+	if len(user) == 0 {
+		operatorChallenge(w)
+		return
+	}
+
+	data := tmplOperator{
+		Server:   split[0],
+		Action:   split[1],
+		Protocol: split[2],
+		Command:  fmt.Sprintf(operatorActions[split[1]], split[2]),
+		User:     user,
+	}
+	if r.Method != "POST" {
+		data.Token = operatorConfirmToken(user, data.Server, data.Command, time.Now().Add(operatorConfirmLifetime))
+	} else {
+		entry := operatorAuditEntry{
+			Time:    time.Now(),
+			User:    user,
+			Auth:    method,
+			Remote:  r.RemoteAddr,
+			Server:  data.Server,
+			Command: data.Command,
+		}
+		// Browsers send cookies and basic auth by themselves, so they need
+		// the token of the confirmation page
+		if method != "token" && !operatorCheckConfirmToken(r.PostFormValue("token"), user, data.Server, data.Command, time.Now()) {
+			entry.Error = i18nTranslate(lang, "The confirmation has expired, please try again.")
+		} else if result, err := operatorRequest(data.Server, user, data.Command); err != nil {
+			entry.Error = err.Error()
+		} else {
+			data.Result = result
+		}
+		data.Done = true
+		data.Error = entry.Error
+		operatorAudit(entry)
+
+		if method == "token" {
+			w.Header().Add("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(apiResponse{
+				Error:  data.Error,
+				Result: []apiResult{{Server: data.Server, Data: data.Result}},
+			})
+			return
+		}
+	}
+
+	renderTemplate(
+		w, r,
+		" - "+html.EscapeString(data.Server+" "+data.Command),
+		renderPageContent(lang, "operator", data),
+	)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPBKDF2SHA256(t *testing.T) {
+	// Test vectors of RFC 7914 section 11
+	tests := []struct {
+		password   string
+		salt       string
+		iterations int
+		want       string
+	}{
+		{"passwd", "salt", 1, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"},
+		{"Password", "NaCl", 80000, "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56a1d425a1225833549adb841b51c9b3176a272bdebba1d078478f62b397f33c8d"},
+	}
+	for _, test := range tests {
+		got := hex.EncodeToString(pbkdf2SHA256([]byte(test.password), []byte(test.salt), test.iterations, 64))
+		if got != test.want {
+			t.Errorf("pbkdf2SHA256(%q, %q, %d) = %s, want %s", test.password, test.salt, test.iterations, got, test.want)
+		}
+	}
+	// Shorter keys are a prefix of longer ones
+	if got := hex.EncodeToString(pbkdf2SHA256([]byte("passwd"), []byte("salt"), 1, 20)); got != tests[0].want[:40] {
+		t.Errorf("20 byte key = %s, want %s", got, tests[0].want[:40])
+	}
+}
+
+func TestOperatorCheckPassword(t *testing.T) {
+	hash := "pbkdf2_sha256$1000$abc$ezAwPW/wuspSU83Z4aU2LP5+de/RqK3RFrreZbJFqEM="
+	tests := []struct {
+		hash     string
+		password string
+		want     bool
+	}{
+		{hash, "secret", true},
+		{hash, "Secret", false},
+		{hash, "", false},
+		{"pbkdf2_sha256$1001$abc$ezAwPW/wuspSU83Z4aU2LP5+de/RqK3RFrreZbJFqEM=", "secret", false},
+		{"pbkdf2_sha1$1000$abc$ezAwPW/wuspSU83Z4aU2LP5+de/RqK3RFrreZbJFqEM=", "secret", false},
+		{"pbkdf2_sha256$0$abc$ezAwPW/wuspSU83Z4aU2LP5+de/RqK3RFrreZbJFqEM=", "secret", false},
+		{"pbkdf2_sha256$1000$abc$", "secret", false},
+		{"secret", "secret", false},
+	}
+	for _, test := range tests {
+		if got := operatorCheckPassword(test.hash, test.password); got != test.want {
+			t.Errorf("operatorCheckPassword(%q, %q) = %v, want %v", test.hash, test.password, got, test.want)
+		}
+	}
+}
+
+func TestOperatorSession(t *testing.T) {
+	saved := setting
+	defer func() { setting = saved }()
+	setting.operatorSessionKey = "session"
+	setting.operatorProxyKeys = []string{"a:proxy"}
+
+	now := time.Now()
+	value := operatorSessionValue("alice", now.Add(time.Hour))
+	if user := operatorCheckSession(value, now); user != "alice" {
+		t.Errorf("valid session: user %q", user)
+	}
+	if user := operatorCheckSession(value, now.Add(2*time.Hour)); user != "" {
+		t.Errorf("expired session: user %q", user)
+	}
+	if user := operatorCheckSession("mallory"+value[len("alice"):], now); user != "" {
+		t.Errorf("session of another user: user %q", user)
+	}
+
+	// Sessions are signed with the session key only
+	setting.operatorProxyKeys = []string{"a:other"}
+	if user := operatorCheckSession(value, now); user != "alice" {
+		t.Errorf("session after changing proxy keys: user %q", user)
+	}
+	setting.operatorSessionKey = "proxy"
+	if user := operatorCheckSession(value, now); user != "" {
+		t.Errorf("session with another session key: user %q", user)
+	}
+}
+
+func TestOperatorProxySignature(t *testing.T) {
+	saved := setting
+	defer func() { setting = saved }()
+	setting.operatorProxyKeys = []string{"a:secret-a", "b:secret-b"}
+
+	if secret := operatorProxyKey("b"); secret != "secret-b" {
+		t.Errorf("secret of b = %q", secret)
+	}
+	if secret := operatorProxyKey("c"); secret != "" {
+		t.Errorf("secret of c = %q, want none", secret)
+	}
+	if _, err := operatorRequest("c", "alice", "restart bgp_peer"); err == nil {
+		t.Error("request to a server without a key sent")
+	}
+
+	// Signatures for another server don't match, even with the same key
+	signature := operatorProxySignature("secret", "a", "1700000000", "alice", "restart bgp_peer")
+	if other := operatorProxySignature("secret", "b", "1700000000", "alice", "restart bgp_peer"); other == signature {
+		t.Error("signature doesn't depend on the server")
+	}
+	if other := operatorProxySignature("secret", "a", "1700000000", "alice", "disable bgp_peer"); other == signature {
+		t.Error("signature doesn't depend on the command")
+	}
+}
+
+func TestOperatorValidProtocol(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"bgp_peer", true},
+		{"_peer1", true},
+		{"all", false},
+		{"in", false},
+		{"out", false},
+		{"", false},
+		{"1peer", false},
+		{"bgp peer", false},
+		{"bgp-peer", false},
+	}
+	for _, test := range tests {
+		if got := operatorValidProtocol(test.name); got != test.want {
+			t.Errorf("operatorValidProtocol(%q) = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestWebHandlerOperatorRefusesAll(t *testing.T) {
+	testProxy(t, []string{"a"}, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("request to the proxy: %s", r.URL.Path)
+	})
+	setting.operatorSessionKey = "session"
+	setting.operatorTokens = []string{"alice:token"}
+	setting.operatorProxyKeys = []string{"a:proxy"}
+
+	for _, path := range []string{"/operator/a/disable/all", "/operator/a/reload_in/all", "/operator/a/reload/in", "/operator/a/reload_in/"} {
+		r := httptest.NewRequest("POST", path, nil)
+		r.Header.Set("Authorization", "Bearer token")
+		w := httptest.NewRecorder()
+		webHandlerOperator(w, r)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s: status %d, want 404", path, w.Code)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Commands whose results are paginated, as full table exports are large
+var paginatedCommands = map[string]bool{
+	"route_export": true,
+	"route_import": true,
+}
+
+// Number of networks the proxy notes at the end of a page
+var paginationNetworksRegex = regexp.MustCompile(`^\.\.\. (\d+) networks$`)
+
+// Get a page of networks in the output of a command from each server. The
+// proxies return only the page, with the number of networks at the end.
+// Older proxies return the full output, which is paginated here. Returns
+// the pages and the numbers of networks.
+func paginatedRequest(servers []string, endpoint string, command string, lang string, page int, pageSize int) ([]string, []int) {
+	responses := batchRequestQuery(servers, endpoint, url.Values{
+		"q":      {command},
+		"offset": {strconv.Itoa((page - 1) * pageSize)},
+		"limit":  {strconv.Itoa(pageSize)},
+	}, lang)
+	networks := make([]int, len(responses))
+	for i, response := range responses {
+		var ok bool
+		if responses[i], networks[i], ok = paginateSplitCount(response); !ok {
+			responses[i], networks[i] = paginateRoutes(response, page, pageSize)
+		}
+	}
+	return responses, networks
+}
+
+// A page of the networks in the output of a command on some servers
+type routePages struct {
+	Responses []string
+	Networks  []int
+	// Current page, and number of pages of the server with the most
+	Page  int
+	Pages int
+	// Whether a proxy truncated the output, so networks may be missing
+	Truncated bool
+}
+
+// Page requested with the "page" query parameter, starting from 1
+func paginatedPageParam(r *http.Request) int {
+	if page, err := strconv.Atoi(r.URL.Query().Get("page")); err == nil && page > 1 {
+		return page
+	}
+	return 1
+}
+
+// Get a page of the networks in the output of a command from each server,
+// of --route-page-size networks. After the last page, the last page is
+// returned instead.
+func paginatedPage(servers []string, endpoint string, command string, lang string, page int) routePages {
+	result := routePages{Page: page}
+	result.Responses, result.Networks = paginatedRequest(servers, endpoint, command, lang, page, setting.routePageSize)
+	for i, response := range result.Responses {
+		if pages := (result.Networks[i] + setting.routePageSize - 1) / setting.routePageSize; pages > result.Pages {
+			result.Pages = pages
+		}
+		result.Truncated = result.Truncated || paginateTruncated(response)
+	}
+	if result.Page > result.Pages && result.Pages > 0 {
+		result.Page = result.Pages
+		result.Responses, result.Networks = paginatedRequest(servers, endpoint, command, lang, result.Page, setting.routePageSize)
+	}
+	return result
+}
+
+// Split the number of networks off a page returned by the proxy. Returns
+// false if the output has no number, e.g. from an older proxy.
+func paginateSplitCount(data string) (string, int, bool) {
+	trimmed := strings.TrimRight(data, "\n")
+	start := strings.LastIndex(trimmed, "\n") + 1
+	match := paginationNetworksRegex.FindStringSubmatch(trimmed[start:])
+	if match == nil {
+		return data, 0, false
+	}
+	networks, err := strconv.Atoi(match[1])
+	if err != nil {
+		return data, 0, false
+	}
+	return trimmed[:start], networks, true
+}
+
+// Whether the proxy stopped reading the output at its size limit, so
+// networks may be missing
+func paginateTruncated(data string) bool {
+	return strings.HasPrefix(data, "... output truncated") || strings.Contains(data, "\n... output truncated")
+}
+
+// Get a page of networks in the output of a "show route" command, with the
+// "Table" line before the first network of each table on the page. Lines
+// before the first network and the proxy's note of truncated output are on
+// every page. Errors look like a network, so they are on the first page.
+// Returns the page and the number of networks.
+func paginateRoutes(data string, page int, pageSize int) (string, int) {
+	var result []string
+	var table string
+	tableShown := false
+	networks := 0
+	included := false
+	for _, line := range strings.Split(strings.TrimRight(data, "\n"), "\n") {
+		switch {
+		case strings.HasPrefix(line, "... "):
+			result = append(result, line)
+			continue
+		case strings.HasPrefix(line, "Table "):
+			table = line
+			tableShown = false
+			continue
+		case len(line) > 0 && line[0] != ' ' && line[0] != '\t':
+			// A new network, routes and attributes are indented
+			networks++
+			included = networks > (page-1)*pageSize && networks <= page*pageSize
+			if included && !tableShown && len(table) > 0 {
+				result = append(result, table)
+				tableShown = true
+			}
+		case networks == 0:
+			included = true
+		}
+		if included {
+			result = append(result, line)
+		}
+	}
+	return strings.Join(result, "\n") + "\n", networks
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+const paginationTestOutput = `Table master4:
+10.0.0.0/24          unicast [peer1 2024-01-01] * (100) [AS4242420001i]
+	via 172.20.0.1 on eth0
+	BGP.as_path: 4242420001
+10.0.1.0/24          unicast [peer1 2024-01-01] * (100) [AS4242420002i]
+	via 172.20.0.1 on eth0
+Table master6:
+fd00::/48            unicast [peer1 2024-01-01] * (100) [AS4242420001i]
+	via fe80::1 on eth0
+`
+
+func TestPaginateRoutes(t *testing.T) {
+	tests := []struct {
+		data     string
+		page     int
+		pageSize int
+		want     string
+		networks int
+	}{
+		{paginationTestOutput, 1, 10, paginationTestOutput, 3},
+		{paginationTestOutput, 1, 1, `Table master4:
+10.0.0.0/24          unicast [peer1 2024-01-01] * (100) [AS4242420001i]
+	via 172.20.0.1 on eth0
+	BGP.as_path: 4242420001
+`, 3},
+		// The table line is repeated on the page of its next network
+		{paginationTestOutput, 2, 1, `Table master4:
+10.0.1.0/24          unicast [peer1 2024-01-01] * (100) [AS4242420002i]
+	via 172.20.0.1 on eth0
+`, 3},
+		{paginationTestOutput, 2, 2, `Table master6:
+fd00::/48            unicast [peer1 2024-01-01] * (100) [AS4242420001i]
+	via fe80::1 on eth0
+`, 3},
+		{paginationTestOutput, 3, 2, "\n", 3},
+		// Errors look like a network, and are on the first page
+		{"No such protocol peer2\n", 1, 10, "No such protocol peer2\n", 1},
+		// Notes of the proxy are on every page
+		{paginationTestOutput + "... output truncated at 100 bytes\n", 3, 1, `Table master6:
+fd00::/48            unicast [peer1 2024-01-01] * (100) [AS4242420001i]
+	via fe80::1 on eth0
+... output truncated at 100 bytes
+`, 3},
+	}
+	for _, test := range tests {
+		got, networks := paginateRoutes(test.data, test.page, test.pageSize)
+		if got != test.want || networks != test.networks {
+			t.Errorf("page %d of size %d = %q, %d networks, want %q, %d", test.page, test.pageSize, got, networks, test.want, test.networks)
+		}
+	}
+}
+
+func TestPaginateSplitCount(t *testing.T) {
+	tests := []struct {
+		data     string
+		want     string
+		networks int
+		ok       bool
+	}{
+		{"Table master4:\n10.0.0.0/24 unicast\n... 250 networks\n", "Table master4:\n10.0.0.0/24 unicast\n", 250, true},
+		{"... 0 networks\n", "", 0, true},
+		{paginationTestOutput, paginationTestOutput, 0, false},
+		{"Network not found\n", "Network not found\n", 0, false},
+		{"... output truncated at 100 bytes\n", "... output truncated at 100 bytes\n", 0, false},
+	}
+	for _, test := range tests {
+		got, networks, ok := paginateSplitCount(test.data)
+		if got != test.want || networks != test.networks || ok != test.ok {
+			t.Errorf("paginateSplitCount(%q) = %q, %d, %v, want %q, %d, %v", test.data, got, networks, ok, test.want, test.networks, test.ok)
+		}
+	}
+}
+
+func TestPaginatedRequest(t *testing.T) {
+	testProxy(t, []string{"new", "old"}, func(w http.ResponseWriter, r *http.Request) {
+		switch testProxyServer(r) {
+		case "new":
+			query := r.URL.Query()
+			w.Write([]byte(query.Get("q") + " " + query.Get("offset") + " " + query.Get("limit") + "\n... 500 networks\n"))
+		case "old":
+			// Ignores the page, and returns the full output
+			w.Write([]byte(paginationTestOutput))
+		}
+	})
+
+	pages, networks := paginatedRequest([]string{"new", "old"}, "bird", "show route export peer1", "en", 3, 1)
+	want := []string{
+		"show route export peer1 2 1\n",
+		"Table master6:\nfd00::/48            unicast [peer1 2024-01-01] * (100) [AS4242420001i]\n\tvia fe80::1 on eth0\n",
+	}
+	if !reflect.DeepEqual(pages, want) {
+		t.Errorf("pages %q, want %q", pages, want)
+	}
+	if !reflect.DeepEqual(networks, []int{500, 3}) {
+		t.Errorf("networks %v, want [500 3]", networks)
+	}
+}
+
+func TestPaginateTruncated(t *testing.T) {
+	tests := []struct {
+		data string
+		want bool
+	}{
+		{paginationTestOutput, false},
+		{paginationTestOutput + "... output truncated at 100 bytes\n", true},
+		{"... output truncated at 100 bytes\n", true},
+		{"... 3 networks\n", false},
+	}
+	for _, test := range tests {
+		if got := paginateTruncated(test.data); got != test.want {
+			t.Errorf("paginateTruncated(%q) = %v, want %v", test.data, got, test.want)
+		}
+	}
+}
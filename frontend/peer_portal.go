@@ -0,0 +1,369 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A channel of a protocol, with its route counts
+type peerChannel struct {
+	Name     string
+	Imported int
+	Filtered int
+	Exported int
+}
+
+// A protocol with a peer, from "show protocols all"
+type peerProtocol struct {
+	Server string
+	Name   string
+	Proto  string
+	State  string
+	Since  string
+	Info   string
+	// Uptime in the last 30 days, if history is enabled
+	Uptime string
+
+	// Details, only shown to the peer if login is required
+	NeighborAS      string
+	NeighborAddress string
+	BGPState        string
+	Channels        []peerChannel
+	LastError       string
+}
+
+const (
+	peerSessionCookie   = "birdlg_peer"
+	peerSessionLifetime = 12 * time.Hour
+	// Time to sign a login challenge
+	peerChallengeLifetime = 10 * time.Minute
+	// Namespace of login signatures, as given to "ssh-keygen -Y sign -n"
+	peerSignatureNamespace = "bird-lg"
+)
+
+var (
+	peerHeaderRegex = regexp.MustCompile(`^(\w+)\s+(\w+)\s+([\w-]+)\s+(\w+)\s+([0-9\-\. :]+)(.*)`)
+	peerRoutesRegex = regexp.MustCompile(`(\d+) (imported|filtered|exported)`)
+	peerASNRegex    = regexp.MustCompile(`^(?i:as)?(\d+)$`)
+
+	// Key for login challenges and sessions, sessions end on restart
+	peerSecret = peerRandomSecret()
+
+	// Challenges already used to log in, until they expire
+	peerUsedMutex      sync.Mutex
+	peerUsedChallenges = make(map[string]time.Time)
+)
+
+func peerRandomSecret() []byte {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(err)
+	}
+	return secret
+}
+
+func peerPortalEnabled() bool {
+	return setting.peerPortal != "off"
+}
+
+func peerSign(purpose string, message string) string {
+	mac := hmac.New(sha256.New, peerSecret)
+	mac.Write([]byte(purpose + "\n" + message))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Parse the output of "show protocols all" into protocols with their details
+func parseProtocolsAll(server string, data string) []peerProtocol {
+	var result []peerProtocol
+	var channel *peerChannel
+	for _, line := range strings.Split(data, "\n") {
+		if len(strings.TrimSpace(line)) == 0 {
+			continue
+		}
+		if line[0] != ' ' && line[0] != '\t' {
+			if match := peerHeaderRegex.FindStringSubmatch(line); match != nil && match[1] != "Name" {
+				result = append(result, peerProtocol{
+					Server: server,
+					Name:   match[1],
+					Proto:  match[2],
+					State:  match[4],
+					Since:  strings.TrimSpace(match[5]),
+					Info:   strings.TrimSpace(match[6]),
+				})
+				channel = nil
+			}
+			continue
+		}
+		if len(result) == 0 {
+			continue
+		}
+
+		protocol := &result[len(result)-1]
+		line = strings.TrimSpace(line)
+		split := strings.SplitN(line, ":", 2)
+		value := ""
+		if len(split) == 2 {
+			value = strings.TrimSpace(split[1])
+		}
+		switch {
+		case strings.HasPrefix(line, "Channel "):
+			protocol.Channels = append(protocol.Channels, peerChannel{Name: strings.TrimPrefix(line, "Channel ")})
+			channel = &protocol.Channels[len(protocol.Channels)-1]
+		case split[0] == "BGP state":
+			protocol.BGPState = value
+		case split[0] == "Neighbor address":
+			protocol.NeighborAddress = value
+		case split[0] == "Neighbor AS":
+			protocol.NeighborAS = value
+		case split[0] == "Last error":
+			protocol.LastError = value
+		case split[0] == "Routes" && channel != nil:
+			for _, match := range peerRoutesRegex.FindAllStringSubmatch(value, -1) {
+				count, _ := strconv.Atoi(match[1])
+				switch match[2] {
+				case "imported":
+					channel.Imported = count
+				case "filtered":
+					channel.Filtered = count
+				case "exported":
+					channel.Exported = count
+				}
+			}
+		}
+	}
+	return result
+}
+
+// ASN of the peer logged in with a session cookie, empty if not logged in
+func peerSession(r *http.Request) string {
+	cookie, err := r.Cookie(peerSessionCookie)
+	if err != nil {
+		return ""
+	}
+	split := strings.Split(cookie.Value, ":")
+	if len(split) != 3 {
+		return ""
+	}
+	expires, err := strconv.ParseInt(split[1], 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return ""
+	}
+	if !hmac.Equal([]byte(split[2]), []byte(peerSign("session", split[0]+":"+split[1]))) {
+		return ""
+	}
+	return split[0]
+}
+
+// Text to sign to log in as an ASN, valid for a while
+func peerChallenge(asn string, expires time.Time) string {
+	expiry := strconv.FormatInt(expires.Unix(), 10)
+	return "bird-lg login AS" + asn + " " + expiry + " " + peerSign("challenge", asn+"\n"+expiry)[:16]
+}
+
+func peerCheckChallenge(asn string, challenge string, now time.Time) bool {
+	split := strings.Split(challenge, " ")
+	if len(split) != 5 {
+		return false
+	}
+	expires, err := strconv.ParseInt(split[3], 10, 64)
+	if err != nil || now.Unix() > expires {
+		return false
+	}
+	return hmac.Equal([]byte(challenge), []byte(peerChallenge(asn, time.Unix(expires, 0))))
+}
+
+// Maintainers of an ASN in the registry, with the ssh-ed25519 keys in their
+// auth attributes
+func peerMaintainerKeys(asn string) ([]string, []string) {
+	autnum := registryGet("aut-num", "AS"+asn)
+	if autnum == nil {
+		return nil, nil
+	}
+	var maintainers, keys []string
+	for _, mntner := range registryMaintainers(autnum) {
+		maintainers = append(maintainers, mntner.Name)
+		for _, auth := range mntner.Get("auth") {
+			if strings.HasPrefix(auth, "ssh-ed25519 ") {
+				keys = append(keys, auth)
+			}
+		}
+	}
+	return maintainers, keys
+}
+
+// Only redirect to paths of this site after login
+func peerRedirectTarget(next string, asn string) string {
+	if strings.HasPrefix(next, "/") && !strings.HasPrefix(next, "//") && !strings.HasPrefix(next, "/\\") {
+		return next
+	}
+	return "/peer/" + strings.Join(setting.servers, "+") + "/" + asn
+}
+
+// Protocols of an ASN on all servers, at /peer/<servers>/<asn>, and routes
+// exported to one of them with ?export=<server>/<protocol>
+func webHandlerPeer(w http.ResponseWriter, r *http.Request) {
+	split := strings.SplitN(r.URL.Path[1:], "/", 3)
+	lang := i18nNegotiate(r)
+	data := tmplPeer{
+		Mode:       setting.peerPortal,
+		ServersURL: split[1],
+		History:    historyEnabled(),
+		LoggedIn:   peerSession(r),
+	}
+	if len(split) >= 3 {
+		if match := peerASNRegex.FindStringSubmatch(strings.TrimSpace(split[2])); match != nil {
+			data.ASN = match[1]
+		} else if len(strings.TrimSpace(split[2])) > 0 {
+			data.Error = i18nTranslate(lang, "invalid ASN")
+		}
+	}
+	if len(data.ASN) == 0 {
+		renderTemplate(w, r, " - peer portal", renderPageContent(lang, "peer", data))
+		return
+	}
+	data.Name = asnName(asnLookup(data.ASN))
+	data.Details = data.Mode == "public" || data.LoggedIn == data.ASN
+
+	var servers []string
+	for _, server := range strings.Split(split[1], "+") {
+		if isValidServer(server) {
+			servers = append(servers, server)
+		}
+	}
+	now := time.Now()
+	for i, response := range batchRequest(servers, "bird", "show protocols all", lang) {
+		protocols := parseProtocolsAll(servers[i], response)
+		if len(protocols) == 0 {
+			data.Errors = append(data.Errors, servers[i]+": "+strings.TrimSpace(response))
+			continue
+		}
+		for _, protocol := range protocols {
+			if protocol.NeighborAS != data.ASN {
+				continue
+			}
+			if data.History {
+				protocol.Uptime = "-"
+				if fraction, ok := historyUptime(historyGet(protocol.Server, protocol.Name), 30*24*time.Hour, now); ok {
+					protocol.Uptime = fmt.Sprintf("%.2f%%", fraction*100)
+				}
+			}
+			if !data.Details {
+				protocol.NeighborAddress = ""
+				protocol.BGPState = ""
+				protocol.Channels = nil
+				protocol.LastError = ""
+			}
+			data.Protocols = append(data.Protocols, protocol)
+		}
+	}
+
+	// Only protocols with this peer can be looked up
+	if export := r.URL.Query().Get("export"); len(export) > 0 && data.Details {
+		for _, protocol := range data.Protocols {
+			if protocol.Server+"/"+protocol.Name == export {
+				// Paginated like route_export, exports to transit peers
+				// are full tables
+				command := fmt.Sprintf(backendCommandPrimitives["route_export"], protocol.Name)
+				pages := paginatedPage([]string{protocol.Server}, "bird", command, lang, paginatedPageParam(r))
+				data.Export = &tmplBirdServer{
+					Server: protocol.Server + ": " + command,
+					Raw:    pages.Responses[0],
+					Result: smartFormatter(pages.Responses[0]),
+					Count:  i18nTranslate(lang, "%d networks", pages.Networks[0]),
+				}
+				data.ExportKey = export
+				data.Page = pages.Page
+				data.Pages = pages.Pages
+				data.Truncated = pages.Truncated
+			}
+		}
+	}
+
+	renderTemplate(w, r, " - peer portal AS"+html.EscapeString(data.ASN), renderPageContent(lang, "peer", data))
+}
+
+// Log in as an ASN at /peer_login/<asn>, by signing a challenge with an SSH
+// key of a maintainer of its aut-num object in the registry
+func webHandlerPeerLogin(w http.ResponseWriter, r *http.Request) {
+	lang := i18nNegotiate(r)
+	data := tmplPeerLogin{Next: r.FormValue("next")}
+	if match := peerASNRegex.FindStringSubmatch(strings.TrimPrefix(r.URL.Path, "/peer_login/")); match != nil {
+		data.ASN = match[1]
+	} else {
+		w.WriteHeader(http.StatusNotFound)
+		renderTemplate(w, r, " - peer portal", "<pre>"+html.EscapeString(i18nTranslate(lang, "invalid ASN"))+"</pre>")
+		return
+	}
+	data.Maintainers, data.Keys = peerMaintainerKeys(data.ASN)
+
+	if r.Method == "POST" {
+		challenge := r.PostFormValue("challenge")
+		signature := r.PostFormValue("signature")
+		verified := false
+		if !peerCheckChallenge(data.ASN, challenge, time.Now()) {
+			data.Error = i18nTranslate(lang, "The login has expired, please try again.")
+		} else {
+			for _, key := range data.Keys {
+				if err := sshsigVerify(key, peerSignatureNamespace, []byte(challenge), signature); err == nil {
+					verified = true
+					break
+				} else {
+					data.Error = err.Error()
+				}
+			}
+		}
+
+		if verified {
+			peerUsedMutex.Lock()
+			for used, expires := range peerUsedChallenges {
+				if time.Now().After(expires) {
+					delete(peerUsedChallenges, used)
+				}
+			}
+			_, used := peerUsedChallenges[challenge]
+			peerUsedChallenges[challenge] = time.Now().Add(peerChallengeLifetime)
+			peerUsedMutex.Unlock()
+
+			if used {
+				data.Error = i18nTranslate(lang, "The login has expired, please try again.")
+			} else {
+				expires := time.Now().Add(peerSessionLifetime)
+				message := data.ASN + ":" + strconv.FormatInt(expires.Unix(), 10)
+				http.SetCookie(w, &http.Cookie{
+					Name:     peerSessionCookie,
+					Value:    message + ":" + peerSign("session", message),
+					Path:     "/",
+					Expires:  expires,
+					HttpOnly: true,
+					Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+					SameSite: http.SameSiteLaxMode,
+				})
+				http.Redirect(w, r, peerRedirectTarget(data.Next, data.ASN), http.StatusSeeOther)
+				return
+			}
+		}
+	}
+
+	data.Challenge = peerChallenge(data.ASN, time.Now().Add(peerChallengeLifetime))
+	renderTemplate(w, r, " - peer portal login AS"+data.ASN, renderPageContent(lang, "peer_login", data))
+}
+
+func webHandlerPeerLogout(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     peerSessionCookie,
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+	http.Redirect(w, r, peerRedirectTarget(r.FormValue("next"), ""), http.StatusSeeOther)
+}
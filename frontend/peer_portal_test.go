@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWebHandlerPeerExportPages(t *testing.T) {
+	var exportQuery string
+	testProxy(t, []string{"a"}, func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		switch query.Get("q") {
+		case "show protocols all":
+			w.Write([]byte(statsTestProtocols))
+		case "show route export peer1":
+			exportQuery = query.Get("offset") + " " + query.Get("limit")
+			w.Write([]byte("10.0.0.0/24          unicast [peer1 2024-01-01] * (100) [AS4242420001i]\n... 250 networks\n"))
+		default:
+			t.Errorf("unexpected query %q", query.Get("q"))
+		}
+	})
+	setting.peerPortal = "public"
+	setting.routePageSize = 100
+
+	w := httptest.NewRecorder()
+	webHandlerPeer(w, httptest.NewRequest("GET", "/peer/a/AS4242420002?export=a/peer1&page=2", nil))
+	if exportQuery != "100 100" {
+		t.Errorf("export requested with offset and limit %q, want \"100 100\"", exportQuery)
+	}
+	body := w.Body.String()
+	for _, want := range []string{"page 2 of 3", "250 networks", "?export=a/peer1&amp;page=3", "AS4242420001"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("page doesn't contain %q", want)
+		}
+	}
+	if strings.Contains(body, "... 250 networks") {
+		t.Error("page contains the number of networks of the proxy")
+	}
+}
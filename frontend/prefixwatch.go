@@ -0,0 +1,372 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A prefix to watch, with the origin AS it should have if known
+type prefixWatchEntry struct {
+	Prefix         string
+	ExpectedOrigin string
+}
+
+// Best path to a watched prefix on a server, or a change of it, stored as
+// one JSON line in the prefix watch file
+type prefixEvent struct {
+	Time   time.Time `json:"time"`
+	Server string    `json:"server"`
+	Prefix string    `json:"prefix"`
+	// Prefix of the best route, empty if withdrawn
+	Route    string   `json:"route"`
+	Protocol string   `json:"protocol"`
+	Path     []string `json:"path"`
+	// What changed since the previous event, empty for the first one
+	Changes []string `json:"changes"`
+}
+
+// Kinds of changes of the best path. Changes other than "path" are notified.
+const (
+	prefixChangeAnnounced        = "announced"
+	prefixChangeWithdrawn        = "withdrawn"
+	prefixChangeOrigin           = "origin"
+	prefixChangeUpstream         = "upstream"
+	prefixChangePath             = "path"
+	prefixChangeUnexpectedOrigin = "unexpected origin"
+)
+
+var (
+	prefixWatchList   []prefixWatchEntry
+	prefixWatchMutex  sync.RWMutex
+	prefixWatchEvents = make(map[[2]string][]prefixEvent)
+	prefixWatchStore  *jsonLinesStore
+)
+
+func prefixWatchEnabled() bool {
+	return len(prefixWatchList) > 0
+}
+
+// Parse a watch list entry, in the form of "prefix" or "prefix@ASN"
+func parsePrefixWatchEntry(s string) (prefixWatchEntry, error) {
+	var entry prefixWatchEntry
+	split := strings.SplitN(s, "@", 2)
+	entry.Prefix = strings.TrimSpace(split[0])
+	if len(split) == 2 {
+		asn, err := parseROAASN(strings.TrimSpace(split[1]))
+		if err != nil {
+			return entry, fmt.Errorf("invalid expected origin in prefix watch: %s", s)
+		}
+		entry.ExpectedOrigin = fmt.Sprint(asn)
+	}
+	if _, network, err := net.ParseCIDR(entry.Prefix); err == nil {
+		entry.Prefix = network.String()
+	} else if ip := net.ParseIP(entry.Prefix); ip != nil {
+		entry.Prefix = ip.String()
+	} else {
+		return entry, fmt.Errorf("invalid prefix in prefix watch: %s", s)
+	}
+	return entry, nil
+}
+
+func prefixWatchFind(prefix string) (prefixWatchEntry, bool) {
+	for _, entry := range prefixWatchList {
+		if entry.Prefix == prefix {
+			return entry, true
+		}
+	}
+	return prefixWatchEntry{}, false
+}
+
+// Origin AS of the best path, empty if withdrawn or originated locally
+func (event prefixEvent) Origin() string {
+	asns, _ := bgpmapParseASPath(strings.Join(event.Path, " "))
+	if len(asns) == 0 {
+		return ""
+	}
+	return asns[len(asns)-1]
+}
+
+// First AS of the best path
+func (event prefixEvent) Upstream() string {
+	asns, _ := bgpmapParseASPath(strings.Join(event.Path, " "))
+	if len(asns) == 0 {
+		return ""
+	}
+	return asns[0]
+}
+
+// Whether the changes are notified, rather than just recorded
+func (event prefixEvent) Notable() bool {
+	for _, change := range event.Changes {
+		if change != prefixChangePath {
+			return true
+		}
+	}
+	return false
+}
+
+func (event prefixEvent) PathString() string {
+	if len(event.Route) == 0 {
+		return "(withdrawn)"
+	}
+	if len(event.Path) == 0 {
+		return "(local)"
+	}
+	return strings.Join(event.Path, " ")
+}
+
+// Load events from the prefix watch file, and rewrite it without old events
+func prefixWatchLoad() error {
+	prefixWatchStore = newJSONLinesStore(setting.prefixWatchFile, prefixWatchDump)
+	events := make(map[[2]string][]prefixEvent)
+	err := prefixWatchStore.load(func(line []byte) error {
+		var event prefixEvent
+		if err := json.Unmarshal(line, &event); err != nil {
+			return err
+		}
+		key := [2]string{event.Server, event.Prefix}
+		events[key] = append(events[key], event)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	prefixWatchMutex.Lock()
+	for key, prefixEvents := range events {
+		sort.SliceStable(prefixEvents, func(i, j int) bool {
+			return prefixEvents[i].Time.Before(prefixEvents[j].Time)
+		})
+		prefixWatchEvents[key] = prefixEvents
+	}
+	prefixWatchMutex.Unlock()
+	return prefixWatchStore.compact()
+}
+
+// Remove events before the cutoff, except the last one of them
+func prefixWatchTrim(events []prefixEvent, cutoff time.Time) []prefixEvent {
+	first := sort.Search(len(events), func(i int) bool {
+		return !events[i].Time.Before(cutoff)
+	})
+	if first > 0 {
+		first--
+	}
+	return events[first:]
+}
+
+// Remove old events of all prefixes, and write the remaining ones to the
+// prefix watch file
+func prefixWatchDump(encoder *json.Encoder) error {
+	cutoff := time.Now().Add(-historyRetention)
+	prefixWatchMutex.Lock()
+	defer prefixWatchMutex.Unlock()
+	for key, events := range prefixWatchEvents {
+		events = prefixWatchTrim(events, cutoff)
+		prefixWatchEvents[key] = events
+		for _, event := range events {
+			if err := encoder.Encode(event); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func prefixWatchAppend(events []prefixEvent) error {
+	if len(events) == 0 || prefixWatchStore == nil {
+		return nil
+	}
+	return prefixWatchStore.append(func(encoder *json.Encoder) error {
+		for _, event := range events {
+			if err := encoder.Encode(event); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Route entry line of BIRD output, with the protocol name, and a "*" after
+// the attributes in brackets for the best route
+var prefixRouteLineRegex = regexp.MustCompile(`^\S*\s+\S+\s+\[(\S+)[^\]]*\](\s+\*)?`)
+
+// Find the best route in the output of "show route for ... all". Returns
+// false if the output is an error, and the state of the route is unknown.
+func prefixWatchParse(entry prefixWatchEntry, server string, response string, now time.Time) (prefixEvent, bool) {
+	event := prefixEvent{
+		Time:   now,
+		Server: server,
+		Prefix: entry.Prefix,
+	}
+	if strings.Contains(response, "Network not found") {
+		return event, true
+	}
+	if !strings.HasPrefix(response, "Table ") {
+		return event, false
+	}
+
+	var prefix string
+	var inBest bool
+	for _, line := range strings.Split(response, "\n") {
+		prefix = roaPrefixFromLine(line, prefix)
+		if len(line) > 0 && line[0] != '\t' {
+			match := prefixRouteLineRegex.FindStringSubmatch(line)
+			if match == nil {
+				continue
+			}
+			if len(event.Route) > 0 {
+				// Attributes of the best route end here
+				break
+			}
+			inBest = len(match[2]) > 0
+			if inBest {
+				event.Route = prefix
+				event.Protocol = match[1]
+			}
+		} else if inBest && strings.HasPrefix(line, "\tBGP.as_path:") {
+			event.Path = strings.Fields(strings.TrimPrefix(line, "\tBGP.as_path:"))
+		}
+	}
+
+	// A less specific route covering a watched prefix doesn't count as
+	// an announcement of the prefix itself
+	if _, network, err := net.ParseCIDR(event.Route); err == nil && strings.Contains(entry.Prefix, "/") {
+		if network.String() != entry.Prefix {
+			event.Route = ""
+			event.Protocol = ""
+			event.Path = nil
+		}
+	}
+	return event, true
+}
+
+// Compare the best path with the previous one, and list what changed
+func prefixWatchChanges(entry prefixWatchEntry, previous *prefixEvent, event prefixEvent) []string {
+	var changes []string
+	announced := len(event.Route) > 0
+	unexpected := announced && len(entry.ExpectedOrigin) > 0 && event.Origin() != entry.ExpectedOrigin
+
+	if previous == nil {
+		if unexpected {
+			changes = append(changes, prefixChangeUnexpectedOrigin)
+		}
+		return changes
+	}
+
+	wasAnnounced := len(previous.Route) > 0
+	switch {
+	case announced && !wasAnnounced:
+		changes = append(changes, prefixChangeAnnounced)
+		if unexpected {
+			changes = append(changes, prefixChangeUnexpectedOrigin)
+		}
+	case !announced && wasAnnounced:
+		changes = append(changes, prefixChangeWithdrawn)
+	case announced:
+		if event.Origin() != previous.Origin() {
+			changes = append(changes, prefixChangeOrigin)
+			if unexpected {
+				changes = append(changes, prefixChangeUnexpectedOrigin)
+			}
+		}
+		if event.Upstream() != previous.Upstream() {
+			changes = append(changes, prefixChangeUpstream)
+		}
+		if len(changes) == 0 && (event.Route != previous.Route ||
+			event.Protocol != previous.Protocol ||
+			strings.Join(event.Path, " ") != strings.Join(previous.Path, " ")) {
+			changes = append(changes, prefixChangePath)
+		}
+	}
+	return changes
+}
+
+// Query the best path to each watched prefix on all servers, and record
+// and notify changes since last time
+func prefixWatchPoll() {
+	now := time.Now()
+	cutoff := now.Add(-historyRetention)
+	var newEvents []prefixEvent
+	previousEvents := make(map[[2]string]prefixEvent)
+
+	for _, entry := range prefixWatchList {
+		responses := batchRequest(setting.servers, "bird", "show route for "+entry.Prefix+" all", "en")
+
+		prefixWatchMutex.Lock()
+		for i, response := range responses {
+			server := setting.servers[i]
+			event, ok := prefixWatchParse(entry, server, response, now)
+			if !ok {
+				continue
+			}
+			key := [2]string{server, entry.Prefix}
+			events := prefixWatchEvents[key]
+			var previous *prefixEvent
+			if len(events) > 0 {
+				previous = &events[len(events)-1]
+			}
+			event.Changes = prefixWatchChanges(entry, previous, event)
+			if previous != nil && len(event.Changes) == 0 {
+				continue
+			}
+			newEvents = append(newEvents, event)
+			if previous != nil {
+				previousEvents[key] = *previous
+			}
+			prefixWatchEvents[key] = prefixWatchTrim(append(events, event), cutoff)
+		}
+		prefixWatchMutex.Unlock()
+	}
+
+	if err := prefixWatchAppend(newEvents); err != nil {
+		println(err.Error())
+	}
+	if alertEnabled() {
+		alertPrefixEvents(newEvents, previousEvents, now)
+	}
+}
+
+func prefixWatchAlertMessage(entry prefixWatchEntry, previous *prefixEvent, event prefixEvent) alertMessage {
+	message := alertMessage{
+		Kind:           "prefix",
+		Time:           event.Time,
+		Server:         event.Server,
+		Prefix:         event.Prefix,
+		Route:          event.Route,
+		Protocol:       event.Protocol,
+		Path:           event.Path,
+		Origin:         event.Origin(),
+		ExpectedOrigin: entry.ExpectedOrigin,
+		Changes:        event.Changes,
+	}
+	message.Text = fmt.Sprintf("%s %s: %s, path %s", event.Server, event.Prefix, strings.Join(event.Changes, ", "), event.PathString())
+	if previous != nil {
+		message.PreviousPath = previous.Path
+		message.Text = fmt.Sprintf("%s %s: %s, path %s -> %s", event.Server, event.Prefix, strings.Join(event.Changes, ", "), previous.PathString(), event.PathString())
+	}
+	if len(entry.ExpectedOrigin) > 0 {
+		message.Text += " (expected origin AS" + entry.ExpectedOrigin + ")"
+	}
+	return message
+}
+
+func prefixWatchPollLoop() {
+	prefixWatchPoll()
+	for range time.Tick(time.Duration(setting.prefixWatchInterval) * time.Second) {
+		prefixWatchPoll()
+	}
+}
+
+// Get best path changes of a prefix, oldest first
+func prefixWatchGet(server string, prefix string) []prefixEvent {
+	prefixWatchMutex.RLock()
+	defer prefixWatchMutex.RUnlock()
+	events := prefixWatchEvents[[2]string{server, prefix}]
+	return append([]prefixEvent(nil), events...)
+}
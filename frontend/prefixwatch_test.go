@@ -0,0 +1,201 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePrefixWatchEntry(t *testing.T) {
+	tests := []struct {
+		s     string
+		entry prefixWatchEntry
+		err   bool
+	}{
+		{"172.20.0.0/24", prefixWatchEntry{"172.20.0.0/24", ""}, false},
+		{"172.20.0.1/24@AS4242420001", prefixWatchEntry{"172.20.0.0/24", "4242420001"}, false},
+		{" fd00::/48 @ 4242420002", prefixWatchEntry{"fd00::/48", "4242420002"}, false},
+		{"172.20.0.53", prefixWatchEntry{"172.20.0.53", ""}, false},
+		{"172.20.0.0/24@ASX", prefixWatchEntry{}, true},
+		{"example.com", prefixWatchEntry{}, true},
+	}
+	for _, test := range tests {
+		entry, err := parsePrefixWatchEntry(test.s)
+		if (err != nil) != test.err || (err == nil && entry != test.entry) {
+			t.Errorf("parsePrefixWatchEntry(%q) = %v, %v", test.s, entry, err)
+		}
+	}
+}
+
+func TestPrefixWatchParse(t *testing.T) {
+	entry := prefixWatchEntry{Prefix: "172.20.0.0/24"}
+	now := time.Now()
+	tests := []struct {
+		name     string
+		entry    prefixWatchEntry
+		response string
+		ok       bool
+		route    string
+		protocol string
+		path     []string
+	}{
+		{
+			name:  "best route",
+			entry: entry,
+			response: "Table master4:\n" +
+				"172.20.0.0/24        unicast [bgp2 2024-01-01] (100) [AS4242420009i]\n" +
+				"\tBGP.as_path: 4242420002 4242420009\n" +
+				"                     unicast [bgp1 2024-01-01] * (100) [AS4242420001i]\n" +
+				"\tType: BGP univ\n" +
+				"\tBGP.as_path: 4242420003 4242420001\n",
+			ok:       true,
+			route:    "172.20.0.0/24",
+			protocol: "bgp1",
+			path:     []string{"4242420003", "4242420001"},
+		},
+		{
+			name:     "not found",
+			entry:    entry,
+			response: "Network not found\n",
+			ok:       true,
+		},
+		{
+			name:  "less specific route",
+			entry: entry,
+			response: "Table master4:\n" +
+				"172.20.0.0/16        unicast [bgp1 2024-01-01] * (100) [AS4242420001i]\n" +
+				"\tBGP.as_path: 4242420001\n",
+			ok: true,
+		},
+		{
+			name:  "address",
+			entry: prefixWatchEntry{Prefix: "172.20.0.53"},
+			response: "Table master4:\n" +
+				"172.20.0.0/16        unicast [bgp1 2024-01-01] * (100) [AS4242420001i]\n" +
+				"\tBGP.as_path: 4242420001\n",
+			ok:       true,
+			route:    "172.20.0.0/16",
+			protocol: "bgp1",
+			path:     []string{"4242420001"},
+		},
+		{
+			name:     "error",
+			entry:    entry,
+			response: "request failed: timeout\n",
+			ok:       false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			event, ok := prefixWatchParse(test.entry, "a", test.response, now)
+			if ok != test.ok || event.Route != test.route || event.Protocol != test.protocol || !reflect.DeepEqual(event.Path, test.path) {
+				t.Errorf("prefixWatchParse() = %v %q %q %q", ok, event.Route, event.Protocol, event.Path)
+			}
+		})
+	}
+}
+
+func prefixTestEvent(route string, path string) prefixEvent {
+	event := prefixEvent{Server: "a", Prefix: "172.20.0.0/24", Route: route, Path: strings.Fields(path)}
+	if len(route) > 0 {
+		event.Protocol = "bgp1"
+	}
+	return event
+}
+
+func TestPrefixWatchChanges(t *testing.T) {
+	const prefix = "172.20.0.0/24"
+	entry := prefixWatchEntry{Prefix: prefix}
+	expected := prefixWatchEntry{Prefix: prefix, ExpectedOrigin: "4242420001"}
+	announced := prefixTestEvent(prefix, "4242420002 4242420001")
+
+	tests := []struct {
+		name     string
+		entry    prefixWatchEntry
+		previous *prefixEvent
+		event    prefixEvent
+		changes  []string
+	}{
+		{"first", entry, nil, announced, nil},
+		{"first unexpected", expected, nil, prefixTestEvent(prefix, "4242420009"), []string{"unexpected origin"}},
+		{"first withdrawn", expected, nil, prefixTestEvent("", ""), nil},
+		{"same", entry, &announced, announced, nil},
+		{"announced", entry, &prefixEvent{}, announced, []string{"announced"}},
+		{"announced unexpected", expected, &prefixEvent{}, prefixTestEvent(prefix, "4242420009"), []string{"announced", "unexpected origin"}},
+		{"withdrawn", entry, &announced, prefixTestEvent("", ""), []string{"withdrawn"}},
+		{"origin", entry, &announced, prefixTestEvent(prefix, "4242420002 4242420009"), []string{"origin"}},
+		{"origin unexpected", expected, &announced, prefixTestEvent(prefix, "4242420002 4242420009"), []string{"origin", "unexpected origin"}},
+		{"upstream", entry, &announced, prefixTestEvent(prefix, "4242420003 4242420001"), []string{"upstream"}},
+		{"origin and upstream", entry, &announced, prefixTestEvent(prefix, "4242420009"), []string{"origin", "upstream"}},
+		{"path", entry, &announced, prefixTestEvent(prefix, "4242420002 4242420005 4242420001"), []string{"path"}},
+		{"prepending", entry, &announced, prefixTestEvent(prefix, "4242420002 4242420001 4242420001"), []string{"path"}},
+		{"local", entry, &announced, prefixTestEvent(prefix, ""), []string{"origin", "upstream"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := prefixWatchChanges(test.entry, test.previous, test.event); !reflect.DeepEqual(got, test.changes) {
+				t.Errorf("prefixWatchChanges() = %q, want %q", got, test.changes)
+			}
+		})
+	}
+}
+
+func TestAlertPrefixChanges(t *testing.T) {
+	alertTestSetup(t, 60, nil, "a/*@2024-05-01T14:00:00Z/2024-05-01T15:00:00Z")
+	const prefix = "172.20.0.0/24"
+	saved := prefixWatchList
+	prefixWatchList = []prefixWatchEntry{{Prefix: prefix, ExpectedOrigin: "4242420001"}}
+	defer func() { prefixWatchList = saved }()
+	alertMutex.Lock()
+	alertPrefixStates = make(map[[2]string]*alertPrefixState)
+	alertMutex.Unlock()
+
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	at := func(minutes int, event prefixEvent) prefixEvent {
+		event.Time = start.Add(time.Duration(minutes) * time.Minute)
+		return event
+	}
+	announced := prefixTestEvent(prefix, "4242420002 4242420001")
+	withdrawn := prefixTestEvent("", "")
+	hijacked := prefixTestEvent(prefix, "4242420002 4242420009")
+	key := [2]string{"a", prefix}
+
+	steps := []struct {
+		events   []prefixEvent
+		previous map[[2]string]prefixEvent
+		now      int
+		want     string
+	}{
+		// Known from the prefix watch file, a withdrawal lasting 1 minute
+		{[]prefixEvent{at(0, withdrawn)}, map[[2]string]prefixEvent{key: at(-60, announced)}, 0, ""},
+		{[]prefixEvent{at(1, announced)}, nil, 1, ""},
+		{nil, nil, 10, ""},
+		// Plain path changes aren't notified
+		{[]prefixEvent{at(20, prefixTestEvent(prefix, "4242420002 4242420005 4242420001"))}, nil, 20, ""},
+		{nil, nil, 30, ""},
+		// A new origin lasting for the debounce period
+		{[]prefixEvent{at(40, hijacked)}, nil, 40, ""},
+		{nil, nil, 41, "a 172.20.0.0/24: origin, unexpected origin, path 4242420002 4242420005 4242420001 -> 4242420002 4242420009 (expected origin AS4242420001)"},
+		{nil, nil, 100, ""},
+		// Held back during maintenance, and sent after it
+		{[]prefixEvent{at(130, withdrawn)}, nil, 130, ""},
+		{nil, nil, 150, ""},
+		{nil, nil, 180, "a 172.20.0.0/24: withdrawn, path 4242420002 4242420009 -> (withdrawn) (expected origin AS4242420001)"},
+	}
+	for i, step := range steps {
+		messages := alertPrefixChanges(step.events, step.previous, start.Add(time.Duration(step.now)*time.Minute))
+		var got string
+		if len(messages) > 1 {
+			t.Errorf("step %d: %d messages", i, len(messages))
+		} else if len(messages) == 1 {
+			got = messages[0].Text
+			if messages[0].Kind != "prefix" {
+				t.Errorf("step %d: kind %q", i, messages[0].Kind)
+			}
+		}
+		if got != step.want {
+			t.Errorf("step %d: %q, want %q", i, got, step.want)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const registryCheckInterval = time.Minute
+
+type registryNetwork struct {
+	network *net.IPNet
+	object  *rpslObject
+}
+
+type registryIndex struct {
+	// Objects by type, then by lowercase name
+	objects map[string]map[string]*rpslObject
+	// inetnum and inet6num objects
+	inetnums []registryNetwork
+	// route and route6 objects
+	routes []registryNetwork
+}
+
+var (
+	registry        *registryIndex
+	registryMutex   sync.RWMutex
+	registryVersion string
+)
+
+func registryEnabled() bool {
+	return len(setting.registryPath) > 0
+}
+
+// Object files are named after the object, except "/" in prefixes are
+// replaced by "_"
+func registryNameFromFile(objectType string, fileName string) string {
+	switch objectType {
+	case "inetnum", "inet6num", "route", "route6":
+		return strings.Replace(fileName, "_", "/", 1)
+	}
+	return fileName
+}
+
+func registryLoad(path string) (*registryIndex, error) {
+	index := &registryIndex{
+		objects: make(map[string]map[string]*rpslObject),
+	}
+
+	dataPath := filepath.Join(path, "data")
+	types, err := ioutil.ReadDir(dataPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, objectType := range types {
+		if !objectType.IsDir() {
+			continue
+		}
+		files, err := ioutil.ReadDir(filepath.Join(dataPath, objectType.Name()))
+		if err != nil {
+			return nil, err
+		}
+		objects := make(map[string]*rpslObject)
+		for _, file := range files {
+			if file.IsDir() || strings.HasPrefix(file.Name(), ".") {
+				continue
+			}
+			content, err := ioutil.ReadFile(filepath.Join(dataPath, objectType.Name(), file.Name()))
+			if err != nil {
+				return nil, err
+			}
+			parsed := rpslParse(string(content))
+			if len(parsed) == 0 {
+				continue
+			}
+			object := &parsed[0]
+			name := registryNameFromFile(objectType.Name(), file.Name())
+			objects[strings.ToLower(name)] = object
+
+			switch objectType.Name() {
+			case "inetnum", "inet6num", "route", "route6":
+				_, network, err := net.ParseCIDR(name)
+				if err != nil {
+					continue
+				}
+				entry := registryNetwork{network, object}
+				if strings.HasPrefix(objectType.Name(), "route") {
+					index.routes = append(index.routes, entry)
+				} else {
+					index.inetnums = append(index.inetnums, entry)
+				}
+			}
+		}
+		index.objects[objectType.Name()] = objects
+	}
+	return index, nil
+}
+
+// Identify the current state of the checkout: the commit of git HEAD if
+// possible, or modification time of the object directories
+func registryGetVersion(path string) string {
+	gitPath := filepath.Join(path, ".git")
+	if head, err := ioutil.ReadFile(filepath.Join(gitPath, "HEAD")); err == nil {
+		head = bytes.TrimSpace(head)
+		if !bytes.HasPrefix(head, []byte("ref: ")) {
+			return string(head)
+		}
+		ref := string(bytes.TrimPrefix(head, []byte("ref: ")))
+		if commit, err := ioutil.ReadFile(filepath.Join(gitPath, ref)); err == nil {
+			return string(bytes.TrimSpace(commit))
+		}
+		if packedRefs, err := ioutil.ReadFile(filepath.Join(gitPath, "packed-refs")); err == nil {
+			for _, line := range strings.Split(string(packedRefs), "\n") {
+				if strings.HasSuffix(line, " "+ref) {
+					return line
+				}
+			}
+		}
+	}
+
+	var version string
+	types, _ := ioutil.ReadDir(filepath.Join(path, "data"))
+	for _, objectType := range types {
+		version += objectType.Name() + objectType.ModTime().String()
+	}
+	return version
+}
+
+func registryReload() error {
+	version := registryGetVersion(setting.registryPath)
+	if version == registryVersion && registry != nil {
+		return nil
+	}
+
+	index, err := registryLoad(setting.registryPath)
+	if err != nil {
+		return err
+	}
+	registryMutex.Lock()
+	registry = index
+	registryVersion = version
+	registryMutex.Unlock()
+	return nil
+}
+
+// Reload the registry when the checkout changes
+func registryWatchLoop() {
+	if !registryEnabled() {
+		return
+	}
+	for range time.Tick(registryCheckInterval) {
+		if err := registryReload(); err != nil {
+			println(err.Error())
+		}
+	}
+}
+
+// Find an object by its type and name
+func registryGet(objectType string, name string) *rpslObject {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	if registry == nil {
+		return nil
+	}
+	return registry.objects[objectType][strings.ToLower(name)]
+}
+
+// Find all networks containing the given IP or prefix, most specific first
+func registryNetworkLookup(networks []registryNetwork, target string) []*rpslObject {
+	var ip net.IP
+	var length int = -1
+	if _, network, err := net.ParseCIDR(target); err == nil {
+		ip = network.IP
+		length, _ = network.Mask.Size()
+	} else if ip = net.ParseIP(target); ip == nil {
+		return nil
+	}
+
+	var matches []registryNetwork
+	for _, entry := range networks {
+		entryLength, _ := entry.network.Mask.Size()
+		if entry.network.Contains(ip) && (length < 0 || entryLength <= length) {
+			matches = append(matches, entry)
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		iLength, _ := matches[i].network.Mask.Size()
+		jLength, _ := matches[j].network.Mask.Size()
+		return iLength > jLength
+	})
+
+	var result []*rpslObject
+	for _, entry := range matches {
+		result = append(result, entry.object)
+	}
+	return result
+}
+
+// Look up objects for a whois query, returns nil if nothing is found
+func registryQuery(target string) []*rpslObject {
+	target = strings.TrimSpace(target)
+
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	if registry == nil {
+		return nil
+	}
+
+	// IP addresses and prefixes: the most specific inetnum and route
+	if strings.ContainsAny(target, ".:") {
+		inetnums := registryNetworkLookup(registry.inetnums, target)
+		routes := registryNetworkLookup(registry.routes, target)
+		if inetnums != nil || routes != nil {
+			var result []*rpslObject
+			if len(inetnums) > 0 {
+				result = append(result, inetnums[0])
+			}
+			if len(routes) > 0 {
+				result = append(result, routes[0])
+			}
+			return result
+		}
+	}
+
+	// Other objects are looked up by their names in all types
+	var types []string
+	for objectType := range registry.objects {
+		types = append(types, objectType)
+	}
+	sort.Strings(types)
+
+	var result []*rpslObject
+	for _, objectType := range types {
+		if object, ok := registry.objects[objectType][strings.ToLower(target)]; ok {
+			result = append(result, object)
+		}
+	}
+	return result
+}
+
+// Send a whois request to the registry, returns empty string if nothing
+// is found
+func registryWhois(target string) string {
+	var result []string
+	for _, object := range registryQuery(target) {
+		result = append(result, object.String())
+	}
+	return strings.Join(result, "\n")
+}
+
+// Get the maintainers of an object, as mntner objects if available
+func registryMaintainers(object *rpslObject) []*rpslObject {
+	var result []*rpslObject
+	for _, name := range object.Get("mnt-by") {
+		if mntner := registryGet("mntner", name); mntner != nil {
+			result = append(result, mntner)
+		} else {
+			result = append(result, &rpslObject{Type: "mntner", Name: name})
+		}
+	}
+	return result
+}
+
+// Get a description of an AS from its aut-num object, in lines
+func registryASNRepresentation(asn string) []string {
+	autnum := registryGet("aut-num", "AS"+asn)
+	if autnum == nil {
+		return nil
+	}
+
+	var result []string
+	if name := autnum.GetFirst("as-name"); len(name) > 0 {
+		result = append(result, name)
+	}
+	for _, mntner := range registryMaintainers(autnum) {
+		result = append(result, mntner.Name)
+	}
+	return result
+}
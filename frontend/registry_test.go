@@ -0,0 +1,174 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// Write files of a registry checkout, with paths relative to it
+func registryTestWrite(t *testing.T, path string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		fullPath := filepath.Join(path, name)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// Use a registry checkout with the given files in the test
+func registryTestSetup(t *testing.T, files map[string]string) string {
+	t.Helper()
+	savedSetting, savedRegistry, savedVersion := setting, registry, registryVersion
+	t.Cleanup(func() {
+		setting = savedSetting
+		registryMutex.Lock()
+		registry, registryVersion = savedRegistry, savedVersion
+		registryMutex.Unlock()
+	})
+
+	path := t.TempDir()
+	registryTestWrite(t, path, files)
+	setting.registryPath = path
+	registry, registryVersion = nil, ""
+	if err := registryReload(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+var registryTestFiles = map[string]string{
+	".git/HEAD":              "ref: refs/heads/master\n",
+	".git/refs/heads/master": "1111111111111111111111111111111111111111\n",
+	"data/inetnum/10.0.0.0_8": "inetnum:            10.0.0.0 - 10.255.255.255\n" +
+		"cidr:               10.0.0.0/8\n" +
+		"netname:            RFC1918-10\n",
+	"data/inetnum/10.1.0.0_16": "inetnum:            10.1.0.0 - 10.1.255.255\n" +
+		"cidr:               10.1.0.0/16\n" +
+		"netname:            EXAMPLE-NET\n" +
+		"mnt-by:             EXAMPLE-MNT\n",
+	"data/inet6num/fd00::_8": "inet6num:           fd00:0000:0000:0000:0000:0000:0000:0000 - fdff:ffff:ffff:ffff:ffff:ffff:ffff:ffff\n" +
+		"cidr:               fd00::/8\n" +
+		"netname:            ULA\n",
+	"data/route/10.1.0.0_16": "route:              10.1.0.0/16\n" +
+		"origin:             AS4242420001\n",
+	"data/route/10.1.2.0_24": "route:              10.1.2.0/24\n" +
+		"origin:             AS4242420002\n",
+	"data/aut-num/AS4242420001": "aut-num:            AS4242420001\n" +
+		"as-name:            EXAMPLE-AS\n" +
+		"mnt-by:             EXAMPLE-MNT\n" +
+		"mnt-by:             MISSING-MNT\n",
+	"data/mntner/EXAMPLE-MNT": "mntner:             EXAMPLE-MNT\n" +
+		"auth:               ssh-ed25519 AAAA\n",
+	// Hidden files are not objects
+	"data/mntner/.gitkeep": "",
+}
+
+func TestRegistryQueryNetworks(t *testing.T) {
+	registryTestSetup(t, registryTestFiles)
+
+	tests := []struct {
+		target string
+		want   []string
+	}{
+		// The most specific inetnum and route
+		{"10.1.2.3", []string{"10.1.0.0/16", "10.1.2.0/24"}},
+		{"10.1.3.0/24", []string{"10.1.0.0/16", "10.1.0.0/16"}},
+		// Routes more specific than the prefix don't match
+		{"10.1.0.0/16", []string{"10.1.0.0/16", "10.1.0.0/16"}},
+		{"10.2.0.1", []string{"10.0.0.0/8"}},
+		{"fd00::1", []string{"fd00::/8"}},
+		{"192.168.0.1", nil},
+	}
+	for _, test := range tests {
+		var got []string
+		for _, object := range registryQuery(test.target) {
+			if cidr := object.GetFirst("cidr"); len(cidr) > 0 {
+				got = append(got, cidr)
+			} else {
+				got = append(got, object.Name)
+			}
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("registryQuery(%q) = %v, want %v", test.target, got, test.want)
+		}
+	}
+
+	// All matching networks, most specific first
+	var got []string
+	for _, object := range registryNetworkLookup(registry.inetnums, "10.1.2.3") {
+		got = append(got, object.GetFirst("cidr"))
+	}
+	if want := []string{"10.1.0.0/16", "10.0.0.0/8"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("inetnums of 10.1.2.3 %v, want %v", got, want)
+	}
+}
+
+func TestRegistryQueryNames(t *testing.T) {
+	registryTestSetup(t, registryTestFiles)
+
+	if objects := registryQuery("example-mnt"); len(objects) != 1 || objects[0].Type != "mntner" {
+		t.Errorf("registryQuery(example-mnt) = %v", objects)
+	}
+	if objects := registryQuery(".gitkeep"); objects != nil {
+		t.Errorf("hidden file found: %v", objects)
+	}
+	if result := registryWhois("AS4242420999"); result != "" {
+		t.Errorf("unknown AS found: %q", result)
+	}
+}
+
+func TestRegistryMaintainers(t *testing.T) {
+	registryTestSetup(t, registryTestFiles)
+
+	maintainers := registryMaintainers(registryGet("aut-num", "as4242420001"))
+	if len(maintainers) != 2 {
+		t.Fatalf("%d maintainers, want 2", len(maintainers))
+	}
+	// Maintainers in the registry are resolved to their objects
+	if maintainers[0].Name != "EXAMPLE-MNT" || maintainers[0].GetFirst("auth") != "ssh-ed25519 AAAA" {
+		t.Errorf("maintainer %v", maintainers[0])
+	}
+	if maintainers[1].Name != "MISSING-MNT" || maintainers[1].Type != "mntner" || len(maintainers[1].Attributes) != 0 {
+		t.Errorf("missing maintainer %v", maintainers[1])
+	}
+
+	if got, want := registryASNRepresentation("4242420001"), []string{"EXAMPLE-AS", "EXAMPLE-MNT", "MISSING-MNT"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("registryASNRepresentation = %v, want %v", got, want)
+	}
+}
+
+func TestRegistryReload(t *testing.T) {
+	path := registryTestSetup(t, registryTestFiles)
+
+	newRoute := map[string]string{
+		"data/route/10.1.2.128_25": "route:              10.1.2.128/25\n" +
+			"origin:             AS4242420003\n",
+	}
+	registryTestWrite(t, path, newRoute)
+	// Without a new commit, the index is kept
+	if err := registryReload(); err != nil {
+		t.Fatal(err)
+	}
+	if objects := registryQuery("10.1.2.129"); len(objects) != 2 || objects[1].Name != "10.1.2.0/24" {
+		t.Errorf("registry reloaded without a change of the checkout: %v", objects)
+	}
+
+	registryTestWrite(t, path, map[string]string{
+		".git/refs/heads/master": "2222222222222222222222222222222222222222\n",
+	})
+	if err := registryReload(); err != nil {
+		t.Fatal(err)
+	}
+	if objects := registryQuery("10.1.2.129"); len(objects) != 2 || objects[1].Name != "10.1.2.128/25" {
+		t.Errorf("new route not found after the commit changed: %v", objects)
+	}
+	if registryVersion != "2222222222222222222222222222222222222222" {
+		t.Errorf("version %q", registryVersion)
+	}
+}
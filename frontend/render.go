@@ -2,7 +2,9 @@ package main
 
 import (
 	"fmt"
+	"html"
 	"net/http"
+	"net/url"
 	"regexp"
 	"sort"
 	"strings"
@@ -36,9 +38,26 @@ func renderTemplate(w http.ResponseWriter, r *http.Request, title string, conten
 		"route_where_all":    "show route where net ~ [ ... ] all",
 		"route_where_bgpmap": "show route where net ~ [ ... ] (bgpmap)",
 		"route_generic":      "show route ...",
+		"route_export":       "show route export ...",
+		"route_import":       "show route protocol ...",
+		"route_origin":       "show route where bgp_path.last = ASN ...",
+		"route_aspath":       "show route where bgp_path ~ [= * ASN * =] ...",
 		"generic":            "show ...",
 		"whois":              "whois ...",
 		"traceroute":         "traceroute ...",
+		"traceroute_map":     "traceroute ... (map)",
+		"history":            "protocol history ...",
+		"prefix_history":     "prefix history ...",
+	}
+	if peerPortalEnabled() {
+		args.Options["peer"] = "peer portal (ASN) ..."
+	}
+	if statsEnabled() {
+		args.Options["stats"] = "routing table statistics"
+	}
+	lang := i18nNegotiate(r)
+	for option, label := range args.Options {
+		args.Options[option] = i18nTranslate(lang, label)
 	}
 	args.Servers = setting.servers
 	args.AllServersLinkActive = strings.ToLower(split[1]) == strings.ToLower(strings.Join(setting.servers, "+"))
@@ -53,117 +72,168 @@ func renderTemplate(w http.ResponseWriter, r *http.Request, title string, conten
 	args.Title = setting.titleBrand + title
 	args.Brand = setting.navBarBrand
 	args.Content = content
+	args.Lang = lang
+	args.Languages = i18nLanguages()
+	args.Operator, _ = operatorAuthenticate(r)
 
-	tmpl.Execute(w, args)
+	tmpls[lang]["page"].Execute(w, args)
+}
+
+// Render a graph with viz.js, or download it if a format is requested
+func renderGraph(w http.ResponseWriter, r *http.Request, title string, fileName string, graph *bgpmapGraph) {
+	if format, ok := bgpmapFormats[r.URL.Query().Get("format")]; ok {
+		fileName = regexp.MustCompile(`[^\w.-]+`).ReplaceAllString(fileName, "_")
+		w.Header().Set("Content-Type", format.contentType)
+		w.Header().Set("Content-Disposition", `attachment; filename="`+fileName+`.`+format.extension+`"`)
+		w.Write([]byte(format.export(graph)))
+		return
+	}
+
+	var servers []string
+	for _, node := range graph.Nodes {
+		if node.Type == "server" {
+			servers = append(servers, node.ID)
+		}
+	}
+	renderTemplate(
+		w, r,
+		title,
+		renderPageContent(i18nNegotiate(r), "bgpmap", tmplBGPMap{
+			Servers:  servers,
+			Targets:  graph.Targets,
+			Graphviz: graph.Graphviz(),
+		}),
+	)
 }
 
 // Write the given text to http response, and add whois links for
-// ASNs and IP addresses
+// ASNs and IP addresses, descriptions for BGP communities and ROA status
+// for route entries
 func smartFormatter(s string) string {
 	var result string
+	var routePrefix string
 	result += "<pre>"
 	for _, line := range strings.Split(s, "\n") {
 		var lineFormatted string
-		if strings.HasPrefix(strings.TrimSpace(line), "BGP.as_path:") || strings.HasPrefix(strings.TrimSpace(line), "Neighbor AS:") || strings.HasPrefix(strings.TrimSpace(line), "Local AS:") {
-			lineFormatted = regexp.MustCompile(`(\d+)`).ReplaceAllString(line, `<a href="/whois/AS${1}" class="whois">${1}</a>`)
+		if kind, isCommunityLine := communityLineKind(line); isCommunityLine {
+			lineFormatted = communityFormatLine(kind, line)
+		} else if strings.HasPrefix(strings.TrimSpace(line), "BGP.as_path:") || strings.HasPrefix(strings.TrimSpace(line), "Neighbor AS:") || strings.HasPrefix(strings.TrimSpace(line), "Local AS:") {
+			lineFormatted = regexp.MustCompile(`(\d+)`).ReplaceAllStringFunc(line, func(asn string) string {
+				return `<a href="/whois/AS` + asn + `" class="whois" title="` + html.EscapeString(asnName(asnLookupCached(asn))) + `">` + asn + `</a>`
+			})
 		} else {
 			lineFormatted = regexp.MustCompile(`([a-zA-Z0-9\-]*\.([a-zA-Z]{2,3}){1,2})(\s|$)`).ReplaceAllString(line, `<a href="/whois/${1}" class="whois">${1}</a>${3}`)
 			lineFormatted = regexp.MustCompile(`\[AS(\d+)`).ReplaceAllString(lineFormatted, `[<a href="/whois/AS${1}" class="whois">AS${1}</a>`)
 			lineFormatted = regexp.MustCompile(`(\d+\.\d+\.\d+\.\d+)`).ReplaceAllString(lineFormatted, `<a href="/whois/${1}" class="whois">${1}</a>`)
 			lineFormatted = regexp.MustCompile(`(?i)(([a-f\d]{0,4}:){3,10}[a-f\d]{0,4})`).ReplaceAllString(lineFormatted, `<a href="/whois/${1}" class="whois">${1}</a>`)
 		}
+		if roaEnabled() {
+			routePrefix = roaPrefixFromLine(line, routePrefix)
+			lineFormatted += roaFormatLine(line, routePrefix)
+		}
 		result += lineFormatted + "\n"
 	}
 	result += "</pre>"
 	return result
 }
 
-type summaryTableArguments struct {
-	Headers []string
-	Lines   [][]string
+// Link a whois attribute value to its own whois page
+func whoisLinkValue(value string) string {
+	fields := strings.SplitN(value, " ", 2)
+	result := `<a href="/whois/` + html.EscapeString(url.PathEscape(fields[0])) + `" class="whois">` + html.EscapeString(fields[0]) + `</a>`
+	if len(fields) > 1 {
+		result += " " + html.EscapeString(fields[1])
+	}
+	return result
 }
 
-// Output a table for the summary page
-func summaryTable(data string, serverName string) string {
-	var result string
+// Output whois objects as key/value tables, with links to referenced
+// objects. Falls back to smartFormatter if the result isn't RPSL.
+func whoisFormatter(result string, compact bool, lang string) string {
+	objects := rpslParse(result)
+	if len(objects) == 0 {
+		return smartFormatter(result)
+	}
 
-	// Sort the table, excluding title row
-	stringsSplitted := strings.Split(strings.TrimSpace(data), "\n")
-	if len(stringsSplitted) <= 1 {
-		// Likely backend returned an error message
-		result = fmt.Sprintf("<pre>%s</pre>", strings.TrimSpace(data))
-	} else {
-		// Draw the table head
-		result += `<table class="table table-hover table-bordered table-sm">`
-		result += `<thead>`
-		for _, col := range strings.Split(stringsSplitted[0], " ") {
-			colTrimmed := strings.TrimSpace(col)
-			if len(colTrimmed) == 0 {
-				continue
+	var output string
+	var skippedLines int
+	for _, object := range objects {
+		if compact {
+			var skipped int
+			object, skipped = whoisFilterObject(object)
+			skippedLines += skipped
+		}
+
+		output += `<table class="table table-sm table-bordered"><tbody>`
+		for _, attr := range object.Attributes {
+			var lines []string
+			for _, line := range strings.Split(attr.Value, "\n") {
+				if whoisReferenceKeys[attr.Key] && len(line) > 0 {
+					lines = append(lines, whoisLinkValue(line))
+				} else {
+					lines = append(lines, html.EscapeString(line))
+				}
 			}
-			result += fmt.Sprintf(`<th scope="col">%s</th>`, colTrimmed)
+			output += fmt.Sprintf(
+				`<tr><th scope="row" class="w-25">%s</th><td class="text-monospace">%s</td></tr>`,
+				html.EscapeString(attr.Key), strings.Join(lines, "<br>"),
+			)
 		}
-		result += `</thead><tbody>`
+		output += `</tbody></table>`
+	}
+	if skippedLines > 0 {
+		output += `<p class="text-muted">` + i18nTranslate(lang, "%d line(s) skipped.", skippedLines) + `</p>`
+	}
+	return output
+}
 
-		stringsWithoutTitle := stringsSplitted[1:]
-		sort.Strings(stringsWithoutTitle)
+// Parse the output of "show protocols" for the summary template
+func summaryTable(data string, serverName string) tmplSummaryServer {
+	result := tmplSummaryServer{
+		Server: serverName,
+		Raw:    data,
+	}
 
-		for _, line := range stringsWithoutTitle {
-			// Ignore empty lines
-			line = strings.TrimSpace(line)
-			if len(line) == 0 {
-				continue
-			}
+	// Sort the table, excluding title row
+	stringsSplitted := strings.Split(strings.TrimSpace(data), "\n")
+	if len(stringsSplitted) <= 1 {
+		// Likely backend returned an error message
+		result.Result = fmt.Sprintf("<pre>%s</pre>", strings.TrimSpace(data))
+		return result
+	}
 
-			// Parse a total of 6 columns from bird summary
-			lineSplitted := regexp.MustCompile(`(\w+)(\s+)(\w+)(\s+)([\w-]+)(\s+)(\w+)(\s+)([0-9\-\. :]+)(.*)`).FindStringSubmatch(line)
-			if lineSplitted == nil {
-				continue
-			}
+	for _, col := range strings.Split(stringsSplitted[0], " ") {
+		colTrimmed := strings.TrimSpace(col)
+		if len(colTrimmed) == 0 {
+			continue
+		}
+		result.Headers = append(result.Headers, colTrimmed)
+	}
 
-			var row [6]string
-			if len(lineSplitted) >= 2 {
-				row[0] = strings.TrimSpace(lineSplitted[1])
-			}
-			if len(lineSplitted) >= 4 {
-				row[1] = strings.TrimSpace(lineSplitted[3])
-			}
-			if len(lineSplitted) >= 6 {
-				row[2] = strings.TrimSpace(lineSplitted[5])
-			}
-			if len(lineSplitted) >= 8 {
-				row[3] = strings.TrimSpace(lineSplitted[7])
-			}
-			if len(lineSplitted) >= 10 {
-				row[4] = strings.TrimSpace(lineSplitted[9])
-			}
-			if len(lineSplitted) >= 11 {
-				row[5] = strings.TrimSpace(lineSplitted[10])
-			}
+	stringsWithoutTitle := stringsSplitted[1:]
+	sort.Strings(stringsWithoutTitle)
 
-			// Draw the row in red if the link isn't up
-			result += fmt.Sprintf(`<tr class="%s">`, map[string]string{
-				"up":      "table-success",
-				"down":    "table-warning",
-				"start":   "table-danger",
-				"passive": "table-info",
-			}[row[3]])
-
-			// Add link to detail for first column
-			if row[0] == "new_peer" {
-				result += fmt.Sprintf(`<td><a href="/new_peer/%s">+ add new peer</a></td>`, serverName)
-			} else {
-				result += fmt.Sprintf(`<td><a href="/detail/%s/%[2]s">%[2]s</a></td>`, serverName, row[0])
-			}
+	for _, line := range stringsWithoutTitle {
+		// Ignore empty lines
+		line = strings.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
 
-			// Draw the other cells
-			for i := 1; i < 6; i++ {
-				result += "<td>" + row[i] + "</td>"
-			}
-			result += "</tr>"
+		// Parse a total of 6 columns from bird summary
+		lineSplitted := regexp.MustCompile(`(\w+)(\s+)(\w+)(\s+)([\w-]+)(\s+)(\w+)(\s+)([0-9\-\. :]+)(.*)`).FindStringSubmatch(line)
+		if lineSplitted == nil {
+			continue
 		}
-		result += "</tbody></table>"
-		result += "<!--" + data + "-->"
+
+		result.Rows = append(result.Rows, tmplSummaryRow{
+			Name:  strings.TrimSpace(lineSplitted[1]),
+			Proto: strings.TrimSpace(lineSplitted[3]),
+			Table: strings.TrimSpace(lineSplitted[5]),
+			State: strings.TrimSpace(lineSplitted[7]),
+			Since: strings.TrimSpace(lineSplitted[9]),
+			Info:  strings.TrimSpace(lineSplitted[10]),
+		})
 	}
 
 	return result
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type roaEntry struct {
+	prefix    *net.IPNet
+	maxLength int
+	asn       uint32
+}
+
+func (roa roaEntry) String() string {
+	return fmt.Sprintf("%s max %d as %d", roa.prefix.String(), roa.maxLength, roa.asn)
+}
+
+type roaStatus string
+
+const (
+	roaValid   roaStatus = "valid"
+	roaInvalid roaStatus = "invalid"
+	roaUnknown roaStatus = "unknown"
+)
+
+var (
+	roaTable      []roaEntry
+	roaTableMutex sync.RWMutex
+)
+
+// ROA export in the format of the dn42 registry, also used by routinator
+// and rpki-client
+type roaJSONFile struct {
+	ROAs []struct {
+		Prefix    string          `json:"prefix"`
+		MaxLength int             `json:"maxLength"`
+		ASN       json.RawMessage `json:"asn"`
+	} `json:"roas"`
+}
+
+// BIRD config line, e.g. "route 172.20.0.0/14 max 28 as 4242420000;"
+var roaBirdLineRegex = regexp.MustCompile(`^\s*(?:route|roa)\s+(\S+)\s+max\s+(\d+)\s+as\s+(\d+)\s*;`)
+
+func parseROAASN(s string) (uint32, error) {
+	s = strings.TrimPrefix(strings.ToUpper(strings.Trim(s, `"`)), "AS")
+	asn, err := strconv.ParseUint(s, 10, 32)
+	return uint32(asn), err
+}
+
+func newROAEntry(prefix string, maxLength int, asn uint32) (roaEntry, error) {
+	_, network, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return roaEntry{}, err
+	}
+	return roaEntry{network, maxLength, asn}, nil
+}
+
+func loadROAJSONFile(file *os.File) ([]roaEntry, error) {
+	var data roaJSONFile
+	if err := json.NewDecoder(file).Decode(&data); err != nil {
+		return nil, err
+	}
+
+	var result []roaEntry
+	for _, roa := range data.ROAs {
+		asn, err := parseROAASN(string(roa.ASN))
+		if err != nil {
+			return nil, err
+		}
+		entry, err := newROAEntry(roa.Prefix, roa.MaxLength, asn)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, entry)
+	}
+	return result, nil
+}
+
+func loadROABirdFile(file *os.File) ([]roaEntry, error) {
+	var result []roaEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		match := roaBirdLineRegex.FindStringSubmatch(scanner.Text())
+		if match == nil {
+			continue
+		}
+		maxLength, _ := strconv.Atoi(match[2])
+		asn, err := parseROAASN(match[3])
+		if err != nil {
+			return nil, err
+		}
+		entry, err := newROAEntry(match[1], maxLength, asn)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, entry)
+	}
+	return result, scanner.Err()
+}
+
+func loadROAFile(path string) ([]roaEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var result []roaEntry
+	if strings.HasSuffix(strings.ToLower(path), ".json") {
+		result, err = loadROAJSONFile(file)
+	} else {
+		result, err = loadROABirdFile(file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return result, nil
+}
+
+func loadROATables() error {
+	var table []roaEntry
+	for _, path := range setting.roaFiles {
+		entries, err := loadROAFile(strings.TrimSpace(path))
+		if err != nil {
+			return err
+		}
+		table = append(table, entries...)
+	}
+
+	roaTableMutex.Lock()
+	roaTable = table
+	roaTableMutex.Unlock()
+	return nil
+}
+
+// Reload ROA tables periodically, keeping the old table on errors
+func roaRefreshLoop() {
+	if len(setting.roaFiles) == 0 || setting.roaRefresh <= 0 {
+		return
+	}
+	for range time.Tick(time.Duration(setting.roaRefresh) * time.Second) {
+		if err := loadROATables(); err != nil {
+			println(err.Error())
+		}
+	}
+}
+
+// Validate a route origin as in RFC 6811. Returns the ROA that made the
+// route valid, or one of the ROAs that made it invalid.
+func roaValidate(prefix string, asn uint32) (roaStatus, *roaEntry) {
+	_, network, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return roaUnknown, nil
+	}
+	length, _ := network.Mask.Size()
+
+	roaTableMutex.RLock()
+	defer roaTableMutex.RUnlock()
+
+	var covering *roaEntry
+	for i := range roaTable {
+		roa := &roaTable[i]
+		roaLength, roaBits := roa.prefix.Mask.Size()
+		if roaBits != len(network.Mask)*8 || roaLength > length || !roa.prefix.Contains(network.IP) {
+			continue
+		}
+		if roa.asn == asn && asn != 0 && length <= roa.maxLength {
+			return roaValid, roa
+		}
+		if covering == nil {
+			covering = roa
+		}
+	}
+	if covering != nil {
+		return roaInvalid, covering
+	}
+	return roaUnknown, nil
+}
+
+func roaEnabled() bool {
+	return len(setting.roaFiles) > 0
+}
+
+// Track the prefix of route entries in BIRD output. Alternative routes for
+// the same prefix don't repeat the prefix, so keep the previous one.
+func roaPrefixFromLine(line string, currentPrefix string) string {
+	if len(line) == 0 || line[0] == ' ' || line[0] == '\t' {
+		return currentPrefix
+	}
+	fields := strings.Fields(line)
+	if _, _, err := net.ParseCIDR(fields[0]); err == nil {
+		return fields[0]
+	}
+	return currentPrefix
+}
+
+var roaOriginRegex = regexp.MustCompile(`\[AS(\d+)[ie?]\]`)
+
+// Generate a badge with ROA status for a route entry line of BIRD output
+func roaFormatLine(line string, prefix string) string {
+	match := roaOriginRegex.FindStringSubmatch(line)
+	if match == nil || len(prefix) == 0 {
+		return ""
+	}
+	asn, err := parseROAASN(match[1])
+	if err != nil {
+		return ""
+	}
+
+	status, roa := roaValidate(prefix, asn)
+	title := "no ROA covering " + prefix
+	if roa != nil {
+		title = "ROA: " + roa.String()
+	}
+	return fmt.Sprintf(` <span class="badge %s" title="%s">ROA %s</span>`, map[roaStatus]string{
+		roaValid:   "badge-success",
+		roaInvalid: "badge-danger",
+		roaUnknown: "badge-secondary",
+	}[status], html.EscapeString(title), status)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func roaTestTable(t *testing.T, files map[string]string) {
+	dir := t.TempDir()
+	saved := setting.roaFiles
+	setting.roaFiles = nil
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		setting.roaFiles = append(setting.roaFiles, path)
+	}
+	if err := loadROATables(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		setting.roaFiles = saved
+		loadROATables()
+	})
+}
+
+func TestLoadROATables(t *testing.T) {
+	roaTestTable(t, map[string]string{
+		"roa.json": `{"roas": [{"prefix": "172.20.0.0/24", "maxLength": 28, "asn": "AS4242420001"}, {"prefix": "fd00::/48", "maxLength": 64, "asn": 4242420002}]}`,
+		"roa.conf": "# comment\nroute 172.21.0.0/16 max 24 as 4242420003;\nroa 10.0.0.0/8 max 8 as 64500;\ninvalid line\n",
+	})
+	var entries []string
+	for _, roa := range roaTable {
+		entries = append(entries, roa.String())
+	}
+	got := strings.Join(entries, ", ")
+	for _, want := range []string{
+		"172.20.0.0/24 max 28 as 4242420001",
+		"fd00::/48 max 64 as 4242420002",
+		"172.21.0.0/16 max 24 as 4242420003",
+		"10.0.0.0/8 max 8 as 64500",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("ROA table %q doesn't contain %q", got, want)
+		}
+	}
+	if len(entries) != 4 {
+		t.Errorf("%d ROAs loaded, want 4", len(entries))
+	}
+}
+
+func TestLoadROATablesError(t *testing.T) {
+	roaTestTable(t, map[string]string{"roa.conf": "route 172.20.0.0/24 max 28 as 4242420001;\n"})
+	setting.roaFiles = append(setting.roaFiles, filepath.Join(t.TempDir(), "missing.json"))
+	if err := loadROATables(); err == nil {
+		t.Error("missing ROA file accepted")
+	}
+	// The old table is kept
+	if len(roaTable) != 1 {
+		t.Errorf("%d ROAs after a failed reload, want 1", len(roaTable))
+	}
+}
+
+func TestROAValidate(t *testing.T) {
+	roaTestTable(t, map[string]string{
+		"roa.conf": "route 172.20.0.0/16 max 24 as 4242420001;\n" +
+			"route 172.20.1.0/24 max 24 as 4242420002;\n" +
+			"route 172.21.0.0/16 max 16 as 0;\n" +
+			"route fd00::/48 max 64 as 4242420001;\n",
+	})
+	tests := []struct {
+		prefix string
+		asn    uint32
+		status roaStatus
+		roa    string
+	}{
+		{"172.20.0.0/16", 4242420001, roaValid, "172.20.0.0/16 max 24 as 4242420001"},
+		{"172.20.5.0/24", 4242420001, roaValid, "172.20.0.0/16 max 24 as 4242420001"},
+		// Too specific
+		{"172.20.5.128/25", 4242420001, roaInvalid, "172.20.0.0/16 max 24 as 4242420001"},
+		// Wrong origin
+		{"172.20.5.0/24", 4242420009, roaInvalid, "172.20.0.0/16 max 24 as 4242420001"},
+		// Valid by the more specific ROA
+		{"172.20.1.0/24", 4242420002, roaValid, "172.20.1.0/24 max 24 as 4242420002"},
+		// AS0 ROAs never make routes valid
+		{"172.21.0.0/16", 0, roaInvalid, "172.21.0.0/16 max 16 as 0"},
+		{"172.22.0.0/16", 4242420001, roaUnknown, ""},
+		// Less specific than the ROA
+		{"172.0.0.0/8", 4242420001, roaUnknown, ""},
+		{"fd00::/56", 4242420001, roaValid, "fd00::/48 max 64 as 4242420001"},
+		{"fd00::/56", 4242420002, roaInvalid, "fd00::/48 max 64 as 4242420001"},
+		// IPv4-mapped addresses don't match IPv6 ROAs
+		{"::ffff:172.20.0.0/112", 4242420001, roaUnknown, ""},
+		{"not a prefix", 4242420001, roaUnknown, ""},
+	}
+	for _, test := range tests {
+		status, roa := roaValidate(test.prefix, test.asn)
+		var roaString string
+		if roa != nil {
+			roaString = roa.String()
+		}
+		if status != test.status || roaString != test.roa {
+			t.Errorf("roaValidate(%s, %d) = %s, %q, want %s, %q", test.prefix, test.asn, status, roaString, test.status, test.roa)
+		}
+	}
+}
+
+func TestROAFormatLine(t *testing.T) {
+	roaTestTable(t, map[string]string{"roa.conf": "route 172.20.0.0/16 max 24 as 4242420001;\n"})
+	tests := []struct {
+		line   string
+		prefix string
+		want   string
+	}{
+		{"172.20.0.0/24 unicast [bgp1 2024-01-01] * (100) [AS4242420001i]", "172.20.0.0/24", `badge-success" title="ROA: 172.20.0.0/16 max 24 as 4242420001">ROA valid`},
+		{"                   unicast [bgp2 2024-01-01] (100) [AS4242420002i]", "172.20.0.0/24", `badge-danger" title="ROA: 172.20.0.0/16 max 24 as 4242420001">ROA invalid`},
+		{"10.0.0.0/8 unicast [static1 2024-01-01] * (200)", "10.0.0.0/8", ""},
+		{"10.0.0.0/8 unicast [bgp1 2024-01-01] * (100) [AS64500?]", "10.0.0.0/8", `badge-secondary" title="no ROA covering 10.0.0.0/8">ROA unknown`},
+	}
+	for _, test := range tests {
+		got := roaFormatLine(test.line, test.prefix)
+		if !strings.Contains(got, test.want) || (len(test.want) == 0) != (len(got) == 0) {
+			t.Errorf("roaFormatLine(%q) = %q, want %q", test.line, got, test.want)
+		}
+	}
+}
+
+func TestROAPrefixFromLine(t *testing.T) {
+	tests := []struct {
+		line    string
+		current string
+		want    string
+	}{
+		{"172.20.0.0/24 unicast [bgp1 2024-01-01] * (100) [AS4242420001i]", "", "172.20.0.0/24"},
+		{"                   unicast [bgp2 2024-01-01] (100) [AS4242420002i]", "172.20.0.0/24", "172.20.0.0/24"},
+		{"\tBGP.as_path: 4242420001", "172.20.0.0/24", "172.20.0.0/24"},
+		{"Table master4:", "172.20.0.0/24", "172.20.0.0/24"},
+		{"", "fd00::/48", "fd00::/48"},
+	}
+	for _, test := range tests {
+		if got := roaPrefixFromLine(test.line, test.current); got != test.want {
+			t.Errorf("roaPrefixFromLine(%q) = %q, want %q", test.line, got, test.want)
+		}
+	}
+}
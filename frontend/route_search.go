@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Filters of route searches, %s is replaced by the ASN
+var routeSearchFilters = map[string]string{
+	"route_origin": "bgp_path.last = %s",
+	"route_aspath": "bgp_path ~ [= * %s * =]",
+}
+
+// A search for routes by ASN, with optional community and prefix length
+type routeSearch struct {
+	ASN string
+	// Standard (a:b) or large (a:b:c) community, empty if not set
+	Community string
+	// Prefix length range, zero if not set
+	MinLength int
+	MaxLength int
+}
+
+var routeSearchASNRegex = regexp.MustCompile(`^(?i:as)?(\d+)$`)
+
+// Parse a search like "AS4242420001 community=64511:1 length=24-28"
+func parseRouteSearch(target string) (routeSearch, error) {
+	var search routeSearch
+	fields := strings.Fields(target)
+	if len(fields) == 0 {
+		return search, fmt.Errorf("missing ASN")
+	}
+	match := routeSearchASNRegex.FindStringSubmatch(fields[0])
+	if match == nil {
+		return search, fmt.Errorf("invalid ASN: %s", fields[0])
+	}
+	if _, err := strconv.ParseUint(match[1], 10, 32); err != nil {
+		return search, fmt.Errorf("invalid ASN: %s", fields[0])
+	}
+	search.ASN = match[1]
+
+	for _, field := range fields[1:] {
+		split := strings.SplitN(field, "=", 2)
+		if len(split) != 2 {
+			return search, fmt.Errorf("invalid filter: %s", field)
+		}
+		switch strings.ToLower(split[0]) {
+		case "community":
+			parts := strings.Split(strings.Trim(split[1], "()"), ":")
+			if len(parts) == 1 {
+				parts = strings.Split(strings.Trim(split[1], "()"), ",")
+			}
+			bits := 16
+			if len(parts) == 3 {
+				bits = 32
+			} else if len(parts) != 2 {
+				return search, fmt.Errorf("invalid community: %s", split[1])
+			}
+			for _, part := range parts {
+				if _, err := strconv.ParseUint(part, 10, bits); err != nil {
+					return search, fmt.Errorf("invalid community: %s", split[1])
+				}
+			}
+			search.Community = strings.Join(parts, ":")
+		case "length":
+			parts := strings.SplitN(split[1], "-", 2)
+			min, err := strconv.Atoi(parts[0])
+			max := min
+			if err == nil && len(parts) == 2 {
+				max, err = strconv.Atoi(parts[1])
+			}
+			if err != nil || min < 0 || max < 1 || max > 128 || min > max {
+				return search, fmt.Errorf("invalid prefix length: %s", split[1])
+			}
+			search.MinLength, search.MaxLength = min, max
+		default:
+			return search, fmt.Errorf("invalid filter: %s", field)
+		}
+	}
+	return search, nil
+}
+
+// BIRD command of a search, only built from validated numbers
+func routeSearchCommand(searchType string, search routeSearch) string {
+	conditions := []string{fmt.Sprintf(routeSearchFilters[searchType], search.ASN)}
+	if parts := strings.Split(search.Community, ":"); len(parts) == 2 {
+		conditions = append(conditions, "("+strings.Join(parts, ",")+") ~ bgp_community")
+	} else if len(parts) == 3 {
+		conditions = append(conditions, "("+strings.Join(parts, ",")+") ~ bgp_large_community")
+	}
+	if search.MaxLength > 0 {
+		conditions = append(conditions, fmt.Sprintf("net.len >= %d && net.len <= %d", search.MinLength, search.MaxLength))
+	}
+	return "show route where " + strings.Join(conditions, " && ")
+}
+
+// A prefix found by a search, with the origins of its routes
+type routeSearchPrefix struct {
+	Prefix  string   `json:"prefix"`
+	Origins []string `json:"origins"`
+}
+
+// Get the unique prefixes in the output of "show route", sorted, or nil if
+// there are none, e.g. for errors
+func routeSearchPrefixes(data string) []routeSearchPrefix {
+	var result []routeSearchPrefix
+	index := make(map[string]int)
+	current := -1
+	for _, line := range strings.Split(data, "\n") {
+		if len(strings.TrimSpace(line)) == 0 || strings.HasPrefix(line, "Table ") || strings.HasPrefix(line, "... ") {
+			continue
+		}
+		if line[0] != ' ' && line[0] != '\t' {
+			prefix := strings.Fields(line)[0]
+			if !strings.Contains(prefix, "/") {
+				continue
+			}
+			i, ok := index[prefix]
+			if !ok {
+				i = len(result)
+				index[prefix] = i
+				result = append(result, routeSearchPrefix{Prefix: prefix})
+			}
+			current = i
+		} else if current < 0 || !strings.Contains(line, "[") {
+			continue
+		}
+		// Alternative routes of the same network are indented
+		for _, match := range asnOriginRegex.FindAllStringSubmatch(line, -1) {
+			origins := &result[current].Origins
+			found := false
+			for _, origin := range *origins {
+				found = found || origin == match[1]
+			}
+			if !found {
+				*origins = append(*origins, match[1])
+			}
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Prefix < result[j].Prefix
+	})
+	return result
+}
+
+// Search routes by origin AS or AS path, at /route_origin/<servers>/<search>
+// and /route_aspath/<servers>/<search>
+func webHandlerRouteSearch(searchType string) func(w http.ResponseWriter, r *http.Request) {
+	if _, ok := routeSearchFilters[searchType]; !ok {
+		panic("invalid route search: " + searchType)
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		split := strings.SplitN(r.URL.Path[1:], "/", 3)
+		var target string
+		if len(split) >= 3 {
+			target = strings.TrimSpace(split[2])
+		}
+		lang := i18nNegotiate(r)
+		data := tmplRouteSearch{Type: searchType, Target: target}
+
+		search, err := parseRouteSearch(target)
+		if err != nil {
+			data.Error = err.Error()
+		} else {
+			data.Search = search
+			data.Command = routeSearchCommand(searchType, search)
+			servers := strings.Split(split[1], "+")
+			responses := batchRequest(servers, "bird", data.Command, lang)
+			for i, response := range responses {
+				server := tmplRouteSearchServer{
+					Server:   servers[i],
+					Prefixes: routeSearchPrefixes(response),
+				}
+				if server.Prefixes == nil {
+					server.Result = smartFormatter(response)
+				}
+				data.Servers = append(data.Servers, server)
+			}
+		}
+
+		renderTemplate(
+			w, r,
+			" - "+html.EscapeString(searchType+" "+target),
+			renderPageContent(lang, "route_search", data),
+		)
+	}
+}
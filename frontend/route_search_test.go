@@ -0,0 +1,91 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRouteSearch(t *testing.T) {
+	tests := []struct {
+		target string
+		want   routeSearch
+		valid  bool
+	}{
+		{"4242420001", routeSearch{ASN: "4242420001"}, true},
+		{"AS4242420001", routeSearch{ASN: "4242420001"}, true},
+		{"as64500", routeSearch{ASN: "64500"}, true},
+		{"  AS64500  ", routeSearch{ASN: "64500"}, true},
+		{"AS64500 community=64511:1", routeSearch{ASN: "64500", Community: "64511:1"}, true},
+		{"AS64500 community=(64511,1)", routeSearch{ASN: "64500", Community: "64511:1"}, true},
+		{"AS64500 COMMUNITY=4242420001:1:2", routeSearch{ASN: "64500", Community: "4242420001:1:2"}, true},
+		{"AS64500 length=24", routeSearch{ASN: "64500", MinLength: 24, MaxLength: 24}, true},
+		{"AS64500 length=24-28", routeSearch{ASN: "64500", MinLength: 24, MaxLength: 28}, true},
+		{"AS64500 length=0-128 community=64511:1", routeSearch{ASN: "64500", Community: "64511:1", MinLength: 0, MaxLength: 128}, true},
+		{"", routeSearch{}, false},
+		{"ASN64500", routeSearch{}, false},
+		{"AS4294967296", routeSearch{}, false},
+		{"AS64500;", routeSearch{}, false},
+		{"AS64500 64501", routeSearch{}, false},
+		{"AS64500 color=red", routeSearch{}, false},
+		// Standard communities are 16 bits per part
+		{"AS64500 community=4242420001:1", routeSearch{}, false},
+		{"AS64500 community=1:2:3:4", routeSearch{}, false},
+		{"AS64500 community=64511", routeSearch{}, false},
+		{"AS64500 community=64511:x", routeSearch{}, false},
+		{"AS64500 length=28-24", routeSearch{}, false},
+		{"AS64500 length=129", routeSearch{}, false},
+		{"AS64500 length=0", routeSearch{}, false},
+		{"AS64500 length=-1", routeSearch{}, false},
+		{"AS64500 length=24-", routeSearch{}, false},
+	}
+	for _, test := range tests {
+		got, err := parseRouteSearch(test.target)
+		if valid := err == nil; valid != test.valid {
+			t.Errorf("parseRouteSearch(%q): error %v, want valid %v", test.target, err, test.valid)
+		} else if valid && got != test.want {
+			t.Errorf("parseRouteSearch(%q) = %+v, want %+v", test.target, got, test.want)
+		}
+	}
+}
+
+func TestRouteSearchCommand(t *testing.T) {
+	tests := []struct {
+		searchType string
+		search     routeSearch
+		want       string
+	}{
+		{"route_origin", routeSearch{ASN: "64500"}, "show route where bgp_path.last = 64500"},
+		{"route_aspath", routeSearch{ASN: "64500"}, "show route where bgp_path ~ [= * 64500 * =]"},
+		{"route_origin", routeSearch{ASN: "64500", Community: "64511:1"}, "show route where bgp_path.last = 64500 && (64511,1) ~ bgp_community"},
+		{"route_origin", routeSearch{ASN: "64500", Community: "4242420001:1:2"}, "show route where bgp_path.last = 64500 && (4242420001,1,2) ~ bgp_large_community"},
+		{"route_origin", routeSearch{ASN: "64500", MinLength: 24, MaxLength: 28}, "show route where bgp_path.last = 64500 && net.len >= 24 && net.len <= 28"},
+	}
+	for _, test := range tests {
+		if got := routeSearchCommand(test.searchType, test.search); got != test.want {
+			t.Errorf("routeSearchCommand(%s, %+v) = %q, want %q", test.searchType, test.search, got, test.want)
+		}
+	}
+}
+
+func TestRouteSearchPrefixes(t *testing.T) {
+	data := `Table master4:
+10.0.1.0/24          unicast [peer1 2024-01-01] * (100) [AS4242420001i]
+	via 172.20.0.1 on eth0
+                     unicast [peer2 2024-01-01] (100) [AS4242420002i]
+	via 172.20.0.2 on eth0
+10.0.0.0/24          unicast [peer1 2024-01-01] * (100) [AS4242420001i]
+	via 172.20.0.1 on eth0
+Table master6:
+10.0.0.0/24          unicast [peer2 2024-01-01] * (100) [AS4242420001i]
+`
+	want := []routeSearchPrefix{
+		{Prefix: "10.0.0.0/24", Origins: []string{"4242420001"}},
+		{Prefix: "10.0.1.0/24", Origins: []string{"4242420001", "4242420002"}},
+	}
+	if got := routeSearchPrefixes(data); !reflect.DeepEqual(got, want) {
+		t.Errorf("routeSearchPrefixes = %+v, want %+v", got, want)
+	}
+	if got := routeSearchPrefixes("Network not found\n"); got != nil {
+		t.Errorf("routeSearchPrefixes of an error = %+v, want nil", got)
+	}
+}
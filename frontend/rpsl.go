@@ -0,0 +1,109 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+type rpslAttribute struct {
+	Key   string
+	Value string
+}
+
+// An object in the Routing Policy Specification Language, as used by whois
+// servers and the dn42 registry. Type and Name come from the first attribute.
+type rpslObject struct {
+	Type       string
+	Name       string
+	Attributes []rpslAttribute
+}
+
+// Get all values of an attribute
+func (o *rpslObject) Get(key string) []string {
+	var result []string
+	for _, attr := range o.Attributes {
+		if attr.Key == key {
+			result = append(result, attr.Value)
+		}
+	}
+	return result
+}
+
+// Get the first value of an attribute, or empty string if not present
+func (o *rpslObject) GetFirst(key string) string {
+	for _, attr := range o.Attributes {
+		if attr.Key == key {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// Format the object as a whois server would do
+func (o *rpslObject) String() string {
+	var result string
+	for _, attr := range o.Attributes {
+		lines := strings.Split(attr.Value, "\n")
+		result += attr.Key + ":" + strings.Repeat(" ", maxInt(1, 19-len(attr.Key))) + lines[0] + "\n"
+		for _, line := range lines[1:] {
+			if len(line) == 0 {
+				result += "+\n"
+			} else {
+				result += strings.Repeat(" ", 20) + line + "\n"
+			}
+		}
+	}
+	return result
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// Attribute names are letters, digits, "-" and "_", so that other text
+// with colons, like error messages, isn't taken for attributes
+var rpslKeyRegex = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Parse RPSL text into objects. Objects are separated by empty lines,
+// comment lines start with "%" or "#", and lines starting with whitespace
+// or "+" continue the value of the previous attribute.
+func rpslParse(text string) []rpslObject {
+	var result []rpslObject
+	var current *rpslObject
+
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r", ""), "\n") {
+		if len(strings.TrimSpace(line)) == 0 {
+			current = nil
+			continue
+		}
+		if line[0] == '%' || line[0] == '#' {
+			continue
+		}
+
+		if line[0] == ' ' || line[0] == '\t' || line[0] == '+' {
+			if current != nil && len(current.Attributes) > 0 {
+				last := &current.Attributes[len(current.Attributes)-1]
+				last.Value += "\n" + strings.TrimSpace(strings.TrimPrefix(line, "+"))
+			}
+			continue
+		}
+
+		index := strings.IndexByte(line, ':')
+		if index <= 0 || !rpslKeyRegex.MatchString(strings.TrimSpace(line[:index])) {
+			continue
+		}
+		attr := rpslAttribute{
+			Key:   strings.ToLower(strings.TrimSpace(line[:index])),
+			Value: strings.TrimSpace(line[index+1:]),
+		}
+		if current == nil {
+			result = append(result, rpslObject{Type: attr.Key, Name: attr.Value})
+			current = &result[len(result)-1]
+		}
+		current.Attributes = append(current.Attributes, attr)
+	}
+	return result
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRPSLParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		types []string
+		attrs [][]rpslAttribute
+	}{
+		{
+			name:  "empty",
+			text:  "",
+			types: nil,
+		},
+		{
+			name:  "single object with comments",
+			text:  "% comment\n# another\naut-num:  AS4242420001\nas-name:  EXAMPLE\nmnt-by:   EXAMPLE-MNT\n",
+			types: []string{"aut-num"},
+			attrs: [][]rpslAttribute{{
+				{"aut-num", "AS4242420001"},
+				{"as-name", "EXAMPLE"},
+				{"mnt-by", "EXAMPLE-MNT"},
+			}},
+		},
+		{
+			name:  "continuation lines",
+			text:  "person:   Foo\nremarks:  first\n          second\n+\n\tthird\n",
+			types: []string{"person"},
+			attrs: [][]rpslAttribute{{
+				{"person", "Foo"},
+				{"remarks", "first\nsecond\n\nthird"},
+			}},
+		},
+		{
+			name:  "multiple objects with CRLF",
+			text:  "route:  172.20.0.0/24\r\norigin: AS4242420001\r\n\r\nroute6: fd00::/48\r\norigin: AS4242420002\r\n",
+			types: []string{"route", "route6"},
+			attrs: [][]rpslAttribute{
+				{{"route", "172.20.0.0/24"}, {"origin", "AS4242420001"}},
+				{{"route6", "fd00::/48"}, {"origin", "AS4242420002"}},
+			},
+		},
+		{
+			name:  "keys are case insensitive",
+			text:  "Domain: example.dn42\nNSERVER: ns1.example.dn42\n",
+			types: []string{"domain"},
+			attrs: [][]rpslAttribute{{{"domain", "example.dn42"}, {"nserver", "ns1.example.dn42"}}},
+		},
+		{
+			name:  "error messages aren't attributes",
+			text:  "dial tcp 192.0.2.1:43: connect: connection refused\n",
+			types: nil,
+		},
+		{
+			name:  "continuation before any attribute",
+			text:  "  orphan\nmntner: FOO-MNT\n",
+			types: []string{"mntner"},
+			attrs: [][]rpslAttribute{{{"mntner", "FOO-MNT"}}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			objects := rpslParse(test.text)
+			var types []string
+			for i, object := range objects {
+				types = append(types, object.Type)
+				if !reflect.DeepEqual(object.Attributes, test.attrs[i]) {
+					t.Errorf("object %d attributes = %q, want %q", i, object.Attributes, test.attrs[i])
+				}
+			}
+			if !reflect.DeepEqual(types, test.types) {
+				t.Errorf("types = %q, want %q", types, test.types)
+			}
+		})
+	}
+}
+
+func TestRPSLObjectString(t *testing.T) {
+	object := rpslParse("person: Foo\nremarks: first\n  second\n+\n")[0]
+	want := "person:             Foo\nremarks:            first\n                    second\n+\n"
+	if got := object.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestWhoisFilterObject(t *testing.T) {
+	setting.whoisFilter = []string{"descr", "remarks"}
+	defer func() { setting.whoisFilter = nil }()
+
+	object := rpslParse("aut-num: AS4242420001\ndescr: a\n  b\nmnt-by: FOO-MNT\n  BAR-MNT\nremarks: c\n")[0]
+	filtered, skipped := whoisFilterObject(object)
+	want := []rpslAttribute{{"aut-num", "AS4242420001"}, {"mnt-by", "FOO-MNT"}}
+	if !reflect.DeepEqual(filtered.Attributes, want) {
+		t.Errorf("attributes = %q, want %q", filtered.Attributes, want)
+	}
+	// Two lines of descr, one of remarks, and the continuation of mnt-by
+	if skipped != 4 {
+		t.Errorf("skipped = %d, want 4", skipped)
+	}
+}
+
+func TestWhoisLinkValue(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"FOO-MNT", `<a href="/whois/FOO-MNT" class="whois">FOO-MNT</a>`},
+		{"172.20.0.0/24", `<a href="/whois/172.20.0.0%2F24" class="whois">172.20.0.0/24</a>`},
+		{`a"b?c#d`, `<a href="/whois/a%22b%3Fc%23d" class="whois">a&#34;b?c#d</a>`},
+		{"FOO-MNT <script>", `<a href="/whois/FOO-MNT" class="whois">FOO-MNT</a> &lt;script&gt;`},
+	}
+	for _, test := range tests {
+		if got := whoisLinkValue(test.value); got != test.want {
+			t.Errorf("whoisLinkValue(%q) = %s, want %s", test.value, got, test.want)
+		}
+	}
+}
+
+func TestWhoisFormatterFallback(t *testing.T) {
+	got := whoisFormatter("no colons here\n", false, "en")
+	if strings.Contains(got, "<table") {
+		t.Errorf("non-RPSL text formatted as a table: %s", got)
+	}
+}
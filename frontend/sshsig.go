@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// Read a string of the SSH wire format, a uint32 length and the data
+func sshReadString(data []byte) ([]byte, []byte, error) {
+	if len(data) < 4 {
+		return nil, nil, fmt.Errorf("truncated data")
+	}
+	length := binary.BigEndian.Uint32(data)
+	if uint32(len(data)-4) < length {
+		return nil, nil, fmt.Errorf("truncated data")
+	}
+	return data[4 : 4+length], data[4+length:], nil
+}
+
+func sshWriteString(buffer *bytes.Buffer, data []byte) {
+	binary.Write(buffer, binary.BigEndian, uint32(len(data)))
+	buffer.Write(data)
+}
+
+// Parse an ed25519 key in authorized_keys format, "ssh-ed25519 <base64>
+// [comment]", returning the key blob of the wire format
+func sshParseEd25519Key(key string) ([]byte, ed25519.PublicKey, error) {
+	fields := strings.Fields(key)
+	if len(fields) < 2 || fields[0] != "ssh-ed25519" {
+		return nil, nil, fmt.Errorf("not an ssh-ed25519 key")
+	}
+	blob, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return nil, nil, err
+	}
+	keyType, rest, err := sshReadString(blob)
+	if err != nil || string(keyType) != "ssh-ed25519" {
+		return nil, nil, fmt.Errorf("invalid ssh-ed25519 key")
+	}
+	publicKey, _, err := sshReadString(rest)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		return nil, nil, fmt.Errorf("invalid ssh-ed25519 key")
+	}
+	return blob, ed25519.PublicKey(publicKey), nil
+}
+
+// Verify a signature made by "ssh-keygen -Y sign" over a message, with the
+// given ssh-ed25519 key and namespace. Other key types aren't supported.
+func sshsigVerify(key string, namespace string, message []byte, armored string) error {
+	keyBlob, publicKey, err := sshParseEd25519Key(key)
+	if err != nil {
+		return err
+	}
+
+	var encoded strings.Builder
+	for _, line := range strings.Split(armored, "\n") {
+		if line = strings.TrimSpace(line); len(line) > 0 && !strings.HasPrefix(line, "-----") {
+			encoded.WriteString(line)
+		}
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded.String())
+	if err != nil {
+		return fmt.Errorf("invalid signature: %v", err)
+	}
+	if !bytes.HasPrefix(data, []byte("SSHSIG")) || len(data) < 10 || binary.BigEndian.Uint32(data[6:]) != 1 {
+		return fmt.Errorf("invalid signature: not an SSH signature")
+	}
+
+	// Public key, namespace, reserved, hash algorithm and signature
+	var fields [5][]byte
+	rest := data[10:]
+	for i := range fields {
+		if fields[i], rest, err = sshReadString(rest); err != nil {
+			return fmt.Errorf("invalid signature: %v", err)
+		}
+	}
+	if !bytes.Equal(fields[0], keyBlob) {
+		return fmt.Errorf("signed by another key")
+	}
+	if string(fields[1]) != namespace {
+		return fmt.Errorf("signed for namespace %q instead of %q", fields[1], namespace)
+	}
+	var hash []byte
+	switch string(fields[3]) {
+	case "sha256":
+		sum := sha256.Sum256(message)
+		hash = sum[:]
+	case "sha512":
+		sum := sha512.Sum512(message)
+		hash = sum[:]
+	default:
+		return fmt.Errorf("unsupported hash algorithm %q", fields[3])
+	}
+
+	signatureType, rest, err := sshReadString(fields[4])
+	if err != nil || string(signatureType) != "ssh-ed25519" {
+		return fmt.Errorf("invalid signature: not an ssh-ed25519 signature")
+	}
+	signature, _, err := sshReadString(rest)
+	if err != nil {
+		return fmt.Errorf("invalid signature: %v", err)
+	}
+
+	var signed bytes.Buffer
+	signed.WriteString("SSHSIG")
+	sshWriteString(&signed, fields[1])
+	sshWriteString(&signed, fields[2])
+	sshWriteString(&signed, fields[3])
+	sshWriteString(&signed, hash)
+	if !ed25519.Verify(publicKey, signed.Bytes(), signature) {
+		return fmt.Errorf("signature doesn't match")
+	}
+	return nil
+}
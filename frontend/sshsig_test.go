@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+func TestSSHSigVerify(t *testing.T) {
+	// Made with "ssh-keygen -Y sign -n bird-lg -f key message"
+	key := "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIJaj3yYXR3rEsS5ny4y7euQHyGCuaecdk25EWOPbwVsI test"
+	message := []byte("challenge-AS4242420001")
+	signature := `-----BEGIN SSH SIGNATURE-----
+U1NIU0lHAAAAAQAAADMAAAALc3NoLWVkMjU1MTkAAAAglqPfJhdHesSxLmfLjLt65AfIYK
+5p5x2TbkRY49vBWwgAAAAHYmlyZC1sZwAAAAAAAAAGc2hhNTEyAAAAUwAAAAtzc2gtZWQy
+NTUxOQAAAECJNQRLYS1bKiYkwctxCcAagmIlFTqFpnJkknrqAzPcmcVzbcBoPK7aMaXhDp
+/K+BESoIgLdIuQExvXyCrtRCAN
+-----END SSH SIGNATURE-----
+`
+	// The same message signed in the "file" namespace
+	fileSignature := `-----BEGIN SSH SIGNATURE-----
+U1NIU0lHAAAAAQAAADMAAAALc3NoLWVkMjU1MTkAAAAglqPfJhdHesSxLmfLjLt65AfIYK
+5p5x2TbkRY49vBWwgAAAAEZmlsZQAAAAAAAAAGc2hhNTEyAAAAUwAAAAtzc2gtZWQyNTUx
+OQAAAEDBdINV9Va8CaKh42Hy1ER3gSDo4gklBtzKCgLbibxwWUm4uO3qKTQ1SDBUU/LEza
+h1vkqZDID9gaIbvM2JSsQB
+-----END SSH SIGNATURE-----
+`
+	otherKey := "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIBYL4hvBWOPg1GY1EHz7VLHmg5L29aglUTjfsJcDAhe2 other"
+
+	tests := []struct {
+		name      string
+		key       string
+		namespace string
+		message   []byte
+		signature string
+		valid     bool
+	}{
+		{"valid", key, "bird-lg", message, signature, true},
+		{"key without comment", key[:len(key)-len(" test")], "bird-lg", message, signature, true},
+		{"other message", key, "bird-lg", []byte("challenge-AS4242420002"), signature, false},
+		{"other key", otherKey, "bird-lg", message, signature, false},
+		{"other namespace", key, "bird-lg", message, fileSignature, false},
+		{"namespace of the signature", key, "file", message, fileSignature, true},
+		{"not armored", key, "bird-lg", message, "U1NIU0lH", false},
+		{"empty", key, "bird-lg", message, "", false},
+		{"rsa key", "ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQ test", "bird-lg", message, signature, false},
+	}
+	for _, test := range tests {
+		err := sshsigVerify(test.key, test.namespace, test.message, test.signature)
+		if valid := err == nil; valid != test.valid {
+			t.Errorf("%s: error %v, want valid %v", test.name, err, test.valid)
+		}
+	}
+}
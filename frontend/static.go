@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Static files bundled into the binary. Third party libraries are
+// downloaded into this directory by fetch-static.sh before building.
+//
+//go:embed static
+var staticEmbedded embed.FS
+
+var staticFiles, _ = fs.Sub(staticEmbedded, "static")
+
+// Third party libraries used by the built-in templates. They are downloaded
+// by fetch-static.sh, and the frontend refuses to start without them.
+var staticLibraries = []string{
+	"bootstrap.min.css",
+	"bootstrap.min.js",
+	"jquery.min.js",
+	"viz.min.js",
+	"lite.render.js",
+}
+
+// Versions of bundled files never change, so they are only hashed once
+var (
+	staticVersionMutex sync.Mutex
+	staticVersions     = make(map[string]string)
+)
+
+// Files from the override directory are cached until they change on disk
+type staticOverride struct {
+	modTime time.Time
+	size    int64
+	data    []byte
+	version string
+}
+
+var (
+	staticOverrideMutex sync.Mutex
+	staticOverrides     = make(map[string]*staticOverride)
+)
+
+func staticVersion(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// Read a file from the override directory, only reading and hashing it
+// again if its size or modification time changed
+func staticReadOverride(name string) (*staticOverride, bool) {
+	filename := filepath.Join(setting.staticDir, filepath.FromSlash(name))
+	info, err := os.Stat(filename)
+	if err != nil || info.IsDir() {
+		return nil, false
+	}
+
+	staticOverrideMutex.Lock()
+	defer staticOverrideMutex.Unlock()
+	if cached, ok := staticOverrides[filename]; ok && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+		return cached, true
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, false
+	}
+	cached := &staticOverride{info.ModTime(), info.Size(), data, staticVersion(data)}
+	staticOverrides[filename] = cached
+	return cached, true
+}
+
+// Read a static file from the override directory, or from the bundled ones,
+// and return it with a version derived from its content
+func staticRead(name string) ([]byte, string, error) {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+
+	if len(setting.staticDir) > 0 {
+		if override, ok := staticReadOverride(name); ok {
+			return override.data, override.version, nil
+		}
+	}
+
+	data, err := fs.ReadFile(staticFiles, name)
+	if err != nil {
+		return nil, "", err
+	}
+	staticVersionMutex.Lock()
+	defer staticVersionMutex.Unlock()
+	version, ok := staticVersions[name]
+	if !ok {
+		version = staticVersion(data)
+		staticVersions[name] = version
+	}
+	return data, version, nil
+}
+
+// Check that all third party libraries are either bundled or overridden
+func staticCheck() error {
+	for _, name := range staticLibraries {
+		if _, _, err := staticRead(name); err != nil {
+			return fmt.Errorf("static file %s is missing, run fetch-static.sh before building or put it in the static directory", name)
+		}
+	}
+	return nil
+}
+
+// URL of a static file for use in pages. Files get their version appended,
+// so they can be cached forever.
+func staticURL(name string) string {
+	if _, version, err := staticRead(name); err == nil {
+		return "/static/" + name + "?v=" + version
+	}
+	return "/static/" + name
+}
+
+func webHandlerStatic(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/static/")
+	data, version, err := staticRead(name)
+	if err != nil {
+		webHandler404(w, r)
+		return
+	}
+
+	w.Header().Set("ETag", `"`+version+`"`)
+	if r.URL.Query().Get("v") == version {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+	}
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(data))
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func staticTestDir(t *testing.T) string {
+	dir := t.TempDir()
+	saved := setting.staticDir
+	setting.staticDir = dir
+	t.Cleanup(func() { setting.staticDir = saved })
+	return dir
+}
+
+func TestStaticCheck(t *testing.T) {
+	dir := staticTestDir(t)
+	for _, name := range staticLibraries {
+		if _, err := staticFiles.Open(name); err == nil {
+			t.Skip("libraries are bundled, run without fetch-static.sh to test")
+		}
+	}
+
+	if err := staticCheck(); err == nil || !strings.Contains(err.Error(), staticLibraries[0]) {
+		t.Errorf("staticCheck() = %v, want missing %s", err, staticLibraries[0])
+	}
+	for _, name := range staticLibraries {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := staticCheck(); err != nil {
+		t.Errorf("staticCheck() = %v with all libraries in the static directory", err)
+	}
+}
+
+func TestStaticReadOverride(t *testing.T) {
+	dir := staticTestDir(t)
+	filename := filepath.Join(dir, "style.css")
+
+	data, version, err := staticRead("style.css")
+	if err != nil || strings.HasPrefix(string(data), "override") {
+		t.Fatalf("bundled style.css: %q, %v", data, err)
+	}
+	bundled := version
+
+	if err := os.WriteFile(filename, []byte("override 1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	data, version, _ = staticRead("style.css")
+	if string(data) != "override 1" || version == bundled {
+		t.Errorf("override: %q, version %s", data, version)
+	}
+	first := version
+
+	// Unchanged files are served from the cache
+	staticOverrideMutex.Lock()
+	staticOverrides[filename].data = []byte("cached")
+	staticOverrideMutex.Unlock()
+	if data, _, _ = staticRead("style.css"); string(data) != "cached" {
+		t.Errorf("unchanged override read again: %q", data)
+	}
+
+	// Changed files are read again
+	if err := os.WriteFile(filename, []byte("override 22"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(filename, time.Now(), time.Now().Add(time.Minute))
+	data, version, _ = staticRead("style.css")
+	if string(data) != "override 22" || version == first {
+		t.Errorf("changed override: %q, version %s", data, version)
+	}
+	if url := staticURL("style.css"); url != "/static/style.css?v="+version {
+		t.Errorf("staticURL() = %s", url)
+	}
+
+	// Removed files fall back to the bundled ones
+	os.Remove(filename)
+	if _, version, _ = staticRead("style.css"); version != bundled {
+		t.Errorf("removed override: version %s, want %s", version, bundled)
+	}
+}
+
+func TestWebHandlerStatic(t *testing.T) {
+	staticTestDir(t)
+	_, version, _ := staticRead("style.css")
+	tests := []struct {
+		url   string
+		code  int
+		cache string
+	}{
+		{"/static/style.css?v=" + version, 200, "public, max-age=31536000, immutable"},
+		{"/static/style.css", 200, "public, max-age=3600"},
+		{"/static/../main.go", 404, ""},
+		{"/static/missing.js", 404, ""},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		webHandlerStatic(w, httptest.NewRequest("GET", test.url, nil))
+		if w.Code != test.code || w.Header().Get("Cache-Control") != test.cache {
+			t.Errorf("%s: status %d, Cache-Control %q", test.url, w.Code, w.Header().Get("Cache-Control"))
+		}
+	}
+}
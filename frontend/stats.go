@@ -0,0 +1,621 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"math"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Number of origin and transit ASes kept in each snapshot
+const statsTopCount = 10
+
+// Number of neighbor ASes whose transit routes are counted, each with a
+// query on every server, and how many of these queries run at once
+const (
+	statsTransitCandidateCount = 20
+	statsTransitConcurrency    = 4
+)
+
+// Route count of a table, from "show route count"
+type statsTable struct {
+	Name     string `json:"name"`
+	Routes   int    `json:"routes"`
+	Networks int    `json:"networks"`
+}
+
+// Route counts of a protocol, summed over its channels
+type statsProtocol struct {
+	Name     string `json:"name"`
+	Proto    string `json:"proto"`
+	Imported int    `json:"imported"`
+	Filtered int    `json:"filtered"`
+	Exported int    `json:"exported"`
+}
+
+// An AS with the number of prefixes it originates or transits
+type statsASN struct {
+	ASN      string `json:"asn"`
+	Prefixes int    `json:"prefixes"`
+}
+
+// Routing table statistics of a server at a time, stored as one JSON line
+// in the stats file
+type statsSnapshot struct {
+	Time      time.Time       `json:"time"`
+	Server    string          `json:"server"`
+	Tables    []statsTable    `json:"tables"`
+	Protocols []statsProtocol `json:"protocols"`
+
+	// Derived from the best routes of the server
+	IPv4 int `json:"ipv4"`
+	IPv6 int `json:"ipv6"`
+	// Number of prefixes by prefix length
+	LengthsIPv4 map[int]int `json:"lengths_ipv4"`
+	LengthsIPv6 map[int]int `json:"lengths_ipv6"`
+	OriginASes  int         `json:"origin_ases"`
+	Origins     []statsASN  `json:"origins"`
+	Transits    []statsASN  `json:"transits"`
+	// Set if the proxy truncated the routes, derived numbers are incomplete
+	Truncated bool `json:"truncated"`
+	// Set if the routes couldn't be queried, derived numbers are missing
+	Error string `json:"error,omitempty"`
+}
+
+var (
+	statsMutex     sync.RWMutex
+	statsSnapshots = make(map[string][]statsSnapshot)
+	statsStore     *jsonLinesStore
+
+	statsCountRegex = regexp.MustCompile(`(?m)^(\d+) of (\d+) routes for (\d+) networks(?: in table (\S+))?`)
+)
+
+func statsEnabled() bool {
+	return setting.statsInterval > 0
+}
+
+// Parse the output of "show route count" into tables
+func statsParseCount(data string) []statsTable {
+	var result []statsTable
+	for _, match := range statsCountRegex.FindAllStringSubmatch(data, -1) {
+		table := statsTable{Name: match[4]}
+		if len(table.Name) == 0 {
+			table.Name = "master"
+		}
+		table.Routes, _ = strconv.Atoi(match[2])
+		table.Networks, _ = strconv.Atoi(match[3])
+		result = append(result, table)
+	}
+	return result
+}
+
+// Sum the route counts of each protocol in "show protocols all"
+func statsParseProtocols(data string) []statsProtocol {
+	var result []statsProtocol
+	for _, protocol := range parseProtocolsAll("", data) {
+		counts := statsProtocol{Name: protocol.Name, Proto: protocol.Proto}
+		for _, channel := range protocol.Channels {
+			counts.Imported += channel.Imported
+			counts.Filtered += channel.Filtered
+			counts.Exported += channel.Exported
+		}
+		result = append(result, counts)
+	}
+	return result
+}
+
+// Sort ASes by count, and keep the given number of top ones
+func statsTopASNs(counts map[string]int, count int) []statsASN {
+	var result []statsASN
+	for asn, prefixes := range counts {
+		result = append(result, statsASN{ASN: asn, Prefixes: prefixes})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Prefixes != result[j].Prefixes {
+			return result[i].Prefixes > result[j].Prefixes
+		}
+		return result[i].ASN < result[j].ASN
+	})
+	if len(result) > count {
+		result = result[:count]
+	}
+	return result
+}
+
+// Counts prefix lengths and origins of the best routes in the output of
+// "show route primary", line by line
+type statsRouteCounter struct {
+	snapshot *statsSnapshot
+	origins  map[string]int
+	prefix   string
+	found    bool
+	// First line of the output, the error if there are no routes
+	first string
+}
+
+func newStatsRouteCounter(snapshot *statsSnapshot) *statsRouteCounter {
+	snapshot.LengthsIPv4 = make(map[int]int)
+	snapshot.LengthsIPv6 = make(map[int]int)
+	return &statsRouteCounter{snapshot: snapshot, origins: make(map[string]int)}
+}
+
+func (counter *statsRouteCounter) add(line string) {
+	if len(counter.first) == 0 {
+		counter.first = strings.TrimSpace(line)
+	}
+	if strings.HasPrefix(line, "... ") {
+		counter.snapshot.Truncated = true
+		return
+	}
+	current := roaPrefixFromLine(line, counter.prefix)
+	if current == counter.prefix {
+		// Alternative routes and attributes of the same network
+		return
+	}
+	counter.prefix = current
+	_, network, err := net.ParseCIDR(current)
+	if err != nil {
+		return
+	}
+	counter.found = true
+	length, _ := network.Mask.Size()
+	if network.IP.To4() != nil {
+		counter.snapshot.LengthsIPv4[length]++
+	} else {
+		counter.snapshot.LengthsIPv6[length]++
+	}
+	if match := asnOriginRegex.FindStringSubmatch(line); match != nil {
+		counter.origins[match[1]]++
+	}
+}
+
+// Store the origins in the snapshot. Returns false if there were no
+// routes, e.g. for errors.
+func (counter *statsRouteCounter) finish() bool {
+	if !counter.found {
+		counter.snapshot.LengthsIPv4 = nil
+		counter.snapshot.LengthsIPv6 = nil
+		return false
+	}
+	counter.snapshot.OriginASes = len(counter.origins)
+	counter.snapshot.Origins = statsTopASNs(counter.origins, statsTopCount)
+	return true
+}
+
+// Count prefix lengths and origins of the best routes of the snapshot's
+// server, streaming them from the proxy, as full tables are large
+func statsStreamRoutes(snapshot *statsSnapshot) error {
+	counter := newStatsRouteCounter(snapshot)
+	if err := streamRequest(snapshot.Server, "bird", "show route primary", counter.add); err != nil {
+		return err
+	}
+	if !counter.finish() {
+		return fmt.Errorf("%s", counter.first)
+	}
+	return nil
+}
+
+// Number of networks in the output of a "count" command, in all tables
+func statsCountNetworks(data string) int {
+	networks := 0
+	for _, table := range statsParseCount(data) {
+		networks += table.Networks
+	}
+	return networks
+}
+
+// Neighbor ASes of BGP sessions, which may be transit ASes of the best
+// routes, with the most imported routes first
+func statsTransitCandidates(protocols []string) []string {
+	imported := make(map[string]int)
+	for _, data := range protocols {
+		for _, protocol := range parseProtocolsAll("", data) {
+			if len(protocol.NeighborAS) == 0 {
+				continue
+			}
+			routes := 0
+			for _, channel := range protocol.Channels {
+				routes += channel.Imported
+			}
+			imported[protocol.NeighborAS] += routes
+		}
+	}
+	var result []string
+	for _, asn := range statsTopASNs(imported, statsTransitCandidateCount) {
+		result = append(result, asn.ASN)
+	}
+	return result
+}
+
+// Command counting the best routes passing through an AS other than as
+// their origin
+func statsTransitCommand(asn string) string {
+	return "show route primary where bgp_path ~ [= * " + asn + " * =] && bgp_path.last != " + asn + " count"
+}
+
+// Count best routes through each candidate transit AS on every server,
+// with one count query per AS, instead of fetching all AS paths. Only a
+// few queries run at the same time.
+func statsCountTransits(servers []string, candidates []string) []map[string]int {
+	result := make([]map[string]int, len(servers))
+	for i := range result {
+		result[i] = make(map[string]int)
+	}
+	var mutex sync.Mutex
+	var wait sync.WaitGroup
+	slots := make(chan struct{}, statsTransitConcurrency)
+	for _, asn := range candidates {
+		wait.Add(1)
+		slots <- struct{}{}
+		go func(asn string) {
+			defer func() {
+				<-slots
+				wait.Done()
+			}()
+			responses := batchRequest(servers, "bird", statsTransitCommand(asn), "en")
+			mutex.Lock()
+			defer mutex.Unlock()
+			for i, response := range responses {
+				if networks := statsCountNetworks(response); networks > 0 {
+					result[i][asn] = networks
+				}
+			}
+		}(asn)
+	}
+	wait.Wait()
+	return result
+}
+
+// Load snapshots from the stats file, and rewrite it without old ones
+func statsLoad() error {
+	statsStore = newJSONLinesStore(setting.statsFile, statsDump)
+	snapshots := make(map[string][]statsSnapshot)
+	err := statsStore.load(func(line []byte) error {
+		var snapshot statsSnapshot
+		if err := json.Unmarshal(line, &snapshot); err != nil {
+			return err
+		}
+		snapshots[snapshot.Server] = append(snapshots[snapshot.Server], snapshot)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	statsMutex.Lock()
+	for server, serverSnapshots := range snapshots {
+		sort.SliceStable(serverSnapshots, func(i, j int) bool {
+			return serverSnapshots[i].Time.Before(serverSnapshots[j].Time)
+		})
+		statsSnapshots[server] = serverSnapshots
+	}
+	statsMutex.Unlock()
+	return statsStore.compact()
+}
+
+// Remove snapshots before the cutoff
+func statsTrim(snapshots []statsSnapshot, cutoff time.Time) []statsSnapshot {
+	first := sort.Search(len(snapshots), func(i int) bool {
+		return !snapshots[i].Time.Before(cutoff)
+	})
+	return snapshots[first:]
+}
+
+// Remove old snapshots of all servers, and write the remaining ones to the
+// stats file
+func statsDump(encoder *json.Encoder) error {
+	cutoff := time.Now().Add(-historyRetention)
+	statsMutex.Lock()
+	defer statsMutex.Unlock()
+	for server, snapshots := range statsSnapshots {
+		snapshots = statsTrim(snapshots, cutoff)
+		if len(snapshots) == 0 {
+			delete(statsSnapshots, server)
+			continue
+		}
+		statsSnapshots[server] = snapshots
+		for _, snapshot := range snapshots {
+			if err := encoder.Encode(snapshot); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func statsAppend(snapshots []statsSnapshot) error {
+	if len(snapshots) == 0 || statsStore == nil {
+		return nil
+	}
+	return statsStore.append(func(encoder *json.Encoder) error {
+		for _, snapshot := range snapshots {
+			if err := encoder.Encode(snapshot); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Collect statistics of all servers, and record them
+func statsPoll() {
+	now := time.Now()
+	counts := batchRequest(setting.servers, "bird", "show route count", "en")
+	protocols := batchRequest(setting.servers, "bird", "show protocols all", "en")
+	ipv4 := batchRequest(setting.servers, "bird", "show route primary where net.type = NET_IP4 count", "en")
+	ipv6 := batchRequest(setting.servers, "bird", "show route primary where net.type = NET_IP6 count", "en")
+	transits := statsCountTransits(setting.servers, statsTransitCandidates(protocols))
+
+	var newSnapshots []statsSnapshot
+	for i, server := range setting.servers {
+		snapshot := statsSnapshot{
+			Time:      now,
+			Server:    server,
+			Tables:    statsParseCount(counts[i]),
+			Protocols: statsParseProtocols(protocols[i]),
+			IPv4:      statsCountNetworks(ipv4[i]),
+			IPv6:      statsCountNetworks(ipv6[i]),
+			Transits:  statsTopASNs(transits[i], statsTopCount),
+		}
+		if len(snapshot.Tables) == 0 && len(snapshot.Protocols) == 0 {
+			// The server is unreachable
+			continue
+		}
+		newSnapshots = append(newSnapshots, snapshot)
+	}
+
+	// Prefix lengths and origins need every route, streamed from all
+	// servers at the same time
+	var wait sync.WaitGroup
+	for i := range newSnapshots {
+		wait.Add(1)
+		go func(snapshot *statsSnapshot) {
+			defer wait.Done()
+			if err := statsStreamRoutes(snapshot); err != nil {
+				snapshot.Error = err.Error()
+			}
+		}(&newSnapshots[i])
+	}
+	wait.Wait()
+
+	cutoff := now.Add(-historyRetention)
+	statsMutex.Lock()
+	for _, snapshot := range newSnapshots {
+		statsSnapshots[snapshot.Server] = statsTrim(append(statsSnapshots[snapshot.Server], snapshot), cutoff)
+	}
+	statsMutex.Unlock()
+
+	if err := statsAppend(newSnapshots); err != nil {
+		println(err.Error())
+	}
+}
+
+func statsPollLoop() {
+	statsPoll()
+	for range time.Tick(time.Duration(setting.statsInterval) * time.Second) {
+		statsPoll()
+	}
+}
+
+// Get snapshots of a server since a time, oldest first
+func statsGet(server string, since time.Time) []statsSnapshot {
+	statsMutex.RLock()
+	defer statsMutex.RUnlock()
+	snapshots := statsSnapshots[server]
+	return append([]statsSnapshot(nil), statsTrim(snapshots, since)...)
+}
+
+// Parse a period of the stats page or API, one of historyUptimePeriods
+func statsParsePeriod(name string) (time.Duration, bool) {
+	for _, period := range historyUptimePeriods {
+		if period.name == name {
+			return period.period, true
+		}
+	}
+	return 0, false
+}
+
+// Colors of series in charts, from the Bootstrap palette
+var statsChartColors = []string{"#007bff", "#28a745", "#dc3545", "#ffc107", "#17a2b8", "#6f42c1", "#fd7e14", "#20c997"}
+
+const (
+	statsChartWidth  = 800
+	statsChartHeight = 200
+	// Space for labels around the plot
+	statsChartLeft   = 60
+	statsChartTop    = 25
+	statsChartBottom = 20
+)
+
+// A line in a chart, with a value for each snapshot, or -1 if unknown
+type statsSeries struct {
+	Name   string
+	Values []int
+}
+
+// Draw series over time as an SVG line chart, from the start to the end of
+// the period
+func statsLineChart(times []time.Time, series []statsSeries, from time.Time, to time.Time) string {
+	max := 0
+	for _, line := range series {
+		for _, value := range line.Values {
+			if value > max {
+				max = value
+			}
+		}
+	}
+	if max == 0 {
+		max = 1
+	}
+	plotWidth := float64(statsChartWidth - statsChartLeft - 10)
+	plotHeight := float64(statsChartHeight - statsChartTop - statsChartBottom)
+	duration := to.Sub(from).Seconds()
+
+	var svg strings.Builder
+	fmt.Fprintf(&svg, `<svg class="w-100" viewBox="0 0 %d %d" xmlns="http://www.w3.org/2000/svg" font-size="11">`, statsChartWidth, statsChartHeight)
+	fmt.Fprintf(&svg, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#ccc"/>`, statsChartLeft, statsChartTop, statsChartLeft, statsChartHeight-statsChartBottom)
+	fmt.Fprintf(&svg, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#ccc"/>`, statsChartLeft, statsChartHeight-statsChartBottom, statsChartWidth-10, statsChartHeight-statsChartBottom)
+	fmt.Fprintf(&svg, `<text x="%d" y="%d" text-anchor="end">%d</text>`, statsChartLeft-5, statsChartTop+4, max)
+	fmt.Fprintf(&svg, `<text x="%d" y="%d" text-anchor="end">0</text>`, statsChartLeft-5, statsChartHeight-statsChartBottom)
+	fmt.Fprintf(&svg, `<text x="%d" y="%d">%s</text>`, statsChartLeft, statsChartHeight-5, from.Format("01-02 15:04"))
+	fmt.Fprintf(&svg, `<text x="%d" y="%d" text-anchor="end">%s</text>`, statsChartWidth-10, statsChartHeight-5, to.Format("01-02 15:04"))
+
+	legend := statsChartLeft
+	for i, line := range series {
+		color := statsChartColors[i%len(statsChartColors)]
+		fmt.Fprintf(&svg, `<rect x="%d" y="5" width="10" height="10" fill="%s"/>`, legend, color)
+		fmt.Fprintf(&svg, `<text x="%d" y="14">%s</text>`, legend+14, html.EscapeString(line.Name))
+		legend += 24 + 7*len(line.Name)
+
+		// Break the line where values are unknown
+		var points []string
+		flush := func() {
+			if len(points) == 1 {
+				split := strings.Split(points[0], ",")
+				fmt.Fprintf(&svg, `<circle cx="%s" cy="%s" r="2" fill="%s"/>`, split[0], split[1], color)
+			} else if len(points) > 1 {
+				fmt.Fprintf(&svg, `<polyline points="%s" fill="none" stroke="%s" stroke-width="1.5"/>`, strings.Join(points, " "), color)
+			}
+			points = nil
+		}
+		for j, value := range line.Values {
+			if value < 0 {
+				flush()
+				continue
+			}
+			x := float64(statsChartLeft) + plotWidth*math.Max(0, times[j].Sub(from).Seconds())/duration
+			y := float64(statsChartTop) + plotHeight*(1-float64(value)/float64(max))
+			points = append(points, fmt.Sprintf("%.1f,%.1f", x, y))
+		}
+		flush()
+	}
+	svg.WriteString(`</svg>`)
+	return svg.String()
+}
+
+// Draw the number of prefixes by prefix length as an SVG bar chart
+func statsBarChart(lengths map[int]int, maxLength int) string {
+	max := 1
+	for _, count := range lengths {
+		if count > max {
+			max = count
+		}
+	}
+	plotHeight := float64(statsChartHeight - statsChartTop - statsChartBottom)
+	barWidth := float64(statsChartWidth-statsChartLeft-10) / float64(maxLength+1)
+
+	var svg strings.Builder
+	fmt.Fprintf(&svg, `<svg class="w-100" viewBox="0 0 %d %d" xmlns="http://www.w3.org/2000/svg" font-size="11">`, statsChartWidth, statsChartHeight)
+	fmt.Fprintf(&svg, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#ccc"/>`, statsChartLeft, statsChartHeight-statsChartBottom, statsChartWidth-10, statsChartHeight-statsChartBottom)
+	fmt.Fprintf(&svg, `<text x="%d" y="%d" text-anchor="end">%d</text>`, statsChartLeft-5, statsChartTop+4, max)
+	fmt.Fprintf(&svg, `<text x="%d" y="%d" text-anchor="end">0</text>`, statsChartLeft-5, statsChartHeight-statsChartBottom)
+	for length := 0; length <= maxLength; length++ {
+		x := float64(statsChartLeft) + barWidth*float64(length)
+		if count := lengths[length]; count > 0 {
+			height := plotHeight * float64(count) / float64(max)
+			fmt.Fprintf(&svg, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"><title>/%d: %d</title></rect>`,
+				x+1, float64(statsChartHeight-statsChartBottom)-height, barWidth-2, height, statsChartColors[0], length, count)
+		}
+		if length%8 == 0 {
+			fmt.Fprintf(&svg, `<text x="%.1f" y="%d" text-anchor="middle">/%d</text>`, x+barWidth/2, statsChartHeight-5, length)
+		}
+	}
+	svg.WriteString(`</svg>`)
+	return svg.String()
+}
+
+// Charts of a server over a period, and of its latest snapshot
+func statsCharts(lang string, snapshots []statsSnapshot, from time.Time, to time.Time) []tmplStatsChart {
+	var times []time.Time
+	var tableNames []string
+	tableIndex := make(map[string]int)
+	for _, snapshot := range snapshots {
+		times = append(times, snapshot.Time)
+		for _, table := range snapshot.Tables {
+			if _, ok := tableIndex[table.Name]; !ok {
+				tableIndex[table.Name] = len(tableNames)
+				tableNames = append(tableNames, table.Name)
+			}
+		}
+	}
+
+	tables := make([]statsSeries, len(tableNames))
+	for i, name := range tableNames {
+		tables[i].Name = name
+	}
+	families := []statsSeries{{Name: "IPv4"}, {Name: "IPv6"}}
+	origins := []statsSeries{{Name: i18nTranslate(lang, "origin ASes")}}
+	for j, snapshot := range snapshots {
+		for i := range tables {
+			tables[i].Values = append(tables[i].Values, -1)
+		}
+		for _, table := range snapshot.Tables {
+			tables[tableIndex[table.Name]].Values[j] = table.Routes
+		}
+		if len(snapshot.Error) > 0 {
+			families[0].Values = append(families[0].Values, -1)
+			families[1].Values = append(families[1].Values, -1)
+			origins[0].Values = append(origins[0].Values, -1)
+		} else {
+			families[0].Values = append(families[0].Values, snapshot.IPv4)
+			families[1].Values = append(families[1].Values, snapshot.IPv6)
+			origins[0].Values = append(origins[0].Values, snapshot.OriginASes)
+		}
+	}
+
+	charts := []tmplStatsChart{
+		{Title: "routes per table", SVG: statsLineChart(times, tables, from, to)},
+		{Title: "prefixes by address family", SVG: statsLineChart(times, families, from, to)},
+		{Title: "origin ASes", SVG: statsLineChart(times, origins, from, to)},
+	}
+	if latest := snapshots[len(snapshots)-1]; len(latest.Error) == 0 {
+		charts = append(charts,
+			tmplStatsChart{Title: "IPv4 prefix lengths", SVG: statsBarChart(latest.LengthsIPv4, 32)},
+			tmplStatsChart{Title: "IPv6 prefix lengths", SVG: statsBarChart(latest.LengthsIPv6, 128)},
+		)
+	}
+	return charts
+}
+
+// Routing table statistics of servers over a period, at
+// /stats/<servers>/?period=<period>
+func webHandlerStats(w http.ResponseWriter, r *http.Request) {
+	split := strings.SplitN(r.URL.Path[1:], "/", 3)
+	lang := i18nNegotiate(r)
+	data := tmplStats{
+		Enabled:    statsEnabled(),
+		Period:     r.URL.Query().Get("period"),
+		ServersURL: split[1],
+	}
+	for _, period := range historyUptimePeriods {
+		data.Periods = append(data.Periods, period.name)
+	}
+	period, ok := statsParsePeriod(data.Period)
+	if !ok {
+		data.Period = "24h"
+		period = 24 * time.Hour
+	}
+
+	now := time.Now()
+	for _, server := range strings.Split(split[1], "+") {
+		if !data.Enabled || !isValidServer(server) {
+			continue
+		}
+		result := tmplStatsServer{Server: server}
+		if snapshots := statsGet(server, now.Add(-period)); len(snapshots) > 0 {
+			result.Latest = &snapshots[len(snapshots)-1]
+			result.Charts = statsCharts(lang, snapshots, now.Add(-period), now)
+		}
+		data.Servers = append(data.Servers, result)
+	}
+
+	renderTemplate(w, r, " - stats", renderPageContent(lang, "stats", data))
+}
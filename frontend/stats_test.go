@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatsStreamRoutes(t *testing.T) {
+	data := `Table master4:
+10.0.0.0/24          unicast [peer1 2024-01-01] * (100) [AS4242420001i]
+	via 172.20.0.1 on eth0
+10.0.1.0/24          unicast [peer1 2024-01-01] * (100) [AS4242420001i]
+	via 172.20.0.1 on eth0
+172.20.0.0/16        unicast [peer2 2024-01-01] * (100) [AS4242420002i]
+	via 172.20.0.2 on eth0
+192.168.0.0/24       unicast [static1 2024-01-01] * (200)
+	dev eth1
+Table master6:
+fd00::/48            unicast [peer1 2024-01-01] * (100) [AS4242420002i]
+	via fe80::1 on eth0
+`
+	testProxy(t, []string{"a", "b", "c"}, func(w http.ResponseWriter, r *http.Request) {
+		switch testProxyServer(r) {
+		case "a":
+			w.Write([]byte(data))
+		case "b":
+			w.Write([]byte(data + "... output truncated at 100 bytes\n"))
+		default:
+			w.Write([]byte("syntax error, unexpected CF_SYM_UNDEFINED\n"))
+		}
+	})
+
+	snapshot := statsSnapshot{Server: "a"}
+	if err := statsStreamRoutes(&snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[int]int{24: 3, 16: 1}; !reflect.DeepEqual(snapshot.LengthsIPv4, want) {
+		t.Errorf("IPv4 lengths %v, want %v", snapshot.LengthsIPv4, want)
+	}
+	if want := map[int]int{48: 1}; !reflect.DeepEqual(snapshot.LengthsIPv6, want) {
+		t.Errorf("IPv6 lengths %v, want %v", snapshot.LengthsIPv6, want)
+	}
+	if snapshot.OriginASes != 2 {
+		t.Errorf("%d origin ASes, want 2", snapshot.OriginASes)
+	}
+	want := []statsASN{{"4242420001", 2}, {"4242420002", 2}}
+	if !reflect.DeepEqual(snapshot.Origins, want) {
+		t.Errorf("origins %v, want %v", snapshot.Origins, want)
+	}
+	if snapshot.Truncated {
+		t.Error("truncated without a note of the proxy")
+	}
+
+	snapshot = statsSnapshot{Server: "b"}
+	if err := statsStreamRoutes(&snapshot); err != nil || !snapshot.Truncated {
+		t.Error("truncated routes not noticed")
+	}
+	snapshot = statsSnapshot{Server: "c"}
+	if err := statsStreamRoutes(&snapshot); err == nil || err.Error() != "syntax error, unexpected CF_SYM_UNDEFINED" {
+		t.Errorf("error %v for an error output", err)
+	}
+}
+
+func TestStatsCountNetworks(t *testing.T) {
+	data := "30 of 40 routes for 30 networks in table master4\n5 of 5 routes for 5 networks in table master6\nTotal: 35 of 45 routes for 35 networks in 2 tables\n"
+	if networks := statsCountNetworks(data); networks != 35 {
+		t.Errorf("%d networks, want 35", networks)
+	}
+	if networks := statsCountNetworks("syntax error\n"); networks != 0 {
+		t.Errorf("%d networks in an error, want 0", networks)
+	}
+}
+
+const statsTestProtocols = `Name       Proto      Table      State  Since         Info
+static1    Static     master4    up     2024-01-01
+  Channel ipv4
+    Routes:         1 imported, 0 exported, 1 preferred
+peer1      BGP        ---        up     2024-01-01    Established
+  BGP state:          Established
+    Neighbor address: fe80::1%eth0
+    Neighbor AS:      4242420002
+  Channel ipv4
+    Routes:         100 imported, 5 filtered, 50 exported, 80 preferred
+  Channel ipv6
+    Routes:         20 imported, 0 exported, 20 preferred
+peer2      BGP        ---        up     2024-01-01    Established
+  BGP state:          Established
+    Neighbor address: fe80::2%eth0
+    Neighbor AS:      4242420003
+  Channel ipv4
+    Routes:         200 imported, 0 exported, 150 preferred
+`
+
+func TestStatsTransitCandidates(t *testing.T) {
+	got := statsTransitCandidates([]string{statsTestProtocols, "request failed: timeout\n"})
+	if want := []string{"4242420003", "4242420002"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("candidates %v, want %v", got, want)
+	}
+}
+
+func TestStatsCountTransits(t *testing.T) {
+	testProxy(t, []string{"a", "b"}, func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query().Get("q")
+		switch {
+		case testProxyServer(r) == "b":
+			w.Write([]byte("syntax error\n"))
+		case strings.Contains(query, " 4242420002 "):
+			w.Write([]byte("30 of 30 routes for 30 networks in table master4\n5 of 5 routes for 5 networks in table master6\nTotal: 35 of 35 routes for 35 networks in 2 tables\n"))
+		default:
+			w.Write([]byte("0 of 0 routes for 0 networks in table master4\n"))
+		}
+	})
+
+	got := statsCountTransits([]string{"a", "b"}, []string{"4242420002", "4242420003"})
+	want := []map[string]int{{"4242420002": 35}, {}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("transits %v, want %v", got, want)
+	}
+	if command := statsTransitCommand("4242420002"); command != "show route primary where bgp_path ~ [= * 4242420002 * =] && bgp_path.last != 4242420002 count" {
+		t.Errorf("command %q", command)
+	}
+}
+
+func TestStatsDump(t *testing.T) {
+	saved := statsSnapshots
+	defer func() { statsSnapshots = saved }()
+	now := time.Now()
+	statsSnapshots = map[string][]statsSnapshot{
+		"a": {
+			{Time: now.Add(-historyRetention - time.Hour), Server: "a"},
+			{Time: now.Add(-time.Hour), Server: "a"},
+		},
+		// Servers without recent snapshots are removed
+		"b": {{Time: now.Add(-historyRetention - time.Hour), Server: "b"}},
+	}
+
+	var buffer bytes.Buffer
+	if err := statsDump(json.NewEncoder(&buffer)); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(buffer.String(), "\n"); lines != 1 {
+		t.Errorf("%d snapshots written, want 1", lines)
+	}
+	if len(statsSnapshots) != 1 || len(statsSnapshots["a"]) != 1 {
+		t.Errorf("snapshots in memory %v, want one of a", statsSnapshots)
+	}
+}
@@ -1,7 +1,11 @@
 package main
 
 import (
+	"bytes"
+	"crypto/subtle"
 	"encoding/json"
+	"fmt"
+	"mime/multipart"
 	"net/http"
 	"strconv"
 	"strings"
@@ -11,147 +15,458 @@ type tgChat struct {
 	ID int64 `json:"id"`
 }
 
+type tgUser struct {
+	ID           int64  `json:"id"`
+	Username     string `json:"username"`
+	LanguageCode string `json:"language_code"`
+}
+
 type tgMessage struct {
-	MessageID int64  `json:"message_id"`
-	Chat      tgChat `json:"chat"`
-	Text      string `json:"text"`
+	MessageID      int64      `json:"message_id"`
+	From           tgUser     `json:"from"`
+	Chat           tgChat     `json:"chat"`
+	Text           string     `json:"text"`
+	ReplyToMessage *tgMessage `json:"reply_to_message"`
 }
 
-type tgWebhookRequest struct {
+// Sent when a button of an inline keyboard is pressed
+type tgCallbackQuery struct {
+	ID      string    `json:"id"`
+	From    tgUser    `json:"from"`
 	Message tgMessage `json:"message"`
+	Data    string    `json:"data"`
 }
 
-type tgWebhookResponse struct {
-	Method           string `json:"method"`
-	ChatID           int64  `json:"chat_id"`
-	Text             string `json:"text"`
-	ReplyToMessageID int64  `json:"reply_to_message_id"`
-	ParseMode        string `json:"parse_mode"`
+// An incoming message or button press, from the webhook or getUpdates
+type tgUpdate struct {
+	UpdateID      int64            `json:"update_id"`
+	Message       tgMessage        `json:"message"`
+	CallbackQuery *tgCallbackQuery `json:"callback_query"`
 }
 
-func telegramIsCommand(message string, command string) bool {
-	b := false
-	b = b || strings.HasPrefix(message, "/"+command+"@")
-	b = b || strings.HasPrefix(message, "/"+command+" ")
-	b = b || message == "/"+command
-	return b
+type tgInlineKeyboardButton struct {
+	Text         string `json:"text"`
+	CallbackData string `json:"callback_data"`
 }
 
-func telegramDefaultPostProcess(s string) string {
-	return strings.TrimSpace(s)
+type tgInlineKeyboardMarkup struct {
+	InlineKeyboard [][]tgInlineKeyboardButton `json:"inline_keyboard"`
 }
 
-func telegramBatchRequestFormat(servers []string, endpoint string, command string, postProcess func(string) string) string {
-	results := batchRequest(servers, endpoint, command)
-	result := ""
-	for i, r := range results {
-		if len(servers) > 1 {
-			result += servers[i] + "\n"
-		}
-		result += postProcess(r) + "\n\n"
-	}
-	return result
+// A Bot API method call, returned as the webhook response or sent to the
+// Bot API with the bot token
+type tgWebhookResponse struct {
+	Method           string                  `json:"method"`
+	ChatID           int64                   `json:"chat_id,omitempty"`
+	MessageID        int64                   `json:"message_id,omitempty"`
+	Text             string                  `json:"text,omitempty"`
+	ReplyToMessageID int64                   `json:"reply_to_message_id,omitempty"`
+	ParseMode        string                  `json:"parse_mode,omitempty"`
+	ReplyMarkup      *tgInlineKeyboardMarkup `json:"reply_markup,omitempty"`
+	CallbackQueryID  string                  `json:"callback_query_id,omitempty"`
 }
 
-func webHandlerTelegramBot(w http.ResponseWriter, r *http.Request) {
-	// Parse only needed fields of incoming JSON body
-	var err error
-	var request tgWebhookRequest
-	err = json.NewDecoder(r.Body).Decode(&request)
+// Maximum length of a message, and number of messages a result may be
+// split into before it is sent as a file instead
+const (
+	telegramMessageLimit = 4096
+	telegramMaxMessages  = 4
+)
+
+func telegramAPIURL(method string) string {
+	return strings.TrimSuffix(setting.telegramAPIBase, "/") + "/bot" + setting.telegramToken + "/" + method
+}
+
+// Call a Bot API method with JSON parameters
+func telegramAPI(method string, params interface{}) error {
+	return alertPostJSON(telegramAPIURL(method), params)
+}
+
+// Call a Bot API method uploading a file, as a photo if it's an image
+func telegramAPIUpload(chatID int64, replyTo int64, file *botFile) error {
+	method, field := "sendDocument", "document"
+	if file.Image {
+		method, field = "sendPhoto", "photo"
+	}
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("chat_id", strconv.FormatInt(chatID, 10))
+	if replyTo != 0 {
+		writer.WriteField("reply_to_message_id", strconv.FormatInt(replyTo, 10))
+	}
+	if len(file.Caption) > 0 {
+		writer.WriteField("caption", file.Caption)
+	}
+	part, err := writer.CreateFormFile(field, file.Name)
 	if err != nil {
-		println(err.Error())
-		return
+		return err
+	}
+	part.Write(file.Data)
+	if err := writer.Close(); err != nil {
+		return err
 	}
 
-	// Do not respond if not a tg Bot command (starting with /)
-	if len(request.Message.Text) == 0 || request.Message.Text[0] != '/' {
-		return
+	response, err := http.Post(telegramAPIURL(method), writer.FormDataContentType(), &body)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("HTTP status %s", response.Status)
 	}
+	return nil
+}
 
-	// Select only one server based on webhook URL
-	var servers []string
-	if len(r.URL.Path[len("/telegram/"):]) == 0 {
-		servers = setting.servers
-	} else {
-		servers = strings.Split(r.URL.Path[len("/telegram/"):], "+")
+// Chat key of the default servers, plain chat IDs of older state files
+// are converted by botLoadChatServers
+func telegramChatKey(chatID int64) string {
+	return "telegram:" + strconv.FormatInt(chatID, 10)
+}
+
+// Context of a command in a chat, with the servers in the webhook URL, or
+// all servers, as default
+func telegramContext(chatID int64, user tgUser, defaultServers []string) botContext {
+	return botContext{
+		Chat:           telegramChatKey(chatID),
+		User:           "telegram:" + strconv.FormatInt(user.ID, 10),
+		Username:       user.Username,
+		DefaultServers: defaultServers,
+		Lang:           telegramLanguage(user),
+		Prefix:         "/",
 	}
+}
 
-	// Parse target
-	target := ""
-	if strings.Contains(request.Message.Text, " ") {
-		target = strings.Join(strings.Split(request.Message.Text, " ")[1:], " ")
-		target = strings.TrimSpace(target)
+// Split a result into code blocks fitting in messages
+func telegramSplitMessage(text string) []string {
+	const wrapper = "```\n\n```"
+	result := botSplitMessage(text, telegramMessageLimit-len(wrapper))
+	for i := range result {
+		result[i] = "```\n" + result[i] + "\n```"
 	}
+	return result
+}
 
-	// Execute command
-	commandResult := ""
+// Keyboard to run the command again on another server, or on all servers
+func telegramServersKeyboard(selected []string) *tgInlineKeyboardMarkup {
+	if len(setting.servers) <= 1 {
+		return nil
+	}
+	isSelected := func(server string) bool {
+		return len(selected) == 1 && selected[0] == server
+	}
 
-	// - traceroute
-	if telegramIsCommand(request.Message.Text, "trace") {
-		commandResult = telegramBatchRequestFormat(servers, "traceroute", target, telegramDefaultPostProcess)
+	var keyboard tgInlineKeyboardMarkup
+	var row []tgInlineKeyboardButton
+	for _, server := range setting.servers {
+		label := server
+		if isSelected(server) {
+			label = "✓ " + label
+		}
+		row = append(row, tgInlineKeyboardButton{Text: label, CallbackData: "run:" + server})
+		if len(row) == 3 {
+			keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, row)
+			row = nil
+		}
+	}
+	if len(row) > 0 {
+		keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, row)
+	}
+	keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, []tgInlineKeyboardButton{
+		{Text: "*", CallbackData: "run:*"},
+	})
+	return &keyboard
+}
 
-	} else if telegramIsCommand(request.Message.Text, "route") {
-		commandResult = telegramBatchRequestFormat(servers, "bird", "show route for "+target+" primary", telegramDefaultPostProcess)
+// Keyboard to toggle default servers of a chat
+func telegramDefaultsKeyboard(chatID int64) *tgInlineKeyboardMarkup {
+	botChatServersMutex.RLock()
+	defaults := botChatServers[telegramChatKey(chatID)]
+	botChatServersMutex.RUnlock()
 
-	} else if telegramIsCommand(request.Message.Text, "path") {
-		commandResult = telegramBatchRequestFormat(servers, "bird", "show route for "+target+" all primary", func(result string) string {
-			for _, s := range strings.Split(result, "\n") {
-				if strings.Contains(s, "BGP.as_path: ") {
-					return strings.TrimSpace(strings.Split(s, ":")[1])
-				}
+	var keyboard tgInlineKeyboardMarkup
+	var row []tgInlineKeyboardButton
+	for _, server := range setting.servers {
+		label := server
+		for _, defaultServer := range defaults {
+			if defaultServer == server {
+				label = "✓ " + label
 			}
-			return ""
+		}
+		row = append(row, tgInlineKeyboardButton{Text: label, CallbackData: "default:" + server})
+		if len(row) == 3 {
+			keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, row)
+			row = nil
+		}
+	}
+	if len(row) > 0 {
+		keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, row)
+	}
+	keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, []tgInlineKeyboardButton{
+		{Text: "↺", CallbackData: "default:"},
+	})
+	return &keyboard
+}
+
+// Change default servers with "/servers a b", or show them with a keyboard
+func telegramServersCommand(message tgMessage, ctx botContext, target string) tgWebhookResponse {
+	return tgWebhookResponse{
+		Method:           "sendMessage",
+		ChatID:           message.Chat.ID,
+		Text:             botServersCommand(ctx, target),
+		ReplyToMessageID: message.MessageID,
+		ReplyMarkup:      telegramDefaultsKeyboard(message.Chat.ID),
+	}
+}
+
+// Replies to send, the first one as the webhook response, and the others
+// through the Bot API if the bot token is set
+type telegramReplies struct {
+	calls   []tgWebhookResponse
+	files   []*botFile
+	chatID  int64
+	replyTo int64
+}
+
+// Add the result of a command as messages, or as a file if it's too long.
+// The first message replaces the given one if messageID is set.
+func (replies *telegramReplies) addResult(result string, keyboard *tgInlineKeyboardMarkup, messageID int64, lang string) {
+	parts := telegramSplitMessage(result)
+	if len(parts) > telegramMaxMessages && len(setting.telegramToken) > 0 {
+		replies.files = append(replies.files, &botFile{
+			Name: "result.txt",
+			Data: []byte(result),
 		})
+		parts = []string{i18nTranslate(lang, "The result is too long, and is sent as a file.")}
+	} else if len(parts) > 1 && len(setting.telegramToken) == 0 {
+		// Only one message can be sent as the webhook response
+		parts = parts[:1]
+		parts[0] = strings.TrimSuffix(parts[0], "\n```") + "\n```\n" + i18nTranslate(lang, "The result is truncated.")
+	}
 
-	} else if telegramIsCommand(request.Message.Text, "whois") {
-		if setting.netSpecificMode == "dn42" {
-			targetNumber, err := strconv.ParseUint(target, 10, 64)
-			if err == nil {
-				if targetNumber < 10000 {
-					targetNumber += 4242420000
-					target = "AS" + strconv.FormatUint(targetNumber, 10)
-				} else {
-					target = "AS" + target
+	for i, part := range parts {
+		call := tgWebhookResponse{
+			Method:    "sendMessage",
+			ChatID:    replies.chatID,
+			Text:      part,
+			ParseMode: "Markdown",
+		}
+		if i == 0 {
+			if messageID != 0 {
+				call.Method = "editMessageText"
+				call.MessageID = messageID
+			} else {
+				call.ReplyToMessageID = replies.replyTo
+			}
+			call.ReplyMarkup = keyboard
+		}
+		replies.calls = append(replies.calls, call)
+	}
+}
+
+// Write the reply as the webhook response, or send all replies through
+// the Bot API in order if there are more
+func (replies *telegramReplies) send(w http.ResponseWriter) {
+	// Without the bot token, only the first reply can be sent
+	if len(setting.telegramToken) == 0 || len(replies.calls) == 1 && len(replies.files) == 0 {
+		if len(replies.calls) == 0 {
+			return
+		}
+		w.Header().Add("Content-Type", "application/json")
+		data, err := json.Marshal(replies.calls[0])
+		if err != nil {
+			println(err.Error())
+			return
+		}
+		w.Write(data)
+		return
+	}
+	go replies.sendAPI()
+}
+
+// Send all replies through the Bot API in order
+func (replies *telegramReplies) sendAPI() {
+	for _, call := range replies.calls {
+		if err := telegramAPI(call.Method, call); err != nil {
+			println("telegram " + call.Method + ": " + err.Error())
+		}
+	}
+	for _, file := range replies.files {
+		if err := telegramAPIUpload(replies.chatID, replies.replyTo, file); err != nil {
+			println("telegram upload: " + err.Error())
+		}
+	}
+}
+
+// Reply language of a user
+func telegramLanguage(user tgUser) string {
+	lang := i18nMatch(user.LanguageCode)
+	if len(lang) == 0 {
+		lang = setting.language
+	}
+	return lang
+}
+
+// Handle a button press on an inline keyboard
+func telegramHandleCallback(query *tgCallbackQuery, webhookServers []string, replies *telegramReplies) {
+	ctx := telegramContext(query.Message.Chat.ID, query.From, webhookServers)
+	chatID := query.Message.Chat.ID
+	replies.chatID = chatID
+	answer := tgWebhookResponse{Method: "answerCallbackQuery", CallbackQueryID: query.ID}
+
+	if strings.HasPrefix(query.Data, "default:") {
+		server := strings.TrimPrefix(query.Data, "default:")
+		var servers []string
+		if len(server) > 0 && isValidServer(server) {
+			// Toggle the server in the chat defaults
+			servers = append(servers, botGetChatServers(ctx.Chat, nil)...)
+			found := false
+			for i, s := range servers {
+				if s == server {
+					servers = append(servers[:i], servers[i+1:]...)
+					found = true
+					break
 				}
 			}
+			if !found {
+				servers = append(servers, server)
+			}
+		}
+		botSetChatServers(ctx.Chat, servers)
+		replies.calls = append(replies.calls, tgWebhookResponse{
+			Method:      "editMessageText",
+			ChatID:      chatID,
+			MessageID:   query.Message.MessageID,
+			Text:        botDefaultsText(ctx),
+			ReplyMarkup: telegramDefaultsKeyboard(chatID),
+		}, answer)
+
+	} else if strings.HasPrefix(query.Data, "run:") && query.Message.ReplyToMessage != nil {
+		// Run the command the result was a reply to again
+		servers := webhookServers
+		if server := strings.TrimPrefix(query.Data, "run:"); server != "*" {
+			servers = []string{server}
 		}
-		tempResult := whois(target)
-		if setting.netSpecificMode == "dn42" {
-			commandResult = dn42WhoisFilter(tempResult)
-		} else {
-			commandResult = tempResult
+		message := query.Message.ReplyToMessage
+		replies.replyTo = message.MessageID
+		if command, ok := botParseCommand(message.Text, "/"); ok && command.Name != "servers" {
+			if result, ok := botRun(ctx, command, servers); ok && result.File != nil {
+				replies.files = append(replies.files, result.File)
+			} else if ok {
+				replies.addResult(result.Text, telegramServersKeyboard(servers), query.Message.MessageID, ctx.Lang)
+			}
 		}
+		// Stop the loading indicator on the button
+		replies.calls = append(replies.calls, answer)
 
-	} else if telegramIsCommand(request.Message.Text, "help") {
-		commandResult = `
-/path <IP>
-/route <IP>
-/trace <IP>
-/whois <Target>
-		`
 	} else {
-		return
+		replies.calls = append(replies.calls, answer)
 	}
+}
 
-	commandResult = strings.TrimSpace(commandResult)
-	if len(commandResult) <= 0 {
-		commandResult = "empty result"
+// Handle an update received by the webhook or by polling, with commands
+// running on the given servers unless the chat has its own default
+func telegramHandleUpdate(update tgUpdate, defaultServers []string) *telegramReplies {
+	replies := &telegramReplies{}
+	if query := update.CallbackQuery; query != nil {
+		ctx := telegramContext(query.Message.Chat.ID, query.From, defaultServers)
+		if telegramAllowCommand(ctx, query.Data, replies, tgWebhookResponse{
+			Method:          "answerCallbackQuery",
+			CallbackQueryID: query.ID,
+		}) {
+			telegramHandleCallback(query, defaultServers, replies)
+		}
+		return replies
+	}
+
+	// Do not respond if not a tg Bot command (starting with /)
+	message := update.Message
+	command, ok := botParseCommand(message.Text, "/")
+	if !ok {
+		return replies
 	}
 
-	// Create a JSON response
-	w.Header().Add("Content-Type", "application/json")
-	response := &tgWebhookResponse{
+	// Reply in the language of the user if possible
+	ctx := telegramContext(message.Chat.ID, message.From, defaultServers)
+	replies.chatID = message.Chat.ID
+	replies.replyTo = message.MessageID
+
+	if !telegramAllowCommand(ctx, message.Text, replies, tgWebhookResponse{
 		Method:           "sendMessage",
-		ChatID:           request.Message.Chat.ID,
-		Text:             "```\n" + commandResult + "\n```",
-		ReplyToMessageID: request.Message.MessageID,
-		ParseMode:        "Markdown",
+		ChatID:           message.Chat.ID,
+		ReplyToMessageID: message.MessageID,
+	}) {
+		return replies
+	}
+
+	if command.Name == "servers" {
+		replies.calls = append(replies.calls, telegramServersCommand(message, ctx, command.Target))
+		return replies
+	}
+
+	result, ok := botRun(ctx, command, nil)
+	if !ok {
+		return replies
+	}
+	if result.File != nil {
+		if len(setting.telegramToken) > 0 {
+			replies.files = append(replies.files, result.File)
+			return replies
+		}
+		result.Text = i18nTranslate(ctx.Lang, "Files can only be sent with the bot token set.")
+	}
+
+	var keyboard *tgInlineKeyboardMarkup
+	if len(result.Servers) > 0 {
+		keyboard = telegramServersKeyboard(result.Servers)
+	}
+	replies.addResult(result.Text, keyboard, 0, ctx.Lang)
+	return replies
+}
+
+// Check access of a command or button press. If rejected with a notice,
+// it is sent as the given reply.
+func telegramAllowCommand(ctx botContext, text string, replies *telegramReplies, reply tgWebhookResponse) bool {
+	allowed, notice := botAllow(ctx, text)
+	if !allowed && len(notice) > 0 {
+		reply.Text = notice
+		replies.calls = append(replies.calls, reply)
+	}
+	return allowed
+}
+
+// Check if the webhook request comes from Telegram, with the secret token
+// given when setting the webhook. Without a secret, anyone could send
+// commands, so all requests are refused.
+func telegramCheckSecret(r *http.Request) bool {
+	if len(setting.telegramSecret) == 0 {
+		return false
 	}
-	data, err := json.Marshal(response)
+	secret := r.Header.Get("X-Telegram-Bot-Api-Secret-Token")
+	return subtle.ConstantTimeCompare([]byte(secret), []byte(setting.telegramSecret)) == 1
+}
+
+func webHandlerTelegramBot(w http.ResponseWriter, r *http.Request) {
+	if !telegramCheckSecret(r) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	// Parse only needed fields of incoming JSON body
+	var err error
+	var update tgUpdate
+	err = json.NewDecoder(r.Body).Decode(&update)
 	if err != nil {
 		println(err.Error())
 		return
 	}
-	// println(string(data))
-	w.Write(data)
+
+	// Servers to use by default based on webhook URL
+	var webhookServers []string
+	if len(r.URL.Path[len("/telegram/"):]) == 0 {
+		webhookServers = setting.servers
+	} else {
+		webhookServers = strings.Split(r.URL.Path[len("/telegram/"):], "+")
+	}
+
+	telegramHandleUpdate(update, webhookServers).send(w)
 }
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Seconds to wait for updates in each getUpdates request
+const telegramPollTimeout = 50
+
+type tgGetUpdatesResponse struct {
+	OK          bool       `json:"ok"`
+	Description string     `json:"description"`
+	Result      []tgUpdate `json:"result"`
+}
+
+func telegramGetUpdates(client *http.Client, offset int64) ([]tgUpdate, error) {
+	params, err := json.Marshal(map[string]interface{}{
+		"offset":          offset,
+		"timeout":         telegramPollTimeout,
+		"allowed_updates": []string{"message", "callback_query"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	response, err := client.Post(telegramAPIURL("getUpdates"), "application/json", bytes.NewReader(params))
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	var result tgGetUpdatesResponse
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("HTTP status %s: %s", response.Status, err.Error())
+	}
+	if !result.OK {
+		return nil, fmt.Errorf("%s", result.Description)
+	}
+	return result.Result, nil
+}
+
+// Receive updates with getUpdates instead of a webhook, for frontends not
+// reachable from the internet. Replies are sent through the Bot API.
+func telegramPollLoop() {
+	client := &http.Client{Timeout: (telegramPollTimeout + 10) * time.Second}
+	var offset int64
+	for {
+		updates, err := telegramGetUpdates(client, offset)
+		if err != nil {
+			println("telegram getUpdates: " + err.Error())
+			time.Sleep(5 * time.Second)
+			continue
+		}
+		for _, update := range updates {
+			// Confirm the update with the next request, so it's not received again
+			offset = update.UpdateID + 1
+			go func(update tgUpdate) {
+				telegramHandleUpdate(update, setting.servers).sendAPI()
+			}(update)
+		}
+	}
+}
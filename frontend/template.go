@@ -1,9 +1,15 @@
 package main
 
 import (
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"strings"
 	"text/template"
 )
 
+// Data of the "page" template, the layout around every page
 type tmplArguments struct {
 	// Global options
 	Options map[string]string
@@ -25,28 +31,276 @@ type tmplArguments struct {
 	Title   string
 	Brand   string
 	Content string
+
+	// Language of the page, and available languages with their own names
+	Lang      string
+	Languages map[string]string
+
+	// Logged in operator, if any
+	Operator string
+}
+
+// A protocol in the "summary" template, columns of "show protocols"
+type tmplSummaryRow struct {
+	Name  string
+	Proto string
+	Table string
+	State string
+	Since string
+	Info  string
+	// Flaps in the last 24 hours, if history is enabled
+	Flaps int
+}
+
+type tmplSummaryServer struct {
+	Server string
+	// Output of BIRD, and the same formatted as HTML
+	Raw    string
+	Result string
+	// Empty if the output can't be parsed, e.g. for error messages
+	Headers []string
+	Rows    []tmplSummaryRow
+}
+
+// Data of the "summary" template, protocols of each server
+type tmplSummary struct {
+	Command string
+	Servers []tmplSummaryServer
+	// Whether protocol history is recorded, and flaps are counted
+	History bool
+	// Whether an operator is logged in, and actions are shown
+	Operator bool
+}
+
+type tmplBirdServer struct {
+	Server string
+	// Output of BIRD or traceroute, and the same formatted as HTML
+	Raw    string
+	Result string
+	// Number of networks of paginated commands
+	Count string
+}
+
+// Data of the "detail" template for protocol details, and the "route"
+// template for routes, other BIRD commands and traceroute
+type tmplBird struct {
+	Endpoint string
+	Command  string
+	Servers  []tmplBirdServer
+	// Protocol of the detail page, and whether an operator is logged in,
+	// and actions are shown
+	Protocol string
+	Operator bool
+	// Current page and number of pages of paginated commands, zero if
+	// the command isn't paginated
+	Page  int
+	Pages int
+	// Whether a proxy truncated the output, so networks and pages may be
+	// missing
+	Truncated bool
+}
+
+// Data of the "operator" template, confirmation and result of an action
+type tmplOperator struct {
+	Server   string
+	Action   string
+	Protocol string
+	Command  string
+	User     string
+	// Token of the confirmation form
+	Token string
+	// Set after running the action, with its output or error
+	Done   bool
+	Error  string
+	Result string
+}
+
+// Data of the "whois" template
+type tmplWhois struct {
+	Target  string
+	Compact bool
+	// Set if the query failed
+	Error string
+	// Whois result, and the same formatted as HTML
+	Raw    string
+	Result string
+}
+
+// Data of the "peering" template
+type tmplPeering struct {
+	Server string
+	// Set if the request failed
+	Error string
+	// Example configuration files after a successful request
+	Files map[string]string
+	// Information of the server as JSON, for the peering form
+	Info string
+}
+
+// A part of the timeline in the "history" template
+type tmplHistorySegment struct {
+	// Empty if unknown
+	State string
+	// Percentage of the timeline, and the time range as text
+	Width string
+	Title string
+}
+
+type tmplHistoryUptime struct {
+	Period string
+	// Percentage, or "-" if unknown
+	Uptime string
+}
+
+type tmplHistoryServer struct {
+	Server  string
+	Uptimes []tmplHistoryUptime
+	// Flaps and timeline of the last 24 hours
+	Flaps    int
+	Timeline []tmplHistorySegment
+	// State changes, newest first
+	Events []protocolEvent
+}
+
+// Data of the "history" template, state changes of a protocol
+type tmplHistory struct {
+	Protocol string
+	// Whether protocol history is recorded
+	Enabled bool
+	Servers []tmplHistoryServer
 }
 
-var tmpl = template.Must(template.New("tmpl").Parse(`
+type tmplPrefixHistoryServer struct {
+	Server string
+	// Best path changes, newest first
+	Events []prefixEvent
+}
+
+// Data of the "prefix_history" template, best path changes of a watched
+// prefix, or the watch list if the prefix is not watched
+type tmplPrefixHistory struct {
+	Prefix         string
+	ExpectedOrigin string
+	Watched        bool
+	Prefixes       []prefixWatchEntry
+	// Servers of the current page, to link to other prefixes with
+	ServersURL string
+	Servers    []tmplPrefixHistoryServer
+}
+
+type tmplRouteSearchServer struct {
+	Server string
+	// Unique prefixes found, sorted
+	Prefixes []routeSearchPrefix
+	// Output formatted as HTML if no prefix is found, e.g. for errors
+	Result string
+}
+
+// Data of the "route_search" template, routes by origin AS or AS path
+type tmplRouteSearch struct {
+	// route_origin or route_aspath
+	Type   string
+	Target string
+	Search routeSearch
+	// Set if the search can't be parsed
+	Error   string
+	Command string
+	Servers []tmplRouteSearchServer
+}
+
+// A chart in the "stats" template, drawn as SVG
+type tmplStatsChart struct {
+	Title string
+	SVG   string
+}
+
+type tmplStatsServer struct {
+	Server string
+	// Nil if no statistics are recorded in the period
+	Latest *statsSnapshot
+	Charts []tmplStatsChart
+}
+
+// Data of the "stats" template, routing table statistics over a period
+type tmplStats struct {
+	// Whether statistics are collected
+	Enabled bool
+	Period  string
+	Periods []string
+	// Servers of the current page, to link to other periods with
+	ServersURL string
+	Servers    []tmplStatsServer
+}
+
+// Data of the "peer" template, protocols with a peer on all servers
+type tmplPeer struct {
+	// Mode of the peer portal, public or login
+	Mode       string
+	ASN        string
+	Name       string
+	ServersURL string
+	Error      string
+	// Whether protocol history is recorded, and uptime is shown
+	History bool
+	// ASN of the logged in peer, and whether details are shown
+	LoggedIn  string
+	Details   bool
+	Protocols []peerProtocol
+	// Responses of servers that can't be parsed, e.g. errors
+	Errors []string
+	// Routes exported to a protocol, if requested, as server/protocol in
+	// ExportKey, with pages like the route template
+	Export    *tmplBirdServer
+	ExportKey string
+	Page      int
+	Pages     int
+	Truncated bool
+}
+
+// Data of the "peer_login" template
+type tmplPeerLogin struct {
+	ASN         string
+	Maintainers []string
+	// ssh-ed25519 keys of the maintainers
+	Keys      []string
+	Challenge string
+	// Page to return to after login
+	Next  string
+	Error string
+}
+
+// Data of the "bgpmap" template, also used for traceroute maps
+type tmplBGPMap struct {
+	Servers []string
+	Targets []string
+	// Graph in DOT format, to be rendered by viz.js
+	Graphviz string
+}
+
+// Functions available in templates, in addition to the built-in ones
+var tmplFuncs = template.FuncMap{
+	"static": staticURL,
+	"join":   strings.Join,
+	"inc":    func(i int) int { return i + 1 },
+	"dec":    func(i int) int { return i - 1 },
+	// Replaced by the translation function of each language
+	"t": fmt.Sprintf,
+}
+
+// Built-in templates, used if not overridden by the theme
+var tmplBuiltin = map[string]string{
+	"page": `
 <!DOCTYPE html>
-<html lang="en-US">
+<html lang="{{ .Lang }}">
 <head>
 <meta http-equiv="Content-Type" content="text/html;charset=UTF-8">
 <meta http-equiv="X-UA-Compatible" content="IE=edge">
 <meta name="viewport" content="width=device-width, initial-scale=1, maximum-scale=1, user-scalable=no">
 <meta name="renderer" content="webkit">
 <title>{{ .Title }}</title>
-<link rel="stylesheet" href="https://cdn.jsdelivr.net/npm/bootstrap@4.5.1/dist/css/bootstrap.min.css" integrity="sha256-VoFZSlmyTXsegReQCNmbXrS4hBBUl/cexZvPmPWoJsY=" crossorigin="anonymous">
+<link rel="stylesheet" href="{{ static "bootstrap.min.css" }}">
+<link rel="stylesheet" href="{{ static "style.css" }}">
 <meta name="robots" content="noindex, nofollow">
-<style>
-	.container h2 {
-		font-size: 1.5rem;
-		margin: 48px 0px 20px;
-	}
-	.nav-link.active{
-		font-weight: bold;
-	}
-</style>
 </head>
 <body>
 
@@ -68,7 +322,7 @@ var tmpl = template.Must(template.New("tmpl").Parse(`
 		<ul class="navbar-nav mr-auto">
 			<li class="nav-item">
 				<a class="nav-link{{ if .AllServersLinkActive }} active{{ end }}"
-					href="/{{ $option }}/{{ .AllServersURL }}/{{ $target }}"> All Servers </a>
+					href="/{{ $option }}/{{ .AllServersURL }}/{{ $target }}"> {{ t "All Servers" }} </a>
 			</li>
 			{{ range $k, $v := .Servers }}
 			<li class="nav-item">
@@ -88,12 +342,28 @@ var tmpl = template.Must(template.New("tmpl").Parse(`
 					{{ end }}
 				</select>
 				<input name="server" class="d-none" value="{{ $server }}">
-				<input name="target" class="form-control" placeholder="Target" aria-label="Target" value="{{ $target }}">
+				<input name="target" class="form-control" placeholder="{{ t "Target" }}" aria-label="{{ t "Target" }}" value="{{ $target }}">
 				<div class="input-group-append">
 					<button class="btn btn-outline-success" type="submit">&raquo;</button>
 				</div>
 			</div>
 		</form>
+		{{ if gt (len .Languages) 1 }}
+		<ul class="navbar-nav ml-lg-2">
+			{{ range $k, $v := .Languages }}
+			<li class="nav-item">
+				<a class="nav-link{{ if eq $k $.Lang }} active{{ end }}" href="?lang={{ $k }}" hreflang="{{ $k }}">{{ $v }}</a>
+			</li>
+			{{ end }}
+		</ul>
+		{{ end }}
+		{{ if .Operator }}
+		<ul class="navbar-nav ml-lg-2">
+			<li class="nav-item">
+				<a class="nav-link" href="/operator/logout">{{ t "log out %s" (html .Operator) }}</a>
+			</li>
+		</ul>
+		{{ end }}
 	</div>
 </nav>
 
@@ -101,102 +371,204 @@ var tmpl = template.Must(template.New("tmpl").Parse(`
 	{{ .Content }}
 </div>
 
-<script src="https://cdn.jsdelivr.net/npm/jquery@3.5.1/dist/jquery.min.js" integrity="sha256-9/aliU8dGd2tb6OSsuzixeV4y/faTqgFtohetphbbj0=" crossorigin="anonymous"></script>
-<script src="https://cdn.jsdelivr.net/npm/bootstrap@4.5.1/dist/js/bootstrap.min.js" integrity="sha256-0IiaoZCI++9oAAvmCb5Y0r93XkuhvJpRalZLffQXLok=" crossorigin="anonymous"></script>
+<script src="{{ static "jquery.min.js" }}"></script>
+<script src="{{ static "bootstrap.min.js" }}"></script>
 <script>jQuery.noConflict();</script>
 </body>
 </html>
-`))
+`,
+
+	"summary": `
+{{ range .Servers }}
+<h2>{{ html .Server }}: {{ html $.Command }}</h2>
+{{ if .Headers }}
+<table class="table table-hover table-bordered table-sm">
+	<thead>
+	{{ range .Headers }}<th scope="col">{{ html . }}</th>{{ end }}
+	{{ if $.History }}<th scope="col">{{ t "flaps (24h)" }}</th>{{ end }}
+	{{ if $.Operator }}<th scope="col">{{ t "actions" }}</th>{{ end }}
+	</thead>
+	<tbody>
+	{{ $server := .Server }}
+	{{ range .Rows }}
+	<tr class="{{ if eq .State "up" }}table-success{{ else if eq .State "down" }}table-warning{{ else if eq .State "start" }}table-danger{{ else if eq .State "passive" }}table-info{{ end }}">
+		{{ if eq .Name "new_peer" }}
+		<td><a href="/new_peer/{{ $server }}">{{ t "+ add new peer" }}</a></td>
+		{{ else }}
+		<td><a href="/detail/{{ $server }}/{{ .Name }}">{{ .Name }}</a></td>
+		{{ end }}
+		<td>{{ .Proto }}</td>
+		<td>{{ .Table }}</td>
+		<td>{{ .State }}</td>
+		<td>{{ .Since }}</td>
+		<td>{{ .Info }}</td>
+		{{ if $.History }}<td><a href="/history/{{ $server }}/{{ .Name }}">{{ .Flaps }}</a></td>{{ end }}
+		{{ if $.Operator }}
+		<td class="text-nowrap">
+			{{ if ne .Name "new_peer" }}
+			<a class="btn btn-sm btn-outline-secondary py-0" href="/operator/{{ $server }}/{{ if eq .State "down" }}enable{{ else }}disable{{ end }}/{{ .Name }}">{{ if eq .State "down" }}{{ t "enable" }}{{ else }}{{ t "disable" }}{{ end }}</a>
+			<a class="btn btn-sm btn-outline-secondary py-0" href="/operator/{{ $server }}/restart/{{ .Name }}">{{ t "restart" }}</a>
+			{{ end }}
+		</td>
+		{{ end }}
+	</tr>
+	{{ end }}
+	</tbody>
+</table>
+<!--{{ .Raw }}-->
+{{ else }}
+{{ .Result }}
+{{ end }}
+{{ end }}
+`,
+
+	"detail": `
+{{ range .Servers }}
+<h2>{{ html .Server }}: {{ html $.Command }}</h2>
+{{ if and $.Operator $.Protocol }}
+<p>
+	<a class="btn btn-sm btn-outline-secondary" href="/operator/{{ .Server }}/disable/{{ $.Protocol }}">{{ t "disable" }}</a>
+	<a class="btn btn-sm btn-outline-secondary" href="/operator/{{ .Server }}/enable/{{ $.Protocol }}">{{ t "enable" }}</a>
+	<a class="btn btn-sm btn-outline-secondary" href="/operator/{{ .Server }}/restart/{{ $.Protocol }}">{{ t "restart" }}</a>
+	<a class="btn btn-sm btn-outline-secondary" href="/operator/{{ .Server }}/reload_in/{{ $.Protocol }}">{{ t "reload in" }}</a>
+	<a class="btn btn-sm btn-outline-secondary" href="/operator/{{ .Server }}/reload_out/{{ $.Protocol }}">{{ t "reload out" }}</a>
+</p>
+{{ end }}
+{{ .Result }}
+{{ end }}
+`,
 
-const peeringForm = `
+	"route": `
+{{ range .Servers }}
+<h2>{{ html .Server }}: {{ html $.Command }}</h2>
+{{ if .Count }}<p>{{ html .Count }}</p>{{ end }}
+{{ .Result }}
+{{ end }}
+{{ if gt .Pages 1 }}
+<nav>
+	<ul class="pagination">
+		<li class="page-item{{ if le .Page 1 }} disabled{{ end }}"><a class="page-link" href="?page={{ dec .Page }}">{{ t "previous" }}</a></li>
+		<li class="page-item disabled"><span class="page-link">{{ t "page %d of %d" .Page .Pages }}{{ if .Truncated }} ({{ t "truncated" }}){{ end }}</span></li>
+		<li class="page-item{{ if ge .Page .Pages }} disabled{{ end }}"><a class="page-link" href="?page={{ inc .Page }}">{{ t "next" }}</a></li>
+	</ul>
+</nav>
+{{ end }}
+{{ if .Truncated }}<p class="text-warning">{{ t "The output was truncated by the proxy, so networks and pages may be missing." }}</p>{{ end }}
+`,
+
+	"whois": `
+<h2>whois {{ html .Target }}</h2>
+{{ if .Error }}
+<pre>{{ html .Error }}</pre>
+{{ else }}
+<ul class="nav nav-pills mb-3">
+	<li class="nav-item"><a class="nav-link{{ if not .Compact }} active{{ end }}" href="?view=full">{{ t "full" }}</a></li>
+	<li class="nav-item"><a class="nav-link{{ if .Compact }} active{{ end }}" href="?view=compact">{{ t "compact" }}</a></li>
+</ul>
+{{ .Result }}
+{{ end }}
+`,
+
+	"peering": `
+<h2>{{ html .Server }}: {{ t "peering request" }}</h2>
+{{ if .Error }}
+<pre>{{ html .Error }}</pre>
+{{ else if .Files }}
+<p>{{ t "Congratulations, WireGuard tunnel and BGP sessions have been setup on my server instantly. Just in case you're new to DN42, below are some example configuration files that you could use to setup your own node. Happy hacking!" }}</p>
+{{ range $path, $content := .Files }}
+<h5>{{ html $path }}</h5>
+<pre>{{ html $content }}</pre>
+{{ end }}
+{{ else }}
+<script> var info = {{ .Info }}; </script>
 <div class="form-group row">
-	<label for="aliceASN" class="col-xs-12 col-md-4 col-lg-3">My AS Number</label>
-	<input id="aliceASN" type="number" class="form-control col-xs-12 col-md-8 col-lg-6" placeholder="Loading..." readonly>
+	<label for="aliceASN" class="col-xs-12 col-md-4 col-lg-3">{{ t "My AS Number" }}</label>
+	<input id="aliceASN" type="number" class="form-control col-xs-12 col-md-8 col-lg-6" placeholder="{{ t "Loading..." }}" readonly>
 </div>
 <div class="form-group row">
-	<label for="aliceName" class="col-xs-12 col-md-4 col-lg-3">PoP Location (<a href="https://openflights.org/html/apsearch">IATA</a> / <a href="https://dxcluster.ha8tks.hu/hamgeocoding">Grid</a>)</label>
+	<label for="aliceName" class="col-xs-12 col-md-4 col-lg-3">{{ t "PoP Location" }} (<a href="https://openflights.org/html/apsearch">IATA</a> / <a href="https://dxcluster.ha8tks.hu/hamgeocoding">Grid</a>)</label>
 	<input id="aliceName" type="text" class="form-control col-xs-12 col-md-8 col-lg-6" readonly>
 </div>
 <div class="form-group row">
-	<label for="aliceIPv4" class="col-xs-12 col-md-4 col-lg-3">Tunneled IPv4 Address</label>
+	<label for="aliceIPv4" class="col-xs-12 col-md-4 col-lg-3">{{ t "Tunneled IPv4 Address" }}</label>
 	<input id="aliceIPv4" type="text" class="form-control col-xs-12 col-md-8 col-lg-6" readonly>
 </div>
 <div class="form-group row">
-	<label for="aliceIPv6" class="col-xs-12 col-md-4 col-lg-3">Tunneled IPv6 Address</label>
+	<label for="aliceIPv6" class="col-xs-12 col-md-4 col-lg-3">{{ t "Tunneled IPv6 Address" }}</label>
 	<input id="aliceIPv6" type="text" class="form-control col-xs-12 col-md-8 col-lg-6" readonly>
 </div>
 <div class="form-group row">
-	<label for="aliceLink" class="col-xs-12 col-md-4 col-lg-3">Link Local IPv6 Address</label>
+	<label for="aliceLink" class="col-xs-12 col-md-4 col-lg-3">{{ t "Link Local IPv6 Address" }}</label>
 	<input id="aliceLink" type="text" class="form-control col-xs-12 col-md-8 col-lg-6">
 </div>
 <div class="form-group row">
-	<label for="alicePubl" class="col-xs-12 col-md-4 col-lg-3">WireGuard Public Key</label>
+	<label for="alicePubl" class="col-xs-12 col-md-4 col-lg-3">{{ t "WireGuard Public Key" }}</label>
 	<input id="alicePubl" type="text" class="form-control col-xs-12 col-md-8 col-lg-6" readonly>
 </div>
 <div class="form-group row">
-	<label for="aliceWG" class="col-xs-12 col-md-4 col-lg-3">WireGuard Endpoint</label>
+	<label for="aliceWG" class="col-xs-12 col-md-4 col-lg-3">{{ t "WireGuard Endpoint" }}</label>
 	<input id="aliceWG" type="text" class="form-control col-xs-12 col-md-8 col-lg-6" readonly>
 </div>
 <div class="form-group row">
-	<label for="aliceNote" class="col-xs-12 col-md-4 col-lg-3">Additional Notes</label>
+	<label for="aliceNote" class="col-xs-12 col-md-4 col-lg-3">{{ t "Additional Notes" }}</label>
 	<textarea id="aliceNote" class="form-control col-xs-12 col-md-8 col-lg-6" rows="5" readonly></textarea>
 </div>
 
-<h2>your point of presence</h2>
+<h2>{{ t "your point of presence" }}</h2>
 
 <div class="form-group row">
-	<label for="bobASN" class="col-xs-12 col-md-4 col-lg-3">Your AS Number</label>
+	<label for="bobASN" class="col-xs-12 col-md-4 col-lg-3">{{ t "Your AS Number" }}</label>
 	<input id="bobASN" type="number" min="1" max="4294967295" class="form-control col-xs-12 col-md-8 col-lg-6" placeholder="424242xxxx" required>
 </div>
 <div class="form-group row">
-	<label for="bobName" class="col-xs-12 col-md-4 col-lg-3">PoP Location (<a href="https://openflights.org/html/apsearch">IATA</a> / <a href="https://dxcluster.ha8tks.hu/hamgeocoding">Grid</a>)</label>
-	<input id="bobName" type="text" pattern="\w+" class="form-control col-xs-12 col-md-8 col-lg-6" placeholder="alphanumeric only, IATA identifier or grid locator preferred" required>
+	<label for="bobName" class="col-xs-12 col-md-4 col-lg-3">{{ t "PoP Location" }} (<a href="https://openflights.org/html/apsearch">IATA</a> / <a href="https://dxcluster.ha8tks.hu/hamgeocoding">Grid</a>)</label>
+	<input id="bobName" type="text" pattern="\w+" class="form-control col-xs-12 col-md-8 col-lg-6" placeholder="{{ t "alphanumeric only, IATA identifier or grid locator preferred" }}" required>
 </div>
 <div class="form-group row">
-	<label for="bobIPv4" class="col-xs-12 col-md-4 col-lg-3">Tunneled IPv4 Address</label>
+	<label for="bobIPv4" class="col-xs-12 col-md-4 col-lg-3">{{ t "Tunneled IPv4 Address" }}</label>
 	<input id="bobIPv4" type="text" class="form-control col-xs-12 col-md-8 col-lg-6" placeholder="172.2x.xxx.xxx / 10.127.xxx.xxx" required>
 </div>
 <div class="form-group row">
-	<label for="bobIPv6" class="col-xs-12 col-md-4 col-lg-3">Tunneled IPv6 Address</label>
+	<label for="bobIPv6" class="col-xs-12 col-md-4 col-lg-3">{{ t "Tunneled IPv6 Address" }}</label>
 	<input id="bobIPv6" type="text" class="form-control col-xs-12 col-md-8 col-lg-6" placeholder="fdxx:xxxx:xxxx::xxxx" required>
 </div>
 <div class="form-group row">
-	<label for="bobLink" class="col-xs-12 col-md-4 col-lg-3">Link Local IPv6 Address</label>
+	<label for="bobLink" class="col-xs-12 col-md-4 col-lg-3">{{ t "Link Local IPv6 Address" }}</label>
 	<input id="bobLink" type="text" class="form-control col-xs-12 col-md-8 col-lg-6" placeholder="fe80::xxxx" required>
 </div>
 <div class="form-group row">
-	<label for="bobPubl" class="col-xs-12 col-md-4 col-lg-3">WireGuard Public Key</label>
+	<label for="bobPubl" class="col-xs-12 col-md-4 col-lg-3">{{ t "WireGuard Public Key" }}</label>
 	<input id="bobPubl" type="text" pattern="[A-Za-z0-9+/]{43}=?" class="form-control col-xs-12 col-md-8 col-lg-6" placeholder="enTER+y0uR/256+B1TS/baSe+64/enCoded+key/HeRE=" required>
 </div>
 <div class="form-group row">
-	<label for="bobWG" class="col-xs-12 col-md-4 col-lg-3">WireGuard Endpoint</label>
+	<label for="bobWG" class="col-xs-12 col-md-4 col-lg-3">{{ t "WireGuard Endpoint" }}</label>
 	<input id="bobWG" type="hidden">
 	<div class="input-group col-xs-12 col-md-8 col-lg-6 p-0">
-		<input id="bobWGAddr" type="text" pattern="\w+[-\w\.]+\w+" class="form-control col-xs-10 col-sm-8 col-md-8 col-lg-8" placeholder="Clearnet IP or domain of your server" required>
+		<input id="bobWGAddr" type="text" pattern="\w+[-\w\.]+\w+" class="form-control col-xs-10 col-sm-8 col-md-8 col-lg-8" placeholder="{{ t "Clearnet IP or domain of your server" }}" required>
 		<div class="input-group-prepend input-group-append">
 			<div class="input-group-text">:</div>
 		</div>
-		<input id="bobWGPort" type="number" min="1" max="65535" class="form-control col-xs-1 col-sm-3 col-md-3 col-lg-3" placeholder="UDP Port" required>
+		<input id="bobWGPort" type="number" min="1" max="65535" class="form-control col-xs-1 col-sm-3 col-md-3 col-lg-3" placeholder="{{ t "UDP Port" }}" required>
 	</div>
 </div>
 <div class="form-group row">
-	<label for="bobNote" class="col-xs-12 col-md-4 col-lg-3">Additional Notes</label>
-	<textarea id="bobNote" class="form-control col-xs-12 col-md-8 col-lg-6" rows="5" placeholder="Please feel free to write anything here - probably about yourself, your network topology or your special peering needs.&#10;Will never be shown to anyone else."></textarea>
+	<label for="bobNote" class="col-xs-12 col-md-4 col-lg-3">{{ t "Additional Notes" }}</label>
+	<textarea id="bobNote" class="form-control col-xs-12 col-md-8 col-lg-6" rows="5" placeholder="{{ t "Please feel free to write anything here - probably about yourself, your network topology or your special peering needs.&#10;Will never be shown to anyone else." }}"></textarea>
 </div>
 
-<h2>bgp preferences</h2>
+<h2>{{ t "bgp preferences" }}</h2>
 <div class="form-group row">
-	<label for="protocol" class="col-xs-12 col-md-4 col-lg-3">Multi-protocol Session</label>
+	<label for="protocol" class="col-xs-12 col-md-4 col-lg-3">{{ t "Multi-protocol Session" }}</label>
 	<select class="form-control col-xs-12 col-md-8 col-lg-6" id="protocol" disabled>
-		<option value="mpbg">Multi-protocol BGP over IPv6 link-local (Preferred)</option>
-		<option value="dual">Establish two BGP sessions: IPv6 link-local and IPv4</option>
-		<option value="link">Only route IPv6 prefixes (over IPv6 link-local)</option>
-		<option value="ipv6">Only route IPv6 prefixes (over IPv6 tunneled address)</option>
-		<option value="ipv4">Only route IPv4 prefixes (over IPv4 tunneled address)</option>
+		<option value="mpbg">{{ t "Multi-protocol BGP over IPv6 link-local (Preferred)" }}</option>
+		<option value="dual">{{ t "Establish two BGP sessions: IPv6 link-local and IPv4" }}</option>
+		<option value="link">{{ t "Only route IPv6 prefixes (over IPv6 link-local)" }}</option>
+		<option value="ipv6">{{ t "Only route IPv6 prefixes (over IPv6 tunneled address)" }}</option>
+		<option value="ipv4">{{ t "Only route IPv4 prefixes (over IPv4 tunneled address)" }}</option>
 	</select>
 </div>
 <div class="form-group row">
-	<label for="latency" class="col-xs-12 col-md-4 col-lg-3">Link Latency</label>
+	<label for="latency" class="col-xs-12 col-md-4 col-lg-3">{{ t "Link Latency" }}</label>
 	<select id="latency" class="form-control col-xs-12 col-md-8 col-lg-6">
 		<option value="1">&le; 2.7ms (64511, 1)</option>
 		<option value="2">&le; 7.3ms (64511, 2)</option>
@@ -210,7 +582,7 @@ const peeringForm = `
 	</select>
 </div>
 <div class="form-group row">
-	<label for="bandwidth" class="col-xs-12 col-md-4 col-lg-3">Link Bandwidth</label>
+	<label for="bandwidth" class="col-xs-12 col-md-4 col-lg-3">{{ t "Link Bandwidth" }}</label>
 	<select id="bandwidth" class="form-control col-xs-12 col-md-8 col-lg-6">
 		<option value="20">&lt; 100kbps (64511, 20)</option>
 		<option value="21">&ge; 100kbps (64511, 21)</option>
@@ -222,21 +594,21 @@ const peeringForm = `
 	</select>
 </div>
 <div class="form-group row">
-	<label for="encryption" class="col-xs-12 col-md-4 col-lg-3">Encryption Level</label>
+	<label for="encryption" class="col-xs-12 col-md-4 col-lg-3">{{ t "Encryption Level" }}</label>
 	<select id="encryption" class="form-control col-xs-12 col-md-8 col-lg-6" disabled>
-		<option value="31">Not encrypted (64511, 31)</option>
-		<option value="32">Encrypted with unsafe VPN solution (64511, 32)</option>
-		<option value="33">Safe encryption, but no forward secrecy (64511, 33)</option>
-		<option value="34" selected>Safe encryption with perfect forward secrecy (64511, 34)</option>
+		<option value="31">{{ t "Not encrypted" }} (64511, 31)</option>
+		<option value="32">{{ t "Encrypted with unsafe VPN solution" }} (64511, 32)</option>
+		<option value="33">{{ t "Safe encryption, but no forward secrecy" }} (64511, 33)</option>
+		<option value="34" selected>{{ t "Safe encryption with perfect forward secrecy" }} (64511, 34)</option>
 	</select>
 </div>
 
 <div class="form-check row py-3">
 	<input id="confirm" type="checkbox" class="form-check-input" required>
-	<label for="confirm" class="form-check-label">I have checked all the configurations above. Set up the new peering for me immediately.</label>
+	<label for="confirm" class="form-check-label">{{ t "I have checked all the configurations above. Set up the new peering for me immediately." }}</label>
 </div>
 <div class="form-group row">
-	<button id="submit" type="button" class="btn btn-primary">Submit</button>
+	<button id="submit" type="button" class="btn btn-primary">{{ t "Submit" }}</button>
 </div>
 <form id="jsonForm" method="post"><input type="hidden" id="json" name="json"></form>
 
@@ -329,4 +701,391 @@ $('#submit').addEventListener('click', function(event) {
 });
 
 </script>
-`
+{{ end }}
+`,
+
+	"history": `
+{{ if not .Enabled }}
+<h2>{{ t "history of %s" (html .Protocol) }}</h2>
+<p>{{ t "Protocol history is not enabled." }}</p>
+{{ end }}
+{{ range .Servers }}
+<h2>{{ html .Server }}: {{ t "history of %s" (html $.Protocol) }}</h2>
+{{ if .Events }}
+<p>
+	{{ range .Uptimes }}{{ t "uptime (%s)" .Period }}: <strong>{{ .Uptime }}</strong> &middot; {{ end }}
+	{{ t "flaps (24h)" }}: <strong>{{ .Flaps }}</strong>
+</p>
+<div class="progress mb-1" style="height: 1.5rem;">
+	{{ range .Timeline }}
+	<div class="progress-bar {{ if eq .State "up" }}bg-success{{ else if eq .State "down" }}bg-warning{{ else if eq .State "start" }}bg-danger{{ else if eq .State "passive" }}bg-info{{ else }}bg-light{{ end }}" style="width: {{ .Width }}%" title="{{ .Title }}">{{ .State }}</div>
+	{{ end }}
+</div>
+<p class="text-muted small">{{ t "last 24 hours" }}</p>
+<table class="table table-sm table-bordered">
+	<thead>
+		<th scope="col">{{ t "time" }}</th>
+		<th scope="col">{{ t "state" }}</th>
+		<th scope="col">{{ t "since" }}</th>
+		<th scope="col">{{ t "info" }}</th>
+	</thead>
+	<tbody>
+	{{ range .Events }}
+	<tr class="{{ if eq .State "up" }}table-success{{ else if eq .State "down" }}table-warning{{ else if eq .State "start" }}table-danger{{ else if eq .State "passive" }}table-info{{ end }}">
+		<td>{{ .Time.Format "2006-01-02 15:04:05 MST" }}</td>
+		<td>{{ html .State }}{{ if .Flap }} ({{ t "flap" }}){{ end }}</td>
+		<td>{{ html .Since }}</td>
+		<td>{{ html .Info }}</td>
+	</tr>
+	{{ end }}
+	</tbody>
+</table>
+{{ else }}
+<p>{{ t "No state changes recorded." }}</p>
+{{ end }}
+{{ end }}
+`,
+
+	"prefix_history": `
+{{ if not .Watched }}
+<h2>{{ t "watched prefixes" }}</h2>
+{{ if .Prefix }}<p>{{ t "%s is not watched." (html .Prefix) }}</p>{{ end }}
+{{ if .Prefixes }}
+<ul>
+	{{ range .Prefixes }}
+	<li><a href="/prefix_history/{{ $.ServersURL }}/{{ .Prefix }}">{{ .Prefix }}</a>{{ if .ExpectedOrigin }} ({{ t "expected origin" }}: <a href="/whois/AS{{ .ExpectedOrigin }}">AS{{ .ExpectedOrigin }}</a>){{ end }}</li>
+	{{ end }}
+</ul>
+{{ else }}
+<p>{{ t "No prefixes are watched." }}</p>
+{{ end }}
+{{ end }}
+{{ range .Servers }}
+<h2>{{ html .Server }}: {{ t "best path of %s" (html $.Prefix) }}</h2>
+{{ if $.ExpectedOrigin }}<p>{{ t "expected origin" }}: <a href="/whois/AS{{ $.ExpectedOrigin }}">AS{{ $.ExpectedOrigin }}</a></p>{{ end }}
+{{ if .Events }}
+<table class="table table-sm table-bordered">
+	<thead>
+		<th scope="col">{{ t "time" }}</th>
+		<th scope="col">{{ t "changes" }}</th>
+		<th scope="col">{{ t "route" }}</th>
+		<th scope="col">{{ t "protocol" }}</th>
+		<th scope="col">{{ t "AS path" }}</th>
+	</thead>
+	<tbody>
+	{{ range .Events }}
+	<tr class="{{ if not .Route }}table-danger{{ else if .Notable }}table-warning{{ end }}">
+		<td>{{ .Time.Format "2006-01-02 15:04:05 MST" }}</td>
+		<td>{{ range $i, $change := .Changes }}{{ if $i }}, {{ end }}{{ t $change }}{{ else }}{{ t "first seen" }}{{ end }}</td>
+		<td>{{ html .Route }}</td>
+		<td>{{ html .Protocol }}</td>
+		<td>{{ if .Route }}{{ range .Path }}<a href="/whois/AS{{ html . }}">{{ html . }}</a> {{ else }}{{ t "(local)" }}{{ end }}{{ else }}{{ t "(withdrawn)" }}{{ end }}</td>
+	</tr>
+	{{ end }}
+	</tbody>
+</table>
+{{ else }}
+<p>{{ t "No best path recorded." }}</p>
+{{ end }}
+{{ end }}
+`,
+
+	"operator": `
+<h2>{{ html .Server }}: {{ html .Command }}</h2>
+{{ if .Done }}
+{{ if .Error }}
+<div class="alert alert-danger">{{ html .Error }}</div>
+{{ else }}
+<div class="alert alert-success">{{ t "Done." }}</div>
+<pre>{{ html .Result }}</pre>
+{{ end }}
+<p><a href="/detail/{{ .Server }}/{{ .Protocol }}">{{ t "back to %s" (html .Protocol) }}</a></p>
+{{ else }}
+<p>{{ t "Run %s on %s as %s?" (html .Command) (html .Server) (html .User) }}</p>
+<form method="POST">
+	<input type="hidden" name="token" value="{{ html .Token }}">
+	<button class="btn btn-danger" type="submit">{{ t "confirm" }}</button>
+	<a class="btn btn-outline-secondary" href="/detail/{{ .Server }}/{{ .Protocol }}">{{ t "cancel" }}</a>
+</form>
+{{ end }}
+`,
+
+	"route_search": `
+{{ if .Error }}
+<h2>{{ html .Type }}: {{ html .Target }}</h2>
+<div class="alert alert-danger">{{ html .Error }}</div>
+<p>{{ t "Enter an ASN, optionally followed by community=a:b or community=a:b:c, and length=n or length=n-m, e.g. %s" "AS4242420001 community=64511:1 length=24-28" }}</p>
+{{ else }}
+{{ range .Servers }}
+<h2>{{ html .Server }}: {{ html $.Command }}</h2>
+{{ if .Prefixes }}
+<p>{{ t "%d prefix(es)" (len .Prefixes) }}</p>
+<table class="table table-hover table-bordered table-sm">
+	<thead>
+		<th scope="col">{{ t "prefix" }}</th>
+		<th scope="col">{{ t "origin" }}</th>
+	</thead>
+	<tbody>
+	{{ $server := .Server }}
+	{{ range .Prefixes }}
+	<tr>
+		<td><a href="/route_all/{{ $server }}/{{ .Prefix }}">{{ html .Prefix }}</a></td>
+		<td>{{ range .Origins }}<a href="/whois/AS{{ . }}">AS{{ . }}</a> {{ end }}</td>
+	</tr>
+	{{ end }}
+	</tbody>
+</table>
+{{ else }}
+{{ .Result }}
+{{ end }}
+{{ end }}
+{{ end }}
+`,
+
+	"peer": `
+<h2>{{ t "peer portal" }}{{ if .ASN }}: AS{{ .ASN }}{{ if .Name }} ({{ html .Name }}){{ end }}{{ end }}</h2>
+<form class="form-inline mb-3" action="/redir" method="GET">
+	<input name="action" type="hidden" value="peer">
+	<input name="server" type="hidden" value="{{ html .ServersURL }}">
+	<input name="target" class="form-control mr-2" placeholder="{{ t "Your AS Number" }}" value="{{ .ASN }}" required>
+	<button class="btn btn-outline-success" type="submit">{{ t "show sessions" }}</button>
+</form>
+{{ if .Error }}<div class="alert alert-danger">{{ html .Error }}</div>{{ end }}
+{{ if .ASN }}
+{{ if eq .Mode "login" }}
+<p>
+{{ if eq .LoggedIn .ASN }}
+	{{ t "Logged in as AS%s." .ASN }} <a href="/peer_logout?next=/peer/{{ html .ServersURL }}/{{ .ASN }}">{{ t "log out" }}</a>
+{{ else }}
+	{{ t "Log in to see route counts, errors and exported routes." }} <a href="/peer_login/{{ .ASN }}?next=/peer/{{ html .ServersURL }}/{{ .ASN }}">{{ t "log in" }}</a>
+{{ end }}
+</p>
+{{ end }}
+{{ if .Protocols }}
+<table class="table table-hover table-bordered table-sm">
+	<thead>
+		<th scope="col">{{ t "server" }}</th>
+		<th scope="col">{{ t "protocol" }}</th>
+		<th scope="col">{{ t "state" }}</th>
+		<th scope="col">{{ t "since" }}</th>
+		{{ if .History }}<th scope="col">{{ t "uptime (30d)" }}</th>{{ end }}
+		{{ if .Details }}
+		<th scope="col">{{ t "routes" }}</th>
+		<th scope="col">{{ t "last error" }}</th>
+		<th scope="col"></th>
+		{{ end }}
+	</thead>
+	<tbody>
+	{{ range .Protocols }}
+	<tr class="{{ if eq .State "up" }}table-success{{ else if eq .State "down" }}table-warning{{ else if eq .State "start" }}table-danger{{ end }}">
+		<td>{{ html .Server }}</td>
+		<td><a href="/detail/{{ .Server }}/{{ .Name }}">{{ .Name }}</a>{{ if .NeighborAddress }}<br><small>{{ html .NeighborAddress }}</small>{{ end }}</td>
+		<td>{{ .State }}{{ if .BGPState }} ({{ html .BGPState }}){{ else if .Info }} ({{ html .Info }}){{ end }}</td>
+		<td>{{ .Since }}</td>
+		{{ if $.History }}<td><a href="/history/{{ .Server }}/{{ .Name }}">{{ .Uptime }}</a></td>{{ end }}
+		{{ if $.Details }}
+		<td>{{ range .Channels }}{{ html .Name }}: {{ t "%d imported, %d filtered, %d exported" .Imported .Filtered .Exported }}<br>{{ end }}</td>
+		<td>{{ html .LastError }}</td>
+		<td><a href="?export={{ .Server }}/{{ .Name }}">{{ t "exported routes" }}</a></td>
+		{{ end }}
+	</tr>
+	{{ end }}
+	</tbody>
+</table>
+{{ else }}
+<p>{{ t "No sessions with AS%s found." .ASN }}</p>
+{{ end }}
+{{ range .Errors }}<pre>{{ html . }}</pre>{{ end }}
+{{ if .Export }}
+<h2>{{ html .Export.Server }}</h2>
+<p>{{ html .Export.Count }}</p>
+{{ .Export.Result }}
+{{ if gt .Pages 1 }}
+<nav>
+	<ul class="pagination">
+		<li class="page-item{{ if le .Page 1 }} disabled{{ end }}"><a class="page-link" href="?export={{ .ExportKey }}&amp;page={{ dec .Page }}">{{ t "previous" }}</a></li>
+		<li class="page-item disabled"><span class="page-link">{{ t "page %d of %d" .Page .Pages }}{{ if .Truncated }} ({{ t "truncated" }}){{ end }}</span></li>
+		<li class="page-item{{ if ge .Page .Pages }} disabled{{ end }}"><a class="page-link" href="?export={{ .ExportKey }}&amp;page={{ inc .Page }}">{{ t "next" }}</a></li>
+	</ul>
+</nav>
+{{ end }}
+{{ if .Truncated }}<p class="text-warning">{{ t "The output was truncated by the proxy, so networks and pages may be missing." }}</p>{{ end }}
+{{ end }}
+{{ end }}
+`,
+
+	"peer_login": `
+<h2>{{ t "peer portal" }}: {{ t "log in as AS%s" .ASN }}</h2>
+{{ if .Error }}<div class="alert alert-danger">{{ html .Error }}</div>{{ end }}
+{{ if .Keys }}
+<p>{{ t "Sign the text below with an SSH key in the auth attribute of a maintainer of AS%s (%s) in the registry, and paste the signature:" .ASN (html (join .Maintainers ", ")) }}</p>
+<pre>echo -n '{{ html .Challenge }}' | ssh-keygen -Y sign -n bird-lg -f ~/.ssh/id_ed25519</pre>
+<form method="POST">
+	<input type="hidden" name="challenge" value="{{ html .Challenge }}">
+	<input type="hidden" name="next" value="{{ html .Next }}">
+	<div class="form-group">
+		<textarea name="signature" class="form-control" rows="8" placeholder="-----BEGIN SSH SIGNATURE-----" required></textarea>
+	</div>
+	<button class="btn btn-primary" type="submit">{{ t "log in" }}</button>
+</form>
+{{ else }}
+<p>{{ t "No ssh-ed25519 key found in maintainers of AS%s in the registry." .ASN }}</p>
+{{ end }}
+`,
+
+	"stats": `
+{{ if not .Enabled }}
+<h2>{{ t "routing table statistics" }}</h2>
+<p>{{ t "Routing table statistics are not enabled." }}</p>
+{{ else }}
+<ul class="nav nav-pills mb-3">
+	{{ range .Periods }}
+	<li class="nav-item"><a class="nav-link{{ if eq . $.Period }} active{{ end }}" href="/stats/{{ html $.ServersURL }}/?period={{ . }}">{{ t "last %s" . }}</a></li>
+	{{ end }}
+</ul>
+{{ end }}
+{{ range .Servers }}
+{{ $server := .Server }}
+<h2>{{ html .Server }}: {{ t "routing table statistics" }}</h2>
+{{ with .Latest }}
+<p>
+	{{ t "collected at %s" (.Time.Format "2006-01-02 15:04:05 MST") }}
+	{{ if not .Error }}
+	&middot; {{ t "IPv4 prefixes" }}: <strong>{{ .IPv4 }}</strong>
+	&middot; {{ t "IPv6 prefixes" }}: <strong>{{ .IPv6 }}</strong>
+	&middot; {{ t "origin ASes" }}: <strong>{{ .OriginASes }}</strong>
+	{{ end }}
+</p>
+{{ if .Error }}<div class="alert alert-warning">{{ t "Routes couldn't be queried, derived numbers are missing:" }} {{ html .Error }}</div>{{ end }}
+{{ if .Truncated }}<div class="alert alert-warning">{{ t "Routes were truncated by the proxy, derived numbers are incomplete." }}</div>{{ end }}
+{{ end }}
+{{ range .Charts }}
+<h4>{{ t .Title }}</h4>
+{{ .SVG }}
+{{ end }}
+{{ with .Latest }}
+<div class="row">
+	<div class="col-md-6">
+		<h4>{{ t "tables" }}</h4>
+		<table class="table table-sm table-bordered">
+			<thead>
+				<th scope="col">{{ t "table" }}</th>
+				<th scope="col">{{ t "routes" }}</th>
+				<th scope="col">{{ t "networks" }}</th>
+			</thead>
+			<tbody>
+			{{ range .Tables }}
+			<tr><td>{{ html .Name }}</td><td>{{ .Routes }}</td><td>{{ .Networks }}</td></tr>
+			{{ end }}
+			</tbody>
+		</table>
+	</div>
+	<div class="col-md-3">
+		<h4>{{ t "top origin ASes" }}</h4>
+		<table class="table table-sm table-bordered">
+			<tbody>
+			{{ range .Origins }}
+			<tr><td><a href="/whois/AS{{ html .ASN }}">AS{{ html .ASN }}</a></td><td>{{ .Prefixes }}</td></tr>
+			{{ end }}
+			</tbody>
+		</table>
+	</div>
+	<div class="col-md-3">
+		<h4>{{ t "top transit ASes" }}</h4>
+		<table class="table table-sm table-bordered">
+			<tbody>
+			{{ range .Transits }}
+			<tr><td><a href="/whois/AS{{ html .ASN }}">AS{{ html .ASN }}</a></td><td>{{ .Prefixes }}</td></tr>
+			{{ end }}
+			</tbody>
+		</table>
+	</div>
+</div>
+<h4>{{ t "routes per protocol" }}</h4>
+<table class="table table-sm table-bordered">
+	<thead>
+		<th scope="col">{{ t "protocol" }}</th>
+		<th scope="col">{{ t "imported" }}</th>
+		<th scope="col">{{ t "filtered" }}</th>
+		<th scope="col">{{ t "exported" }}</th>
+	</thead>
+	<tbody>
+	{{ range .Protocols }}
+	<tr><td><a href="/detail/{{ $server }}/{{ html .Name }}">{{ html .Name }}</a> ({{ html .Proto }})</td><td>{{ .Imported }}</td><td>{{ .Filtered }}</td><td>{{ .Exported }}</td></tr>
+	{{ end }}
+	</tbody>
+</table>
+{{ else }}
+<p>{{ t "No statistics recorded." }}</p>
+{{ end }}
+{{ end }}
+`,
+
+	"bgpmap": `
+<ul class="nav nav-pills mb-3">
+	<li class="nav-item"><a class="nav-link" href="?format=dot">DOT</a></li>
+	<li class="nav-item"><a class="nav-link" href="?format=json">JSON</a></li>
+	<li class="nav-item"><a class="nav-link" href="?format=graphml">GraphML</a></li>
+</ul>
+<script src="{{ static "viz.min.js" }}"></script>
+<script src="{{ static "lite.render.js" }}"></script>
+<script>
+var viz = new Viz();
+viz.renderSVGElement("{{ js .Graphviz }}")
+.then(element => {
+	document.body.appendChild(element);
+})
+.catch(error => {
+	document.body.innerHTML = "<pre>"+error+"</pre>"
+});
+</script>
+`,
+}
+
+// Templates by language and then by page type
+var tmpls = make(map[string]map[string]*template.Template)
+
+// Parse all templates, using files named "<name>.tpl" in the theme
+// directory in place of the built-in ones. Each language gets a copy,
+// with "t" translating messages into it.
+func loadTemplates() error {
+	for lang := range i18nCatalogs {
+		tmpls[lang] = make(map[string]*template.Template)
+	}
+	for name, text := range tmplBuiltin {
+		if len(setting.themeDir) > 0 {
+			data, err := os.ReadFile(filepath.Join(setting.themeDir, name+".tpl"))
+			if err == nil {
+				text = string(data)
+			} else if !os.IsNotExist(err) {
+				return err
+			}
+		}
+		t, err := template.New(name).Funcs(tmplFuncs).Parse(text)
+		if err != nil {
+			return fmt.Errorf("template %s: %v", name, err)
+		}
+		for lang := range i18nCatalogs {
+			lang := lang
+			clone, err := t.Clone()
+			if err != nil {
+				return err
+			}
+			tmpls[lang][name] = clone.Funcs(template.FuncMap{
+				"t": func(message string, args ...interface{}) string {
+					return i18nTranslate(lang, message, args...)
+				},
+			})
+		}
+	}
+	return nil
+}
+
+// Execute a template of a page type, returning the content of the page
+func renderPageContent(lang string, name string, data interface{}) string {
+	var result strings.Builder
+	if err := tmpls[lang][name].Execute(&result, data); err != nil {
+		return "<pre>" + html.EscapeString(err.Error()) + "</pre>"
+	}
+	return result.String()
+}
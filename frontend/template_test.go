@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Load templates with the given files in the theme directory
+func templateTestTheme(t *testing.T, files map[string]string) error {
+	t.Helper()
+	saved := setting
+	t.Cleanup(func() {
+		setting = saved
+		loadTemplates()
+	})
+
+	setting.themeDir = t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(setting.themeDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return loadTemplates()
+}
+
+func TestLoadTemplatesTheme(t *testing.T) {
+	// An empty theme directory
+	if err := templateTestTheme(t, nil); err != nil {
+		t.Fatal(err)
+	}
+	builtin := make(map[string]string)
+	for name, tmpl := range tmpls["en"] {
+		builtin[name] = tmpl.Tree.Root.String()
+	}
+
+	err := templateTestTheme(t, map[string]string{
+		"bgpmap.tpl": `<div class="theme">{{ .Graphviz }}</div>`,
+		// Files not named after a template are ignored
+		"unknown.tpl": `{{ if }}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for lang := range i18nCatalogs {
+		if got := renderPageContent(lang, "bgpmap", tmplBGPMap{Graphviz: "digraph {}"}); got != `<div class="theme">digraph {}</div>` {
+			t.Errorf("themed bgpmap in %s: %q", lang, got)
+		}
+	}
+	// Templates missing in the theme are the built-in ones
+	for name, tmpl := range tmpls["en"] {
+		if name != "bgpmap" && tmpl.Tree.Root.String() != builtin[name] {
+			t.Errorf("template %s changed without a theme file", name)
+		}
+	}
+}
+
+func TestLoadTemplatesBrokenTheme(t *testing.T) {
+	err := templateTestTheme(t, map[string]string{"bgpmap.tpl": `{{ if .Graphviz }}unterminated`})
+	if err == nil || !strings.Contains(err.Error(), "template bgpmap") {
+		t.Errorf("broken template not reported: %v", err)
+	}
+
+	// Errors while rendering are shown in place of the page
+	if err := templateTestTheme(t, map[string]string{"bgpmap.tpl": `{{ .Missing }}`}); err != nil {
+		t.Fatal(err)
+	}
+	got := renderPageContent("en", "bgpmap", tmplBGPMap{})
+	if !strings.HasPrefix(got, "<pre>") || !strings.Contains(got, "Missing") {
+		t.Errorf("rendering error not shown: %q", got)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type tracerouteHop struct {
+	number   int
+	ip       string
+	hostname string
+	rtt      string
+}
+
+// A responding hop, e.g. " 3  router.example.com (192.0.2.1)  1.234 ms"
+var tracerouteHopRegex = regexp.MustCompile(`^\s*(\d+)\s+(\S+)(?:\s+\(([^)]+)\))?\s+([\d.]+)\s*ms`)
+
+func tracerouteParse(response string) []tracerouteHop {
+	var result []tracerouteHop
+	for _, line := range strings.Split(response, "\n") {
+		match := tracerouteHopRegex.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		number, _ := strconv.Atoi(match[1])
+		hop := tracerouteHop{number: number, ip: match[2], rtt: match[4] + " ms"}
+		if len(match[3]) > 0 {
+			hop.ip = match[3]
+			if match[2] != match[3] {
+				hop.hostname = match[2]
+			}
+		}
+		result = append(result, hop)
+	}
+	return result
+}
+
+// Find origin ASNs of all IPs in parallel
+func tracerouteLookupASNs(ips []string) map[string]string {
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	result := make(map[string]string)
+	workers := make(chan struct{}, asnPrefetchWorkers)
+	for _, ip := range ips {
+		wg.Add(1)
+		go func(ip string) {
+			workers <- struct{}{}
+			asn := ipToASN(ip)
+			<-workers
+			mutex.Lock()
+			result[ip] = asn
+			mutex.Unlock()
+			wg.Done()
+		}(ip)
+	}
+	wg.Wait()
+	return result
+}
+
+// Merge traceroute results from each server into one graph
+func tracerouteToGraph(servers []string, responses []string, target string) *bgpmapGraph {
+	graph := newBGPMapGraph()
+	graph.Targets = []string{target}
+
+	hops := make([][]tracerouteHop, len(servers))
+	var ips []string
+	for i, response := range responses {
+		hops[i] = tracerouteParse(response)
+		for _, hop := range hops[i] {
+			ips = appendUnique(ips, hop.ip)
+		}
+	}
+	asns := tracerouteLookupASNs(ips)
+	var asnList []string
+	for _, asn := range asns {
+		if len(asn) > 0 {
+			asnList = appendUnique(asnList, asn)
+		}
+	}
+	asnPrefetch(asnList)
+
+	targetID := "Target: " + target
+	graph.addNode(targetID, "target", targetID).URL = "/traceroute/" + strings.Join(servers, "+") + "/" + target
+	for i, server := range servers {
+		graph.addNode(server, "server", server).URL = "/summary/" + server + "/"
+		if len(hops[i]) == 0 {
+			// Cannot find a path starting from this server
+			graph.addEdge(server, targetID, server, target, false).Unknown = true
+			continue
+		}
+
+		previousID := server
+		previousNumber := 0
+		for _, hop := range hops[i] {
+			// The last hop may be the target itself
+			var node *bgpmapNode
+			if hop.ip == target {
+				node = graph.nodeIndex[targetID]
+			} else {
+				node = graph.addNode(hop.ip, "hop", hop.ip)
+			}
+			if node.Type == "hop" && len(node.IP) == 0 {
+				var label []string
+				if len(hop.hostname) > 0 {
+					label = append(label, hop.hostname)
+				}
+				label = append(label, hop.ip)
+				if asn := asns[hop.ip]; len(asn) > 0 {
+					node.ASN = asn
+					node.Name = asnName(asnLookupCached(asn))
+					label = append(label, strings.TrimSpace("AS"+asn+" "+node.Name))
+				}
+				node.Label = strings.Join(label, "\n")
+				node.IP = hop.ip
+				node.Hostname = hop.hostname
+				node.URL = "/whois/" + hop.ip
+			}
+			node.RTTs = appendUnique(node.RTTs, server+": "+hop.rtt)
+			node.Servers = appendUnique(node.Servers, server)
+
+			edge := graph.addEdge(previousID, node.ID, server, target, false)
+			if hidden := hop.number - previousNumber - 1; hidden > edge.HiddenHops {
+				edge.HiddenHops = hidden
+			}
+			previousID = node.ID
+			previousNumber = hop.number
+		}
+
+		// Connect to the target node, unless the target itself is the last hop
+		if previousID != targetID {
+			graph.addEdge(previousID, targetID, server, target, false)
+		}
+	}
+
+	graph.sort()
+	return graph
+}
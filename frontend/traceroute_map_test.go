@@ -0,0 +1,55 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTracerouteParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		hops     []tracerouteHop
+	}{
+		{
+			name:     "empty",
+			response: "",
+			hops:     nil,
+		},
+		{
+			name: "hostnames",
+			response: "traceroute to 172.20.0.53 (172.20.0.53), 30 hops max, 60 byte packets\n" +
+				" 1  gateway.example.dn42 (172.20.1.1)  0.512 ms\n" +
+				" 2  172.20.2.1 (172.20.2.1)  12.3 ms\n" +
+				" 3  *\n" +
+				" 4  ns1.dn42 (172.20.0.53)  25 ms\n",
+			hops: []tracerouteHop{
+				{1, "172.20.1.1", "gateway.example.dn42", "0.512 ms"},
+				{2, "172.20.2.1", "", "12.3 ms"},
+				{4, "172.20.0.53", "ns1.dn42", "25 ms"},
+			},
+		},
+		{
+			name: "numeric output",
+			response: "traceroute to fd42::1 (fd42::1), 30 hops max, 80 byte packets\n" +
+				" 1  fd00::1  1.001 ms\n" +
+				"10  fd42::1  100.5ms\n",
+			hops: []tracerouteHop{
+				{1, "fd00::1", "", "1.001 ms"},
+				{10, "fd42::1", "", "100.5 ms"},
+			},
+		},
+		{
+			name:     "errors",
+			response: "traceroute not supported on this node.\nrequest failed: timeout\n",
+			hops:     nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := tracerouteParse(test.response); !reflect.DeepEqual(got, test.hops) {
+				t.Errorf("tracerouteParse() = %v, want %v", got, test.hops)
+			}
+		})
+	}
+}
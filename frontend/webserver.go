@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gorilla/handlers"
@@ -14,18 +15,31 @@ import (
 
 func webHandlerWhois(w http.ResponseWriter, r *http.Request) {
 	var target string = r.URL.Path[len("/whois/"):]
+	var compact bool = r.URL.Query().Get("view") == "compact"
+	var lang string = i18nNegotiate(r)
+
+	data := tmplWhois{
+		Target:  target,
+		Compact: compact,
+	}
+	if result, err := whois(target); err != nil {
+		data.Error = err.Error()
+	} else {
+		data.Raw = result
+		data.Result = whoisFormatter(result, compact, lang)
+	}
 
 	renderTemplate(
 		w, r,
 		" - whois "+html.EscapeString(target),
-		"<h2>whois "+html.EscapeString(target)+"</h2>"+smartFormatter(whois(target)),
+		renderPageContent(lang, "whois", data),
 	)
 }
 
 func webHandlerPeering(w http.ResponseWriter, r *http.Request) {
 	var (
 		server string = r.URL.Path[len("/new_peer/"):]
-		body   string
+		data          = tmplPeering{Server: server}
 		msg    struct {
 			Error string
 			Files map[string]string
@@ -40,35 +54,36 @@ func webHandlerPeering(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	if err != nil {
-		body = `<pre>` + html.EscapeString(err.Error()) + `</pre>`
+		data.Error = err.Error()
 	} else if msg.Files != nil {
-		body = "<p>Congratulations, WireGuard tunnel and BGP sessions have been setup on my server instantly. Just in case you're new to DN42, below are some example configuration files that you could use to setup your own node. Happy hacking!</p>"
-		for path, content := range msg.Files {
-			body += `<h5>` + html.EscapeString(path) + `</h5>`
-			body += `<pre>` + html.EscapeString(content) + `</pre>`
-		}
+		data.Files = msg.Files
 	} else {
-		body = `<script> var info = ` + string(ret) + `; </script>` + peeringForm
+		data.Info = string(ret)
 	}
 	renderTemplate(
 		w, r,
 		" - peering with "+html.EscapeString(server),
-		`<h2>`+html.EscapeString(server)+`: peering request</h2>`+body,
+		renderPageContent(i18nNegotiate(r), "peering", data),
 	)
 }
 
+// Commands sent to the proxies for each option, %s is replaced by user input
+var backendCommandPrimitives = map[string]string{
+	"summary":         "show protocols",
+	"detail":          "show protocols all %s",
+	"route":           "show route for %s",
+	"route_all":       "show route for %s all",
+	"route_where":     "show route where net ~ [ %s ]",
+	"route_where_all": "show route where net ~ [ %s ] all",
+	"route_generic":   "show route %s",
+	"route_export":    "show route export %s",
+	"route_import":    "show route protocol %s",
+	"generic":         "show %s",
+	"traceroute":      "%s",
+}
+
 func webBackendCommunicator(endpoint string, command string) func(w http.ResponseWriter, r *http.Request) {
-	backendCommandPrimitive, commandPresent := (map[string]string{
-		"summary":         "show protocols",
-		"detail":          "show protocols all %s",
-		"route":           "show route for %s",
-		"route_all":       "show route for %s all",
-		"route_where":     "show route where net ~ [ %s ]",
-		"route_where_all": "show route where net ~ [ %s ] all",
-		"route_generic":   "show route %s",
-		"generic":         "show %s",
-		"traceroute":      "%s",
-	})[command]
+	backendCommandPrimitive, commandPresent := backendCommandPrimitives[command]
 
 	if !commandPresent {
 		panic("invalid command: " + command)
@@ -90,15 +105,65 @@ func webBackendCommunicator(endpoint string, command string) func(w http.Respons
 		backendCommand = strings.TrimSpace(backendCommand)
 
 		var servers []string = strings.Split(split[1], "+")
-		var responses []string = batchRequest(servers, endpoint, backendCommand)
+		var lang string = i18nNegotiate(r)
+		var responses []string
+		var pages routePages
+		if paginatedCommands[command] {
+			pages = paginatedPage(servers, endpoint, backendCommand, lang, paginatedPageParam(r))
+			responses = pages.Responses
+		} else {
+			responses = batchRequest(servers, endpoint, backendCommand, lang)
+		}
+		if endpoint == "bird" {
+			asnPrefetchBackground(asnExtract(responses))
+		}
 		var result string
-		for i, response := range responses {
-			result += "<h2>" + html.EscapeString(servers[i]) + ": " + html.EscapeString(backendCommand) + "</h2>"
-			if (endpoint == "bird") && backendCommand == "show protocols" && len(response) > 4 && strings.ToLower(response[0:4]) == "name" {
-				result += summaryTable(response, servers[i])
-			} else {
-				result += smartFormatter(response)
+		if command == "summary" {
+			operator, _ := operatorAuthenticate(r)
+			data := tmplSummary{Command: backendCommand, History: historyEnabled(), Operator: len(operator) > 0}
+			for i, response := range responses {
+				if len(response) > 4 && strings.ToLower(response[0:4]) == "name" {
+					summary := summaryTable(response, servers[i])
+					if data.History {
+						now := time.Now()
+						for j, row := range summary.Rows {
+							summary.Rows[j].Flaps = historyFlaps(historyGet(servers[i], row.Name), 24*time.Hour, now)
+						}
+					}
+					data.Servers = append(data.Servers, summary)
+				} else {
+					data.Servers = append(data.Servers, tmplSummaryServer{
+						Server: servers[i],
+						Raw:    response,
+						Result: smartFormatter(response),
+					})
+				}
+			}
+			result = renderPageContent(lang, "summary", data)
+		} else {
+			data := tmplBird{Endpoint: endpoint, Command: backendCommand}
+			if command == "detail" && operatorValidProtocol(urlCommands) {
+				operator, _ := operatorAuthenticate(r)
+				data.Protocol = urlCommands
+				data.Operator = len(operator) > 0
 			}
+			if paginatedCommands[command] {
+				data.Page = pages.Page
+				data.Pages = pages.Pages
+				data.Truncated = pages.Truncated
+			}
+			for i, response := range responses {
+				server := tmplBirdServer{
+					Server: servers[i],
+					Raw:    response,
+				}
+				if paginatedCommands[command] {
+					server.Count = i18nTranslate(lang, "%d networks", pages.Networks[i])
+				}
+				server.Result = smartFormatter(response)
+				data.Servers = append(data.Servers, server)
+			}
+			result = renderPageContent(lang, map[bool]string{true: "detail", false: "route"}[command == "detail"], data)
 		}
 
 		renderTemplate(
@@ -109,6 +174,9 @@ func webBackendCommunicator(endpoint string, command string) func(w http.Respons
 	}
 }
 
+// Most prefixes compared in one bgpmap, each is queried on every server
+const bgpmapMaxTargets = 10
+
 func webHandlerBGPMap(endpoint string, command string) func(w http.ResponseWriter, r *http.Request) {
 	backendCommandPrimitive, commandPresent := (map[string]string{
 		"route_bgpmap":       "show route for %s all",
@@ -130,33 +198,155 @@ func webHandlerBGPMap(endpoint string, command string) func(w http.ResponseWrite
 			backendCommand = backendCommandPrimitive
 		}
 
+		// Several prefixes can be compared, separated by comma
+		var targets []string
+		if command == "route_bgpmap" {
+			for _, target := range strings.Split(urlCommands, ",") {
+				if target = strings.TrimSpace(target); len(target) > 0 {
+					targets = append(targets, target)
+				}
+			}
+		} else {
+			targets = []string{urlCommands}
+		}
+		if len(targets) > bgpmapMaxTargets {
+			w.WriteHeader(http.StatusBadRequest)
+			renderTemplate(w, r, " - bgpmap", "<pre>"+html.EscapeString(i18nTranslate(i18nNegotiate(r), "At most %d prefixes can be compared.", bgpmapMaxTargets))+"</pre>")
+			return
+		}
+
 		var servers []string = strings.Split(split[1], "+")
-		var responses []string = batchRequest(servers, endpoint, backendCommand)
-		renderTemplate(
-			w, r,
-			" - "+html.EscapeString(endpoint+" "+backendCommand),
-			`
-			<script src="https://cdn.jsdelivr.net/npm/viz.js@2.1.2/viz.min.js" crossorigin="anonymous"></script>
-			<script src="https://cdn.jsdelivr.net/npm/viz.js@2.1.2/lite.render.js" crossorigin="anonymous"></script>
-			<script>
-			var viz = new Viz();
-			viz.renderSVGElement(`+"`"+birdRouteToGraphviz(servers, responses, urlCommands)+"`"+`)
-			.then(element => {
-				document.body.appendChild(element);
+		var responses [][]string = make([][]string, len(targets))
+		var wg sync.WaitGroup
+		for i, target := range targets {
+			wg.Add(1)
+			go func(i int, target string) {
+				responses[i] = batchRequest(servers, endpoint, fmt.Sprintf(backendCommandPrimitive, target), i18nNegotiate(r))
+				wg.Done()
+			}(i, target)
+		}
+		wg.Wait()
+		graph := birdRouteToGraph(servers, responses, targets, strings.TrimSuffix(command, "_bgpmap")+"_all")
+
+		renderGraph(w, r, " - "+html.EscapeString(endpoint+" "+backendCommand), "bgpmap-"+urlCommands, graph)
+	}
+}
+
+func webHandlerTracerouteMap(w http.ResponseWriter, r *http.Request) {
+	split := strings.SplitN(r.URL.Path[1:], "/", 3)
+	var target string
+	if len(split) >= 3 {
+		target = strings.TrimSpace(split[2])
+	}
+
+	var servers []string = strings.Split(split[1], "+")
+	var responses []string = batchRequest(servers, "traceroute", target, i18nNegotiate(r))
+	graph := tracerouteToGraph(servers, responses, target)
+
+	renderGraph(w, r, " - "+html.EscapeString("traceroute "+target), "traceroute-"+target, graph)
+}
+
+// Periods to show uptime for on the history page
+var historyUptimePeriods = []struct {
+	name   string
+	period time.Duration
+}{
+	{"24h", 24 * time.Hour},
+	{"7d", 7 * 24 * time.Hour},
+	{"30d", 30 * 24 * time.Hour},
+}
+
+func webHandlerHistory(w http.ResponseWriter, r *http.Request) {
+	split := strings.SplitN(r.URL.Path[1:], "/", 3)
+	var protocol string
+	if len(split) >= 3 {
+		protocol = strings.TrimSpace(split[2])
+	}
+
+	data := tmplHistory{
+		Protocol: protocol,
+		Enabled:  historyEnabled(),
+	}
+	now := time.Now()
+	for _, server := range strings.Split(split[1], "+") {
+		if !data.Enabled || !isValidServer(server) {
+			continue
+		}
+		events := historyGet(server, protocol)
+		result := tmplHistoryServer{
+			Server: server,
+			Flaps:  historyFlaps(events, 24*time.Hour, now),
+		}
+		for _, period := range historyUptimePeriods {
+			uptime := tmplHistoryUptime{Period: period.name, Uptime: "-"}
+			if fraction, ok := historyUptime(events, period.period, now); ok {
+				uptime.Uptime = fmt.Sprintf("%.2f%%", fraction*100)
+			}
+			result.Uptimes = append(result.Uptimes, uptime)
+		}
+		for _, segment := range historyTimeline(events, 24*time.Hour, now) {
+			result.Timeline = append(result.Timeline, tmplHistorySegment{
+				State: segment.State,
+				Width: fmt.Sprintf("%.3f", segment.Fraction*100),
+				Title: segment.From.Format("01-02 15:04") + " - " + segment.To.Format("01-02 15:04"),
 			})
-			.catch(error => {
-				document.body.innerHTML = "<pre>"+error+"</pre>"
-			});
-			</script>`,
-		)
+		}
+		for i := len(events) - 1; i >= 0; i-- {
+			result.Events = append(result.Events, events[i])
+		}
+		data.Servers = append(data.Servers, result)
+	}
+
+	renderTemplate(
+		w, r,
+		" - history "+html.EscapeString(protocol),
+		renderPageContent(i18nNegotiate(r), "history", data),
+	)
+}
+
+func webHandlerPrefixHistory(w http.ResponseWriter, r *http.Request) {
+	split := strings.SplitN(r.URL.Path[1:], "/", 3)
+	var target string
+	if len(split) >= 3 {
+		target = strings.TrimSpace(split[2])
+	}
+
+	data := tmplPrefixHistory{
+		Prefix:     target,
+		Prefixes:   prefixWatchList,
+		ServersURL: split[1],
+	}
+	if entry, err := parsePrefixWatchEntry(target); err == nil {
+		var watchedEntry prefixWatchEntry
+		if watchedEntry, data.Watched = prefixWatchFind(entry.Prefix); data.Watched {
+			data.Prefix = watchedEntry.Prefix
+			data.ExpectedOrigin = watchedEntry.ExpectedOrigin
+		}
+	}
+	for _, server := range strings.Split(split[1], "+") {
+		if !data.Watched || !isValidServer(server) {
+			continue
+		}
+		events := prefixWatchGet(server, data.Prefix)
+		result := tmplPrefixHistoryServer{Server: server}
+		for i := len(events) - 1; i >= 0; i-- {
+			result.Events = append(result.Events, events[i])
+		}
+		data.Servers = append(data.Servers, result)
 	}
+
+	renderTemplate(
+		w, r,
+		" - prefix history "+html.EscapeString(data.Prefix),
+		renderPageContent(i18nNegotiate(r), "prefix_history", data),
+	)
 }
 
 func webHandlerNavbarFormRedirect(w http.ResponseWriter, r *http.Request) {
 	query := r.URL.Query()
 	if query.Get("action") == "whois" {
 		http.Redirect(w, r, "/"+query.Get("action")+"/"+query.Get("target"), 302)
-	} else if query.Get("action") == "summary" {
+	} else if query.Get("action") == "summary" || query.Get("action") == "stats" {
 		http.Redirect(w, r, "/"+query.Get("action")+"/"+query.Get("server")+"/", 302)
 	} else {
 		http.Redirect(w, r, "/"+query.Get("action")+"/"+query.Get("server")+"/"+query.Get("target"), 302)
@@ -186,14 +376,39 @@ func webServerStart() {
 	http.HandleFunc("/route_where_all/", webBackendCommunicator("bird", "route_where_all"))
 	http.HandleFunc("/route_where_bgpmap/", webHandlerBGPMap("bird", "route_where_bgpmap"))
 	http.HandleFunc("/route_generic/", webBackendCommunicator("bird", "route_generic"))
+	http.HandleFunc("/route_origin/", webHandlerRouteSearch("route_origin"))
+	http.HandleFunc("/route_aspath/", webHandlerRouteSearch("route_aspath"))
+	http.HandleFunc("/route_export/", webBackendCommunicator("bird", "route_export"))
+	http.HandleFunc("/route_import/", webBackendCommunicator("bird", "route_import"))
 	http.HandleFunc("/generic/", webBackendCommunicator("bird", "generic"))
 	http.HandleFunc("/traceroute/", webBackendCommunicator("traceroute", "traceroute"))
+	http.HandleFunc("/traceroute_map/", webHandlerTracerouteMap)
+	http.HandleFunc("/history/", webHandlerHistory)
+	http.HandleFunc("/prefix_history/", webHandlerPrefixHistory)
+	http.HandleFunc("/stats/", webHandlerStats)
+	if peerPortalEnabled() {
+		http.HandleFunc("/peer/", webHandlerPeer)
+		http.HandleFunc("/peer_login/", webHandlerPeerLogin)
+		http.HandleFunc("/peer_logout", webHandlerPeerLogout)
+	}
 	http.HandleFunc("/whois/", webHandlerWhois)
 	http.HandleFunc("/new_peer/", webHandlerPeering)
 	http.HandleFunc("/redir", webHandlerNavbarFormRedirect)
-	http.HandleFunc("/telegram/", webHandlerTelegramBot)
+	if setting.telegramMode == "webhook" {
+		http.HandleFunc("/telegram/", webHandlerTelegramBot)
+	}
+	if discordEnabled() {
+		http.HandleFunc("/discord/", webHandlerDiscordBot)
+	}
+	if operatorEnabled() {
+		http.HandleFunc("/operator/login", webHandlerOperatorLogin)
+		http.HandleFunc("/operator/logout", webHandlerOperatorLogout)
+		http.HandleFunc("/operator/", webHandlerOperator)
+	}
+	http.HandleFunc("/api/", webHandlerAPI)
+	http.HandleFunc("/static/", webHandlerStatic)
 	http.HandleFunc("/robots.txt", webHandlerRobotsTxt)
 	http.HandleFunc("/favicon.ico", webHandler404)
 	http.DefaultClient.Timeout = time.Duration(setting.timeout) * time.Millisecond
-	http.ListenAndServe(setting.listen, handlers.LoggingHandler(os.Stdout, http.DefaultServeMux))
+	http.ListenAndServe(setting.listen, handlers.LoggingHandler(os.Stdout, i18nHandler(http.DefaultServeMux)))
 }
@@ -1,22 +1,285 @@
 package main
 
 import (
+	"container/list"
+	"context"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 )
 
-// Send a whois request
-func whois(s string) string {
-	conn, err := net.Dial("tcp", setting.whoisServer+":43")
+// Attributes that link to other objects in whois results
+var whoisReferenceKeys = map[string]bool{
+	"admin-c":    true,
+	"tech-c":     true,
+	"zone-c":     true,
+	"mnt-by":     true,
+	"mnt-lower":  true,
+	"mnt-routes": true,
+	"member-of":  true,
+	"origin":     true,
+	"route":      true,
+	"route6":     true,
+	"nserver":    true,
+}
+
+const (
+	whoisIANAServer   = "whois.iana.org"
+	whoisMaxReferrals = 3
+	whoisMaxLength    = 1 << 20
+	// Queries are chosen by users, so only the most recent ones are kept
+	whoisCacheSize = 256
+)
+
+type whoisCacheEntry struct {
+	query   string
+	result  string
+	expires time.Time
+}
+
+var (
+	whoisCacheMutex   sync.Mutex
+	whoisCacheEntries = make(map[string]*list.Element)
+	whoisCacheOrder   = list.New()
+)
+
+// Cached result of a query, if it hasn't expired
+func whoisCacheGet(query string) (string, bool) {
+	whoisCacheMutex.Lock()
+	defer whoisCacheMutex.Unlock()
+	element, ok := whoisCacheEntries[query]
+	if !ok {
+		return "", false
+	}
+	entry := element.Value.(*whoisCacheEntry)
+	if time.Now().After(entry.expires) {
+		whoisCacheOrder.Remove(element)
+		delete(whoisCacheEntries, query)
+		return "", false
+	}
+	whoisCacheOrder.MoveToFront(element)
+	return entry.result, true
+}
+
+// Cache the result of a query, removing the least recently used ones
+// beyond whoisCacheSize
+func whoisCacheSet(query string, result string) {
+	entry := &whoisCacheEntry{
+		query:   query,
+		result:  result,
+		expires: time.Now().Add(time.Duration(setting.whoisCacheTTL) * time.Second),
+	}
+	whoisCacheMutex.Lock()
+	defer whoisCacheMutex.Unlock()
+	if element, ok := whoisCacheEntries[query]; ok {
+		whoisCacheOrder.Remove(element)
+	}
+	whoisCacheEntries[query] = whoisCacheOrder.PushFront(entry)
+	for whoisCacheOrder.Len() > whoisCacheSize {
+		oldest := whoisCacheOrder.Back()
+		whoisCacheOrder.Remove(oldest)
+		delete(whoisCacheEntries, oldest.Value.(*whoisCacheEntry).query)
+	}
+}
+
+// Remove characters that would end the query early, or start another query
+func whoisSanitize(s string) string {
+	return strings.TrimSpace(strings.NewReplacer("\r", "", "\n", "").Replace(s))
+}
+
+// Choose the first server to ask for a target
+func whoisSelectServer(target string) string {
+	if setting.netSpecificMode == "dn42" && dn42IsTarget(target) {
+		return setting.dn42WhoisServer
+	}
+	isIP := net.ParseIP(target) != nil
+	if _, _, err := net.ParseCIDR(target); err == nil {
+		isIP = true
+	}
+	if _, err := parseROAASN(target); err == nil || isIP {
+		return whoisIANAServer
+	}
+	if setting.netSpecificMode == "dn42" && !strings.Contains(target, ".") {
+		// Handles like FOO-MNT or FOO-DN42
+		return setting.dn42WhoisServer
+	}
+	return setting.whoisServer
+}
+
+// Host names of whois servers, without a port
+var whoisHostnameRegex = regexp.MustCompile(`^(?i:[a-z0-9]([a-z0-9-]*[a-z0-9])?)(\.(?i:[a-z0-9]([a-z0-9-]*[a-z0-9])?))*\.?$`)
+
+// Address ranges whois referrals may not point to, so that a whois server
+// can't make the frontend connect to its own network
+var whoisForbiddenNetworks = parseCIDRs(
+	"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8",
+	"169.254.0.0/16", "172.16.0.0/12", "192.168.0.0/16", "224.0.0.0/4",
+	"240.0.0.0/4", "::/128", "::1/128", "fc00::/7", "fe80::/10", "ff00::/8",
+)
+
+func parseCIDRs(cidrs ...string) []*net.IPNet {
+	var result []*net.IPNet
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		result = append(result, network)
+	}
+	return result
+}
+
+func whoisForbiddenIP(ip net.IP) bool {
+	if ipv4 := ip.To4(); ipv4 != nil {
+		ip = ipv4
+	}
+	for _, network := range whoisForbiddenNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Refuse connections to forbidden addresses, checked on the address
+// actually connected to, after name resolution
+func whoisDialControl(network string, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || whoisForbiddenIP(ip) {
+		return fmt.Errorf("referral to forbidden address %s", host)
+	}
+	return nil
+}
+
+// Find the server a whois response refers to, if any. Only host names are
+// accepted, referrals are always queried on port 43.
+func whoisFindReferral(result string) string {
+	for _, line := range strings.Split(result, "\n") {
+		index := strings.IndexByte(line, ':')
+		if index <= 0 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:index]))
+		if key != "refer" && key != "whois" && key != "referralserver" {
+			continue
+		}
+		server := whoisSanitize(line[index+1:])
+		if strings.HasPrefix(server, "rwhois://") {
+			continue
+		}
+		server = strings.TrimSuffix(strings.TrimPrefix(server, "whois://"), ":43")
+		if whoisHostnameRegex.MatchString(server) && net.ParseIP(strings.TrimSuffix(server, ".")) == nil {
+			return server
+		}
+	}
+	return ""
+}
+
+// Send a single whois query to a server before the deadline. Servers from
+// referrals can't be on private or loopback addresses.
+func whoisQueryServer(server string, query string, referral bool, deadline time.Time) (string, error) {
+	if referral {
+		server = net.JoinHostPort(server, "43")
+	} else if !strings.Contains(server, ":") || strings.HasSuffix(server, "]") {
+		server = net.JoinHostPort(strings.Trim(server, "[]"), "43")
+	}
+	dialer := net.Dialer{Deadline: deadline}
+	if referral {
+		dialer.Control = whoisDialControl
+	}
+	conn, err := dialer.DialContext(context.Background(), "tcp", server)
 	if err != nil {
-		return err.Error()
+		return "", err
 	}
 	defer conn.Close()
 
-	conn.Write([]byte(s + "\r\n"))
-	result, err := ioutil.ReadAll(conn)
+	conn.SetDeadline(deadline)
+	if _, err = conn.Write([]byte(query + "\r\n")); err != nil {
+		return "", err
+	}
+	result, err := ioutil.ReadAll(io.LimitReader(conn, whoisMaxLength))
 	if err != nil {
-		return err.Error()
+		return "", err
+	}
+	return string(result), nil
+}
+
+// Send a whois request, to the local registry if possible, or to the
+// whois servers following their referrals
+func whois(s string) (string, error) {
+	s = whoisSanitize(s)
+
+	if registryEnabled() {
+		if result := registryWhois(s); len(result) > 0 {
+			return result, nil
+		}
+	}
+
+	if result, cached := whoisCacheGet(strings.ToLower(s)); cached {
+		return result, nil
+	}
+
+	// The timeout applies to the whole chain of referrals
+	deadline := time.Now().Add(time.Duration(setting.timeout) * time.Millisecond)
+	server := whoisSelectServer(s)
+	visited := make(map[string]bool)
+	var result string
+	for depth := 0; depth <= whoisMaxReferrals; depth++ {
+		response, err := whoisQueryServer(server, s, depth > 0, deadline)
+		if err != nil {
+			if len(result) > 0 {
+				// Referral failed, show the last result instead
+				break
+			}
+			return "", fmt.Errorf("%s: %v", server, err)
+		}
+		result = "% Result from " + server + "\n\n" + response
+		visited[strings.ToLower(server)] = true
+
+		server = whoisFindReferral(response)
+		if len(server) == 0 || visited[strings.ToLower(server)] {
+			break
+		}
+	}
+
+	if setting.whoisCacheTTL > 0 {
+		whoisCacheSet(strings.ToLower(s), result)
+	}
+	return result, nil
+}
+
+// Remove attributes hidden in compact view from a whois object, and
+// continuation lines of the others, returns the object and number of lines
+// removed
+func whoisFilterObject(object rpslObject) (rpslObject, int) {
+	var skippedLines int
+	filtered := rpslObject{Type: object.Type, Name: object.Name}
+	for _, attr := range object.Attributes {
+		shouldSkip := false
+		for _, key := range setting.whoisFilter {
+			if attr.Key == key {
+				shouldSkip = true
+				break
+			}
+		}
+		if shouldSkip {
+			skippedLines += strings.Count(attr.Value, "\n") + 1
+			continue
+		}
+		if index := strings.IndexByte(attr.Value, '\n'); index >= 0 {
+			skippedLines += strings.Count(attr.Value, "\n")
+			attr.Value = attr.Value[:index]
+		}
+		filtered.Attributes = append(filtered.Attributes, attr)
 	}
-	return string(result)
+	return filtered, skippedLines
 }
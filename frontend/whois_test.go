@@ -0,0 +1,129 @@
+package main
+
+import (
+	"container/list"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWhoisFindReferral(t *testing.T) {
+	tests := []struct {
+		name   string
+		result string
+		want   string
+	}{
+		{"refer", "% IANA WHOIS server\nrefer:        whois.arin.net\n", "whois.arin.net"},
+		{"whois", "domain: DN42\nwhois:  whois.dn42\n", "whois.dn42"},
+		{"referral server with scheme", "ReferralServer: whois://whois.ripe.net\n", "whois.ripe.net"},
+		{"port 43", "ReferralServer: whois://whois.ripe.net:43\n", "whois.ripe.net"},
+		{"rwhois skipped", "ReferralServer: rwhois://rwhois.example.net:4321\nrefer: whois.example.net\n", "whois.example.net"},
+		{"other port", "refer: whois.example.net:8080\n", ""},
+		{"internal port", "refer: 127.0.0.1:6379\n", ""},
+		{"IPv4 literal", "refer: 10.0.0.1\n", ""},
+		{"IPv6 literal", "refer: [::1]:43\n", ""},
+		{"path", "refer: example.net/whois\n", ""},
+		{"space", "refer: whois.example.net extra\n", ""},
+		{"CRLF", "refer: whois.afrinic.net\r\n", "whois.afrinic.net"},
+		{"none", "inetnum: 192.0.2.0 - 192.0.2.255\n", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := whoisFindReferral(test.result); got != test.want {
+				t.Errorf("whoisFindReferral() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestWhoisForbiddenIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"127.0.0.1", true},
+		{"10.1.2.3", true},
+		{"172.20.0.1", true},
+		{"192.168.1.1", true},
+		{"169.254.169.254", true},
+		{"100.64.0.1", true},
+		{"0.0.0.0", true},
+		{"::1", true},
+		{"::", true},
+		{"fd42::1", true},
+		{"fe80::1", true},
+		{"::ffff:127.0.0.1", true},
+		{"192.0.43.8", false},
+		{"2001:500:88:200::8", false},
+	}
+	for _, test := range tests {
+		if got := whoisForbiddenIP(net.ParseIP(test.ip)); got != test.want {
+			t.Errorf("whoisForbiddenIP(%s) = %v, want %v", test.ip, got, test.want)
+		}
+	}
+}
+
+func TestWhoisQueryServerReferralRefused(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte("inetnum: 192.0.2.0 - 192.0.2.255\n"))
+			conn.Close()
+		}
+	}()
+	deadline := time.Now().Add(time.Second)
+
+	// Configured servers may be local, with any port
+	result, err := whoisQueryServer(listener.Addr().String(), "192.0.2.1", false, deadline)
+	if err != nil || !strings.HasPrefix(result, "inetnum:") {
+		t.Errorf("configured server: %q, %v", result, err)
+	}
+	// Referrals may not resolve to loopback addresses
+	if _, err := whoisQueryServer("localhost", "192.0.2.1", true, deadline); err == nil || !strings.Contains(err.Error(), "forbidden") {
+		t.Errorf("referral to localhost: %v, want forbidden address", err)
+	}
+}
+
+func TestWhoisCacheEviction(t *testing.T) {
+	savedTTL := setting.whoisCacheTTL
+	defer func() {
+		setting.whoisCacheTTL = savedTTL
+		whoisCacheEntries = make(map[string]*list.Element)
+		whoisCacheOrder = list.New()
+	}()
+	setting.whoisCacheTTL = 3600
+
+	whoisCacheSet("first", "result")
+	for i := 0; i < whoisCacheSize; i++ {
+		// Using the first query keeps it in the cache
+		if _, cached := whoisCacheGet("first"); !cached {
+			t.Fatalf("first query evicted after %d others", i)
+		}
+		whoisCacheSet(fmt.Sprintf("query%d", i), "result")
+	}
+	if whoisCacheOrder.Len() != whoisCacheSize || len(whoisCacheEntries) != whoisCacheSize {
+		t.Errorf("%d cached queries, want %d", len(whoisCacheEntries), whoisCacheSize)
+	}
+	if _, cached := whoisCacheGet("query0"); cached {
+		t.Error("least recently used query not evicted")
+	}
+	if result, cached := whoisCacheGet("first"); !cached || result != "result" {
+		t.Errorf("first query %q, %v", result, cached)
+	}
+
+	setting.whoisCacheTTL = -1
+	whoisCacheSet("expired", "result")
+	if _, cached := whoisCacheGet("expired"); cached {
+		t.Error("expired query returned")
+	}
+}
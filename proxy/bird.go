@@ -1,9 +1,11 @@
 package main
 
 import (
+	"bytes"
 	"io"
 	"net"
 	"net/http"
+	"strconv"
 )
 
 // Read a line from bird socket, removing preceding status number, output it.
@@ -50,9 +52,92 @@ func birdWriteln(bird io.Writer, s string) {
 	bird.Write([]byte(s + "\n"))
 }
 
-// Handles BIRDv4 queries
+// Writer passing whole lines on until a size limit, then dropping the rest
+type birdLimitWriter struct {
+	w         io.Writer
+	remaining int
+	truncated bool
+}
+
+func (l *birdLimitWriter) Write(p []byte) (int, error) {
+	if l.truncated || len(p) > l.remaining {
+		l.truncated = true
+		return len(p), nil
+	}
+	l.remaining -= len(p)
+	return l.w.Write(p)
+}
+
+// Writer passing on a page of the networks in "show route" output, with
+// the "Table" line before the first network of each table on the page,
+// and counting all networks. Lines before the first network are always
+// passed on.
+type birdPageWriter struct {
+	w        io.Writer
+	offset   int
+	limit    int
+	networks int
+
+	line       []byte
+	table      []byte
+	tableShown bool
+	included   bool
+}
+
+func (p *birdPageWriter) Write(data []byte) (int, error) {
+	p.line = append(p.line, data...)
+	for {
+		end := bytes.IndexByte(p.line, '\n')
+		if end < 0 {
+			return len(data), nil
+		}
+		if err := p.writeLine(p.line[:end+1]); err != nil {
+			return len(data), err
+		}
+		p.line = p.line[end+1:]
+	}
+}
+
+func (p *birdPageWriter) writeLine(line []byte) error {
+	switch {
+	case bytes.HasPrefix(line, []byte("Table ")):
+		p.table = append(p.table[:0], line...)
+		p.tableShown = false
+		return nil
+	case len(line) > 1 && line[0] != ' ' && line[0] != '\t':
+		// A new network, routes and attributes are indented
+		p.networks++
+		p.included = p.networks > p.offset && p.networks <= p.offset+p.limit
+		if p.included && !p.tableShown && len(p.table) > 0 {
+			if _, err := p.w.Write(p.table); err != nil {
+				return err
+			}
+			p.tableShown = true
+		}
+	case p.networks == 0:
+		p.included = true
+	}
+	if !p.included {
+		return nil
+	}
+	_, err := p.w.Write(line)
+	return err
+}
+
+// Handles BIRDv4 queries. With offset and limit, only that page of the
+// networks in the output is returned, followed by "... <n> networks" with
+// the number of all networks.
 func birdHandler(httpW http.ResponseWriter, httpR *http.Request) {
 	query := string(httpR.URL.Query().Get("q"))
+	var page *birdPageWriter
+	if httpR.URL.Query().Get("limit") != "" {
+		offset, offsetErr := strconv.Atoi(httpR.URL.Query().Get("offset"))
+		limit, limitErr := strconv.Atoi(httpR.URL.Query().Get("limit"))
+		if offsetErr != nil || limitErr != nil || offset < 0 || limit < 1 {
+			query = ""
+		}
+		page = &birdPageWriter{offset: offset, limit: limit}
+	}
 	if query == "" {
 		invalidHandler(httpW, httpR)
 	} else {
@@ -67,7 +152,25 @@ func birdHandler(httpW http.ResponseWriter, httpR *http.Request) {
 		birdWriteln(bird, "restrict")
 		birdReadln(bird, nil)
 		birdWriteln(bird, query)
-		for birdReadln(bird, httpW) {
+		var output io.Writer = httpW
+		var limited *birdLimitWriter
+		if setting.birdMaxSize > 0 {
+			limited = &birdLimitWriter{w: httpW, remaining: setting.birdMaxSize}
+			output = limited
+		}
+		if page != nil {
+			page.w = output
+			output = page
+		}
+		// Stop reading once the limit is reached, e.g. for exports of full
+		// tables, unless networks of a page are still counted
+		for birdReadln(bird, output) && (limited == nil || !limited.truncated || page != nil) {
+		}
+		if limited != nil && limited.truncated {
+			httpW.Write([]byte("... output truncated at " + strconv.Itoa(setting.birdMaxSize) + " bytes\n"))
+		}
+		if page != nil {
+			httpW.Write([]byte("... " + strconv.Itoa(page.networks) + " networks\n"))
 		}
 	}
 
@@ -5,6 +5,7 @@ import (
 	"flag"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/gorilla/handlers"
@@ -21,6 +22,15 @@ func invalidHandler(httpW http.ResponseWriter, httpR *http.Request) {
 	httpW.Write([]byte("Invalid Request\n"))
 }
 
+// IP address of the client, without port and brackets around IPv6 addresses
+func requestIP(httpR *http.Request) string {
+	IPPort := httpR.RemoteAddr
+	requestIp := IPPort[0:strings.LastIndex(IPPort, ":")]
+	requestIp = strings.Replace(requestIp, "[", "", -1)
+	requestIp = strings.Replace(requestIp, "]", "", -1)
+	return requestIp
+}
+
 // Access handler, check to see if client IP in allowed IPs, continue if it is, send to invalidHandler if not
 func accessHandler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(httpW http.ResponseWriter, httpR *http.Request) {
@@ -31,12 +41,7 @@ func accessHandler(next http.Handler) http.Handler {
 			return
 		}
 
-		IPPort := httpR.RemoteAddr
-
-		// Remove port from IP and remove brackets that are around IPv6 addresses
-		requestIp := IPPort[0:strings.LastIndex(IPPort, ":")]
-		requestIp = strings.Replace(requestIp, "[", "", -1)
-		requestIp = strings.Replace(requestIp, "]", "", -1)
+		requestIp := requestIP(httpR)
 
 		for _, allowedIP := range setting.allowedIPs {
 			if requestIp == allowedIP {
@@ -56,6 +61,13 @@ type settingType struct {
 	allowedIPs  []string
 	peeringConf string
 	templates   string
+	// Secret shared with the frontend to sign write commands, the name
+	// of this server in the signed commands, and IPs allowed to send them
+	operatorSecret     string
+	operatorServer     string
+	operatorAllowedIPs []string
+	// Maximum size of a BIRD response in bytes, 0 for no limit
+	birdMaxSize int
 }
 
 var (
@@ -73,6 +85,10 @@ func main() {
 		[]string{""},
 		"",
 		"templates",
+		"",
+		"",
+		[]string{},
+		8 * 1024 * 1024,
 	}
 
 	if birdSocketEnv := os.Getenv("BIRD_SOCKET"); birdSocketEnv != "" {
@@ -90,6 +106,21 @@ func main() {
 	if templatesEnv := os.Getenv("BIRDLG_TEMPLATES"); templatesEnv != "" {
 		settingDefault.templates = templatesEnv
 	}
+	if operatorSecretEnv := os.Getenv("BIRDLG_OPERATOR_SECRET"); operatorSecretEnv != "" {
+		settingDefault.operatorSecret = operatorSecretEnv
+	}
+	if operatorServerEnv := os.Getenv("BIRDLG_OPERATOR_SERVER"); operatorServerEnv != "" {
+		settingDefault.operatorServer = operatorServerEnv
+	}
+	if operatorAllowedEnv := os.Getenv("BIRDLG_OPERATOR_ALLOWED_IPS"); operatorAllowedEnv != "" {
+		settingDefault.operatorAllowedIPs = strings.Split(operatorAllowedEnv, ",")
+	}
+	if birdMaxSizeEnv := os.Getenv("BIRDLG_BIRD_MAX_SIZE"); birdMaxSizeEnv != "" {
+		var err error
+		if settingDefault.birdMaxSize, err = strconv.Atoi(birdMaxSizeEnv); err != nil {
+			panic(err)
+		}
+	}
 
 	// Allow parameters to override environment variables
 	birdParam := flag.String("bird", settingDefault.birdSocket, "socket file for bird, set either in parameter or environment variable BIRD_SOCKET")
@@ -97,6 +128,10 @@ func main() {
 	AllowedIPsParam := flag.String("allowed", strings.Join(settingDefault.allowedIPs, ","), "IPs allowed to access this proxy, separated by commas. Don't set to allow all IPs.")
 	peeringParam := flag.String("peering", settingDefault.peeringConf, "peering config file, set either in parameter or environment variable BIRDLG_PEERING")
 	templatesParam := flag.String("templates", settingDefault.templates, "peering config file, set either in parameter or environment variable BIRDLG_TEMPLATES")
+	operatorSecretParam := flag.String("operator-secret", settingDefault.operatorSecret, "secret of this proxy shared only with the frontend to sign write commands of operators, set either in parameter or environment variable BIRDLG_OPERATOR_SECRET")
+	operatorServerParam := flag.String("operator-server", settingDefault.operatorServer, "name of this server in the frontend, which signs it in write commands of operators, set either in parameter or environment variable BIRDLG_OPERATOR_SERVER")
+	operatorAllowedParam := flag.String("operator-allowed", strings.Join(settingDefault.operatorAllowedIPs, ","), "IPs allowed to send write commands of operators, separated by commas, set either in parameter or environment variable BIRDLG_OPERATOR_ALLOWED_IPS")
+	birdMaxSizeParam := flag.Int("bird-max-size", settingDefault.birdMaxSize, "maximum size of a BIRD response in bytes, longer ones are truncated, 0 for no limit, set either in parameter or environment variable BIRDLG_BIRD_MAX_SIZE")
 	flag.Parse()
 
 	setting.birdSocket = *birdParam
@@ -104,6 +139,20 @@ func main() {
 	setting.allowedIPs = strings.Split(*AllowedIPsParam, ",")
 	setting.peeringConf = *peeringParam
 	setting.templates = *templatesParam
+	setting.operatorSecret = *operatorSecretParam
+	setting.operatorServer = *operatorServerParam
+	setting.birdMaxSize = *birdMaxSizeParam
+	for _, ip := range strings.Split(*operatorAllowedParam, ",") {
+		if ip = strings.TrimSpace(ip); ip != "" {
+			setting.operatorAllowedIPs = append(setting.operatorAllowedIPs, ip)
+		}
+	}
+	if setting.operatorSecret != "" && len(setting.operatorAllowedIPs) == 0 {
+		panic("operator mode needs IPs allowed to send write commands")
+	}
+	if setting.operatorSecret != "" && setting.operatorServer == "" {
+		panic("operator mode needs the name of this server")
+	}
 
 	if setting.peeringConf != "" {
 		if file, err := os.Open(setting.peeringConf); err != nil {
@@ -122,6 +171,11 @@ func main() {
 	http.HandleFunc("/bird6", birdHandler)
 	http.HandleFunc("/traceroute", tracerouteHandler)
 	http.HandleFunc("/traceroute6", tracerouteHandler)
+	http.HandleFunc("/ping", pingHandler)
+	http.HandleFunc("/mtr", mtrHandler)
 	http.HandleFunc("/peering", peeringWrapper)
+	if setting.operatorSecret != "" {
+		http.HandleFunc("/operator", operatorHandler)
+	}
 	http.ListenAndServe(*listenParam, handlers.LoggingHandler(os.Stdout, accessHandler(http.DefaultServeMux)))
 }
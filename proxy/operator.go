@@ -0,0 +1,110 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Write commands operators may run without "restrict". Anything else is
+// rejected, so the secret can't be used to reconfigure or shut down BIRD.
+var operatorCommandRegex = regexp.MustCompile(`^(disable|enable|restart|reload( in| out)?) ([A-Za-z_]\w*)$`)
+
+// Whether a write command is allowed. BIRD takes "all" as every protocol,
+// which would drop all sessions at once, so it is refused. "in" and "out"
+// are keywords, so "reload in" is not a reload of a protocol named "in".
+func operatorAllowedCommand(command string) bool {
+	match := operatorCommandRegex.FindStringSubmatch(command)
+	return match != nil && match[3] != "all" && match[3] != "in" && match[3] != "out"
+}
+
+// Maximum difference between the time a request was signed and now
+const operatorMaxClockSkew = 60 * time.Second
+
+// Signatures of recent requests, so each signed request runs only once
+var (
+	operatorSeenMutex sync.Mutex
+	operatorSeen      = make(map[string]time.Time)
+)
+
+// Sign a command of an operator to this server, in the same way as the
+// frontend. Requests signed for another server don't match.
+func operatorSignature(timestamp string, user string, command string) string {
+	mac := hmac.New(sha256.New, []byte(setting.operatorSecret))
+	mac.Write([]byte(setting.operatorServer + "\n" + timestamp + "\n" + user + "\n" + command))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Check the signature and time of a request, and that it wasn't sent before
+func operatorCheckRequest(r *http.Request, command string, now time.Time) error {
+	timestamp := r.Header.Get("X-Operator-Timestamp")
+	signedAt, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp")
+	}
+	if skew := now.Sub(time.Unix(signedAt, 0)); skew > operatorMaxClockSkew || skew < -operatorMaxClockSkew {
+		return fmt.Errorf("request expired")
+	}
+	signature := r.Header.Get("X-Operator-Signature")
+	expected := operatorSignature(timestamp, r.Header.Get("X-Operator-User"), command)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return fmt.Errorf("invalid signature")
+	}
+
+	operatorSeenMutex.Lock()
+	defer operatorSeenMutex.Unlock()
+	for seen, at := range operatorSeen {
+		if now.Sub(at) > 2*operatorMaxClockSkew {
+			delete(operatorSeen, seen)
+		}
+	}
+	if _, ok := operatorSeen[signature]; ok {
+		return fmt.Errorf("request already handled")
+	}
+	operatorSeen[signature] = now
+	return nil
+}
+
+// Handles signed write commands from the frontend's operator mode
+func operatorHandler(httpW http.ResponseWriter, httpR *http.Request) {
+	ip := requestIP(httpR)
+	allowed := false
+	for _, allowedIP := range setting.operatorAllowedIPs {
+		allowed = allowed || ip == allowedIP
+	}
+	if !allowed || httpR.Method != "POST" {
+		invalidHandler(httpW, httpR)
+		return
+	}
+
+	command := httpR.PostFormValue("q")
+	if err := operatorCheckRequest(httpR, command, time.Now()); err != nil {
+		httpW.WriteHeader(http.StatusForbidden)
+		httpW.Write([]byte(err.Error() + "\n"))
+		return
+	}
+	if !operatorAllowedCommand(command) {
+		httpW.WriteHeader(http.StatusForbidden)
+		httpW.Write([]byte("command not allowed\n"))
+		return
+	}
+	fmt.Printf("operator %s from %s: %s\n", httpR.Header.Get("X-Operator-User"), ip, command)
+
+	bird, err := net.Dial("unix", setting.birdSocket)
+	if err != nil {
+		panic(err)
+	}
+	defer bird.Close()
+
+	birdReadln(bird, nil)
+	birdWriteln(bird, command)
+	for birdReadln(bird, httpW) {
+	}
+}
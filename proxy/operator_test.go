@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+func TestOperatorAllowedCommand(t *testing.T) {
+	tests := []struct {
+		command string
+		want    bool
+	}{
+		{"disable bgp_peer", true},
+		{"enable bgp_peer", true},
+		{"restart bgp_peer", true},
+		{"reload bgp_peer", true},
+		{"reload in bgp_peer", true},
+		{"reload out bgp_peer", true},
+		{"restart _peer1", true},
+		// "all" is every protocol in BIRD
+		{"disable all", false},
+		{"restart all", false},
+		{"reload all", false},
+		{"reload in all", false},
+		// Not a reload of a protocol named "in"
+		{"reload in", false},
+		{"reload out", false},
+		{"disable", false},
+		{"disable 1peer", false},
+		{"disable bgp_peer bgp_other", false},
+		{"disable \"bgp_peer\"", false},
+		{"configure", false},
+		{"down", false},
+		{"show route", false},
+	}
+	for _, test := range tests {
+		if got := operatorAllowedCommand(test.command); got != test.want {
+			t.Errorf("operatorAllowedCommand(%q) = %v, want %v", test.command, got, test.want)
+		}
+	}
+}
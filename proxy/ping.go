@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"runtime"
+	"strings"
+)
+
+// Run the first working command of the given alternatives on the target,
+// and write its output
+func commandHandler(httpW http.ResponseWriter, httpR *http.Request, name string, cmd []string, args [][]string) {
+	query := strings.TrimSpace(httpR.URL.Query().Get("q"))
+	if query == "" || strings.HasPrefix(query, "-") || strings.ContainsAny(query, " \t\n") {
+		invalidHandler(httpW, httpR)
+		return
+	}
+	for i := range args {
+		args[i] = append(args[i], query)
+	}
+
+	if runtime.GOOS != "linux" && runtime.GOOS != "freebsd" && runtime.GOOS != "netbsd" && runtime.GOOS != "openbsd" {
+		httpW.WriteHeader(http.StatusInternalServerError)
+		httpW.Write([]byte(name + " not supported on this node.\n"))
+		return
+	}
+	result, errString := tracerouteTryExecute(cmd, args)
+	if errString != "" {
+		httpW.WriteHeader(http.StatusInternalServerError)
+		httpW.Write([]byte(errString))
+	}
+	if result != nil {
+		httpW.Write([]byte(strings.TrimSpace(string(result))))
+	}
+}
+
+func pingHandler(httpW http.ResponseWriter, httpR *http.Request) {
+	if runtime.GOOS == "linux" {
+		commandHandler(httpW, httpR, "ping",
+			[]string{"ping", "busybox"},
+			[][]string{
+				{"-c4", "-w10"},
+				{"ping", "-c4", "-w10"},
+			},
+		)
+	} else {
+		commandHandler(httpW, httpR, "ping",
+			[]string{"ping"},
+			[][]string{
+				{"-c4"},
+			},
+		)
+	}
+}
+
+func mtrHandler(httpW http.ResponseWriter, httpR *http.Request) {
+	commandHandler(httpW, httpR, "mtr",
+		[]string{"mtr"},
+		[][]string{
+			{"--report", "--report-wide", "--report-cycles=4"},
+		},
+	)
+}